@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/itsmandrew/server-go/internal/config"
+	"github.com/itsmandrew/server-go/internal/migrate"
+	"github.com/itsmandrew/server-go/internal/seed"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+const usage = `usage: chirpy [command]
+
+Without a command the server is started.
+
+commands:
+  migrate up|down|status  apply every pending migration, roll back the newest one or list them
+  promote-admin <email>   make the user with this email the first admin
+  seed [flags]            fill the database with fake users, follows and chirps (dev and test only)
+                          flags: -seed, -users, -chirps-per-user, -follows-per-user`
+
+// Maintenance commands share the config and database connection with the server
+func runCommand(ctx context.Context, conf *config.Config, s store.Store, migrator *migrate.Migrator, args []string) error {
+
+	switch args[0] {
+	case "migrate":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		return runMigrate(ctx, migrator, args[1])
+
+	case "promote-admin":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+
+		user, err := service.NewUserService(s).PromoteFirstAdmin(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		log.Printf("%s (%v) is now an admin, log in again to get an admin token", user.Email, user.ID)
+		return nil
+
+	case "seed":
+		return runSeed(ctx, conf, s, args[1:])
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, direction string) error {
+
+	switch direction {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			log.Println("Database schema is up to date")
+		}
+		for _, version := range applied {
+			log.Printf("Applied migration %d", version)
+		}
+		return nil
+
+	case "down":
+		version, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Rolled back migration %d", version)
+		return nil
+
+	case "status":
+		migrations, err := migrator.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %s\n", state, m.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate direction %q\n%s", direction, usage)
+}
+
+func runSeed(ctx context.Context, conf *config.Config, s store.Store, args []string) error {
+
+	if !config.Disposable(conf.Platform) {
+		return fmt.Errorf("seeding is only allowed on the dev and test platforms, PLATFORM is %q", conf.Platform)
+	}
+
+	opts := seed.Default
+
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.Uint64Var(&opts.Seed, "seed", opts.Seed, "random seed, the same seed gives the same data")
+	flags.IntVar(&opts.Users, "users", opts.Users, "number of users")
+	flags.IntVar(&opts.ChirpsPerUser, "chirps-per-user", opts.ChirpsPerUser, "chirps posted by each user")
+	flags.IntVar(&opts.FollowsPerUser, "follows-per-user", opts.FollowsPerUser, "users each user follows")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := service.NewSeedService(s).Seed(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Seeded %d users, %d chirps and %d follows from seed %d, every user's password is %q",
+		result.Users, result.Chirps, result.Follows, opts.Seed, service.SeedPassword)
+	return nil
+}
@@ -10,6 +10,22 @@ require (
 require github.com/joho/godotenv v1.5.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/golang-jwt/jwt/v4 v4.5.2
-	golang.org/x/crypto v0.38.0
+	golang.org/x/crypto v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.27.0
+
+require (
+	github.com/pressly/goose/v3 v3.26.0
+	golang.org/x/image v0.27.0
+)
+
+require (
+	github.com/mfridman/interpolate v0.0.2 // indirect
+	github.com/sethvargo/go-retry v0.3.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
 )
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+)
+
+// Asks for the password again, a stolen access token alone can't delete the account
+func (a *API) deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Password string `json:"password"`
+		// Instead of the password for accounts without one, from a recent login
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	type response struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	due, err := a.accounts.ScheduleDeletion(r.Context(), userID, params.Password, params.RefreshToken)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 202, the account is only removed once the grace period is over
+	respondWithJson(w, http.StatusAccepted, response{DeletionScheduledAt: due})
+}
+
+// Builds the export in memory, it's small enough and a half written ZIP is useless to the client
+func (a *API) exportHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	export, err := a.accounts.Export(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	authors, err := a.users.Summaries(r.Context(), authorIDs(export.Chirps...))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	polls, err := a.chirps.Polls(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, chirpIDs(export.Chirps...))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	files := []struct {
+		name    string
+		payload any
+	}{
+		{"profile.json", userFromDB(export.User, a.media.URLs)},
+		{"chirps.json", chirpsFromDB(export.Chirps, authors, polls, a.media.URLs)},
+		{"likes.json", likesFromDB(export.Likes)},
+		{"sessions.json", sessionsFromDB(export.Sessions)},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range files {
+		if err := writeZipJSON(zw, f.name, f.payload); err != nil {
+			respondWithError(w, r, apierror.Internal(fmt.Errorf("writing %s: %w", f.name, err)))
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		respondWithError(w, r, apierror.Internal(fmt.Errorf("closing export: %w", err)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.User.Handle))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func writeZipJSON(zw *zip.Writer, name string, payload any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(payload)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/config"
+	"github.com/itsmandrew/server-go/internal/seed"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+// Handler for my metrics endpoint, writes the Content-Type for the heaader and also writes to the body the current "Hits"
+func (a *API) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	fmt.Fprintf(w, `
+		<html>
+	<body>
+		<h1>Welcome, Chirpy Admin</h1>
+		<p>Chirpy has been visited %d times!</p>
+	</body>
+	</html>`, a.fileserverHits.Load())
+}
+
+// Only dev and test data may be wiped or filled with fake users, production answers 403
+func (a *API) requireDisposable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.Disposable(a.platform) {
+			respondWithError(w, r, apierror.Forbidden("Only allowed on the dev and test platforms"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Two step reset: without a confirmation token the tables are checked and a token is handed
+// out, sending it back with the same tables truncates them. No tables means everything,
+// the metrics included.
+func (a *API) resetHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Tables            []string `json:"tables"`
+		ConfirmationToken string   `json:"confirmation_token"`
+	}
+
+	type pending struct {
+		ConfirmationToken string    `json:"confirmation_token"`
+		Tables            []string  `json:"tables"`
+		ExpiresAt         time.Time `json:"expires_at"`
+	}
+
+	type done struct {
+		Msg    string   `json:"msg"`
+		Tables []string `json:"tables"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	actorID := principalFrom(r).UserID
+
+	if params.ConfirmationToken == "" {
+		confirmation, err := a.reset.Request(r.Context(), actorID, params.Tables)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithJson(w, http.StatusAccepted, pending{
+			ConfirmationToken: confirmation.Token,
+			Tables:            confirmation.Tables,
+			ExpiresAt:         confirmation.ExpiresAt,
+		})
+		return
+	}
+
+	tables, err := a.reset.Confirm(r.Context(), actorID, params.ConfirmationToken, params.Tables)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	msg := "Tables were reset"
+	if len(params.Tables) == 0 {
+		a.fileserverHits.Store(0)
+		msg = "Metrics and every table were reset"
+	}
+
+	log.Printf("Reset by %v: %s", actorID, strings.Join(tables, ", "))
+	respondWithJson(w, http.StatusOK, done{Msg: msg, Tables: tables})
+}
+
+// Fills the database with fake users, follows and chirps, every option has a default
+func (a *API) seedHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Seed           *uint64 `json:"seed"`
+		Users          *int    `json:"users"`
+		ChirpsPerUser  *int    `json:"chirps_per_user"`
+		FollowsPerUser *int    `json:"follows_per_user"`
+	}
+
+	type response struct {
+		Users    int    `json:"users"`
+		Chirps   int    `json:"chirps"`
+		Follows  int    `json:"follows"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	opts := seed.Default
+	if params.Seed != nil {
+		opts.Seed = *params.Seed
+	}
+	if params.Users != nil {
+		opts.Users = *params.Users
+	}
+	if params.ChirpsPerUser != nil {
+		opts.ChirpsPerUser = *params.ChirpsPerUser
+	}
+	if params.FollowsPerUser != nil {
+		opts.FollowsPerUser = *params.FollowsPerUser
+	}
+
+	result, err := a.seed.Seed(r.Context(), opts)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Seeded %d users, %d chirps and %d follows from seed %d", result.Users, result.Chirps, result.Follows, opts.Seed)
+	respondWithJson(w, http.StatusCreated, response{
+		Users:    result.Users,
+		Chirps:   result.Chirps,
+		Follows:  result.Follows,
+		Password: service.SeedPassword,
+	})
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/seed"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/store"
+	"github.com/itsmandrew/server-go/internal/stream"
+)
+
+// The handlers only see these interfaces, the concrete services live in internal/service
+
+type UserService interface {
+	Create(ctx context.Context, email, password, handle string) (database.CreateUserRow, error)
+	Update(ctx context.Context, userID uuid.UUID, update service.UserUpdate) (database.GetUserByIDNoPasswordRow, error)
+	Me(ctx context.Context, userID uuid.UUID) (database.GetUserByIDNoPasswordRow, error)
+	Profile(ctx context.Context, handle string) (database.GetUserProfileByHandleRow, error)
+	Summaries(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]database.GetUserSummariesRow, error)
+	SetRole(ctx context.Context, actorID, userID uuid.UUID, role string) (database.GetUserByIDNoPasswordRow, error)
+	UpgradeToChirpyRed(ctx context.Context, userID uuid.UUID) error
+}
+
+type ChirpService interface {
+	Create(ctx context.Context, userID uuid.UUID, body string, replyToID uuid.NullUUID, poll *service.PollInput) (database.Chirp, error)
+	List(ctx context.Context, viewerID uuid.NullUUID, filter service.ChirpFilter) ([]database.Chirp, error)
+	Get(ctx context.Context, viewerID uuid.NullUUID, chirpID uuid.UUID) (database.Chirp, error)
+	Delete(ctx context.Context, userID, chirpID uuid.UUID) error
+	Like(ctx context.Context, userID, chirpID uuid.UUID) (service.LikeState, error)
+	Unlike(ctx context.Context, userID, chirpID uuid.UUID) (service.LikeState, error)
+	Schedule(ctx context.Context, userID uuid.UUID, body string, replyToID uuid.NullUUID, publishAt time.Time) (database.ScheduledChirp, error)
+	ListScheduled(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error)
+	CancelScheduled(ctx context.Context, userID, scheduledID uuid.UUID) error
+	Polls(ctx context.Context, viewerID uuid.NullUUID, chirpIDs []uuid.UUID) (map[uuid.UUID]service.Poll, error)
+	Vote(ctx context.Context, userID, chirpID uuid.UUID, optionIDs []uuid.UUID) (service.Poll, error)
+	Bookmark(ctx context.Context, userID, chirpID uuid.UUID) error
+	Unbookmark(ctx context.Context, userID, chirpID uuid.UUID) error
+	Bookmarks(ctx context.Context, userID uuid.UUID, filter service.ChirpFilter) ([]database.Chirp, error)
+}
+
+type DraftService interface {
+	Create(ctx context.Context, userID uuid.UUID, body string) (database.Draft, error)
+	List(ctx context.Context, userID uuid.UUID) ([]database.Draft, error)
+	Get(ctx context.Context, userID, draftID uuid.UUID) (database.Draft, error)
+	Update(ctx context.Context, userID, draftID uuid.UUID, body string) (database.Draft, error)
+	Delete(ctx context.Context, userID, draftID uuid.UUID) error
+}
+
+type ListService interface {
+	Create(ctx context.Context, ownerID uuid.UUID, name string, public bool) (database.List, error)
+	Owned(ctx context.Context, ownerID uuid.UUID) ([]database.List, error)
+	Get(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID) (database.List, error)
+	Update(ctx context.Context, userID, listID uuid.UUID, name string, public bool) (database.List, error)
+	Delete(ctx context.Context, userID, listID uuid.UUID) error
+	Members(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID) ([]database.ListMember, error)
+	AddMember(ctx context.Context, userID, listID, memberID uuid.UUID) error
+	RemoveMember(ctx context.Context, userID, listID, memberID uuid.UUID) error
+	Timeline(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID, filter service.ChirpFilter) ([]database.Chirp, error)
+}
+
+type AuthService interface {
+	Login(ctx context.Context, email, password string) (service.Session, error)
+	Refresh(ctx context.Context, refreshToken string) (string, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+}
+
+type APIKeyService interface {
+	Create(ctx context.Context, userID uuid.UUID, in service.APIKeyInput) (service.CreatedAPIKey, error)
+	List(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error)
+	Revoke(ctx context.Context, userID, keyID uuid.UUID) error
+}
+
+type OAuthService interface {
+	RegisterClient(ctx context.Context, ownerID uuid.UUID, in service.OAuthClientInput) (service.RegisteredOAuthClient, error)
+	ListClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error)
+	DeleteClient(ctx context.Context, ownerID, clientID uuid.UUID) error
+	Authorize(ctx context.Context, req service.AuthorizeRequest) (service.Consent, error)
+	Approve(ctx context.Context, userID uuid.UUID, req service.AuthorizeRequest, approved bool) (string, error)
+	Token(ctx context.Context, req service.TokenRequest) (service.OAuthToken, error)
+	Revoke(ctx context.Context, creds service.ClientCredentials, token string) error
+	Introspect(ctx context.Context, creds service.ClientCredentials, token string) (service.Introspection, error)
+}
+
+type OIDCService interface {
+	Providers() []string
+	Start(ctx context.Context, provider string) (string, error)
+	Finish(ctx context.Context, provider, code, state string) (service.Session, error)
+	StartLink(ctx context.Context, userID uuid.UUID, provider string) (string, error)
+	FinishLink(ctx context.Context, userID uuid.UUID, provider, code, state string) (database.UserIdentity, error)
+	Identities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error)
+	Unlink(ctx context.Context, userID uuid.UUID, provider string) error
+}
+
+type MagicLinkService interface {
+	Send(ctx context.Context, email, ip string) error
+	Verify(ctx context.Context, token string) (service.Session, error)
+}
+
+type ModerationService interface {
+	ListRules(ctx context.Context) []moderation.Rule
+	CreateRule(ctx context.Context, rule moderation.Rule) (moderation.Rule, error)
+	DeleteRule(ctx context.Context, ruleID uuid.UUID) error
+	ListFlags(ctx context.Context) ([]database.ListModerationFlagsRow, error)
+}
+
+type ReportService interface {
+	ReportChirp(ctx context.Context, reporterID, chirpID uuid.UUID, reason, details string) (database.Report, error)
+	ReportUser(ctx context.Context, reporterID, userID uuid.UUID, reason, details string) (database.Report, error)
+	List(ctx context.Context, status string) ([]database.Report, error)
+	Get(ctx context.Context, reportID uuid.UUID) (database.Report, error)
+	Triage(ctx context.Context, actorID, reportID uuid.UUID, note string) (database.Report, error)
+	Resolve(ctx context.Context, actorID, reportID uuid.UUID, action, note string) (database.Report, error)
+	Dismiss(ctx context.Context, actorID, reportID uuid.UUID, note string) (database.Report, error)
+	ListActions(ctx context.Context) ([]database.ModerationAction, error)
+}
+
+type RelationshipService interface {
+	Follow(ctx context.Context, userID, targetID uuid.UUID) error
+	Unfollow(ctx context.Context, userID, targetID uuid.UUID) error
+	Block(ctx context.Context, userID, targetID uuid.UUID) error
+	Unblock(ctx context.Context, userID, targetID uuid.UUID) error
+	ListBlocks(ctx context.Context, userID uuid.UUID) ([]database.Block, error)
+	Mute(ctx context.Context, userID, targetID uuid.UUID) error
+	Unmute(ctx context.Context, userID, targetID uuid.UUID) error
+	ListMutes(ctx context.Context, userID uuid.UUID) ([]database.Mute, error)
+}
+
+type MediaService interface {
+	SetImage(ctx context.Context, userID uuid.UUID, kind service.ImageKind, data []byte) (database.GetUserByIDNoPasswordRow, error)
+	URLs(kind service.ImageKind, key string) map[string]string
+}
+
+type AccountService interface {
+	ScheduleDeletion(ctx context.Context, userID uuid.UUID, password, refreshToken string) (time.Time, error)
+	Export(ctx context.Context, userID uuid.UUID) (service.AccountExport, error)
+}
+
+type ResetService interface {
+	Request(ctx context.Context, actorID uuid.UUID, tables []string) (service.ResetConfirmation, error)
+	Confirm(ctx context.Context, actorID uuid.UUID, token string, tables []string) ([]string, error)
+}
+
+type SeedService interface {
+	Seed(ctx context.Context, opts seed.Options) (service.SeedResult, error)
+}
+
+type StreamService interface {
+	Filter(ctx context.Context, viewerID uuid.NullUUID, q service.StreamQuery) (stream.Filter, error)
+}
+
+type NotificationService interface {
+	List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (service.NotificationPage, error)
+	MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, int64, error)
+	Preferences(ctx context.Context, userID uuid.UUID) (service.NotificationPreferences, error)
+	SetPreferences(ctx context.Context, userID uuid.UUID, update service.NotificationPreferences) (service.NotificationPreferences, error)
+}
+
+type WebhookService interface {
+	Create(ctx context.Context, in service.WebhookInput) (database.Webhook, error)
+	List(ctx context.Context) ([]database.Webhook, error)
+	Get(ctx context.Context, id uuid.UUID) (database.Webhook, error)
+	Update(ctx context.Context, id uuid.UUID, update service.WebhookUpdate) (database.Webhook, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Deliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]database.WebhookDelivery, error)
+	Delivery(ctx context.Context, webhookID, deliveryID uuid.UUID) (database.WebhookDelivery, []database.WebhookDeliveryAttempt, error)
+	Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (database.WebhookDelivery, error)
+}
+
+// MediaPath is where MediaHandler is mounted, storage URLs must point below it
+const MediaPath = "/app/media/"
+
+// Options wires the API to its services
+type Options struct {
+	Users         UserService
+	Chirps        ChirpService
+	Drafts        DraftService
+	Lists         ListService
+	Auth          AuthService
+	APIKeys       APIKeyService
+	OAuth         OAuthService
+	OIDC          OIDCService
+	MagicLinks    MagicLinkService
+	Moderation    ModerationService
+	Reports       ReportService
+	Relationships RelationshipService
+	Media         MediaService
+	Accounts      AccountService
+	Reset         ResetService
+	Seed          SeedService
+	Streams       StreamService
+	Notifications NotificationService
+	Webhooks      WebhookService
+	Health        store.Health
+
+	// Hub serves /api/stream, Events is where the handlers publish (a Postgres bridge in front of
+	// Hub when several instances run), it defaults to Hub
+	Hub             *stream.Hub
+	Events          stream.Publisher
+	StreamHeartbeat time.Duration
+
+	// MediaHandler serves the stored uploads under MediaPath
+	MediaHandler   http.Handler
+	MaxUploadBytes int64
+
+	// PolkaKey authenticates the payment webhooks, empty rejects them all
+	PolkaKey string
+
+	// Platform is one of the config.Platform* values, only dev and test unlock the reset and seed routes
+	Platform string
+
+	// StaticDir is served under /app/, its assets folder under /app/assets/
+	StaticDir string
+}
+
+// API holds the HTTP handlers and the state they share
+type API struct {
+	fileserverHits atomic.Int32
+	users          UserService
+	chirps         ChirpService
+	drafts         DraftService
+	lists          ListService
+	auth           AuthService
+	apiKeys        APIKeyService
+	oauth          OAuthService
+	oidc           OIDCService
+	magicLinks     MagicLinkService
+	moderation     ModerationService
+	reports        ReportService
+	relationships  RelationshipService
+	media          MediaService
+	accounts       AccountService
+	reset          ResetService
+	seed           SeedService
+	streams        StreamService
+	notifications  NotificationService
+	webhooks       WebhookService
+	health         store.Health
+	hub            *stream.Hub
+	events         stream.Publisher
+	heartbeat      time.Duration
+	mediaHandler   http.Handler
+	maxUploadBytes int64
+	polkaKey       string
+	platform       string
+	staticDir      string
+}
+
+func New(opts Options) *API {
+	staticDir := opts.StaticDir
+	if staticDir == "" {
+		staticDir = "."
+	}
+
+	// A nil *Hub must not end up in the interface
+	events := opts.Events
+	if events == nil && opts.Hub != nil {
+		events = opts.Hub
+	}
+
+	return &API{
+		users:          opts.Users,
+		chirps:         opts.Chirps,
+		drafts:         opts.Drafts,
+		lists:          opts.Lists,
+		auth:           opts.Auth,
+		apiKeys:        opts.APIKeys,
+		oauth:          opts.OAuth,
+		oidc:           opts.OIDC,
+		magicLinks:     opts.MagicLinks,
+		moderation:     opts.Moderation,
+		reports:        opts.Reports,
+		relationships:  opts.Relationships,
+		media:          opts.Media,
+		accounts:       opts.Accounts,
+		reset:          opts.Reset,
+		seed:           opts.Seed,
+		streams:        opts.Streams,
+		notifications:  opts.Notifications,
+		webhooks:       opts.Webhooks,
+		health:         opts.Health,
+		hub:            opts.Hub,
+		events:         events,
+		heartbeat:      opts.StreamHeartbeat,
+		mediaHandler:   opts.MediaHandler,
+		maxUploadBytes: opts.MaxUploadBytes,
+		polkaKey:       opts.PolkaKey,
+		platform:       opts.Platform,
+		staticDir:      staticDir,
+	}
+}
+
+// Wrapper around my other handlers, increments my struct var per request (goroutine) and then handles wrapped handler (using ServeHTTP)
+func (a *API) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.fileserverHits.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reads the Bearer access token and validates it, returning the user ID it was issued for
+func (a *API) authenticate(r *http.Request) (uuid.UUID, error) {
+
+	principal, err := a.principal(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return principal.UserID, nil
+}
+
+// Like authenticate, but anonymous requests are allowed. A token that is sent still has to be valid.
+func (a *API) optionalViewer(r *http.Request) (uuid.NullUUID, error) {
+
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, nil
+	}
+
+	userID, err := a.authenticate(r)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+
+	return uuid.NullUUID{UUID: userID, Valid: true}, nil
+}
+
+// Like authenticate, but also returns the role carried by the token. Personal API keys and app
+// tokens issued over OAuth are accepted on the routes wrapped in requireScope.
+func (a *API) principal(r *http.Request) (auth.Principal, error) {
+
+	token, err := auth.GetBearerToken(r.Header)
+
+	if err != nil {
+		return auth.Principal{}, apierror.Unauthorized(apierror.CodeUnauthorized, "Missing bearer token").WithCause(err)
+	}
+
+	principal, err := a.auth.Authenticate(r.Context(), token)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	if err := checkScope(r, principal); err != nil {
+		return auth.Principal{}, err
+	}
+
+	return principal, nil
+}
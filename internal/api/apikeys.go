@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+func (a *API) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	// 1. Only a session may mint keys, a leaked key can't be used to make more
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Decode the body
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 3. Validate and store the hash
+	key, err := a.apiKeys.Create(r.Context(), userID, service.APIKeyInput{
+		Name:      params.Name,
+		Scopes:    params.Scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created API key %v for %v\n", key.ID, userID)
+
+	// The only time the key is shown
+	out := apiKeyFromDB(key.ApiKey)
+	out.Key = key.Secret
+	respondWithJson(w, http.StatusCreated, out)
+}
+
+func (a *API) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	keys, err := a.apiKeys.List(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, apiKeysFromDB(keys))
+}
+
+func (a *API) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	keyID, err := parseIDParam(r, "keyID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.apiKeys.Revoke(r.Context(), userID, keyID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
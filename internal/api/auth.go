@@ -0,0 +1,106 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+func (a *API) loginUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+
+	// Decoding logic
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	session, err := a.auth.Login(r.Context(), params.Email, params.Password)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Refresh token created for %v\n", session.User.ID)
+
+	respondWithSession(w, session)
+}
+
+// The response of every login, whichever way the user proved who they are
+func respondWithSession(w http.ResponseWriter, session service.Session) {
+
+	type validResponse struct {
+		ID           uuid.UUID `json:"id"`
+		Email        string    `json:"email"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Role         string    `json:"role"`
+		Handle       string    `json:"handle"`
+		Token        string    `json:"token"`
+		RefreshToken string    `json:"refresh_token"`
+	}
+
+	respondWithJson(w, http.StatusOK, validResponse{
+		ID:           session.User.ID,
+		Email:        session.User.Email,
+		CreatedAt:    session.User.CreatedAt,
+		UpdatedAt:    session.User.UpdatedAt,
+		Role:         session.User.Role,
+		Handle:       session.User.Handle,
+		Token:        session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	})
+}
+
+func (a *API) refreshHandler(w http.ResponseWriter, r *http.Request) {
+
+	type validResponse struct {
+		AccessToken string `json:"token"`
+	}
+
+	// Check header for the refresh token
+	refreshToken, err := auth.GetBearerToken(r.Header)
+
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized(apierror.CodeUnauthorized, "Missing refresh token").WithCause(err))
+		return
+	}
+
+	accessToken, err := a.auth.Refresh(r.Context(), refreshToken)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, validResponse{AccessToken: accessToken})
+}
+
+func (a *API) revokeUpdateHandler(w http.ResponseWriter, r *http.Request) {
+
+	refreshToken, err := auth.GetBearerToken(r.Header)
+
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized(apierror.CodeUnauthorized, "Missing refresh token").WithCause(err))
+		return
+	}
+
+	if err := a.auth.Revoke(r.Context(), refreshToken); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
@@ -0,0 +1,460 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/stream"
+)
+
+func (a *API) createChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Body      string        `json:"body"`
+		ReplyToID uuid.NullUUID `json:"reply_to_id"`
+		// Queues the chirp until then instead of publishing it now
+		PublishAt *time.Time `json:"publish_at"`
+		Poll      *struct {
+			Options        []string  `json:"options"`
+			ClosesAt       time.Time `json:"closes_at"`
+			MultipleChoice bool      `json:"multiple_choice"`
+		} `json:"poll"`
+	}
+
+	// 1. Validate our Access Token
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Decode the params into our struct
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var poll *service.PollInput
+
+	if params.Poll != nil {
+		poll = &service.PollInput{
+			Options:        params.Poll.Options,
+			ClosesAt:       params.Poll.ClosesAt,
+			MultipleChoice: params.Poll.MultipleChoice,
+		}
+	}
+
+	if params.PublishAt != nil {
+		// The poll would close on a schedule of its own, possibly before the chirp is out
+		if poll != nil {
+			respondWithError(w, r, apierror.Validation(apierror.FieldError{Field: "poll", Message: "can't be added to a scheduled chirp"}))
+			return
+		}
+
+		scheduled, err := a.chirps.Schedule(r.Context(), userID, params.Body, params.ReplyToID, *params.PublishAt)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		log.Printf("Scheduled chirp %v for %v\n", scheduled.ID, scheduled.PublishAt)
+
+		respondWithJson(w, http.StatusAccepted, scheduledChirpFromDB(scheduled))
+		return
+	}
+
+	// 3. Validate, censor and store
+	chirp, err := a.chirps.Create(r.Context(), userID, params.Body, params.ReplyToID, poll)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	out, err := a.newChirp(r.Context(), chirp)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created chirp: %v\n", chirp.ID)
+
+	a.publish(r.Context(), stream.TypeChirpCreated, chirp.UserID, stream.Tags(chirp.Body), out)
+
+	respondWithJson(w, http.StatusCreated, out)
+}
+
+// PublishChirp announces a chirp created outside a request, like a scheduled one going out, on
+// the stream
+func (a *API) PublishChirp(ctx context.Context, chirp database.Chirp) {
+
+	out, err := a.newChirp(ctx, chirp)
+
+	if err != nil {
+		log.Printf("Publishing %s event: %v", stream.TypeChirpCreated, err)
+		return
+	}
+
+	a.publish(ctx, stream.TypeChirpCreated, chirp.UserID, stream.Tags(chirp.Body), out)
+}
+
+// The response for a chirp just created, what its author and the stream see
+func (a *API) newChirp(ctx context.Context, chirp database.Chirp) (Chirp, error) {
+
+	authors, err := a.users.Summaries(ctx, authorIDs(chirp))
+
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	// Nobody voted yet, so the tallies are hidden for the author and the stream alike
+	polls, err := a.chirps.Polls(ctx, uuid.NullUUID{UUID: chirp.UserID, Valid: true}, chirpIDs(chirp))
+
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirpFromDB(chirp, authors, polls, a.media.URLs), nil
+}
+
+func (a *API) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Signed in viewers don't see chirps from users who blocked or were muted by them
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	filter, err := chirpFilterFromQuery(r.URL.Query())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirps, err := a.chirps.List(r.Context(), viewerID, filter)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	a.respondWithChirps(w, r, viewerID, chirps)
+}
+
+// The ?author_id=, ?before= and ?limit= every endpoint listing chirps takes. before is the ID of
+// the last chirp of the previous page.
+func chirpFilterFromQuery(query url.Values) (service.ChirpFilter, error) {
+
+	filter := service.ChirpFilter{Limit: service.DefaultChirpPageSize}
+
+	var fields []apierror.FieldError
+
+	for _, param := range []struct {
+		name string
+		dst  *uuid.NullUUID
+	}{
+		{"author_id", &filter.AuthorID},
+		{"before", &filter.BeforeID},
+	} {
+		raw := query.Get(param.name)
+		if raw == "" {
+			continue
+		}
+
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: param.name, Message: "must be a valid UUID"})
+			continue
+		}
+		*param.dst = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "limit", Message: "must be a number"})
+		}
+		filter.Limit = limit
+	}
+
+	if len(fields) > 0 {
+		return service.ChirpFilter{}, apierror.Validation(fields...)
+	}
+
+	return filter, nil
+}
+
+// Answers with a page of chirps as viewerID sees them. Shared by every endpoint listing chirps,
+// so they all embed the authors and polls the same way.
+func (a *API) respondWithChirps(w http.ResponseWriter, r *http.Request, viewerID uuid.NullUUID, chirps []database.Chirp) {
+
+	// One lookup for every author on the page, and one for the polls
+	authors, err := a.users.Summaries(r.Context(), authorIDs(chirps...))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	polls, err := a.chirps.Polls(r.Context(), viewerID, chirpIDs(chirps...))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, chirpsFromDB(chirps, authors, polls, a.media.URLs))
+}
+
+func (a *API) getIndividualChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	chirpID, err := parseIDParam(r, "chirpID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirp, err := a.chirps.Get(r.Context(), viewerID, chirpID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	authors, err := a.users.Summaries(r.Context(), authorIDs(chirp))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	polls, err := a.chirps.Polls(r.Context(), viewerID, chirpIDs(chirp))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, chirpFromDB(chirp, authors, polls, a.media.URLs))
+}
+
+func (a *API) deleteChirpFromID(w http.ResponseWriter, r *http.Request) {
+
+	chirpID, err := parseIDParam(r, "chirp_id")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 1. Validate the access token
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Only the author may delete
+	if err := a.chirps.Delete(r.Context(), userID, chirpID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	a.publish(r.Context(), stream.TypeChirpDeleted, userID, nil, ChirpDeleted{ID: chirpID})
+
+	// Return 204 if success
+	respondNoContent(w)
+}
+
+// Shared by like and unlike: authenticate, read {chirpID} and apply change
+func (a *API) likeHandler(change func(ctx context.Context, userID, chirpID uuid.UUID) (service.LikeState, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		chirpID, err := parseIDParam(r, "chirpID")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		userID, err := a.authenticate(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		state, err := change(r.Context(), userID, chirpID)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		a.publish(r.Context(), stream.TypeLikeCount, state.Chirp.UserID, stream.Tags(state.Chirp.Body), LikeCount{
+			ChirpID:   state.Chirp.ID,
+			LikeCount: state.Likes,
+		})
+
+		respondNoContent(w)
+	}
+}
+
+// Shared by bookmark and unbookmark: authenticate, read {chirpID} and apply change
+func (a *API) bookmarkHandler(change func(ctx context.Context, userID, chirpID uuid.UUID) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		chirpID, err := parseIDParam(r, "chirpID")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		userID, err := a.authenticate(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		if err := change(r.Context(), userID, chirpID); err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondNoContent(w)
+	}
+}
+
+func (a *API) listBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	filter, err := chirpFilterFromQuery(r.URL.Query())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirps, err := a.chirps.Bookmarks(r.Context(), userID, filter)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	a.respondWithChirps(w, r, uuid.NullUUID{UUID: userID, Valid: true}, chirps)
+}
+
+func (a *API) votePollHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		OptionIDs []uuid.UUID `json:"option_ids"`
+	}
+
+	chirpID, err := parseIDParam(r, "chirpID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	poll, err := a.chirps.Vote(r.Context(), userID, chirpID, params.OptionIDs)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, pollFromService(poll))
+}
+
+func (a *API) listScheduledChirpsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	scheduled, err := a.chirps.ListScheduled(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, scheduledChirpsFromDB(scheduled))
+}
+
+func (a *API) cancelScheduledChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	scheduledID, err := parseIDParam(r, "scheduledID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.chirps.CancelScheduled(r.Context(), userID, scheduledID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"net/http"
+)
+
+func (a *API) createDraftHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	draft, err := a.drafts.Create(r.Context(), userID, params.Body)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, draftFromDB(draft))
+}
+
+func (a *API) listDraftsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	drafts, err := a.drafts.List(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, draftsFromDB(drafts))
+}
+
+func (a *API) getDraftHandler(w http.ResponseWriter, r *http.Request) {
+
+	draftID, err := parseIDParam(r, "draftID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	draft, err := a.drafts.Get(r.Context(), userID, draftID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, draftFromDB(draft))
+}
+
+func (a *API) updateDraftHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	draftID, err := parseIDParam(r, "draftID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	draft, err := a.drafts.Update(r.Context(), userID, draftID, params.Body)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, draftFromDB(draft))
+}
+
+func (a *API) deleteDraftHandler(w http.ResponseWriter, r *http.Request) {
+
+	draftID, err := parseIDParam(r, "draftID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.drafts.Delete(r.Context(), userID, draftID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
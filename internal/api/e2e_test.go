@@ -0,0 +1,4240 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/api"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/oidc/oidctest"
+	"github.com/itsmandrew/server-go/internal/seed"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/storage"
+	"github.com/itsmandrew/server-go/internal/store"
+	"github.com/itsmandrew/server-go/internal/webhook"
+)
+
+// One request against a server preloaded with testdata/fixtures.json. The response
+// must have wantStatus and match testdata/golden/<name>.json.
+type apiCase struct {
+	name     string
+	platform string
+
+	// Runs before the request, e.g. to revoke a token first
+	setup func(t *testing.T, env *testEnv)
+
+	method string
+	path   string // may use {chirp:saul-first} placeholders
+	auth   string // "access:<user>", "refresh:<user>", "key:<name>", "raw:<token>" or empty
+	body   any
+
+	wantStatus int
+
+	// Extra assertions on the state after the request
+	check func(t *testing.T, env *testEnv)
+}
+
+type testEnv struct {
+	fx    *fixtures
+	store store.Store
+	api   *api.API
+	do    func(method, path, auth string, body any) (*http.Response, []byte)
+}
+
+func runCases(t *testing.T, cases []apiCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, s, _ := newTestServer(t, serverOptions{platform: tc.platform})
+			fx := loadFixtures(t, srv, s)
+
+			env := &testEnv{fx: fx, store: s}
+			env.do = func(method, path, auth string, body any) (*http.Response, []byte) {
+				return do(t, srv, method, fx.expand(t, path), fx.token(t, auth), fx.expandBody(t, body))
+			}
+
+			if tc.setup != nil {
+				tc.setup(t, env)
+			}
+
+			resp, body := env.do(tc.method, tc.path, tc.auth, tc.body)
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, resp.StatusCode, body)
+			}
+
+			assertGolden(t, fx, tc.name, body)
+
+			if tc.check != nil {
+				tc.check(t, env)
+			}
+		})
+	}
+}
+
+// Fails unless the request comes back with the expected status
+func (env *testEnv) expect(t *testing.T, method, path, auth string, body any, wantStatus int) []byte {
+	t.Helper()
+
+	resp, respBody := env.do(method, path, auth, body)
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, respBody)
+	}
+	return respBody
+}
+
+func TestUsers(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "signup",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22"},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22"}, http.StatusOK)
+			},
+		},
+		{
+			name:       "signup_duplicate_email",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "saul@bettercall.com", "password": "hunter22"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "signup_invalid_json",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       `{"email": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "signup_missing_fields",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "not-an-email"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "update_user",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			auth:       "access:saul",
+			body:       map[string]string{"email": "jimmy@bettercall.com", "password": "slippin"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "jimmy@bettercall.com", "password": "slippin"}, http.StatusOK)
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusUnauthorized)
+			},
+		},
+		{
+			name:       "update_user_email_taken",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			auth:       "access:saul",
+			body:       map[string]string{"email": "walt@breakingbad.com", "password": "slippin"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "update_user_unauthenticated",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			body:       map[string]string{"email": "jimmy@bettercall.com", "password": "slippin"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "update_user_partial",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			auth:       "access:saul",
+			body:       map[string]string{"bio": "Better call Saul!"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				// Email and password are left alone
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusOK)
+			},
+		},
+		{
+			name:       "update_user_empty",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			auth:       "access:saul",
+			body:       map[string]string{},
+			wantStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	jesseFollowsWalt := func(t *testing.T, env *testEnv) {
+		env.expect(t, http.MethodPost, "/api/users/{user:walt}/follow", "access:jesse", nil, http.StatusNoContent)
+	}
+
+	runCases(t, []apiCase{
+		{
+			name:       "signup_with_handle",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22", "handle": "kimwexler"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			// "saulgoodman" is taken, so the handle derived from this email gets a random suffix
+			// and the profile behind the plain handle is untouched
+			name: "signup_generated_handle_taken",
+			setup: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodPost, "/api/users", "", map[string]string{"email": "saulgoodman@gmail.com", "password": "hunter22"}, http.StatusCreated)
+
+				var user struct {
+					Handle string `json:"handle"`
+				}
+				if err := json.Unmarshal(body, &user); err != nil {
+					t.Fatal(err)
+				}
+
+				if !strings.HasPrefix(user.Handle, "saulgoodman_") {
+					t.Errorf("expected a suffixed handle, got %q", user.Handle)
+				}
+			},
+			method:     http.MethodGet,
+			path:       "/api/users/saulgoodman",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "signup_handle_taken",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22", "handle": "heisenberg"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "signup_invalid_handle",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22", "handle": "kim wexler"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "signup_reserved_handle",
+			method:     http.MethodPost,
+			path:       "/api/users",
+			body:       map[string]string{"email": "kim@wexlermcgill.com", "password": "hunter22", "handle": "ME"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "update_profile",
+			method: http.MethodPut,
+			path:   "/api/users",
+			auth:   "access:walt",
+			body: map[string]string{
+				"handle":       "walterwhite",
+				"display_name": "Walter White",
+				"bio":          "Chemistry teacher",
+				"location":     "Albuquerque, NM",
+				"website":      "https://breakingbad.com",
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/users/Heisenberg", "", nil, http.StatusNotFound)
+				body := env.expect(t, http.MethodGet, "/api/users/walterwhite", "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "update_profile_public", body)
+			},
+		},
+		{
+			name:   "update_profile_invalid",
+			method: http.MethodPut,
+			path:   "/api/users",
+			auth:   "access:walt",
+			body: map[string]string{
+				"handle":  "x",
+				"bio":     strings.Repeat("a", 161),
+				"website": "ftp://breakingbad.com",
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "update_profile_handle_taken",
+			method:     http.MethodPut,
+			path:       "/api/users",
+			auth:       "access:jesse",
+			body:       map[string]string{"handle": "SAULGOODMAN"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "get_me",
+			method:     http.MethodGet,
+			path:       "/api/users/me",
+			auth:       "access:jesse",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get_me_unauthenticated",
+			method:     http.MethodGet,
+			path:       "/api/users/me",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			// Handles ignore case, and the profile never carries the email
+			name:       "get_profile",
+			setup:      jesseFollowsWalt,
+			method:     http.MethodGet,
+			path:       "/api/users/heisenberg",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get_profile_unknown",
+			method:     http.MethodGet,
+			path:       "/api/users/gustavo",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "follow_user",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/follow",
+			auth:       "access:jesse",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodGet, "/api/users/jesse", "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "follow_user_follower_profile", body)
+			},
+		},
+		{
+			name:       "follow_self",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:jesse}/follow",
+			auth:       "access:jesse",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "follow_blocked",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/users/{user:jesse}/block", "access:walt", nil, http.StatusNoContent)
+			},
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/follow",
+			auth:       "access:jesse",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unfollow_user",
+			setup:      jesseFollowsWalt,
+			method:     http.MethodDelete,
+			path:       "/api/users/{user:walt}/follow",
+			auth:       "access:jesse",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodGet, "/api/users/heisenberg", "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "unfollow_user_profile", body)
+			},
+		},
+		{
+			name:       "block_drops_follow",
+			setup:      jesseFollowsWalt,
+			method:     http.MethodPost,
+			path:       "/api/users/{user:jesse}/block",
+			auth:       "access:walt",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodGet, "/api/users/heisenberg", "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "block_drops_follow_profile", body)
+			},
+		},
+	})
+}
+
+func TestAuth(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "login",
+			method:     http.MethodPost,
+			path:       "/api/login",
+			body:       map[string]string{"email": "saul@bettercall.com", "password": "123456"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "login_wrong_password",
+			method:     http.MethodPost,
+			path:       "/api/login",
+			body:       map[string]string{"email": "saul@bettercall.com", "password": "654321"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "login_unknown_email",
+			method:     http.MethodPost,
+			path:       "/api/login",
+			body:       map[string]string{"email": "gus@lospolloshermanos.com", "password": "123456"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "refresh",
+			method:     http.MethodPost,
+			path:       "/api/refresh",
+			auth:       "refresh:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "refresh_missing_token",
+			method:     http.MethodPost,
+			path:       "/api/refresh",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "refresh_unknown_token",
+			method:     http.MethodPost,
+			path:       "/api/refresh",
+			auth:       "raw:deadbeef",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "revoke",
+			method:     http.MethodPost,
+			path:       "/api/revoke",
+			auth:       "refresh:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/refresh", "refresh:saul", nil, http.StatusUnauthorized)
+			},
+		},
+		{
+			name: "refresh_revoked_token",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/revoke", "refresh:walt", nil, http.StatusNoContent)
+			},
+			method:     http.MethodPost,
+			path:       "/api/refresh",
+			auth:       "refresh:walt",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "access_token_invalid",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "raw:not.a.jwt",
+			body:       map[string]string{"body": "Hello"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "access_token_is_refresh_token",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "refresh:saul",
+			body:       map[string]string{"body": "Hello"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	})
+}
+
+func TestChirps(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "create_chirp",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:saul",
+			body:       map[string]string{"body": "What a kerfuffle this sharbert is"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create_chirp_masks_punctuated_words",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:saul",
+			body:       map[string]string{"body": "Kerfuffle!  Such a\nSHARBERT."},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create_chirp_too_long",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:saul",
+			body:       map[string]string{"body": "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "create_chirp_empty",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:saul",
+			body:       map[string]string{"body": "   "},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "create_chirp_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			body:       map[string]string{"body": "Hello"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "list_chirps",
+			method:     http.MethodGet,
+			path:       "/api/chirps",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list_chirps_by_author",
+			method:     http.MethodGet,
+			path:       "/api/chirps?author_id={user:walt}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list_chirps_page",
+			method:     http.MethodGet,
+			path:       "/api/chirps?limit=1&before={chirp:walt-first}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list_chirps_invalid_filter",
+			method:     http.MethodGet,
+			path:       "/api/chirps?author_id=heisenberg&before=last&limit=ten",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "list_chirps_limit_too_large",
+			method:     http.MethodGet,
+			path:       "/api/chirps?limit=101",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "get_chirp",
+			method:     http.MethodGet,
+			path:       "/api/chirps/{chirp:walt-first}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get_chirp_not_found",
+			method:     http.MethodGet,
+			path:       "/api/chirps/00000000-0000-0000-0000-000000000000",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "get_chirp_invalid_id",
+			method:     http.MethodGet,
+			path:       "/api/chirps/not-a-uuid",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "delete_chirp",
+			method:     http.MethodDelete,
+			path:       "/api/chirps/{chirp:saul-first}",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusNotFound)
+			},
+		},
+		{
+			name:       "delete_chirp_not_author",
+			method:     http.MethodDelete,
+			path:       "/api/chirps/{chirp:walt-first}",
+			auth:       "access:saul",
+			wantStatus: http.StatusForbidden,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:walt-first}", "", nil, http.StatusOK)
+			},
+		},
+		{
+			name:       "delete_chirp_not_found",
+			method:     http.MethodDelete,
+			path:       "/api/chirps/00000000-0000-0000-0000-000000000000",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+}
+
+// Follows ?before= through a chirp listing limit chirps at a time and returns every ID, in order
+func walkChirpPages(t *testing.T, env *testEnv, path, auth string, limit int) []string {
+	t.Helper()
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	var ids []string
+	for before := ""; ; {
+		query := fmt.Sprintf("%slimit=%d", sep, limit)
+		if before != "" {
+			query += "&before=" + before
+		}
+
+		var page []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(env.expect(t, http.MethodGet, path+query, auth, nil, http.StatusOK), &page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page) > limit {
+			t.Fatalf("expected at most %d chirps, got %d", limit, len(page))
+		}
+
+		for _, c := range page {
+			ids = append(ids, c.ID)
+		}
+		if len(page) < limit {
+			return ids
+		}
+		before = page[len(page)-1].ID
+	}
+}
+
+func TestChirpPaging(t *testing.T) {
+	_, env := newTestEnv(t, serverOptions{})
+
+	var posted []string
+	for i := range 5 {
+		body := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{"body": fmt.Sprintf("Batch %d", i)}, http.StatusCreated)
+
+		var chirp struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(body, &chirp); err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, chirp.ID)
+	}
+	slices.Reverse(posted)
+
+	// Newest first, every chirp exactly once across the pages
+	if ids := walkChirpPages(t, env, "/api/chirps?author_id={user:jesse}", "", 2); !slices.Equal(ids, posted) {
+		t.Errorf("expected %v, got %v", posted, ids)
+	}
+
+	all := walkChirpPages(t, env, "/api/chirps", "", 3)
+	if len(all) != 7 || !slices.Equal(all[:5], posted) || all[6] != env.fx.ids["chirp:saul-first"].String() {
+		t.Errorf("expected jesse's chirps then the fixtures, got %v", all)
+	}
+
+	// The cursor is the chirp, not its position: deleting it ends the listing
+	env.expect(t, http.MethodDelete, "/api/chirps/"+posted[1], "access:jesse", nil, http.StatusNoContent)
+	if body := env.expect(t, http.MethodGet, "/api/chirps?before="+posted[1], "", nil, http.StatusOK); string(body) != "[]" {
+		t.Errorf("expected no chirps after a deleted cursor, got %s", body)
+	}
+}
+
+// Sends the confirmation token from a first /admin/reset response back for the same tables
+func confirmReset(t *testing.T, env *testEnv, requested []byte, tables []string, wantStatus int) []byte {
+	t.Helper()
+
+	var pending struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	if err := json.Unmarshal(requested, &pending); err != nil || pending.ConfirmationToken == "" {
+		t.Fatalf("expected a confirmation token, got %s", requested)
+	}
+
+	body := map[string]any{"tables": tables, "confirmation_token": pending.ConfirmationToken}
+	return env.expect(t, http.MethodPost, "/admin/reset", "access:saul", body, wantStatus)
+}
+
+func TestAdmin(t *testing.T) {
+	seedOptions := seed.Options{Seed: 7, Users: 10, ChirpsPerUser: 2, FollowsPerUser: 3}
+	seedBody := map[string]any{"seed": 7, "users": 10, "chirps_per_user": 2, "follows_per_user": 3}
+
+	runCases(t, []apiCase{
+		{
+			name:       "reset",
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			auth:       "access:saul",
+			body:       map[string]any{},
+			wantStatus: http.StatusAccepted,
+			check: func(t *testing.T, env *testEnv) {
+				// Nothing is gone until the token comes back
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK)
+
+				requested := env.expect(t, http.MethodPost, "/admin/reset", "access:saul", map[string]any{}, http.StatusAccepted)
+				body := confirmReset(t, env, requested, nil, http.StatusOK)
+				assertGolden(t, env.fx, "reset_confirmed", body)
+
+				body = env.expect(t, http.MethodGet, "/api/chirps", "", nil, http.StatusOK)
+				if string(body) != "[]" {
+					t.Errorf("expected no chirps after reset, got %s", body)
+				}
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusUnauthorized)
+			},
+		},
+		{
+			name:       "reset_tables",
+			platform:   "test",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			auth:       "access:saul",
+			body:       map[string]any{"tables": []string{"chirps", "chirps"}},
+			wantStatus: http.StatusAccepted,
+			check: func(t *testing.T, env *testEnv) {
+				requested := env.expect(t, http.MethodPost, "/admin/reset", "access:saul", map[string]any{"tables": []string{"chirps"}}, http.StatusAccepted)
+				body := confirmReset(t, env, requested, []string{"chirps"}, http.StatusOK)
+				assertGolden(t, env.fx, "reset_tables_confirmed", body)
+
+				// Only the chirps are gone, and the token can't be used twice
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusNotFound)
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusOK)
+				confirmReset(t, env, requested, []string{"chirps"}, http.StatusUnprocessableEntity)
+			},
+		},
+		{
+			name: "reset_token_for_other_tables",
+			setup: func(t *testing.T, env *testEnv) {
+				requested := env.expect(t, http.MethodPost, "/admin/reset", "access:saul", map[string]any{"tables": []string{"chirps"}}, http.StatusAccepted)
+				confirmReset(t, env, requested, []string{"users"}, http.StatusUnprocessableEntity)
+			},
+			platform:   "dev",
+			method:     http.MethodGet,
+			path:       "/api/chirps/{chirp:saul-first}",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "reset_unknown_table",
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			auth:       "access:saul",
+			body:       map[string]any{"tables": []string{"chirps", "pg_authid"}},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "reset_outside_dev",
+			platform:   "prod",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			auth:       "access:saul",
+			body:       map[string]any{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "reset_as_moderator",
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			auth:       "access:walt",
+			body:       map[string]any{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "seed",
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/seed",
+			auth:       "access:saul",
+			body:       seedBody,
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, env *testEnv) {
+				var chirps []any
+				body := env.expect(t, http.MethodGet, "/api/chirps", "", nil, http.StatusOK)
+				if err := json.Unmarshal(body, &chirps); err != nil || len(chirps) != 2+20 {
+					t.Errorf("expected the 2 fixture chirps and 20 seeded ones, got %d", len(chirps))
+				}
+
+				// Same seed, same users: the first one can log in and follows three others
+				first := seed.Generate(seedOptions).Users[0]
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": first.Email, "password": service.SeedPassword}, http.StatusOK)
+
+				body = env.expect(t, http.MethodGet, "/api/users/"+first.Handle, "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "seed_first_user", body)
+
+				env.expect(t, http.MethodPost, "/admin/seed", "access:saul", seedBody, http.StatusConflict)
+			},
+		},
+		{
+			name:       "seed_invalid",
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/seed",
+			auth:       "access:saul",
+			body:       map[string]any{"users": 3, "chirps_per_user": -1, "follows_per_user": 3},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "seed_outside_dev",
+			platform:   "prod",
+			method:     http.MethodPost,
+			path:       "/admin/seed",
+			auth:       "access:saul",
+			body:       map[string]any{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "healthz",
+			method:     http.MethodGet,
+			path:       "/api/healthz",
+			wantStatus: http.StatusOK,
+		},
+	})
+}
+
+// Adds a moderation rule through the admin API, its ID is available as {rule:<pattern>}
+func addRule(kind, pattern, action string) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		rule := map[string]string{"kind": kind, "pattern": pattern, "action": action}
+		body := env.expect(t, http.MethodPost, "/admin/moderation/rules", "access:saul", rule, http.StatusCreated)
+
+		var created struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal(body, &created); err != nil {
+			t.Fatal(err)
+		}
+		env.fx.ids["rule:"+pattern] = created.ID
+	}
+}
+
+func TestModeration(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "moderation_create_rule",
+			method:     http.MethodPost,
+			path:       "/admin/moderation/rules",
+			auth:       "access:saul",
+			body:       map[string]string{"kind": "regex", "pattern": `\bbuy now\b`, "action": "reject"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "moderation_create_rule_invalid",
+			method:     http.MethodPost,
+			path:       "/admin/moderation/rules",
+			auth:       "access:saul",
+			body:       map[string]string{"kind": "regex", "pattern": "(unclosed", "action": "reject"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "moderation_create_rule_duplicate",
+			setup:      addRule("word", "spam", "reject"),
+			method:     http.MethodPost,
+			path:       "/admin/moderation/rules",
+			auth:       "access:saul",
+			body:       map[string]string{"kind": "word", "pattern": "spam", "action": "flag"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "moderation_create_rule_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/admin/moderation/rules",
+			body:       map[string]string{"kind": "word", "pattern": "spam", "action": "reject"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "moderation_list_rules",
+			setup:      addRule("word", "spam", "reject"),
+			method:     http.MethodGet,
+			path:       "/admin/moderation/rules",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "moderation_rejects_chirp",
+			setup:      addRule("word", "spam", "reject"),
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:walt",
+			body:       map[string]string{"body": "Buy my $PAM"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "moderation_flags_chirp",
+			setup:      addRule("word", "meth", "flag"),
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:walt",
+			body:       map[string]string{"body": "Chemistry, not meth"},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodGet, "/admin/moderation/flags", "access:saul", nil, http.StatusOK)
+				assertGolden(t, env.fx, "moderation_flags_chirp_queue", body)
+			},
+		},
+		{
+			name: "moderation_delete_rule",
+			setup: func(t *testing.T, env *testEnv) {
+				addRule("word", "spam", "reject")(t, env)
+				env.expect(t, http.MethodPost, "/api/chirps", "access:walt", map[string]string{"body": "spam"}, http.StatusUnprocessableEntity)
+			},
+			method:     http.MethodDelete,
+			path:       "/admin/moderation/rules/{rule:spam}",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/chirps", "access:walt", map[string]string{"body": "spam"}, http.StatusCreated)
+			},
+		},
+		{
+			name:       "moderation_delete_rule_not_found",
+			method:     http.MethodDelete,
+			path:       "/admin/moderation/rules/00000000-0000-0000-0000-000000000000",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+}
+
+// Files a report as reporter through the API, its ID is available as {report:<name>}
+func fileReport(name, reporter, path, reason string) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		body := env.expect(t, http.MethodPost, path, "access:"+reporter, map[string]string{"reason": reason}, http.StatusCreated)
+
+		var created struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal(body, &created); err != nil {
+			t.Fatal(err)
+		}
+		env.fx.ids["report:"+name] = created.ID
+	}
+}
+
+// Walt reports Saul's first chirp
+var reportSaulChirp = fileReport("chirp", "walt", "/api/chirps/{chirp:saul-first}/report", "spam")
+
+func TestReports(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "report_chirp",
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/report",
+			auth:       "access:walt",
+			body:       map[string]string{"reason": "harassment", "details": "Keeps calling me"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "report_chirp_invalid_reason",
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/report",
+			auth:       "access:walt",
+			body:       map[string]string{"reason": "boring"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "report_chirp_own",
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/report",
+			auth:       "access:saul",
+			body:       map[string]string{"reason": "spam"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "report_chirp_duplicate",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/report",
+			auth:       "access:walt",
+			body:       map[string]string{"reason": "hate"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "report_chirp_not_found",
+			method:     http.MethodPost,
+			path:       "/api/chirps/00000000-0000-0000-0000-000000000000/report",
+			auth:       "access:walt",
+			body:       map[string]string{"reason": "spam"},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "report_user",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/report",
+			auth:       "access:saul",
+			body:       map[string]string{"reason": "violence"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "report_user_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/report",
+			body:       map[string]string{"reason": "violence"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "reports_list_open",
+			setup: func(t *testing.T, env *testEnv) {
+				reportSaulChirp(t, env)
+				fileReport("user", "saul", "/api/users/{user:walt}/report", "other")(t, env)
+				env.expect(t, http.MethodPost, "/admin/reports/{report:user}/dismiss", "access:saul", map[string]string{}, http.StatusOK)
+			},
+			method:     http.MethodGet,
+			path:       "/admin/reports?status=open",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "reports_list_invalid_status",
+			method:     http.MethodGet,
+			path:       "/admin/reports?status=closed",
+			auth:       "access:saul",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "report_get_not_found",
+			method:     http.MethodGet,
+			path:       "/admin/reports/00000000-0000-0000-0000-000000000000",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "report_triage",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/triage",
+			auth:       "access:walt",
+			body:       map[string]string{"note": "looking into it"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "report_resolve_hide_chirp",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/resolve",
+			auth:       "access:walt",
+			body:       map[string]string{"action": "hide_chirp", "note": "spam link"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusNotFound)
+
+				body := env.expect(t, http.MethodGet, "/admin/moderation/actions", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "report_resolve_hide_chirp_actions", body)
+			},
+		},
+		{
+			name:       "report_resolve_suspend_user",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/resolve",
+			auth:       "access:walt",
+			body:       map[string]string{"action": "suspend_user"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusForbidden)
+				env.expect(t, http.MethodPost, "/api/refresh", "refresh:saul", nil, http.StatusUnauthorized)
+			},
+		},
+		{
+			name:       "report_resolve_warn_user",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/resolve",
+			auth:       "access:walt",
+			body:       map[string]string{"action": "warn_user", "note": "first warning"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK)
+			},
+		},
+		{
+			name:       "report_resolve_invalid_action",
+			setup:      reportSaulChirp,
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/resolve",
+			auth:       "access:walt",
+			body:       map[string]string{"action": "delete_everything"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "report_dismiss_already_resolved",
+			setup: func(t *testing.T, env *testEnv) {
+				reportSaulChirp(t, env)
+				env.expect(t, http.MethodPost, "/admin/reports/{report:chirp}/resolve", "access:walt", map[string]string{"action": "warn_user"}, http.StatusOK)
+			},
+			method:     http.MethodPost,
+			path:       "/admin/reports/{report:chirp}/dismiss",
+			auth:       "access:walt",
+			body:       map[string]string{},
+			wantStatus: http.StatusConflict,
+		},
+	})
+}
+
+func TestRoles(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "admin_metrics_unauthenticated",
+			method:     http.MethodGet,
+			path:       "/admin/metrics",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "admin_metrics_as_user",
+			method:     http.MethodGet,
+			path:       "/admin/metrics",
+			auth:       "access:jesse",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin_metrics",
+			method:     http.MethodGet,
+			path:       "/admin/metrics",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "moderation_rules_as_moderator",
+			method:     http.MethodGet,
+			path:       "/admin/moderation/rules",
+			auth:       "access:walt",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "reports_as_user",
+			method:     http.MethodGet,
+			path:       "/admin/reports",
+			auth:       "access:jesse",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "set_user_role",
+			method:     http.MethodPut,
+			path:       "/admin/users/{user:jesse}/role",
+			auth:       "access:saul",
+			body:       map[string]string{"role": "moderator"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				// The new role is picked up by the next refreshed access token
+				body := env.expect(t, http.MethodPost, "/api/refresh", "refresh:jesse", nil, http.StatusOK)
+
+				var refreshed struct {
+					Token string `json:"token"`
+				}
+				if err := json.Unmarshal(body, &refreshed); err != nil {
+					t.Fatal(err)
+				}
+
+				env.expect(t, http.MethodGet, "/admin/reports", "raw:"+refreshed.Token, nil, http.StatusOK)
+			},
+		},
+		{
+			name:       "set_user_role_invalid",
+			method:     http.MethodPut,
+			path:       "/admin/users/{user:jesse}/role",
+			auth:       "access:saul",
+			body:       map[string]string{"role": "overlord"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "set_user_role_self",
+			method:     http.MethodPut,
+			path:       "/admin/users/{user:saul}/role",
+			auth:       "access:saul",
+			body:       map[string]string{"role": "user"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "set_user_role_as_moderator",
+			method:     http.MethodPut,
+			path:       "/admin/users/{user:jesse}/role",
+			auth:       "access:walt",
+			body:       map[string]string{"role": "admin"},
+			wantStatus: http.StatusForbidden,
+		},
+	})
+}
+
+func TestRelationships(t *testing.T) {
+	saulBlocksWalt := func(t *testing.T, env *testEnv) {
+		env.expect(t, http.MethodPost, "/api/users/{user:walt}/block", "access:saul", nil, http.StatusNoContent)
+	}
+
+	runCases(t, []apiCase{
+		{
+			name:       "block_user",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/block",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				// Walt no longer sees Saul's chirps, everyone else still does
+				body := env.expect(t, http.MethodGet, "/api/chirps", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "block_user_chirps_as_blocked", body)
+
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "access:walt", nil, http.StatusNotFound)
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK)
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "access:jesse", nil, http.StatusOK)
+			},
+		},
+		{
+			name:       "block_user_twice",
+			setup:      saulBlocksWalt,
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/block",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "block_self",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:saul}/block",
+			auth:       "access:saul",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "block_unknown_user",
+			method:     http.MethodPost,
+			path:       "/api/users/00000000-0000-0000-0000-000000000000/block",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "block_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:walt}/block",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "list_blocks",
+			setup:      saulBlocksWalt,
+			method:     http.MethodGet,
+			path:       "/api/users/me/blocks",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unblock_user",
+			setup:      saulBlocksWalt,
+			method:     http.MethodDelete,
+			path:       "/api/users/{user:walt}/block",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "access:walt", nil, http.StatusOK)
+			},
+		},
+		{
+			name:       "mute_user",
+			method:     http.MethodPost,
+			path:       "/api/users/{user:saul}/mute",
+			auth:       "access:walt",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				// Muting filters the list, but the chirp can still be opened
+				body := env.expect(t, http.MethodGet, "/api/chirps", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "mute_user_chirps_as_muter", body)
+
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "access:walt", nil, http.StatusOK)
+			},
+		},
+		{
+			name: "list_mutes",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/users/{user:saul}/mute", "access:walt", nil, http.StatusNoContent)
+			},
+			method:     http.MethodGet,
+			path:       "/api/users/me/mutes",
+			auth:       "access:walt",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list_chirps_invalid_token",
+			method:     http.MethodGet,
+			path:       "/api/chirps",
+			auth:       "raw:not-a-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+	})
+}
+
+// PNG upload of the given size, filled with a gradient so the resized variants aren't trivially flat
+func pngUpload(width, height int) multipartFile {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	// Encoding into memory can't fail
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	return multipartFile{field: "image", data: buf.Bytes()}
+}
+
+// Fetches one of the variant URLs in a user response and checks how it is served
+func fetchVariant(t *testing.T, env *testEnv, body []byte, field, variant string, wantWidth, wantHeight int) string {
+	t.Helper()
+
+	var user map[string]map[string]string
+	json.Unmarshal(body, &user)
+
+	url := user[field][variant]
+	if url == "" {
+		t.Fatalf("no %s %s variant in %s", field, variant, body)
+	}
+
+	resp, data := env.do(http.MethodGet, url, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: expected 200, got %d", url, resp.StatusCode)
+	}
+
+	if got := resp.Header.Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("expected image/jpeg, got %q", got)
+	}
+
+	if got := resp.Header.Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("expected a long-lived Cache-Control header, got %q", got)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Width != wantWidth || cfg.Height != wantHeight {
+		t.Errorf("expected %dx%d, got %dx%d", wantWidth, wantHeight, cfg.Width, cfg.Height)
+	}
+
+	return url
+}
+
+func TestMedia(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			// Wider than tall, the avatar is cropped to a square
+			name:       "upload_avatar",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       pngUpload(300, 200),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "upload_banner",
+			method:     http.MethodPut,
+			path:       "/api/users/me/banner",
+			auth:       "access:saul",
+			body:       pngUpload(900, 900),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "upload_avatar_too_small",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       pngUpload(50, 50),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "upload_avatar_not_an_image",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       multipartFile{field: "image", data: []byte("definitely not a png")},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "upload_avatar_missing_file",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       multipartFile{field: "photo", data: pngUpload(200, 200).data},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "upload_avatar_too_large",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       multipartFile{field: "image", data: bytes.Repeat([]byte{0}, testMaxUploadBytes+1)},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "upload_avatar_not_multipart",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			auth:       "access:saul",
+			body:       map[string]string{"image": "nope"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "upload_avatar_unauthenticated",
+			method:     http.MethodPut,
+			path:       "/api/users/me/avatar",
+			body:       pngUpload(200, 200),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "media_not_found",
+			method:     http.MethodGet,
+			path:       "/app/media/avatars/missing/large.jpg",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	t.Run("variants", func(t *testing.T) {
+		srv, s, _ := newTestServer(t, serverOptions{})
+		fx := loadFixtures(t, srv, s)
+
+		env := &testEnv{fx: fx}
+		env.do = func(method, path, auth string, body any) (*http.Response, []byte) {
+			return do(t, srv, method, fx.expand(t, path), fx.token(t, auth), body)
+		}
+
+		body := env.expect(t, http.MethodPut, "/api/users/me/avatar", "access:saul", pngUpload(300, 200), http.StatusOK)
+		first := fetchVariant(t, env, body, "avatar", "large", 400, 400)
+		fetchVariant(t, env, body, "avatar", "small", 48, 48)
+
+		body = env.expect(t, http.MethodPut, "/api/users/me/banner", "access:saul", pngUpload(900, 900), http.StatusOK)
+		fetchVariant(t, env, body, "banner", "large", 1500, 500)
+
+		// A new upload replaces the previous files
+		body = env.expect(t, http.MethodPut, "/api/users/me/avatar", "access:saul", pngUpload(200, 200), http.StatusOK)
+		second := fetchVariant(t, env, body, "avatar", "large", 400, 400)
+
+		if first == second {
+			t.Errorf("expected a new URL for the new avatar, got %s twice", first)
+		}
+
+		if resp, _ := env.do(http.MethodGet, first, "", nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected the previous avatar to be deleted, got %d", resp.StatusCode)
+		} else if cc := resp.Header.Get("Cache-Control"); cc != "" {
+			t.Errorf("a 404 must not be cached, got Cache-Control %q", cc)
+		}
+
+		// The small avatar shows up next to every chirp and on the profile
+		body = env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK)
+		assertGolden(t, fx, "upload_avatar_chirp_author", body)
+
+		body = env.expect(t, http.MethodGet, "/api/users/saulgoodman", "", nil, http.StatusOK)
+		assertGolden(t, fx, "upload_avatar_profile", body)
+	})
+}
+
+// Runs the background purge once against the test store, returning how many accounts it deleted
+func purgeAccounts(t *testing.T, env *testEnv) int {
+	t.Helper()
+
+	media, err := storage.NewLocal(t.TempDir(), api.MediaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := service.NewAccountService(env.store, service.NewMediaService(env.store, media), testDeletionGracePeriod)
+
+	n, err := accounts.PurgeDue(context.Background())
+	if err != nil {
+		t.Fatalf("PurgeDue: %v", err)
+	}
+	return n
+}
+
+func TestAccounts(t *testing.T) {
+	saulDeletesAccount := func(t *testing.T, env *testEnv) {
+		env.expect(t, http.MethodDelete, "/api/users/me", "access:saul", map[string]string{"password": "123456"}, http.StatusAccepted)
+	}
+
+	runCases(t, []apiCase{
+		{
+			name:       "delete_account",
+			method:     http.MethodDelete,
+			path:       "/api/users/me",
+			auth:       "access:saul",
+			body:       map[string]string{"password": "123456"},
+			wantStatus: http.StatusAccepted,
+			check: func(t *testing.T, env *testEnv) {
+				// Signed out everywhere, the account itself is still there until the purge
+				env.expect(t, http.MethodPost, "/api/refresh", "refresh:saul", nil, http.StatusUnauthorized)
+
+				body := env.expect(t, http.MethodGet, "/api/users/me", "access:saul", nil, http.StatusOK)
+				assertGolden(t, env.fx, "delete_account_me", body)
+
+				if n := purgeAccounts(t, env); n != 1 {
+					t.Fatalf("expected 1 purged account, got %d", n)
+				}
+
+				env.expect(t, http.MethodGet, "/api/users/saulgoodman", "", nil, http.StatusNotFound)
+				env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusNotFound)
+				env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "123456"}, http.StatusUnauthorized)
+			},
+		},
+		{
+			name:       "delete_account_wrong_password",
+			method:     http.MethodDelete,
+			path:       "/api/users/me",
+			auth:       "access:saul",
+			body:       map[string]string{"password": "654321"},
+			wantStatus: http.StatusUnauthorized,
+			check: func(t *testing.T, env *testEnv) {
+				if n := purgeAccounts(t, env); n != 0 {
+					t.Errorf("expected no purged accounts, got %d", n)
+				}
+			},
+		},
+		{
+			name:       "delete_account_missing_password",
+			method:     http.MethodDelete,
+			path:       "/api/users/me",
+			auth:       "access:saul",
+			body:       map[string]string{},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "delete_account_unauthenticated",
+			method:     http.MethodDelete,
+			path:       "/api/users/me",
+			body:       map[string]string{"password": "123456"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "login_cancels_deletion",
+			setup:      saulDeletesAccount,
+			method:     http.MethodPost,
+			path:       "/api/login",
+			body:       map[string]string{"email": "saul@bettercall.com", "password": "123456"},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				if n := purgeAccounts(t, env); n != 0 {
+					t.Errorf("expected no purged accounts, got %d", n)
+				}
+
+				env.expect(t, http.MethodGet, "/api/users/saulgoodman", "", nil, http.StatusOK)
+			},
+		},
+		{
+			// Everything pointing at the purged user goes with it
+			name: "purge_cascades",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/chirps/{chirp:walt-first}/like", "access:saul", nil, http.StatusNoContent)
+				env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/like", "access:walt", nil, http.StatusNoContent)
+				env.expect(t, http.MethodPost, "/api/users/{user:walt}/follow", "access:saul", nil, http.StatusNoContent)
+				env.expect(t, http.MethodPost, "/api/users/{user:jesse}/mute", "access:saul", nil, http.StatusNoContent)
+				env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/report", "access:jesse", map[string]string{"reason": "spam"}, http.StatusCreated)
+				fileReport("user", "walt", "/api/users/{user:jesse}/report", "harassment")(t, env)
+				env.expect(t, http.MethodPost, "/admin/reports/{report:user}/resolve", "access:saul", map[string]string{"action": "warn_user"}, http.StatusOK)
+				saulDeletesAccount(t, env)
+
+				if n := purgeAccounts(t, env); n != 1 {
+					t.Fatalf("expected 1 purged account, got %d", n)
+				}
+			},
+			method:     http.MethodGet,
+			path:       "/api/users/Heisenberg",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				body := env.expect(t, http.MethodGet, "/api/chirps", "", nil, http.StatusOK)
+				assertGolden(t, env.fx, "purge_cascades_chirps", body)
+
+				body = env.expect(t, http.MethodGet, "/admin/reports", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "purge_cascades_reports", body)
+
+				// What saul did as a moderator stays on record, without him
+				body = env.expect(t, http.MethodGet, "/admin/moderation/actions", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "purge_cascades_actions", body)
+			},
+		},
+		{
+			name:       "like_chirp",
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/like",
+			auth:       "access:walt",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				// Liking twice is not an error
+				env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/like", "access:walt", nil, http.StatusNoContent)
+			},
+		},
+		{
+			name: "like_chirp_blocked",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/users/{user:walt}/block", "access:saul", nil, http.StatusNoContent)
+			},
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/like",
+			auth:       "access:walt",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "like_unknown_chirp",
+			method:     http.MethodPost,
+			path:       "/api/chirps/00000000-0000-0000-0000-000000000000/like",
+			auth:       "access:walt",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "like_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/chirps/{chirp:saul-first}/like",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unlike_chirp",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/like", "access:walt", nil, http.StatusNoContent)
+			},
+			method:     http.MethodDelete,
+			path:       "/api/chirps/{chirp:saul-first}/like",
+			auth:       "access:walt",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "unlike_unknown_chirp",
+			method:     http.MethodDelete,
+			path:       "/api/chirps/00000000-0000-0000-0000-000000000000/like",
+			auth:       "access:walt",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	t.Run("export", func(t *testing.T) {
+		srv, s, _ := newTestServer(t, serverOptions{})
+		fx := loadFixtures(t, srv, s)
+
+		env := &testEnv{fx: fx, store: s}
+		env.do = func(method, path, auth string, body any) (*http.Response, []byte) {
+			return do(t, srv, method, fx.expand(t, path), fx.token(t, auth), body)
+		}
+
+		env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/like", "access:walt", nil, http.StatusNoContent)
+
+		resp, body := env.do(http.MethodGet, "/api/users/me/export", "access:walt", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+		}
+
+		if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+			t.Errorf("expected Content-Type application/zip, got %q", ct)
+		}
+
+		if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename="chirpy-export-Heisenberg.zip"` {
+			t.Errorf("unexpected Content-Disposition %q", cd)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("export is not a ZIP: %v", err)
+		}
+
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Tokens and password hashes never make it into the export
+			if bytes.Contains(data, []byte(fx.refreshTokens["walt"])) || bytes.Contains(data, []byte("hashed_password")) {
+				t.Errorf("%s leaks credentials: %s", f.Name, data)
+			}
+
+			assertGolden(t, fx, "export_"+strings.TrimSuffix(f.Name, ".json"), data)
+		}
+
+		if want := []string{"profile.json", "chirps.json", "likes.json", "sessions.json"}; !slices.Equal(names, want) {
+			t.Errorf("expected files %v, got %v", want, names)
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "stream_home_unauthenticated",
+			method:     http.MethodGet,
+			path:       "/api/stream?timeline=home",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "stream_unknown_timeline",
+			method:     http.MethodGet,
+			path:       "/api/stream?timeline=everyone",
+			auth:       "access:jesse",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "stream_unknown_author",
+			method:     http.MethodGet,
+			path:       "/api/stream?author=nobody",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	postChirp := func(t *testing.T, env *testEnv, auth, body string) string {
+		resp, respBody := env.do(http.MethodPost, "/api/chirps", auth, map[string]string{"body": body})
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("posting chirp: %d %s", resp.StatusCode, respBody)
+		}
+
+		var chirp api.Chirp
+		if err := json.Unmarshal(respBody, &chirp); err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID.String()
+	}
+
+	// The data of a chirp_created event, checked against the chirp it announces
+	chirpID := func(t *testing.T, e sseEvent) string {
+		t.Helper()
+
+		if e.Type != "chirp_created" {
+			t.Fatalf("expected a chirp_created event, got %+v", e)
+		}
+
+		var chirp api.Chirp
+		if err := json.Unmarshal([]byte(e.Data), &chirp); err != nil {
+			t.Fatalf("bad event data %s: %v", e.Data, err)
+		}
+		return chirp.ID.String()
+	}
+
+	t.Run("events", func(t *testing.T) {
+		srv, env := newTestEnv(t, serverOptions{})
+		events := openStream(t, srv, "/api/stream", "", "")
+
+		id := postChirp(t, env, "access:saul", "Better call #Saul")
+		env.expect(t, http.MethodPost, "/api/chirps/"+id+"/like", "access:walt", nil, http.StatusNoContent)
+		env.expect(t, http.MethodDelete, "/api/chirps/"+id+"/like", "access:walt", nil, http.StatusNoContent)
+		env.expect(t, http.MethodDelete, "/api/chirps/"+id, "access:saul", nil, http.StatusNoContent)
+
+		// Hidden by a moderator
+		_, body := env.do(http.MethodPost, "/api/chirps/{chirp:saul-first}/report", "access:jesse", map[string]string{"reason": "spam"})
+		var report api.Report
+		if err := json.Unmarshal(body, &report); err != nil {
+			t.Fatal(err)
+		}
+		env.expect(t, http.MethodPost, "/admin/reports/"+report.ID.String()+"/resolve", "access:walt", map[string]string{"action": "hide_chirp"}, http.StatusOK)
+
+		for i, want := range []string{"chirp_created", "like_count", "like_count", "chirp_deleted", "chirp_deleted"} {
+			e := events.next(t)
+			if e.Type != want {
+				t.Fatalf("expected %s, got %+v", want, e)
+			}
+			if e.ID == "" {
+				t.Errorf("%s event without an ID", e.Type)
+			}
+			assertGolden(t, env.fx, fmt.Sprintf("stream_events_%d_%s", i+1, want), []byte(e.Data))
+		}
+
+		events.heartbeat(t)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		srv, env := newTestEnv(t, serverOptions{})
+
+		env.expect(t, http.MethodPost, "/api/users/{user:walt}/follow", "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, "/api/users/{user:saul}/mute", "access:walt", nil, http.StatusNoContent)
+
+		byAuthor := openStream(t, srv, "/api/stream?author=heisenberg", "", "")
+		byTag := openStream(t, srv, "/api/stream?tag=%23Science", "", "")
+		home := openStream(t, srv, "/api/stream?timeline=home", env.fx.token(t, "access:jesse"), "")
+		muting := openStream(t, srv, "/api/stream", env.fx.token(t, "access:walt"), "")
+
+		fromSaul := postChirp(t, env, "access:saul", "Objection! #science")
+		fromWalt := postChirp(t, env, "access:walt", "Respect the chemistry")
+		fromJesse := postChirp(t, env, "access:jesse", "Yeah #SCIENCE")
+
+		cases := []struct {
+			name   string
+			stream *sseStream
+			want   []string
+		}{
+			{"author", byAuthor, []string{fromWalt}},
+			{"tag", byTag, []string{fromSaul, fromJesse}},
+			{"home", home, []string{fromWalt, fromJesse}},
+			{"muted", muting, []string{fromWalt, fromJesse}},
+		}
+
+		for _, tc := range cases {
+			for _, want := range tc.want {
+				if got := chirpID(t, tc.stream.next(t)); got != want {
+					t.Errorf("%s: expected chirp %s, got %s", tc.name, want, got)
+				}
+			}
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		srv, env := newTestEnv(t, serverOptions{})
+		first := openStream(t, srv, "/api/stream", "", "")
+
+		postChirp(t, env, "access:saul", "First")
+		last := first.next(t)
+
+		// Missed while disconnected
+		second := postChirp(t, env, "access:walt", "Second")
+		third := postChirp(t, env, "access:jesse", "Third")
+
+		resumed := openStream(t, srv, "/api/stream", "", last.ID)
+		for _, want := range []string{second, third} {
+			if got := chirpID(t, resumed.next(t)); got != want {
+				t.Errorf("expected chirp %s, got %s", want, got)
+			}
+		}
+
+		// An ID the server doesn't know about anymore
+		reset := openStream(t, srv, "/api/stream", "", uuid.NewString()).next(t)
+		if reset.Type != "reset" {
+			t.Errorf("expected a reset event, got %+v", reset)
+		}
+	})
+}
+
+func like(auth, chirp string) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		env.expect(t, http.MethodPost, "/api/chirps/{chirp:"+chirp+"}/like", auth, nil, http.StatusNoContent)
+	}
+}
+
+func follow(auth, user string) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		env.expect(t, http.MethodPost, "/api/users/{user:"+user+"}/follow", auth, nil, http.StatusNoContent)
+	}
+}
+
+func steps(fns ...func(t *testing.T, env *testEnv)) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		for _, fn := range fns {
+			fn(t, env)
+		}
+	}
+}
+
+// The decoded GET /api/notifications page of auth
+func listNotifications(t *testing.T, env *testEnv, auth, query string) api.NotificationPage {
+	t.Helper()
+
+	var page api.NotificationPage
+	body := env.expect(t, http.MethodGet, "/api/notifications"+query, auth, nil, http.StatusOK)
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestNotifications(t *testing.T) {
+	likedBySaulsFans := steps(like("access:walt", "saul-first"), like("access:jesse", "saul-first"))
+
+	runCases(t, []apiCase{
+		{
+			name:       "notifications_likes_grouped",
+			setup:      steps(likedBySaulsFans, follow("access:walt", "saul")),
+			method:     http.MethodGet,
+			path:       "/api/notifications",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "notifications_follows_grouped",
+			setup:      steps(follow("access:walt", "saul"), follow("access:jesse", "saul")),
+			method:     http.MethodGet,
+			path:       "/api/notifications",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "notifications_empty",
+			setup:      like("access:saul", "saul-first"),
+			method:     http.MethodGet,
+			path:       "/api/notifications",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "notifications_unauthenticated",
+			method:     http.MethodGet,
+			path:       "/api/notifications",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "notifications_invalid_limit",
+			method:     http.MethodGet,
+			path:       "/api/notifications?limit=101",
+			auth:       "access:saul",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "notifications_invalid_cursor",
+			method:     http.MethodGet,
+			path:       "/api/notifications?cursor=nope",
+			auth:       "access:saul",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "reply_chirp",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:jesse",
+			body:       map[string]string{"body": "Yo @saulgoodman, @Heisenberg says hi", "reply_to_id": "{chirp:saul-first}"},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, env *testEnv) {
+				// Saul gets the reply only, Walt the mention
+				body := env.expect(t, http.MethodGet, "/api/notifications", "access:saul", nil, http.StatusOK)
+				assertGolden(t, env.fx, "reply_chirp_notifications_of_author", body)
+
+				body = env.expect(t, http.MethodGet, "/api/notifications", "access:walt", nil, http.StatusOK)
+				assertGolden(t, env.fx, "reply_chirp_notifications_of_mentioned", body)
+			},
+		},
+		{
+			name: "reply_chirp_hidden_parent",
+			setup: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodPost, "/api/users/{user:walt}/block", "access:saul", nil, http.StatusNoContent)
+			},
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:walt",
+			body:       map[string]string{"body": "Better call me", "reply_to_id": "{chirp:saul-first}"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "reply_chirp_unknown_parent",
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "access:walt",
+			body:       map[string]string{"body": "Hello?", "reply_to_id": "00000000-0000-0000-0000-000000000000"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "notifications_hidden_actors",
+			setup: steps(
+				func(t *testing.T, env *testEnv) {
+					env.expect(t, http.MethodPost, "/api/users/{user:jesse}/mute", "access:saul", nil, http.StatusNoContent)
+					env.expect(t, http.MethodPost, "/api/users/{user:saul}/block", "access:walt", nil, http.StatusNoContent)
+				},
+				like("access:jesse", "saul-first"),
+				follow("access:walt", "saul"),
+			),
+			method:     http.MethodGet,
+			path:       "/api/notifications",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get_notification_preferences",
+			method:     http.MethodGet,
+			path:       "/api/notifications/preferences",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "set_notification_preferences",
+			method:     http.MethodPut,
+			path:       "/api/notifications/preferences",
+			auth:       "access:saul",
+			body:       map[string]any{"like": map[string]bool{"in_app": false}},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				likedBySaulsFans(t, env)
+				follow("access:walt", "saul")(t, env)
+
+				page := listNotifications(t, env, "access:saul", "")
+				if len(page.Notifications) != 1 || page.Notifications[0].Kind != "follow" {
+					t.Errorf("expected only the follow, got %+v", page.Notifications)
+				}
+			},
+		},
+		{
+			name:       "set_notification_preferences_invalid",
+			method:     http.MethodPut,
+			path:       "/api/notifications/preferences",
+			auth:       "access:saul",
+			body:       map[string]any{"poke": map[string]bool{"in_app": true}, "like": map[string]bool{"carrier_pigeon": true}},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "mark_notifications_read",
+			setup:      steps(likedBySaulsFans, follow("access:walt", "saul")),
+			method:     http.MethodPost,
+			path:       "/api/notifications/read",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, env *testEnv) {
+				// The group is closed once read, the next like starts a new one
+				like("access:walt", "walt-first")(t, env)
+				env.expect(t, http.MethodDelete, "/api/chirps/{chirp:saul-first}/like", "access:walt", nil, http.StatusNoContent)
+				like("access:walt", "saul-first")(t, env)
+
+				body := env.expect(t, http.MethodGet, "/api/notifications", "access:saul", nil, http.StatusOK)
+				assertGolden(t, env.fx, "mark_notifications_read_after", body)
+			},
+		},
+		{
+			name:       "mark_notifications_read_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/notifications/read",
+			wantStatus: http.StatusUnauthorized,
+		},
+	})
+
+	t.Run("mark_read_by_id", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		likedBySaulsFans(t, env)
+		follow("access:walt", "saul")(t, env)
+
+		page := listNotifications(t, env, "access:saul", "")
+		if page.UnreadCount != 2 {
+			t.Fatalf("expected 2 unread, got %d", page.UnreadCount)
+		}
+
+		// Someone else's notification is left alone
+		first := page.Notifications[0].ID
+		env.expect(t, http.MethodPost, "/api/notifications/read", "access:walt", map[string]any{"ids": []uuid.UUID{first}}, http.StatusOK)
+
+		body := env.expect(t, http.MethodPost, "/api/notifications/read", "access:saul", map[string]any{"ids": []uuid.UUID{first}}, http.StatusOK)
+		assertGolden(t, env.fx, "mark_read_by_id", body)
+
+		for _, n := range listNotifications(t, env, "access:saul", "").Notifications {
+			if n.Read != (n.ID == first) {
+				t.Errorf("notification %s: expected read to be %v", n.ID, n.ID == first)
+			}
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		// Three groups: the two likes and the follow
+		for _, body := range []string{"One", "Two"} {
+			resp := env.expect(t, http.MethodPost, "/api/chirps", "access:saul", map[string]string{"body": body}, http.StatusCreated)
+			var chirp api.Chirp
+			if err := json.Unmarshal(resp, &chirp); err != nil {
+				t.Fatal(err)
+			}
+			env.expect(t, http.MethodPost, "/api/chirps/"+chirp.ID.String()+"/like", "access:jesse", nil, http.StatusNoContent)
+		}
+		follow("access:jesse", "saul")(t, env)
+
+		var kinds []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages == 3 {
+				t.Fatal("expected the cursor to run out")
+			}
+
+			query := "?limit=2"
+			if cursor != "" {
+				query += "&cursor=" + cursor
+			}
+
+			page := listNotifications(t, env, "access:saul", query)
+			for _, n := range page.Notifications {
+				kinds = append(kinds, n.Kind)
+			}
+
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+
+		if want := []string{"follow", "like", "like"}; !slices.Equal(kinds, want) {
+			t.Errorf("expected %v, got %v", want, kinds)
+		}
+	})
+}
+
+// The outbox rows of type typ, oldest first
+func outboxEvents(t *testing.T, env *testEnv, typ string) []database.Outbox {
+	t.Helper()
+
+	rows, err := env.store.ListOutboxEvents(context.Background(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matching []database.Outbox
+	for _, row := range rows {
+		if row.Type == typ {
+			matching = append(matching, row)
+		}
+	}
+	return matching
+}
+
+// Decodes the payload of the only outbox row of type typ
+func onlyOutboxEvent[P any](t *testing.T, env *testEnv, typ string) P {
+	t.Helper()
+
+	rows := outboxEvents(t, env, typ)
+	if len(rows) != 1 {
+		t.Fatalf("expected one %s event, got %d", typ, len(rows))
+	}
+
+	var payload P
+	if err := json.Unmarshal(rows[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestEvents(t *testing.T) {
+	upgradeJesse := `{"event": "user.upgraded", "data": {"user_id": "{user:jesse}"}}`
+
+	runCases(t, []apiCase{
+		{
+			name:       "polka_upgrade",
+			method:     http.MethodPost,
+			path:       "/api/polka/webhooks",
+			auth:       "apikey:" + testPolkaKey,
+			body:       upgradeJesse,
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				user, err := env.store.GetUserByID(context.Background(), env.fx.ids["user:jesse"])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !user.IsChirpyRed {
+					t.Error("expected jesse to have Chirpy Red")
+				}
+
+				payload := onlyOutboxEvent[events.UserUpgradedPayload](t, env, events.UserUpgraded)
+				if payload.UserID != user.ID {
+					t.Errorf("expected the event to be about jesse, got %v", payload.UserID)
+				}
+			},
+		},
+		{
+			name:       "polka_upgrade_unknown_user",
+			method:     http.MethodPost,
+			path:       "/api/polka/webhooks",
+			auth:       "apikey:" + testPolkaKey,
+			body:       `{"event": "user.upgraded", "data": {"user_id": "` + uuid.NewString() + `"}}`,
+			wantStatus: http.StatusNotFound,
+			check: func(t *testing.T, env *testEnv) {
+				if rows := outboxEvents(t, env, events.UserUpgraded); len(rows) != 0 {
+					t.Errorf("expected no event for a failed upgrade, got %d", len(rows))
+				}
+			},
+		},
+		{
+			name:       "polka_other_event",
+			method:     http.MethodPost,
+			path:       "/api/polka/webhooks",
+			auth:       "apikey:" + testPolkaKey,
+			body:       `{"event": "user.payment_failed", "data": {"user_id": "{user:jesse}"}}`,
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				if rows := outboxEvents(t, env, events.UserUpgraded); len(rows) != 0 {
+					t.Errorf("expected other Polka events to be ignored, got %d upgrades", len(rows))
+				}
+			},
+		},
+		{
+			name:       "polka_wrong_key",
+			method:     http.MethodPost,
+			path:       "/api/polka/webhooks",
+			auth:       "apikey:not-the-key",
+			body:       upgradeJesse,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "polka_bearer_token",
+			method:     http.MethodPost,
+			path:       "/api/polka/webhooks",
+			auth:       "access:jesse",
+			body:       upgradeJesse,
+			wantStatus: http.StatusUnauthorized,
+		},
+	})
+
+	t.Run("recorded_with_the_change", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		// The fixtures went through signup
+		if rows := outboxEvents(t, env, events.UserRegistered); len(rows) != len(env.fx.Users) {
+			t.Errorf("expected a %s event per fixture user, got %d", events.UserRegistered, len(rows))
+		}
+
+		env.expect(t, http.MethodPost, "/api/users", "", map[string]string{"email": "gus@pollos.example", "password": "losPollos1!"}, http.StatusCreated)
+
+		var registered events.UserRegisteredPayload
+		rows := outboxEvents(t, env, events.UserRegistered)
+		if err := json.Unmarshal(rows[len(rows)-1].Payload, &registered); err != nil {
+			t.Fatal(err)
+		}
+		if registered.Handle != "gus" {
+			t.Errorf("expected the generated handle in the event, got %q", registered.Handle)
+		}
+
+		// A failed signup leaves nothing behind
+		env.expect(t, http.MethodPost, "/api/users", "", map[string]string{"email": "gus@pollos.example", "password": "losPollos1!"}, http.StatusConflict)
+		if n := len(outboxEvents(t, env, events.UserRegistered)); n != len(rows) {
+			t.Errorf("expected no event for a conflicting signup, got %d events", n)
+		}
+
+		resp := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{"body": "Yeah science!", "reply_to_id": "{chirp:walt-first}"}, http.StatusCreated)
+		var reply api.Chirp
+		if err := json.Unmarshal(resp, &reply); err != nil {
+			t.Fatal(err)
+		}
+
+		created := outboxEvents(t, env, events.ChirpCreated)
+		var payload events.ChirpCreatedPayload
+		if err := json.Unmarshal(created[len(created)-1].Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.ChirpID != reply.ID || payload.ReplyToID == nil || *payload.ReplyToID != env.fx.ids["chirp:walt-first"] {
+			t.Errorf("unexpected %s payload %+v", events.ChirpCreated, payload)
+		}
+
+		env.expect(t, http.MethodDelete, "/api/chirps/"+reply.ID.String(), "access:jesse", nil, http.StatusNoContent)
+
+		deleted := onlyOutboxEvent[events.ChirpDeletedPayload](t, env, events.ChirpDeleted)
+		if deleted.ChirpID != reply.ID || deleted.Reason != events.DeletedByAuthor {
+			t.Errorf("unexpected %s payload %+v", events.ChirpDeleted, deleted)
+		}
+	})
+
+	t.Run("hidden_by_moderator", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		reportSaulChirp(t, env)
+		env.expect(t, http.MethodPost, "/admin/reports/{report:chirp}/resolve", "access:walt", map[string]string{"action": "hide_chirp"}, http.StatusOK)
+
+		deleted := onlyOutboxEvent[events.ChirpDeletedPayload](t, env, events.ChirpDeleted)
+		if deleted.ChirpID != env.fx.ids["chirp:saul-first"] || deleted.UserID != env.fx.ids["user:saul"] || deleted.Reason != events.DeletedByModerator {
+			t.Errorf("unexpected %s payload %+v", events.ChirpDeleted, deleted)
+		}
+	})
+
+	t.Run("dispatched", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		var got []string
+		dispatcher := events.NewDispatcher(env.store, events.Options{})
+		dispatcher.Subscribe("test", func(ctx context.Context, e events.Event) error {
+			got = append(got, e.Type)
+			return nil
+		})
+
+		if _, err := dispatcher.DispatchOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{events.UserRegistered, events.UserRegistered, events.UserRegistered, events.ChirpCreated, events.ChirpCreated}
+		if !slices.Equal(got, want) {
+			t.Errorf("expected the fixture events %v in order, got %v", want, got)
+		}
+	})
+}
+
+// Registers a webhook as saul, its ID is available as {webhook:<name>}
+func registerWebhook(t *testing.T, env *testEnv, name, url string, eventTypes ...string) api.Webhook {
+	t.Helper()
+
+	body := env.expect(t, http.MethodPost, "/admin/webhooks", "access:saul", map[string]any{"url": url, "events": eventTypes}, http.StatusCreated)
+
+	var created api.Webhook
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	env.fx.ids["webhook:"+name] = created.ID
+	return created
+}
+
+func createPartnerWebhook(t *testing.T, env *testEnv) {
+	registerWebhook(t, env, "partner", "https://partner.example/chirpy", events.ChirpCreated)
+}
+
+// A partner endpoint, answering with status and keeping every request
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+
+	rec := &webhookReceiver{status: status}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, receivedWebhook{header: r.Header.Clone(), body: body})
+		w.WriteHeader(rec.status)
+		fmt.Fprintf(w, "request %d", len(rec.requests))
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func (rec *webhookReceiver) respondWith(status int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.status = status
+}
+
+func (rec *webhookReceiver) received() []receivedWebhook {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return slices.Clone(rec.requests)
+}
+
+// Runs the outbox and the webhook worker once, like the background loops would
+type webhookWorker struct {
+	dispatcher *events.Dispatcher
+	webhooks   *service.WebhookService
+}
+
+func newWebhookWorker(env *testEnv) *webhookWorker {
+	w := &webhookWorker{
+		dispatcher: events.NewDispatcher(env.store, events.Options{}),
+		webhooks:   service.NewWebhookService(env.store, testWebhookConfig),
+	}
+	w.dispatcher.Subscribe("webhooks", w.webhooks.HandleEvent)
+	return w
+}
+
+func (w *webhookWorker) run(t *testing.T) {
+	t.Helper()
+
+	if _, err := w.dispatcher.DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.webhooks.DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func webhookDelivery(t *testing.T, env *testEnv, path string) api.WebhookDelivery {
+	t.Helper()
+
+	var delivery api.WebhookDelivery
+	if err := json.Unmarshal(env.expect(t, http.MethodGet, path, "access:saul", nil, http.StatusOK), &delivery); err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestWebhooks(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "webhooks_create",
+			method:     http.MethodPost,
+			path:       "/admin/webhooks",
+			auth:       "access:saul",
+			body:       map[string]any{"url": "https://partner.example/chirpy", "description": "Partner feed", "events": []string{"chirp.deleted", "chirp.created", "chirp.deleted"}},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "webhooks_create_invalid",
+			method:     http.MethodPost,
+			path:       "/admin/webhooks",
+			auth:       "access:saul",
+			body:       map[string]any{"url": "ftp://partner.example", "events": []string{"chirp.exploded"}},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "webhooks_as_moderator",
+			method:     http.MethodGet,
+			path:       "/admin/webhooks",
+			auth:       "access:walt",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "webhooks_list",
+			setup:      createPartnerWebhook,
+			method:     http.MethodGet,
+			path:       "/admin/webhooks",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "webhooks_update",
+			setup:      createPartnerWebhook,
+			method:     http.MethodPut,
+			path:       "/admin/webhooks/{webhook:partner}",
+			auth:       "access:saul",
+			body:       map[string]any{"active": false, "events": []string{}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "webhooks_delete",
+			setup:      createPartnerWebhook,
+			method:     http.MethodDelete,
+			path:       "/admin/webhooks/{webhook:partner}",
+			auth:       "access:saul",
+			wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, env *testEnv) {
+				env.expect(t, http.MethodGet, "/admin/webhooks/{webhook:partner}", "access:saul", nil, http.StatusNotFound)
+			},
+		},
+		{
+			name:       "webhooks_deliveries_invalid_status",
+			setup:      createPartnerWebhook,
+			method:     http.MethodGet,
+			path:       "/admin/webhooks/{webhook:partner}/deliveries?status=lost",
+			auth:       "access:saul",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "webhooks_redeliver_unknown",
+			setup:      createPartnerWebhook,
+			method:     http.MethodPost,
+			path:       "/admin/webhooks/{webhook:partner}/deliveries/" + uuid.NewString() + "/redeliver",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	t.Run("delivered_signed", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		rec := newWebhookReceiver(t, http.StatusOK)
+		worker := newWebhookWorker(env)
+
+		// The fixture events happened before the webhook existed and are not sent
+		secret := registerWebhook(t, env, "partner", rec.URL, events.ChirpCreated).Secret
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{"body": "Yeah science!"}, http.StatusCreated)
+		env.expect(t, http.MethodDelete, "/api/chirps/{chirp:saul-first}", "access:saul", nil, http.StatusNoContent)
+		worker.run(t)
+
+		got := rec.received()
+		if len(got) != 1 {
+			t.Fatalf("expected only the %s event to be delivered, got %d requests", events.ChirpCreated, len(got))
+		}
+
+		if err := webhook.Verify(secret, got[0].header, got[0].body, webhook.DefaultTolerance, time.Now()); err != nil {
+			t.Errorf("expected a valid signature, got %v", err)
+		}
+
+		if h := got[0].header.Get(webhook.EventHeader); h != events.ChirpCreated {
+			t.Errorf("expected the %s header to be %s, got %q", webhook.EventHeader, events.ChirpCreated, h)
+		}
+
+		var payload struct {
+			ID   uuid.UUID                  `json:"id"`
+			Type string                     `json:"type"`
+			Data events.ChirpCreatedPayload `json:"data"`
+		}
+		if err := json.Unmarshal(got[0].body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Type != events.ChirpCreated || payload.Data.UserID != env.fx.ids["user:jesse"] {
+			t.Errorf("unexpected payload %s", got[0].body)
+		}
+
+		var deliveries []api.WebhookDelivery
+		if err := json.Unmarshal(env.expect(t, http.MethodGet, "/admin/webhooks/{webhook:partner}/deliveries", "access:saul", nil, http.StatusOK), &deliveries); err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 || deliveries[0].Status != service.WebhookSucceeded || deliveries[0].EventID != payload.ID {
+			t.Fatalf("expected one succeeded delivery of event %v, got %+v", payload.ID, deliveries)
+		}
+
+		if h := got[0].header.Get(webhook.DeliveryHeader); h != deliveries[0].ID.String() {
+			t.Errorf("expected the %s header to be the delivery ID, got %q", webhook.DeliveryHeader, h)
+		}
+
+		delivery := webhookDelivery(t, env, "/admin/webhooks/{webhook:partner}/deliveries/"+deliveries[0].ID.String())
+		if len(delivery.AttemptLog) != 1 || delivery.AttemptLog[0].ResponseBody != "request 1" {
+			t.Errorf("expected the attempt with the receiver's response in the log, got %+v", delivery.AttemptLog)
+		}
+
+		// Nothing is sent twice
+		worker.run(t)
+		if n := len(rec.received()); n != 1 {
+			t.Errorf("expected no further requests, got %d", n)
+		}
+	})
+
+	t.Run("retried_until_dead_then_redelivered", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		rec := newWebhookReceiver(t, http.StatusInternalServerError)
+		worker := newWebhookWorker(env)
+
+		registerWebhook(t, env, "partner", rec.URL)
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{"body": "Yeah science!"}, http.StatusCreated)
+
+		for range testWebhookConfig.MaxAttempts + 1 {
+			worker.run(t)
+		}
+
+		if n := len(rec.received()); n != testWebhookConfig.MaxAttempts {
+			t.Fatalf("expected %d attempts, got %d", testWebhookConfig.MaxAttempts, n)
+		}
+
+		var dead []api.WebhookDelivery
+		if err := json.Unmarshal(env.expect(t, http.MethodGet, "/admin/webhooks/{webhook:partner}/deliveries?status=dead", "access:saul", nil, http.StatusOK), &dead); err != nil {
+			t.Fatal(err)
+		}
+		if len(dead) != 1 || dead[0].LastStatusCode == nil || *dead[0].LastStatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected one dead delivery after a 500, got %+v", dead)
+		}
+
+		path := "/admin/webhooks/{webhook:partner}/deliveries/" + dead[0].ID.String()
+
+		rec.respondWith(http.StatusNoContent)
+		env.expect(t, http.MethodPost, path+"/redeliver", "access:saul", nil, http.StatusAccepted)
+		worker.run(t)
+
+		delivery := webhookDelivery(t, env, path)
+		if delivery.Status != service.WebhookSucceeded || delivery.DeliveredAt == nil {
+			t.Errorf("expected the redelivery to succeed, got %+v", delivery)
+		}
+		if len(delivery.AttemptLog) != testWebhookConfig.MaxAttempts+1 {
+			t.Errorf("expected every attempt in the log, got %d", len(delivery.AttemptLog))
+		}
+
+		got := rec.received()
+		if !bytes.Equal(got[0].body, got[len(got)-1].body) {
+			t.Error("expected the redelivery to send the same payload")
+		}
+	})
+}
+
+// Mints an API key as user, usable as "key:<name>" and {key:<name>}
+func mintAPIKey(name, user string, scopes ...string) func(t *testing.T, env *testEnv) {
+	return func(t *testing.T, env *testEnv) {
+		body := env.expect(t, http.MethodPost, "/api/keys", "access:"+user, map[string]any{"name": name, "scopes": scopes}, http.StatusCreated)
+
+		var created api.APIKey
+		if err := json.Unmarshal(body, &created); err != nil {
+			t.Fatal(err)
+		}
+		env.fx.ids["key:"+name] = created.ID
+		env.fx.apiKeys[name] = created.Key
+	}
+}
+
+var mintJesseBot = mintAPIKey("bot", "jesse", string(auth.ScopeChirpsRead), string(auth.ScopeChirpsWrite))
+
+func TestAPIKeys(t *testing.T) {
+	runCases(t, []apiCase{
+		{
+			name:       "api_keys_create",
+			method:     http.MethodPost,
+			path:       "/api/keys",
+			auth:       "access:jesse",
+			body:       map[string]any{"name": "  cook bot ", "scopes": []string{"chirps:write", "chirps:read", "chirps:write"}},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "api_keys_create_invalid",
+			method:     http.MethodPost,
+			path:       "/api/keys",
+			auth:       "access:jesse",
+			body:       map[string]any{"scopes": []string{"chirps:delete"}, "expires_at": "2001-01-01T00:00:00Z"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "api_keys_create_unauthenticated",
+			method:     http.MethodPost,
+			path:       "/api/keys",
+			body:       map[string]any{"name": "bot", "scopes": []string{"chirps:read"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "api_keys_list",
+			setup:      mintJesseBot,
+			method:     http.MethodGet,
+			path:       "/api/keys",
+			auth:       "access:jesse",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "api_keys_post_chirp",
+			setup:      mintJesseBot,
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "key:bot",
+			body:       map[string]string{"body": "Posted by a bot"},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, env *testEnv) {
+				var keys []api.APIKey
+				if err := json.Unmarshal(env.expect(t, http.MethodGet, "/api/keys", "access:jesse", nil, http.StatusOK), &keys); err != nil {
+					t.Fatal(err)
+				}
+				if len(keys) != 1 || keys[0].LastUsedAt == nil {
+					t.Errorf("expected the use to be recorded, got %+v", keys)
+				}
+			},
+		},
+		{
+			name:       "api_keys_missing_scope",
+			setup:      mintAPIKey("reader", "jesse", string(auth.ScopeChirpsRead)),
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			auth:       "key:reader",
+			body:       map[string]string{"body": "Not allowed"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "api_keys_optional_auth_route",
+			setup:      mintAPIKey("inbox", "jesse", string(auth.ScopeNotificationsRead)),
+			method:     http.MethodGet,
+			path:       "/api/chirps",
+			auth:       "key:inbox",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "api_keys_cannot_mint_keys",
+			setup:      mintJesseBot,
+			method:     http.MethodPost,
+			path:       "/api/keys",
+			auth:       "key:bot",
+			body:       map[string]any{"name": "another", "scopes": []string{"chirps:read"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "api_keys_admin_route",
+			setup:      mintAPIKey("ops", "saul", string(auth.ScopeUsersRead)),
+			method:     http.MethodGet,
+			path:       "/admin/metrics",
+			auth:       "key:ops",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "api_keys_revoked",
+			setup: func(t *testing.T, env *testEnv) {
+				mintJesseBot(t, env)
+				env.expect(t, http.MethodDelete, "/api/keys/{key:bot}", "access:jesse", nil, http.StatusNoContent)
+			},
+			method:     http.MethodGet,
+			path:       "/api/chirps",
+			auth:       "key:bot",
+			wantStatus: http.StatusUnauthorized,
+			check: func(t *testing.T, env *testEnv) {
+				// Still listed, with the revocation time
+				var keys []api.APIKey
+				if err := json.Unmarshal(env.expect(t, http.MethodGet, "/api/keys", "access:jesse", nil, http.StatusOK), &keys); err != nil {
+					t.Fatal(err)
+				}
+				if len(keys) != 1 || keys[0].RevokedAt == nil {
+					t.Errorf("expected the revoked key in the list, got %+v", keys)
+				}
+			},
+		},
+		{
+			name:       "api_keys_revoke_someone_elses",
+			setup:      mintJesseBot,
+			method:     http.MethodDelete,
+			path:       "/api/keys/{key:bot}",
+			auth:       "access:saul",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		key, prefix, err := auth.MakeAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = env.store.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+			UserID:    env.fx.ids["user:jesse"],
+			Name:      "old bot",
+			Prefix:    prefix,
+			KeyHash:   auth.HashAPIKey(key),
+			Scopes:    []string{string(auth.ScopeChirpsRead)},
+			ExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env.expect(t, http.MethodGet, "/api/chirps", "raw:"+key, nil, http.StatusUnauthorized)
+	})
+
+	t.Run("account_deletion_scheduled", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		mintAPIKey("profile", "jesse", string(auth.ScopeUsersRead))(t, env)
+
+		env.expect(t, http.MethodGet, "/api/users/me", "key:profile", nil, http.StatusOK)
+		env.expect(t, http.MethodDelete, "/api/users/me", "access:jesse", map[string]string{"password": "yeahscience"}, http.StatusAccepted)
+		env.expect(t, http.MethodGet, "/api/users/me", "key:profile", nil, http.StatusForbidden)
+	})
+}
+
+const oauthRedirectURI = "https://cookbook.example/callback"
+
+// Registers an app owned by saul, fx.ids["client:<name>"] holds its id
+func registerOAuthClient(t *testing.T, env *testEnv, name string, public bool) api.OAuthClient {
+	t.Helper()
+
+	body := env.expect(t, http.MethodPost, "/api/oauth/clients", "access:saul", map[string]any{
+		"name":          name,
+		"redirect_uris": []string{oauthRedirectURI, "http://127.0.0.1:8765/callback"},
+		"public":        public,
+	}, http.StatusCreated)
+
+	var created api.OAuthClient
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	env.fx.ids["client:"+name] = created.ClientID
+	return created
+}
+
+func registerCookbook(t *testing.T, env *testEnv) {
+	registerOAuthClient(t, env, "cookbook", false)
+}
+
+func registerOAuthPublic(t *testing.T, env *testEnv) {
+	registerOAuthClient(t, env, "mobile", true)
+}
+
+// Has jesse approve the client for scope and returns the authorization code
+func authorizeOAuth(t *testing.T, env *testEnv, client api.OAuthClient, scope, verifier string) string {
+	t.Helper()
+
+	body := env.expect(t, http.MethodPost, "/api/oauth/authorize", "access:jesse", map[string]any{
+		"response_type":         "code",
+		"client_id":             client.ClientID.String(),
+		"redirect_uri":          oauthRedirectURI,
+		"scope":                 scope,
+		"state":                 "xyz",
+		"code_challenge":        auth.PKCEChallenge(verifier),
+		"code_challenge_method": "S256",
+		"approve":               true,
+	}, http.StatusOK)
+
+	var approved struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	if err := json.Unmarshal(body, &approved); err != nil {
+		t.Fatal(err)
+	}
+
+	redirect, err := url.Parse(approved.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(approved.RedirectTo, oauthRedirectURI+"?") || redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+		t.Fatalf("unexpected redirect %q", approved.RedirectTo)
+	}
+	return redirect.Query().Get("code")
+}
+
+// Posts form to the token endpoint with the client's credentials in the form
+func oauthTokenRequest(t *testing.T, env *testEnv, client api.OAuthClient, form url.Values, wantStatus int) (api.OAuthToken, []byte) {
+	t.Helper()
+
+	form.Set("client_id", client.ClientID.String())
+	if client.ClientSecret != "" {
+		form.Set("client_secret", client.ClientSecret)
+	}
+
+	body := env.expect(t, http.MethodPost, "/api/oauth/token", "", form, wantStatus)
+
+	var token api.OAuthToken
+	if wantStatus == http.StatusOK {
+		if err := json.Unmarshal(body, &token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return token, body
+}
+
+func exchangeOAuthCode(t *testing.T, env *testEnv, client api.OAuthClient, code, verifier string) api.OAuthToken {
+	t.Helper()
+
+	token, _ := oauthTokenRequest(t, env, client, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	}, http.StatusOK)
+	return token
+}
+
+// A valid RFC 7636 code_verifier
+var oauthVerifier = strings.Repeat("heisenberg-", 5)
+
+func oauthErrorCode(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var decoded struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("not an OAuth error: %s", body)
+	}
+	return decoded.Error
+}
+
+func TestOAuth(t *testing.T) {
+	consentQuery := "response_type=code&client_id={client:cookbook}&scope=chirps:read+users:read&state=xyz&code_challenge=" + auth.PKCEChallenge(oauthVerifier)
+
+	runCases(t, []apiCase{
+		{
+			name:       "oauth_clients_create",
+			method:     http.MethodPost,
+			path:       "/api/oauth/clients",
+			auth:       "access:jesse",
+			body:       map[string]any{"name": " Cook Book ", "redirect_uris": []string{oauthRedirectURI, "http://localhost:8080/cb", oauthRedirectURI}},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "oauth_clients_create_public",
+			method:     http.MethodPost,
+			path:       "/api/oauth/clients",
+			auth:       "access:jesse",
+			body:       map[string]any{"name": "Cook Book Mobile", "redirect_uris": []string{"http://127.0.0.1:8765/callback"}, "public": true},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "oauth_clients_create_invalid",
+			method:     http.MethodPost,
+			path:       "/api/oauth/clients",
+			auth:       "access:jesse",
+			body:       map[string]any{"redirect_uris": []string{"http://cookbook.example/callback", "https://cookbook.example/callback#top", "/callback"}},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "oauth_clients_list",
+			setup:      registerCookbook,
+			method:     http.MethodGet,
+			path:       "/api/oauth/clients",
+			auth:       "access:saul",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "oauth_clients_delete_someone_elses",
+			setup:      registerCookbook,
+			method:     http.MethodDelete,
+			path:       "/api/oauth/clients/{client:cookbook}",
+			auth:       "access:jesse",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "oauth_consent",
+			setup:      registerCookbook,
+			method:     http.MethodGet,
+			path:       "/api/oauth/authorize?" + consentQuery + "&code_challenge_method=S256&redirect_uri=" + url.QueryEscape(oauthRedirectURI),
+			auth:       "access:jesse",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "oauth_consent_unregistered_redirect_uri",
+			setup:      registerCookbook,
+			method:     http.MethodGet,
+			path:       "/api/oauth/authorize?" + consentQuery + "&code_challenge_method=S256&redirect_uri=" + url.QueryEscape("https://evil.example/callback"),
+			auth:       "access:jesse",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "oauth_consent_plain_pkce",
+			setup:      registerCookbook,
+			method:     http.MethodGet,
+			path:       "/api/oauth/authorize?" + consentQuery + "&code_challenge_method=plain&redirect_uri=" + url.QueryEscape(oauthRedirectURI),
+			auth:       "access:jesse",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "oauth_consent_unauthenticated",
+			setup:      registerCookbook,
+			method:     http.MethodGet,
+			path:       "/api/oauth/authorize?" + consentQuery + "&code_challenge_method=S256",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "oauth_authorize_denied",
+			setup:  registerCookbook,
+			method: http.MethodPost,
+			path:   "/api/oauth/authorize",
+			auth:   "access:jesse",
+			body: map[string]string{
+				"response_type":         "code",
+				"client_id":             "{client:cookbook}",
+				"redirect_uri":          oauthRedirectURI,
+				"scope":                 "chirps:read",
+				"state":                 "xyz",
+				"code_challenge":        auth.PKCEChallenge(oauthVerifier),
+				"code_challenge_method": "S256",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "oauth_token_wrong_secret",
+			setup:      registerCookbook,
+			method:     http.MethodPost,
+			path:       "/api/oauth/token",
+			body:       url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"abc"}, "client_id": {"{client:cookbook}"}, "client_secret": {"wrong"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "oauth_token_json_body",
+			setup:      registerCookbook,
+			method:     http.MethodPost,
+			path:       "/api/oauth/token",
+			body:       map[string]string{"grant_type": "refresh_token", "client_id": "{client:cookbook}"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "oauth_token_unsupported_grant",
+			setup:      registerOAuthPublic,
+			method:     http.MethodPost,
+			path:       "/api/oauth/token",
+			body:       url.Values{"grant_type": {"password"}, "username": {"jesse@pinkman.com"}, "password": {"yeahscience"}, "client_id": {"{client:mobile}"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	})
+
+	t.Run("authorization_code", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "cookbook", false)
+
+		// A wrong verifier burns the code
+		code := authorizeOAuth(t, env, client, "chirps:read", oauthVerifier)
+		_, body := oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {strings.Repeat("saul-goodman-", 4)},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_grant" {
+			t.Errorf("expected invalid_grant for a wrong verifier, got %s", body)
+		}
+		oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {oauthVerifier},
+		}, http.StatusBadRequest)
+
+		code = authorizeOAuth(t, env, client, "chirps:read", oauthVerifier)
+
+		// Another client can't use the code, nor burn it
+		other := registerOAuthClient(t, env, "pantry", false)
+		_, body = oauthTokenRequest(t, env, other, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {oauthVerifier},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_grant" {
+			t.Errorf("expected invalid_grant for another client's code, got %s", body)
+		}
+
+		resp, body := env.do(http.MethodPost, "/api/oauth/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {oauthVerifier},
+			"client_id":     {client.ClientID.String()},
+			"client_secret": {client.ClientSecret},
+		})
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("expected a 200 that is not cached, got %d %q: %s", resp.StatusCode, resp.Header.Get("Cache-Control"), body)
+		}
+		assertGolden(t, env.fx, "oauth_token", body)
+
+		var token api.OAuthToken
+		if err := json.Unmarshal(body, &token); err != nil {
+			t.Fatal(err)
+		}
+
+		// Single use
+		_, body = oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {oauthVerifier},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_grant" {
+			t.Errorf("expected a used code to be rejected, got %s", body)
+		}
+
+		// The token acts for jesse within the granted scope only
+		env.expect(t, http.MethodGet, "/api/chirps", "raw:"+token.AccessToken, nil, http.StatusOK)
+		assertGolden(t, env.fx, "oauth_token_missing_scope",
+			env.expect(t, http.MethodPost, "/api/chirps", "raw:"+token.AccessToken, map[string]string{"body": "Posted by an app"}, http.StatusForbidden))
+		assertGolden(t, env.fx, "oauth_token_unscoped_route",
+			env.expect(t, http.MethodPost, "/api/oauth/clients", "raw:"+token.AccessToken, map[string]any{"name": "sneaky", "redirect_uris": []string{oauthRedirectURI}}, http.StatusForbidden))
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "cookbook", false)
+		token := exchangeOAuthCode(t, env, client, authorizeOAuth(t, env, client, "chirps:read chirps:write", oauthVerifier), oauthVerifier)
+
+		refreshed, _ := oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+			"scope":         {"chirps:read"},
+		}, http.StatusOK)
+
+		if refreshed.Scope != "chirps:read" || refreshed.RefreshToken == token.RefreshToken {
+			t.Errorf("expected a narrowed access token and a new refresh token, got %+v", refreshed)
+		}
+		env.expect(t, http.MethodPost, "/api/chirps", "raw:"+refreshed.AccessToken, map[string]string{"body": "Not allowed"}, http.StatusForbidden)
+
+		// Rotated, the old one stopped working
+		_, body := oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_grant" {
+			t.Errorf("expected the rotated token to be rejected, got %s", body)
+		}
+
+		// The new refresh token still carries the whole grant, but no more
+		_, body = oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshed.RefreshToken},
+			"scope":         {"chirps:read users:write"},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_scope" {
+			t.Errorf("expected a wider scope to be rejected, got %s", body)
+		}
+
+		again, _ := oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshed.RefreshToken},
+		}, http.StatusOK)
+		if again.Scope != "chirps:read chirps:write" {
+			t.Errorf("expected the whole grant back, got %q", again.Scope)
+		}
+		env.expect(t, http.MethodPost, "/api/chirps", "raw:"+again.AccessToken, map[string]string{"body": "Posted by an app"}, http.StatusCreated)
+
+		// App refresh tokens don't turn into sessions, and sessions aren't app tokens
+		env.expect(t, http.MethodPost, "/api/refresh", "raw:"+again.RefreshToken, nil, http.StatusUnauthorized)
+		_, body = oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {env.fx.refreshTokens["jesse"]},
+		}, http.StatusBadRequest)
+		if oauthErrorCode(t, body) != "invalid_grant" {
+			t.Errorf("expected a session refresh token to be rejected, got %s", body)
+		}
+
+		// Nor can another app use them
+		other := registerOAuthClient(t, env, "other", false)
+		oauthTokenRequest(t, env, other, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {again.RefreshToken},
+		}, http.StatusBadRequest)
+		oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {again.RefreshToken},
+		}, http.StatusOK)
+	})
+
+	t.Run("public_client", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "mobile", true)
+
+		if client.ClientSecret != "" || !client.Public {
+			t.Fatalf("expected a public client without a secret, got %+v", client)
+		}
+
+		token := exchangeOAuthCode(t, env, client, authorizeOAuth(t, env, client, "users:read", oauthVerifier), oauthVerifier)
+		env.expect(t, http.MethodGet, "/api/users/me", "raw:"+token.AccessToken, nil, http.StatusOK)
+
+		// Introspection is for confidential clients
+		_, body := env.do(http.MethodPost, "/api/oauth/introspect", "", url.Values{
+			"client_id": {client.ClientID.String()},
+			"token":     {token.AccessToken},
+		})
+		if oauthErrorCode(t, body) != "unauthorized_client" {
+			t.Errorf("expected unauthorized_client, got %s", body)
+		}
+
+		// A public client has no secret to send
+		spoofed := client
+		spoofed.ClientSecret = "guess"
+		oauthTokenRequest(t, env, spoofed, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+		}, http.StatusUnauthorized)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "cookbook", false)
+		other := registerOAuthClient(t, env, "other", false)
+		token := exchangeOAuthCode(t, env, client, authorizeOAuth(t, env, client, "chirps:read", oauthVerifier), oauthVerifier)
+
+		revoke := func(c api.OAuthClient, tok string) (*http.Response, []byte) {
+			return env.do(http.MethodPost, "/api/oauth/revoke", "", url.Values{
+				"client_id":     {c.ClientID.String()},
+				"client_secret": {c.ClientSecret},
+				"token":         {tok},
+			})
+		}
+
+		// Another client's revocation is silently ignored
+		if resp, body := revoke(other, token.RefreshToken); resp.StatusCode != http.StatusOK || len(body) != 0 {
+			t.Errorf("expected an empty 200, got %d: %s", resp.StatusCode, body)
+		}
+
+		if resp, body := revoke(client, "not-a-token"); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected an unknown token to be a 200, got %d: %s", resp.StatusCode, body)
+		}
+
+		if resp, body := revoke(client, token.AccessToken); resp.StatusCode != http.StatusBadRequest || oauthErrorCode(t, body) != "unsupported_token_type" {
+			t.Errorf("expected access tokens to be unsupported, got %d: %s", resp.StatusCode, body)
+		}
+
+		if resp, body := revoke(client, token.RefreshToken); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the revocation to succeed, got %d: %s", resp.StatusCode, body)
+		}
+
+		oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+		}, http.StatusBadRequest)
+	})
+
+	t.Run("introspect", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "cookbook", false)
+		other := registerOAuthClient(t, env, "other", false)
+		token := exchangeOAuthCode(t, env, client, authorizeOAuth(t, env, client, "chirps:read users:read", oauthVerifier), oauthVerifier)
+
+		// HTTP Basic, the credentials form-encoded first
+		basic := "raw:Basic " + base64.StdEncoding.EncodeToString([]byte(url.QueryEscape(client.ClientID.String())+":"+url.QueryEscape(client.ClientSecret)))
+		introspect := func(auth string, form url.Values) []byte {
+			return env.expect(t, http.MethodPost, "/api/oauth/introspect", auth, form, http.StatusOK)
+		}
+
+		assertGolden(t, env.fx, "oauth_introspect_access_token", introspect(basic, url.Values{"token": {token.AccessToken}}))
+		assertGolden(t, env.fx, "oauth_introspect_refresh_token", introspect(basic, url.Values{"token": {token.RefreshToken}}))
+
+		inactive := []url.Values{
+			{"token": {"not-a-token"}},
+			{"token": {env.fx.accessTokens["jesse"]}},
+			{"token": {env.fx.refreshTokens["jesse"]}},
+		}
+		for _, form := range inactive {
+			if body := introspect(basic, form); string(body) != `{"active":false}` {
+				t.Errorf("expected %v to be inactive, got %s", form, body)
+			}
+		}
+
+		// Another client can't see the tokens either
+		body := introspect("", url.Values{"client_id": {other.ClientID.String()}, "client_secret": {other.ClientSecret}, "token": {token.AccessToken}})
+		if string(body) != `{"active":false}` {
+			t.Errorf("expected another client's token to be inactive, got %s", body)
+		}
+
+		resp, body := env.do(http.MethodPost, "/api/oauth/introspect", "raw:Basic "+base64.StdEncoding.EncodeToString([]byte(client.ClientID.String()+":wrong")), url.Values{"token": {token.AccessToken}})
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" || oauthErrorCode(t, body) != "invalid_client" {
+			t.Errorf("expected a Basic challenge, got %d %v: %s", resp.StatusCode, resp.Header, body)
+		}
+	})
+
+	t.Run("delete_client", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+		client := registerOAuthClient(t, env, "cookbook", false)
+		token := exchangeOAuthCode(t, env, client, authorizeOAuth(t, env, client, "chirps:read", oauthVerifier), oauthVerifier)
+
+		env.expect(t, http.MethodDelete, "/api/oauth/clients/{client:cookbook}", "access:saul", nil, http.StatusNoContent)
+
+		if _, err := env.store.GetUserFromRefreshToken(context.Background(), token.RefreshToken); err == nil {
+			t.Error("expected the client's refresh tokens to go with it")
+		}
+
+		oauthTokenRequest(t, env, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+		}, http.StatusUnauthorized)
+	})
+}
+
+// A server with the oidctest provider configured as "test"
+func newOIDCEnv(t *testing.T) (*oidctest.Server, *testEnv) {
+	t.Helper()
+
+	provider := oidctest.NewServer("chirpy", "chirpy-secret")
+	t.Cleanup(provider.Close)
+
+	_, env := newTestEnv(t, serverOptions{oidc: provider})
+	return provider, env
+}
+
+// Starts a sign-in, has user sign in at the provider and returns its code and state
+func startOIDCLogin(t *testing.T, env *testEnv, provider *oidctest.Server, user oidctest.User) (string, string) {
+	t.Helper()
+	return authorizeOIDC(t, env, provider, user, "/api/login/oidc/test", "")
+}
+
+// Starts linking the provider to the account auth is logged in to, the rest is like a sign-in
+func startOIDCLink(t *testing.T, env *testEnv, provider *oidctest.Server, user oidctest.User, auth string) (string, string) {
+	t.Helper()
+	return authorizeOIDC(t, env, provider, user, "/api/users/me/identities/test", auth)
+}
+
+func authorizeOIDC(t *testing.T, env *testEnv, provider *oidctest.Server, user oidctest.User, path, auth string) (string, string) {
+	t.Helper()
+
+	var started struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	if err := json.Unmarshal(env.expect(t, http.MethodPost, path, auth, nil, http.StatusOK), &started); err != nil {
+		t.Fatal(err)
+	}
+
+	redirect, err := provider.Login(started.AuthorizationURL, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(redirect, testOIDCRedirectURL+"?") {
+		t.Fatalf("expected the provider to redirect to %s, got %s", testOIDCRedirectURL, redirect)
+	}
+
+	return u.Query().Get("code"), u.Query().Get("state")
+}
+
+// Runs a whole sign-in and returns the callback's response
+func oidcLogin(t *testing.T, env *testEnv, provider *oidctest.Server, user oidctest.User, wantStatus int) []byte {
+	t.Helper()
+
+	code, state := startOIDCLogin(t, env, provider, user)
+	return env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": code, "state": state}, wantStatus)
+}
+
+func TestOIDC(t *testing.T) {
+
+	gus := oidctest.User{Subject: "gus-1", Email: "gus@lospolloshermanos.com", EmailVerified: true, Name: "Gustavo Fring"}
+
+	t.Run("providers", func(t *testing.T) {
+		_, env := newOIDCEnv(t)
+
+		assertGolden(t, env.fx, "oidc_providers", env.expect(t, http.MethodGet, "/api/login/oidc", "", nil, http.StatusOK))
+		env.expect(t, http.MethodPost, "/api/login/oidc/nope", "", nil, http.StatusNotFound)
+		env.expect(t, http.MethodPost, "/api/login/oidc/nope/callback", "", map[string]string{"code": "c", "state": "s"}, http.StatusNotFound)
+
+		// Without providers the list is empty
+		_, plain := newTestEnv(t, serverOptions{})
+		if body := plain.expect(t, http.MethodGet, "/api/login/oidc", "", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected no providers, got %s", body)
+		}
+	})
+
+	t.Run("new_user", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		body := oidcLogin(t, env, provider, gus, http.StatusOK)
+		assertGolden(t, env.fx, "oidc_login_new_user", body)
+
+		var session struct {
+			ID    uuid.UUID `json:"id"`
+			Token string    `json:"token"`
+		}
+		if err := json.Unmarshal(body, &session); err != nil {
+			t.Fatal(err)
+		}
+
+		env.expect(t, http.MethodGet, "/api/users/me", "raw:"+session.Token, nil, http.StatusOK)
+
+		// The account has no password until one is set
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": gus.Email, "password": ""}, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": gus.Email, "password": "pollos"}, http.StatusUnauthorized)
+
+		// The subject finds the user again, even after the email changed at the provider
+		moved := gus
+		moved.Email = "gus@madrigal.com"
+		if err := json.Unmarshal(oidcLogin(t, env, provider, moved, http.StatusOK), &session); err != nil {
+			t.Fatal(err)
+		}
+
+		env.fx.ids["user:gus"] = session.ID
+		assertGolden(t, env.fx, "oidc_identities", env.expect(t, http.MethodGet, "/api/users/me/identities", "raw:"+session.Token, nil, http.StatusOK))
+	})
+
+	t.Run("link_by_verified_email", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		var session struct {
+			ID uuid.UUID `json:"id"`
+		}
+
+		// Nobody proved owning the email when jesse's account was registered, so a provider
+		// account with that email can't sign in to it
+		jesse := oidctest.User{Subject: "jesse-1", Email: "jesse@breakingbad.com", EmailVerified: true}
+		assertGolden(t, env.fx, "oidc_login_unverified_account", oidcLogin(t, env, provider, jesse, http.StatusConflict))
+
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": jesse.Email, "password": "yeahscience"}, http.StatusOK)
+		env.expect(t, http.MethodPost, "/api/refresh", "refresh:jesse", nil, http.StatusOK)
+
+		// Linked from jesse's session it signs in to his account from then on, and proves his email
+		code, state := startOIDCLink(t, env, provider, jesse, "access:jesse")
+		assertGolden(t, env.fx, "oidc_link",
+			env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:jesse", map[string]string{"code": code, "state": state}, http.StatusCreated))
+
+		if err := json.Unmarshal(oidcLogin(t, env, provider, jesse, http.StatusOK), &session); err != nil {
+			t.Fatal(err)
+		}
+		if session.ID != env.fx.ids["user:jesse"] {
+			t.Errorf("expected jesse's account to be linked, got user %v", session.ID)
+		}
+
+		// With the email proven, another account at a provider that verified it links on sign-in
+		env.expect(t, http.MethodDelete, "/api/users/me/identities/test", "access:jesse", nil, http.StatusNoContent)
+		other := oidctest.User{Subject: "jesse-2", Email: "jesse@breakingbad.com", EmailVerified: true}
+		oidcLogin(t, env, provider, other, http.StatusOK)
+
+		// A second account at the same provider can't be linked to jesse as well
+		code, state = startOIDCLink(t, env, provider, jesse, "access:jesse")
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:jesse", map[string]string{"code": code, "state": state}, http.StatusConflict)
+
+		// An email the provider hasn't verified links nothing
+		walt := oidctest.User{Subject: "walt-1", Email: "walt@breakingbad.com"}
+		assertGolden(t, env.fx, "oidc_login_unverified_email", oidcLogin(t, env, provider, walt, http.StatusForbidden))
+
+		if body := env.expect(t, http.MethodGet, "/api/users/me/identities", "access:walt", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected walt to have no identities, got %s", body)
+		}
+	})
+
+	t.Run("link_from_session", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		heisenberg := oidctest.User{Subject: "walt-1", Email: "heisenberg@example.com"}
+
+		// Only the user who started the link can finish it, and not as a sign-in
+		code, state := startOIDCLink(t, env, provider, heisenberg, "access:walt")
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:saul", map[string]string{"code": code, "state": state}, http.StatusUnauthorized)
+
+		code, state = startOIDCLink(t, env, provider, heisenberg, "access:walt")
+		env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": code, "state": state}, http.StatusUnauthorized)
+
+		_, state = startOIDCLogin(t, env, provider, heisenberg)
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:walt", map[string]string{"code": "any", "state": state}, http.StatusUnauthorized)
+
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test", "", nil, http.StatusUnauthorized)
+		env.expect(t, http.MethodPost, "/api/users/me/identities/nope", "access:walt", nil, http.StatusNotFound)
+
+		// Logged in on both sides, an email that doesn't match or wasn't verified is fine
+		code, state = startOIDCLink(t, env, provider, heisenberg, "access:walt")
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:walt", map[string]string{"code": code, "state": state}, http.StatusCreated)
+
+		var session struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal(oidcLogin(t, env, provider, heisenberg, http.StatusOK), &session); err != nil {
+			t.Fatal(err)
+		}
+		if session.ID != env.fx.ids["user:walt"] {
+			t.Errorf("expected walt's account, got user %v", session.ID)
+		}
+
+		// The provider account is walt's now, nobody else can link it
+		code, state = startOIDCLink(t, env, provider, heisenberg, "access:jesse")
+		env.expect(t, http.MethodPost, "/api/users/me/identities/test/callback", "access:jesse", map[string]string{"code": code, "state": state}, http.StatusConflict)
+	})
+
+	t.Run("link_account_with_proven_email", func(t *testing.T) {
+		provider := oidctest.NewServer("chirpy", "chirpy-secret")
+		t.Cleanup(provider.Close)
+
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{oidc: provider, mail: mailer})
+
+		// A magic link proves saul owns the address, so his password and sessions stay
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": "saul@bettercall.com"}, http.StatusAccepted)
+		mailer.wait(t, 1)
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": magicLinkToken(t, mailer, "saul@bettercall.com")}, http.StatusOK)
+
+		saul := oidctest.User{Subject: "saul-1", Email: "saul@bettercall.com", EmailVerified: true}
+		oidcLogin(t, env, provider, saul, http.StatusOK)
+
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": saul.Email, "password": "123456"}, http.StatusOK)
+		env.expect(t, http.MethodPost, "/api/refresh", "refresh:saul", nil, http.StatusOK)
+
+		// A new email has to be proven again
+		env.expect(t, http.MethodPut, "/api/users", "access:saul", map[string]string{"email": "jimmy@mcgill.com"}, http.StatusOK)
+		env.expect(t, http.MethodPut, "/api/users", "access:saul", map[string]string{"email": "saul@bettercall.com"}, http.StatusOK)
+
+		// so another account at the provider can't sign in to it, and the account stays as it is
+		other := oidctest.User{Subject: "saul-2", Email: "saul@bettercall.com", EmailVerified: true}
+		oidcLogin(t, env, provider, other, http.StatusConflict)
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": saul.Email, "password": "123456"}, http.StatusOK)
+	})
+
+	t.Run("state_and_token_checks", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{}, http.StatusUnprocessableEntity)
+
+		// A state is single use
+		code, state := startOIDCLogin(t, env, provider, gus)
+		env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": code, "state": state}, http.StatusOK)
+		assertGolden(t, env.fx, "oidc_login_replayed_state",
+			env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": code, "state": state}, http.StatusUnauthorized))
+
+		// A code the provider doesn't know
+		_, state = startOIDCLogin(t, env, provider, gus)
+		env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": "made-up", "state": state}, http.StatusUnauthorized)
+
+		// An ID token that fails verification
+		provider.TamperClaims(func(claims jwt.MapClaims) { claims["nonce"] = "replayed" })
+		assertGolden(t, env.fx, "oidc_login_bad_id_token", oidcLogin(t, env, provider, gus, http.StatusUnauthorized))
+		provider.TamperClaims(nil)
+
+		// A provider that is down
+		_, state = startOIDCLogin(t, env, provider, gus)
+		provider.Close()
+		env.expect(t, http.MethodPost, "/api/login/oidc/test/callback", "", map[string]string{"code": "any", "state": state}, http.StatusBadGateway)
+	})
+
+	t.Run("unlink", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		var session struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(oidcLogin(t, env, provider, gus, http.StatusOK), &session); err != nil {
+			t.Fatal(err)
+		}
+		auth := "raw:" + session.Token
+
+		// The only way in can't go before a password is set
+		assertGolden(t, env.fx, "oidc_unlink_only_identity", env.expect(t, http.MethodDelete, "/api/users/me/identities/test", auth, nil, http.StatusConflict))
+		env.expect(t, http.MethodDelete, "/api/users/me/identities/other", auth, nil, http.StatusNotFound)
+
+		env.expect(t, http.MethodPut, "/api/users", auth, map[string]string{"password": "los-pollos"}, http.StatusOK)
+		env.expect(t, http.MethodDelete, "/api/users/me/identities/test", auth, nil, http.StatusNoContent)
+
+		if body := env.expect(t, http.MethodGet, "/api/users/me/identities", auth, nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected no identities left, got %s", body)
+		}
+
+		env.expect(t, http.MethodPost, "/api/login", "", map[string]string{"email": gus.Email, "password": "los-pollos"}, http.StatusOK)
+
+		// Signing in with the provider again links it again
+		env.expect(t, http.MethodDelete, "/api/users/me/identities/test", "access:jesse", nil, http.StatusNotFound)
+		oidcLogin(t, env, provider, gus, http.StatusOK)
+	})
+
+	t.Run("delete_account", func(t *testing.T) {
+		provider, env := newOIDCEnv(t)
+
+		var session struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(oidcLogin(t, env, provider, gus, http.StatusOK), &session); err != nil {
+			t.Fatal(err)
+		}
+		auth := "raw:" + session.Token
+
+		// Without a password the refresh token of the login stands in for it
+		env.expect(t, http.MethodDelete, "/api/users/me", auth, map[string]string{"password": "pollos"}, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodDelete, "/api/users/me", auth, map[string]string{"refresh_token": "made-up"}, http.StatusUnauthorized)
+		env.expect(t, http.MethodDelete, "/api/users/me", auth, map[string]string{"refresh_token": env.fx.refreshTokens["saul"]}, http.StatusUnauthorized)
+
+		env.expect(t, http.MethodDelete, "/api/users/me", auth, map[string]string{"refresh_token": session.RefreshToken}, http.StatusAccepted)
+		env.expect(t, http.MethodPost, "/api/refresh", "raw:"+session.RefreshToken, nil, http.StatusUnauthorized)
+
+		if n := purgeAccounts(t, env); n != 1 {
+			t.Errorf("expected 1 purged account, got %d", n)
+		}
+	})
+}
+
+// The token of the newest login link emailed to the address
+func magicLinkToken(t *testing.T, mailer *testMailer, to string) string {
+	t.Helper()
+
+	msgs := mailer.messages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].To != to {
+			continue
+		}
+
+		raw := regexp.MustCompile(regexp.QuoteMeta(testMagicLinkURL) + `\?\S+`).FindString(msgs[i].Body)
+		link, err := url.Parse(raw)
+		if err != nil || raw == "" {
+			t.Fatalf("no login link in the email to %s:\n%s", to, msgs[i].Body)
+		}
+		return link.Query().Get("token")
+	}
+
+	t.Fatalf("no email sent to %s", to)
+	return ""
+}
+
+func TestMagicLink(t *testing.T) {
+
+	const jesse = "jesse@breakingbad.com"
+
+	t.Run("login", func(t *testing.T) {
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{mail: mailer})
+
+		assertGolden(t, env.fx, "magic_link_requested", env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted))
+		mailer.wait(t, 1)
+
+		token := magicLinkToken(t, mailer, jesse)
+		assertGolden(t, env.fx, "magic_link_login", env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": token}, http.StatusOK))
+
+		// A link works once
+		assertGolden(t, env.fx, "magic_link_used",
+			env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": token}, http.StatusUnauthorized))
+
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{}, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": "made-up"}, http.StatusUnauthorized)
+	})
+
+	t.Run("newer_link_replaces_older", func(t *testing.T) {
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{mail: mailer})
+
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted)
+		mailer.wait(t, 1)
+		older := magicLinkToken(t, mailer, jesse)
+
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted)
+		mailer.wait(t, 2)
+		newer := magicLinkToken(t, mailer, jesse)
+
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": older}, http.StatusUnauthorized)
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": newer}, http.StatusOK)
+	})
+
+	t.Run("no_enumeration_and_rate_limit", func(t *testing.T) {
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{mail: mailer})
+
+		// Unknown addresses get the same answer and no email
+		unknown := env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": "gus@lospolloshermanos.com"}, http.StatusAccepted)
+		assertGolden(t, env.fx, "magic_link_requested", unknown)
+
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": "not an email"}, http.StatusUnprocessableEntity)
+
+		// Past the limit the request is still accepted, but nothing goes out
+		for range 6 {
+			env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted)
+		}
+
+		// Requests are handled in order, once walt's email is out the others were handled too
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": "walt@breakingbad.com"}, http.StatusAccepted)
+		sent := mailer.wait(t, 6)
+
+		toJesse := 0
+		for _, msg := range sent {
+			switch msg.To {
+			case jesse:
+				toJesse++
+			case "gus@lospolloshermanos.com":
+				t.Errorf("expected no email for an unknown address, got %v", msg)
+			}
+		}
+		if toJesse != 5 || sent[len(sent)-1].To != "walt@breakingbad.com" {
+			t.Errorf("expected 5 emails to jesse within the limit, then walt's, got %v", sent)
+		}
+
+		// The last link sent still works
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": magicLinkToken(t, mailer, jesse)}, http.StatusOK)
+	})
+
+	// One client asking for links to many addresses runs out before it can fill the queue
+	t.Run("rate_limit_per_client", func(t *testing.T) {
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{mail: mailer})
+
+		for i := range 19 {
+			env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": fmt.Sprintf("gus%d@lospolloshermanos.com", i)}, http.StatusAccepted)
+		}
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": "walt@breakingbad.com"}, http.StatusAccepted)
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted)
+
+		// The limit is applied as the request comes in, jesse's was dropped before it was queued
+		recent, err := env.store.CountRecentMagicLinkRequests(context.Background(), database.CountRecentMagicLinkRequestsParams{
+			Email:         jesse,
+			Ip:            "127.0.0.1",
+			WindowSeconds: 3600,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recent.ByEmail != 0 || recent.ByIp != 20 {
+			t.Errorf("expected 20 requests from the client and none for jesse, got %+v", recent)
+		}
+
+		if sent := mailer.wait(t, 1); sent[0].To != "walt@breakingbad.com" {
+			t.Errorf("expected only walt's email, got %v", sent)
+		}
+	})
+
+	// A link doesn't get around a suspension
+	t.Run("suspended", func(t *testing.T) {
+		mailer := &testMailer{}
+		_, env := newTestEnv(t, serverOptions{mail: mailer})
+
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusAccepted)
+		mailer.wait(t, 1)
+		if err := env.store.SuspendUser(context.Background(), env.fx.ids["user:jesse"]); err != nil {
+			t.Fatal(err)
+		}
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": magicLinkToken(t, mailer, jesse)}, http.StatusForbidden)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		env.expect(t, http.MethodPost, "/api/login/magic", "", map[string]string{"email": jesse}, http.StatusNotFound)
+		env.expect(t, http.MethodPost, "/api/login/magic/verify", "", map[string]string{"token": "any"}, http.StatusNotFound)
+	})
+}
+
+// Runs the scheduler once against the test store, returning how many chirps it published
+func publishScheduled(t *testing.T, env *testEnv) int {
+	t.Helper()
+
+	moderator, err := moderation.NewModerator(
+		moderation.WordList([]string{"kerfuffle", "sharbert", "fornax"}, moderation.ActionMask, "config"),
+		service.NewModerationRuleSource(env.store),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := moderator.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	chirps := service.NewChirpService(env.store, 140, moderator, service.NewNotificationService(env.store, service.NewInAppChannel(env.store)))
+
+	n, err := chirps.PublishDue(context.Background(), env.api.PublishChirp)
+	if err != nil {
+		t.Fatalf("PublishDue: %v", err)
+	}
+	return n
+}
+
+// Queues a chirp that is already due, the API only takes publish times in the future
+func scheduleDue(t *testing.T, env *testEnv, author, body string, replyTo uuid.NullUUID) {
+	t.Helper()
+
+	_, err := env.store.CreateScheduledChirp(context.Background(), database.CreateScheduledChirpParams{
+		UserID:    env.fx.ids["user:"+author],
+		Body:      body,
+		ReplyToID: replyTo,
+		PublishAt: time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduledChirps(t *testing.T) {
+
+	inAnHour := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+
+	t.Run("schedule_and_cancel", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		body := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":        "Yeah science, tomorrow",
+			"reply_to_id": "{chirp:walt-first}",
+			"publish_at":  inAnHour,
+		}, http.StatusAccepted)
+		assertGolden(t, env.fx, "scheduled_chirp_created", body)
+
+		var scheduled struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal(body, &scheduled); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nobody sees it before it is published, not even its author
+		for _, viewer := range []string{"", "access:jesse"} {
+			if body := env.expect(t, http.MethodGet, "/api/chirps", viewer, nil, http.StatusOK); strings.Contains(string(body), "tomorrow") {
+				t.Errorf("scheduled chirp listed for %q: %s", viewer, body)
+			}
+		}
+		env.expect(t, http.MethodGet, "/api/chirps/"+scheduled.ID.String(), "access:jesse", nil, http.StatusNotFound)
+
+		assertGolden(t, env.fx, "scheduled_chirps_list", env.expect(t, http.MethodGet, "/api/users/me/scheduled", "access:jesse", nil, http.StatusOK))
+
+		if body := env.expect(t, http.MethodGet, "/api/users/me/scheduled", "access:walt", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected walt to have no scheduled chirps, got %s", body)
+		}
+
+		// Only the author can cancel it
+		env.expect(t, http.MethodDelete, "/api/users/me/scheduled/"+scheduled.ID.String(), "access:walt", nil, http.StatusNotFound)
+		env.expect(t, http.MethodDelete, "/api/users/me/scheduled/"+scheduled.ID.String(), "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodDelete, "/api/users/me/scheduled/"+scheduled.ID.String(), "access:jesse", nil, http.StatusNotFound)
+
+		if body := env.expect(t, http.MethodGet, "/api/users/me/scheduled", "access:jesse", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected no scheduled chirps left, got %s", body)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		assertGolden(t, env.fx, "scheduled_chirp_in_the_past", env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":       "Too late",
+			"publish_at": time.Now().UTC().Add(-time.Minute).Format(time.RFC3339),
+		}, http.StatusUnprocessableEntity))
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":       "Too early",
+			"publish_at": time.Now().UTC().AddDate(2, 0, 0).Format(time.RFC3339),
+		}, http.StatusUnprocessableEntity)
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":       strings.Repeat("a", 141),
+			"publish_at": inAnHour,
+		}, http.StatusUnprocessableEntity)
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":        "To nowhere",
+			"reply_to_id": uuid.NewString(),
+			"publish_at":  inAnHour,
+		}, http.StatusUnprocessableEntity)
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{
+			"body":       "Not a time",
+			"publish_at": "tomorrow",
+		}, http.StatusBadRequest)
+	})
+
+	t.Run("publish_due", func(t *testing.T) {
+		srv, env := newTestEnv(t, serverOptions{})
+		events := openStream(t, srv, "/api/stream", "", "")
+
+		scheduleDue(t, env, "jesse", "Right on time, kerfuffle", uuid.NullUUID{UUID: env.fx.ids["chirp:saul-first"], Valid: true})
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]string{"body": "Later", "publish_at": inAnHour}, http.StatusAccepted)
+
+		if n := publishScheduled(t, env); n != 1 {
+			t.Fatalf("expected 1 published chirp, got %d", n)
+		}
+
+		// Published like any chirp: moderated, listed and the parent's author notified
+		body := env.expect(t, http.MethodGet, "/api/chirps", "", nil, http.StatusOK)
+		if !strings.Contains(string(body), "Right on time, ****") {
+			t.Errorf("expected the published chirp in the list, got %s", body)
+		}
+
+		if body := env.expect(t, http.MethodGet, "/api/notifications", "access:saul", nil, http.StatusOK); !strings.Contains(string(body), `"reply"`) {
+			t.Errorf("expected saul to be notified of the reply, got %s", body)
+		}
+
+		if e := events.next(t); e.Type != "chirp_created" || !strings.Contains(e.Data, "Right on time, ****") {
+			t.Errorf("expected the published chirp on the stream, got %+v", e)
+		}
+
+		// Only the one still waiting is left, and nothing is published twice
+		body = env.expect(t, http.MethodGet, "/api/users/me/scheduled", "access:jesse", nil, http.StatusOK)
+		if strings.Contains(string(body), "Right on time") || !strings.Contains(string(body), "Later") {
+			t.Errorf("expected only the later chirp to be queued, got %s", body)
+		}
+
+		if n := publishScheduled(t, env); n != 0 {
+			t.Errorf("expected nothing left to publish, got %d", n)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		// The chirp it answers is gone by publish time
+		scheduleDue(t, env, "jesse", "Anyone there?", uuid.NullUUID{UUID: uuid.New(), Valid: true})
+
+		// A rule added since it was queued rejects it
+		env.expect(t, http.MethodPost, "/admin/moderation/rules", "access:saul", map[string]string{"kind": "word", "pattern": "blue", "action": "reject"}, http.StatusCreated)
+		scheduleDue(t, env, "jesse", "Blue sky", uuid.NullUUID{})
+
+		// Suspended authors keep theirs queued
+		scheduleDue(t, env, "walt", "Say my name, again", uuid.NullUUID{})
+		if err := env.store.SuspendUser(context.Background(), env.fx.ids["user:walt"]); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := publishScheduled(t, env); n != 0 {
+			t.Fatalf("expected nothing published, got %d", n)
+		}
+
+		assertGolden(t, env.fx, "scheduled_chirps_failed", env.expect(t, http.MethodGet, "/api/users/me/scheduled", "access:jesse", nil, http.StatusOK))
+
+		waiting, err := env.store.ListScheduledChirps(context.Background(), env.fx.ids["user:walt"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(waiting) != 1 || waiting[0].Failure.Valid {
+			t.Errorf("expected walt's chirp to wait for the suspension to end, got %+v", waiting)
+		}
+	})
+}
+
+func TestDrafts(t *testing.T) {
+	_, env := newTestEnv(t, serverOptions{})
+
+	body := env.expect(t, http.MethodPost, "/api/drafts", "access:jesse", map[string]string{"body": "Yo, Mr. White"}, http.StatusCreated)
+	assertGolden(t, env.fx, "draft_created", body)
+
+	var draft struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.Unmarshal(body, &draft); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/drafts/" + draft.ID.String()
+
+	env.expect(t, http.MethodPost, "/api/drafts", "access:jesse", map[string]string{"body": " "}, http.StatusUnprocessableEntity)
+	env.expect(t, http.MethodPost, "/api/drafts", "access:jesse", map[string]string{"body": strings.Repeat("a", 141)}, http.StatusUnprocessableEntity)
+	env.expect(t, http.MethodPost, "/api/drafts", "", map[string]string{"body": "Anonymous"}, http.StatusUnauthorized)
+
+	env.expect(t, http.MethodPut, path, "access:jesse", map[string]string{"body": "Yo, Mr. White!"}, http.StatusOK)
+	assertGolden(t, env.fx, "drafts_list", env.expect(t, http.MethodGet, "/api/drafts", "access:jesse", nil, http.StatusOK))
+
+	// Drafts are private, even to admins
+	env.expect(t, http.MethodGet, path, "access:saul", nil, http.StatusNotFound)
+	env.expect(t, http.MethodPut, path, "access:saul", map[string]string{"body": "Better call Saul"}, http.StatusNotFound)
+	env.expect(t, http.MethodDelete, path, "access:saul", nil, http.StatusNotFound)
+
+	if body := env.expect(t, http.MethodGet, "/api/drafts", "access:saul", nil, http.StatusOK); string(body) != "[]" {
+		t.Errorf("expected saul to have no drafts, got %s", body)
+	}
+
+	// They never show up as chirps
+	if body := env.expect(t, http.MethodGet, "/api/chirps", "access:jesse", nil, http.StatusOK); strings.Contains(string(body), "Mr. White") {
+		t.Errorf("draft listed as a chirp: %s", body)
+	}
+
+	env.expect(t, http.MethodDelete, path, "access:jesse", nil, http.StatusNoContent)
+	env.expect(t, http.MethodGet, path, "access:jesse", nil, http.StatusNotFound)
+}
+
+// Posts a chirp with a poll as jesse and returns the chirp ID and the option IDs, in order
+func createPoll(t *testing.T, env *testEnv, options []string, multipleChoice bool) (string, []string) {
+	t.Helper()
+
+	body := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]any{
+		"body": "Which one?",
+		"poll": map[string]any{
+			"options":         options,
+			"closes_at":       time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339),
+			"multiple_choice": multipleChoice,
+		},
+	}, http.StatusCreated)
+
+	var chirp struct {
+		ID   string `json:"id"`
+		Poll struct {
+			Options []struct {
+				ID string `json:"id"`
+			} `json:"options"`
+		} `json:"poll"`
+	}
+	if err := json.Unmarshal(body, &chirp); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, o := range chirp.Poll.Options {
+		ids = append(ids, o.ID)
+	}
+	return chirp.ID, ids
+}
+
+func TestPolls(t *testing.T) {
+
+	tomorrow := time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339)
+
+	vote := func(optionIDs ...string) map[string]any {
+		return map[string]any{"option_ids": optionIDs}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		body := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]any{
+			"body": "Best cook in town?",
+			"poll": map[string]any{
+				"options":   []string{"Heisenberg", "Cap'n Cook"},
+				"closes_at": tomorrow,
+			},
+		}, http.StatusCreated)
+		assertGolden(t, env.fx, "poll_chirp_created", body)
+
+		// Chirps without a poll don't get an empty one
+		if body := env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK); strings.Contains(string(body), "poll") {
+			t.Errorf("expected no poll, got %s", body)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		poll := func(closesAt string, options ...string) map[string]any {
+			return map[string]any{
+				"body": "Pick one",
+				"poll": map[string]any{"options": options, "closes_at": closesAt},
+			}
+		}
+
+		assertGolden(t, env.fx, "poll_invalid_options", env.expect(t, http.MethodPost, "/api/chirps", "access:jesse",
+			poll(tomorrow, "Blue", " ", "blue", strings.Repeat("a", 26)), http.StatusUnprocessableEntity))
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", poll(tomorrow, "Alone"), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", poll(tomorrow, "a", "b", "c", "d", "e"), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", poll(time.Now().UTC().Add(-time.Minute).Format(time.RFC3339), "a", "b"), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", poll(time.Now().UTC().AddDate(0, 0, 8).Format(time.RFC3339), "a", "b"), http.StatusUnprocessableEntity)
+
+		scheduled := poll(tomorrow, "a", "b")
+		scheduled["publish_at"] = tomorrow
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", scheduled, http.StatusUnprocessableEntity)
+
+		// Nothing was stored along the way
+		if body := env.expect(t, http.MethodGet, "/api/chirps", "", nil, http.StatusOK); strings.Contains(string(body), "Pick one") {
+			t.Errorf("invalid poll created a chirp: %s", body)
+		}
+	})
+
+	t.Run("moderated_options", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		env.expect(t, http.MethodPost, "/admin/moderation/rules", "access:saul", map[string]string{"kind": "word", "pattern": "blue", "action": "reject"}, http.StatusCreated)
+
+		env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]any{
+			"body": "Pick one",
+			"poll": map[string]any{"options": []string{"Blue", "Glass"}, "closes_at": tomorrow},
+		}, http.StatusUnprocessableEntity)
+
+		body := env.expect(t, http.MethodPost, "/api/chirps", "access:jesse", map[string]any{
+			"body": "Pick one",
+			"poll": map[string]any{"options": []string{"Kerfuffle", "Glass"}, "closes_at": tomorrow},
+		}, http.StatusCreated)
+
+		if !strings.Contains(string(body), `"text":"****"`) {
+			t.Errorf("expected the option to be masked, got %s", body)
+		}
+	})
+
+	t.Run("vote", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		chirpID, options := createPoll(t, env, []string{"Yeah", "Science"}, false)
+		path := "/api/chirps/" + chirpID
+
+		// The results stay hidden until the viewer voted
+		if body := env.expect(t, http.MethodGet, path, "access:saul", nil, http.StatusOK); strings.Contains(string(body), "votes") {
+			t.Errorf("expected hidden tallies before voting, got %s", body)
+		}
+
+		env.expect(t, http.MethodPost, path+"/vote", "access:saul", vote(options[0], options[1]), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, path+"/vote", "access:saul", vote(uuid.NewString()), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, path+"/vote", "access:saul", vote(), http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, path+"/vote", "", vote(options[0]), http.StatusUnauthorized)
+
+		assertGolden(t, env.fx, "poll_voted", env.expect(t, http.MethodPost, path+"/vote", "access:saul", vote(options[0]), http.StatusOK))
+		env.expect(t, http.MethodPost, path+"/vote", "access:saul", vote(options[1]), http.StatusConflict)
+
+		// The vote response counts everyone's votes, not just the one it added
+		if body := env.expect(t, http.MethodPost, path+"/vote", "access:walt", vote(options[0]), http.StatusOK); !strings.Contains(string(body), `"voters":2`) {
+			t.Errorf("expected live tallies in the vote response, got %s", body)
+		}
+
+		// Live tallies in every chirp response of a voter, still hidden for everyone else
+		assertGolden(t, env.fx, "poll_chirp_after_votes", env.expect(t, http.MethodGet, path, "access:walt", nil, http.StatusOK))
+
+		if body := env.expect(t, http.MethodGet, "/api/chirps", "access:saul", nil, http.StatusOK); !strings.Contains(string(body), `"voters":2`) {
+			t.Errorf("expected the tallies in the list, got %s", body)
+		}
+
+		for _, viewer := range []string{"", "access:jesse"} {
+			if body := env.expect(t, http.MethodGet, path, viewer, nil, http.StatusOK); strings.Contains(string(body), "votes") {
+				t.Errorf("expected hidden tallies for %q, got %s", viewer, body)
+			}
+		}
+
+		env.expect(t, http.MethodPost, "/api/chirps/{chirp:walt-first}/vote", "access:saul", vote(options[0]), http.StatusNotFound)
+	})
+
+	t.Run("multiple_choice", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		chirpID, options := createPoll(t, env, []string{"Walt", "Jesse", "Saul"}, true)
+		path := "/api/chirps/" + chirpID + "/vote"
+
+		env.expect(t, http.MethodPost, path, "access:saul", vote(options[0], options[0]), http.StatusUnprocessableEntity)
+
+		body := env.expect(t, http.MethodPost, path, "access:saul", vote(options[0], options[2]), http.StatusOK)
+
+		var poll struct {
+			Voters  int64 `json:"voters"`
+			Options []struct {
+				Votes int64 `json:"votes"`
+			} `json:"options"`
+			Voted []string `json:"voted"`
+		}
+		if err := json.Unmarshal(body, &poll); err != nil {
+			t.Fatal(err)
+		}
+
+		if poll.Voters != 1 || poll.Options[0].Votes != 1 || poll.Options[1].Votes != 0 || poll.Options[2].Votes != 1 || len(poll.Voted) != 2 {
+			t.Errorf("unexpected tallies: %s", body)
+		}
+
+		env.expect(t, http.MethodPost, path, "access:saul", vote(options[1]), http.StatusConflict)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		ctx := context.Background()
+		chirpID := env.fx.ids["chirp:saul-first"]
+
+		// Polls can't be created closed through the API
+		if err := env.store.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirpID, ClosesAt: time.Now().UTC().Add(-time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		for i, text := range []string{"Yes", "No"} {
+			if err := env.store.CreatePollOption(ctx, database.CreatePollOptionParams{ChirpID: chirpID, Position: int32(i), Text: text}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Everyone sees the results once it closed
+		body := env.expect(t, http.MethodGet, "/api/chirps/{chirp:saul-first}", "", nil, http.StatusOK)
+		assertGolden(t, env.fx, "poll_closed", body)
+
+		var chirp struct {
+			Poll struct {
+				Options []struct {
+					ID string `json:"id"`
+				} `json:"options"`
+			} `json:"poll"`
+		}
+		if err := json.Unmarshal(body, &chirp); err != nil {
+			t.Fatal(err)
+		}
+
+		env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/vote", "access:jesse", vote(chirp.Poll.Options[0].ID), http.StatusConflict)
+
+		// The insert checks the closing time itself, for votes that raced the poll closing
+		added, err := env.store.CreatePollVoter(ctx, database.CreatePollVoterParams{ChirpID: chirpID, UserID: env.fx.ids["user:jesse"]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != 0 {
+			t.Errorf("expected no voter on a closed poll, got %d", added)
+		}
+	})
+
+	t.Run("deleted_with_the_chirp", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		chirpID, options := createPoll(t, env, []string{"Yeah", "Science"}, false)
+		env.expect(t, http.MethodPost, "/api/chirps/"+chirpID+"/vote", "access:saul", vote(options[0]), http.StatusOK)
+		env.expect(t, http.MethodDelete, "/api/chirps/"+chirpID, "access:jesse", nil, http.StatusNoContent)
+
+		rows, err := env.store.GetPolls(context.Background(), database.GetPollsParams{ChirpIds: []uuid.UUID{uuid.MustParse(chirpID)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 0 {
+			t.Errorf("expected the poll to go with its chirp, got %v", rows)
+		}
+	})
+}
+
+func TestBookmarks(t *testing.T) {
+	_, env := newTestEnv(t, serverOptions{})
+
+	env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/bookmark", "access:jesse", nil, http.StatusNoContent)
+	env.expect(t, http.MethodPost, "/api/chirps/{chirp:walt-first}/bookmark", "access:jesse", nil, http.StatusNoContent)
+	// Idempotent
+	env.expect(t, http.MethodPost, "/api/chirps/{chirp:walt-first}/bookmark", "access:jesse", nil, http.StatusNoContent)
+
+	env.expect(t, http.MethodPost, "/api/chirps/"+uuid.NewString()+"/bookmark", "access:jesse", nil, http.StatusNotFound)
+	env.expect(t, http.MethodPost, "/api/chirps/{chirp:saul-first}/bookmark", "", nil, http.StatusUnauthorized)
+
+	assertGolden(t, env.fx, "bookmarks_list", env.expect(t, http.MethodGet, "/api/bookmarks", "access:jesse", nil, http.StatusOK))
+
+	// Paged and filtered like GET /api/chirps, by when the chirps were bookmarked
+	if ids := walkChirpPages(t, env, "/api/bookmarks", "access:jesse", 1); !slices.Equal(ids, []string{env.fx.ids["chirp:walt-first"].String(), env.fx.ids["chirp:saul-first"].String()}) {
+		t.Errorf("expected the last bookmarked first, got %v", ids)
+	}
+	if ids := walkChirpPages(t, env, "/api/bookmarks?author_id={user:saul}", "access:jesse", 5); !slices.Equal(ids, []string{env.fx.ids["chirp:saul-first"].String()}) {
+		t.Errorf("expected only saul's chirp, got %v", ids)
+	}
+	env.expect(t, http.MethodGet, "/api/bookmarks?limit=0", "access:jesse", nil, http.StatusUnprocessableEntity)
+
+	// Private to whoever bookmarked them
+	if body := env.expect(t, http.MethodGet, "/api/bookmarks", "access:saul", nil, http.StatusOK); string(body) != "[]" {
+		t.Errorf("expected saul to have no bookmarks, got %s", body)
+	}
+
+	// A chirp whose author blocked the user drops out, and comes back once unblocked
+	env.expect(t, http.MethodPost, "/api/users/{user:jesse}/block", "access:walt", nil, http.StatusNoContent)
+	if body := env.expect(t, http.MethodGet, "/api/bookmarks", "access:jesse", nil, http.StatusOK); strings.Contains(string(body), "Say my name") {
+		t.Errorf("expected the blocked author's chirp to drop out, got %s", body)
+	}
+	env.expect(t, http.MethodDelete, "/api/users/{user:jesse}/block", "access:walt", nil, http.StatusNoContent)
+
+	env.expect(t, http.MethodDelete, "/api/chirps/{chirp:walt-first}/bookmark", "access:jesse", nil, http.StatusNoContent)
+	env.expect(t, http.MethodDelete, "/api/chirps/{chirp:walt-first}/bookmark", "access:jesse", nil, http.StatusNoContent)
+
+	// Deleting the chirp takes the bookmark along
+	env.expect(t, http.MethodDelete, "/api/chirps/{chirp:saul-first}", "access:saul", nil, http.StatusNoContent)
+	if body := env.expect(t, http.MethodGet, "/api/bookmarks", "access:jesse", nil, http.StatusOK); string(body) != "[]" {
+		t.Errorf("expected no bookmarks left, got %s", body)
+	}
+}
+
+func TestLists(t *testing.T) {
+
+	// Creates a list as jesse and returns its path
+	createList := func(t *testing.T, env *testEnv, name string, public bool) string {
+		t.Helper()
+
+		body := env.expect(t, http.MethodPost, "/api/lists", "access:jesse", map[string]any{"name": name, "public": public}, http.StatusCreated)
+
+		var list struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			t.Fatal(err)
+		}
+		return "/api/lists/" + list.ID.String()
+	}
+
+	t.Run("manage", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		assertGolden(t, env.fx, "list_created", env.expect(t, http.MethodPost, "/api/lists", "access:jesse", map[string]any{"name": "Lawyers", "public": true}, http.StatusCreated))
+
+		env.expect(t, http.MethodPost, "/api/lists", "access:jesse", map[string]any{"name": "Lawyers"}, http.StatusConflict)
+		env.expect(t, http.MethodPost, "/api/lists", "access:jesse", map[string]any{"name": " "}, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/lists", "access:jesse", map[string]any{"name": strings.Repeat("a", 26)}, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodPost, "/api/lists", "", map[string]any{"name": "Anonymous"}, http.StatusUnauthorized)
+
+		path := createList(t, env, "Cooks", false)
+		env.expect(t, http.MethodPut, path, "access:jesse", map[string]any{"name": "Lawyers"}, http.StatusConflict)
+		env.expect(t, http.MethodPut, path, "access:jesse", map[string]any{"name": "Chemists", "public": false}, http.StatusOK)
+
+		assertGolden(t, env.fx, "lists_owned", env.expect(t, http.MethodGet, "/api/lists", "access:jesse", nil, http.StatusOK))
+
+		// Private lists don't exist for anyone else
+		env.expect(t, http.MethodGet, path, "access:saul", nil, http.StatusNotFound)
+		env.expect(t, http.MethodGet, path, "", nil, http.StatusNotFound)
+		env.expect(t, http.MethodDelete, path, "access:saul", nil, http.StatusNotFound)
+		env.expect(t, http.MethodGet, path, "access:jesse", nil, http.StatusOK)
+
+		// Public ones can be read, only the owner changes them
+		env.expect(t, http.MethodPut, path, "access:jesse", map[string]any{"name": "Chemists", "public": true}, http.StatusOK)
+		env.expect(t, http.MethodGet, path, "", nil, http.StatusOK)
+		env.expect(t, http.MethodPut, path, "access:saul", map[string]any{"name": "Mine now", "public": true}, http.StatusForbidden)
+		env.expect(t, http.MethodPost, path+"/members/{user:saul}", "access:saul", nil, http.StatusForbidden)
+
+		env.expect(t, http.MethodDelete, path, "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodGet, path, "access:jesse", nil, http.StatusNotFound)
+	})
+
+	t.Run("members_and_timeline", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		path := createList(t, env, "Lawyers", true)
+
+		env.expect(t, http.MethodPost, path+"/members/{user:saul}", "access:jesse", nil, http.StatusNoContent)
+		// Idempotent
+		env.expect(t, http.MethodPost, path+"/members/{user:saul}", "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, path+"/members/"+uuid.NewString(), "access:jesse", nil, http.StatusNotFound)
+
+		assertGolden(t, env.fx, "list_members", env.expect(t, http.MethodGet, path+"/members", "", nil, http.StatusOK))
+
+		// Only the members' chirps, with the same shape as GET /api/chirps
+		assertGolden(t, env.fx, "list_timeline", env.expect(t, http.MethodGet, path+"/chirps", "", nil, http.StatusOK))
+
+		// And the same filters and paging
+		env.expect(t, http.MethodPost, path+"/members/{user:walt}", "access:jesse", nil, http.StatusNoContent)
+		if ids := walkChirpPages(t, env, path+"/chirps", "", 1); !slices.Equal(ids, []string{env.fx.ids["chirp:walt-first"].String(), env.fx.ids["chirp:saul-first"].String()}) {
+			t.Errorf("expected both members' chirps newest first, got %v", ids)
+		}
+		if ids := walkChirpPages(t, env, path+"/chirps?author_id={user:saul}", "", 5); !slices.Equal(ids, []string{env.fx.ids["chirp:saul-first"].String()}) {
+			t.Errorf("expected only saul's chirp, got %v", ids)
+		}
+		env.expect(t, http.MethodGet, path+"/chirps?before=last", "", nil, http.StatusUnprocessableEntity)
+		env.expect(t, http.MethodDelete, path+"/members/{user:walt}", "access:jesse", nil, http.StatusNoContent)
+
+		// Filtered for the viewer like the chirp list
+		env.expect(t, http.MethodPost, "/api/users/{user:saul}/mute", "access:walt", nil, http.StatusNoContent)
+		if body := env.expect(t, http.MethodGet, path+"/chirps", "access:walt", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected muted members to be left out, got %s", body)
+		}
+
+		env.expect(t, http.MethodDelete, path+"/members/{user:saul}", "access:jesse", nil, http.StatusNoContent)
+		if body := env.expect(t, http.MethodGet, path+"/chirps", "", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected an empty timeline, got %s", body)
+		}
+
+		// A private list's timeline is as missing as the list
+		env.expect(t, http.MethodPut, path, "access:jesse", map[string]any{"name": "Lawyers", "public": false}, http.StatusOK)
+		env.expect(t, http.MethodGet, path+"/chirps", "access:saul", nil, http.StatusNotFound)
+		env.expect(t, http.MethodGet, path+"/members", "access:saul", nil, http.StatusNotFound)
+		env.expect(t, http.MethodGet, path+"/chirps", "access:jesse", nil, http.StatusOK)
+	})
+	t.Run("blocked_members", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		path := createList(t, env, "Lawyers", true)
+
+		// A block either way keeps someone off the list
+		env.expect(t, http.MethodPost, "/api/users/{user:jesse}/block", "access:saul", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, path+"/members/{user:saul}", "access:jesse", nil, http.StatusForbidden)
+
+		env.expect(t, http.MethodPost, "/api/users/{user:walt}/block", "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, path+"/members/{user:walt}", "access:jesse", nil, http.StatusForbidden)
+
+		if body := env.expect(t, http.MethodGet, path+"/members", "", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected no members, got %s", body)
+		}
+	})
+
+	t.Run("block_after_add", func(t *testing.T) {
+		_, env := newTestEnv(t, serverOptions{})
+
+		path := createList(t, env, "Lawyers", true)
+		env.expect(t, http.MethodPost, path+"/members/{user:saul}", "access:jesse", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, path+"/members/{user:walt}", "access:jesse", nil, http.StatusNoContent)
+
+		// Whoever blocks, the member goes off the list and their chirps out of its timeline
+		env.expect(t, http.MethodPost, "/api/users/{user:jesse}/block", "access:saul", nil, http.StatusNoContent)
+		env.expect(t, http.MethodPost, "/api/users/{user:walt}/block", "access:jesse", nil, http.StatusNoContent)
+
+		if body := env.expect(t, http.MethodGet, path+"/members", "", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected blocked members to be removed, got %s", body)
+		}
+		if body := env.expect(t, http.MethodGet, path+"/chirps", "access:jesse", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected an empty timeline, got %s", body)
+		}
+
+		// Unblocking doesn't put them back
+		env.expect(t, http.MethodDelete, "/api/users/{user:walt}/block", "access:jesse", nil, http.StatusNoContent)
+		if body := env.expect(t, http.MethodGet, path+"/members", "", nil, http.StatusOK); string(body) != "[]" {
+			t.Errorf("expected no members after unblocking, got %s", body)
+		}
+	})
+}
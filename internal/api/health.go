@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// How long the readiness probe waits on the database before giving up
+const readinessTimeout = 2 * time.Second
+
+type readinessResponse struct {
+	Status string `json:"status"`
+	// Each check is "ok" or "unavailable", the cause only goes to the log
+	Database   string                 `json:"database"`
+	Schema     string                 `json:"schema"`
+	Migrations *store.MigrationStatus `json:"migrations,omitempty"`
+}
+
+// Liveness probe, only tells the orchestrator that the process is up and serving requests
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Readiness probe, pings the database and checks that every migration has been applied. The
+// probe needs no credentials, so it never answers with the driver's or goose's error text.
+func (a *API) readinessHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := readinessResponse{Status: "ready", Database: "ok", Schema: "ok"}
+
+	if err := a.health.Ping(ctx); err != nil {
+		log.Printf("Readiness: pinging the database: %v", err)
+		resp.Status = "unavailable"
+		resp.Database = "unavailable"
+		resp.Schema = "unavailable"
+		respondWithJson(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	status, err := a.health.MigrationStatus(ctx)
+
+	if err != nil {
+		log.Printf("Readiness: reading the migration status: %v", err)
+		resp.Status = "unavailable"
+		resp.Schema = "unavailable"
+		respondWithJson(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	resp.Migrations = &status
+
+	if status.Pending > 0 {
+		resp.Status = "migrations_pending"
+		resp.Schema = "migrations_pending"
+		respondWithJson(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, resp)
+}
@@ -0,0 +1,694 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/api"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/mail"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/oidc"
+	"github.com/itsmandrew/server-go/internal/oidc/oidctest"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/storage"
+	"github.com/itsmandrew/server-go/internal/store"
+	"github.com/itsmandrew/server-go/internal/stream"
+	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// go test ./internal/api -update rewrites the golden files from the current responses
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// Set to a migrated, disposable Postgres database to run the suite against Postgres
+// instead of the in-memory store. Every test truncates it.
+const testDBEnvVar = "CHIRPY_TEST_DB_URL"
+
+const testJWTSecret = "test-secret-that-is-long-enough!"
+
+const testMaxUploadBytes = 1 << 20
+
+// What Polka sends in the webhooks' Authorization header
+const testPolkaKey = "f271c81ff7084ee5b99a5091b42d486e"
+
+// Where the web app would receive the provider's redirect, never fetched in tests
+const testOIDCRedirectURL = "https://chirpy.example/login/callback"
+
+// Deleted accounts are due right away, so a test can purge them without waiting
+const testDeletionGracePeriod = 0
+
+// No wait between attempts, so a test can run every retry with DeliverDue
+var testWebhookConfig = service.WebhookConfig{
+	Timeout:     5 * time.Second,
+	MaxAttempts: 3,
+}
+
+// Short, so a test can wait for a heartbeat
+const testStreamHeartbeat = 50 * time.Millisecond
+
+// Every test signs the fixture users up again, at the default cost hashing their passwords is
+// most of the suite's run time
+func TestMain(m *testing.M) {
+	auth.PasswordCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// Picks the backend for the suite, Postgres when CHIRPY_TEST_DB_URL is set
+func newStore(t *testing.T) store.Store {
+	t.Helper()
+
+	dbURL := os.Getenv(testDBEnvVar)
+	if dbURL == "" {
+		return store.NewMemory()
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("opening %s: %v", testDBEnvVar, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	pg := store.NewPostgres(db)
+	if err := pg.DeleteUsers(context.Background()); err != nil {
+		t.Fatalf("truncating test database: %v", err)
+	}
+
+	// Not tied to users, but every test asks for links from the same address
+	if err := pg.Truncate(context.Background(), "magic_link_requests"); err != nil {
+		t.Fatalf("truncating test database: %v", err)
+	}
+
+	return pg
+}
+
+type serverOptions struct {
+	platform string
+	// Configures it as the "test" OpenID Connect provider
+	oidc *oidctest.Server
+	// Receives the emails, nil disables magic-link login
+	mail *testMailer
+}
+
+// The magic links sent by the test server point here, never fetched in tests
+const testMagicLinkURL = "https://chirpy.example/login/magic"
+
+// testMailer keeps the emails instead of sending them
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *testMailer) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.sent...)
+}
+
+// Emails go out in the background, waits until n of them were sent
+func (m *testMailer) wait(t *testing.T, n int) []mail.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if sent := m.messages(); len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d emails, got %d", n, len(m.messages()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Wires the real handlers, services and router to a fresh store
+func newTestServer(t *testing.T, opts serverOptions) (*httptest.Server, store.Store, *api.API) {
+	t.Helper()
+
+	s := newStore(t)
+
+	moderator, err := moderation.NewModerator(
+		moderation.WordList([]string{"kerfuffle", "sharbert", "fornax"}, moderation.ActionMask, "config"),
+		service.NewModerationRuleSource(s),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media, err := storage.NewLocal(t.TempDir(), api.MediaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaService := service.NewMediaService(s, media)
+	notifications := service.NewNotificationService(s, service.NewInAppChannel(s))
+
+	authConfig := service.AuthConfig{
+		JWTSecret:       testJWTSecret,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+	}
+
+	users := service.NewUserService(s)
+	sessions := service.NewAuthService(s, authConfig)
+
+	var providers []*oidc.Provider
+	if opts.oidc != nil {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         "test",
+			Issuer:       opts.oidc.Issuer(),
+			ClientID:     opts.oidc.ClientID,
+			ClientSecret: opts.oidc.ClientSecret,
+			RedirectURL:  testOIDCRedirectURL,
+		}, nil))
+	}
+
+	// A nil *testMailer must not end up in the interface
+	var mailer mail.Mailer
+	if opts.mail != nil {
+		mailer = opts.mail
+	}
+
+	magicLinks := service.NewMagicLinkService(s, mailer, sessions, service.MagicLinkConfig{URL: testMagicLinkURL, TTL: 15 * time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go magicLinks.SendQueued(ctx)
+
+	a := api.New(api.Options{
+		Users:           users,
+		Chirps:          service.NewChirpService(s, 140, moderator, notifications),
+		Drafts:          service.NewDraftService(s, 140),
+		Lists:           service.NewListService(s),
+		Auth:            sessions,
+		APIKeys:         service.NewAPIKeyService(s),
+		OAuth:           service.NewOAuthService(s, authConfig),
+		OIDC:            service.NewOIDCService(s, users, sessions, providers),
+		MagicLinks:      magicLinks,
+		Moderation:      service.NewModerationService(s, moderator),
+		Reports:         service.NewReportService(s),
+		Relationships:   service.NewRelationshipService(s, notifications),
+		Notifications:   notifications,
+		Webhooks:        service.NewWebhookService(s, testWebhookConfig),
+		Media:           mediaService,
+		Accounts:        service.NewAccountService(s, mediaService, testDeletionGracePeriod),
+		Reset:           service.NewResetService(s),
+		Seed:            service.NewSeedService(s),
+		Streams:         service.NewStreamService(s),
+		Health:          s,
+		Hub:             stream.NewHub(100),
+		StreamHeartbeat: testStreamHeartbeat,
+		MediaHandler:    media.Handler(),
+		MaxUploadBytes:  testMaxUploadBytes,
+		PolkaKey:        testPolkaKey,
+		Platform:        opts.platform,
+		StaticDir:       filepath.Join("..", ".."),
+	})
+
+	srv := httptest.NewServer(a.Routes())
+	t.Cleanup(srv.Close)
+	return srv, s, a
+}
+
+// A server with the fixtures loaded, for tests that don't fit in an apiCase
+func newTestEnv(t *testing.T, opts serverOptions) (*httptest.Server, *testEnv) {
+	t.Helper()
+
+	srv, s, a := newTestServer(t, opts)
+	fx := loadFixtures(t, srv, s)
+
+	env := &testEnv{fx: fx, store: s, api: a}
+	env.do = func(method, path, auth string, body any) (*http.Response, []byte) {
+		return do(t, srv, method, fx.expand(t, path), fx.token(t, auth), fx.expandBody(t, body))
+	}
+
+	return srv, env
+}
+
+// fixtures are the users and chirps every test starts from, see testdata/fixtures.json
+type fixtures struct {
+	Users []struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+		// Left out to have one derived from the email
+		Handle string `json:"handle"`
+	} `json:"users"`
+	Chirps []struct {
+		Name   string `json:"name"`
+		Author string `json:"author"`
+		Body   string `json:"body"`
+	} `json:"chirps"`
+
+	// Filled in once loaded through the API
+	accessTokens  map[string]string
+	refreshTokens map[string]string
+	apiKeys       map[string]string
+	ids           map[string]uuid.UUID
+}
+
+func loadFixtures(t *testing.T, srv *httptest.Server, s store.Store) *fixtures {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join("testdata", "fixtures.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fx := &fixtures{
+		accessTokens:  map[string]string{},
+		refreshTokens: map[string]string{},
+		apiKeys:       map[string]string{},
+		ids:           map[string]uuid.UUID{},
+	}
+
+	if err := json.Unmarshal(raw, fx); err != nil {
+		t.Fatalf("parsing fixtures: %v", err)
+	}
+
+	for _, u := range fx.Users {
+		creds := map[string]string{"email": u.Email, "password": u.Password}
+		signup := map[string]string{"email": u.Email, "password": u.Password, "handle": u.Handle}
+
+		resp := mustDo(t, srv, http.MethodPost, "/api/users", "", signup, http.StatusCreated)
+		fx.ids["user:"+u.Name] = uuid.MustParse(resp["id"].(string))
+
+		// Roles can only be granted by an admin, so the fixtures set them on the store directly
+		if u.Role != "" {
+			if _, err := s.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{ID: fx.ids["user:"+u.Name], Role: u.Role}); err != nil {
+				t.Fatalf("setting role of %s: %v", u.Name, err)
+			}
+		}
+
+		resp = mustDo(t, srv, http.MethodPost, "/api/login", "", creds, http.StatusOK)
+		fx.accessTokens[u.Name] = resp["token"].(string)
+		fx.refreshTokens[u.Name] = resp["refresh_token"].(string)
+	}
+
+	for _, c := range fx.Chirps {
+		resp := mustDo(t, srv, http.MethodPost, "/api/chirps", fx.accessTokens[c.Author], map[string]string{"body": c.Body}, http.StatusCreated)
+		fx.ids["chirp:"+c.Name] = uuid.MustParse(resp["id"].(string))
+	}
+
+	return fx
+}
+
+var embeddedUUID = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+var placeholder = regexp.MustCompile(`\{((?:user|chirp|rule|report|webhook|key|client):[a-z0-9-]+)\}`)
+
+// Swaps {chirp:saul-first} style placeholders for the fixture IDs
+func (fx *fixtures) expand(t *testing.T, s string) string {
+	t.Helper()
+
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		id, ok := fx.ids[strings.Trim(m, "{}")]
+		if !ok {
+			t.Fatalf("unknown fixture %s", m)
+		}
+		return id.String()
+	})
+}
+
+// Expands the placeholders in a raw string body or the values of a map[string]string or form
+// body, other bodies are sent as is
+func (fx *fixtures) expandBody(t *testing.T, body any) any {
+	t.Helper()
+
+	if raw, ok := body.(string); ok {
+		return fx.expand(t, raw)
+	}
+
+	if form, ok := body.(url.Values); ok {
+		expanded := url.Values{}
+		for k, values := range form {
+			for _, v := range values {
+				expanded.Add(k, fx.expand(t, v))
+			}
+		}
+		return expanded
+	}
+
+	fields, ok := body.(map[string]string)
+	if !ok {
+		return body
+	}
+
+	expanded := make(map[string]string, len(fields))
+	for k, v := range fields {
+		expanded[k] = fx.expand(t, v)
+	}
+	return expanded
+}
+
+// Resolves "access:saul" / "refresh:saul" / "raw:<token>" into a bearer token
+func (fx *fixtures) token(t *testing.T, auth string) string {
+	t.Helper()
+
+	kind, name, _ := strings.Cut(auth, ":")
+	switch kind {
+	case "":
+		return ""
+	case "access":
+		return fx.accessTokens[name]
+	case "refresh":
+		return fx.refreshTokens[name]
+	case "key":
+		return fx.apiKeys[name]
+	case "raw":
+		return name
+	case "apikey":
+		return "ApiKey " + name
+	}
+
+	t.Fatalf("unknown auth %q", auth)
+	return ""
+}
+
+// multipartFile is sent as a multipart/form-data body holding a single file
+type multipartFile struct {
+	field string
+	data  []byte
+}
+
+// Sends a request, body may be a string (sent verbatim), a multipartFile, url.Values (sent as a
+// form) or anything JSON encodable
+func do(t *testing.T, srv *httptest.Server, method, path, token string, body any) (*http.Response, []byte) {
+	t.Helper()
+
+	var (
+		reader      io.Reader
+		contentType string
+	)
+
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case multipartFile:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+
+		part, err := mw.CreateFormFile(b.field, "upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(b.data)
+		mw.Close()
+
+		reader = &buf
+		contentType = mw.FormDataContentType()
+	case url.Values:
+		reader = strings.NewReader(b.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		payload, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token carrying its own scheme, such as "ApiKey <key>", is sent as it is
+	if token != "" && !strings.Contains(token, " ") {
+		token = "Bearer " + token
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, respBody
+}
+
+// do, but fails the test unless the status matches and returns the decoded JSON object
+func mustDo(t *testing.T, srv *httptest.Server, method, path, token string, body any, wantStatus int) map[string]any {
+	t.Helper()
+
+	resp, respBody := do(t, srv, method, path, token, body)
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("%s %s: expected %d, got %d: %s", method, path, wantStatus, resp.StatusCode, respBody)
+	}
+
+	var decoded map[string]any
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &decoded); err != nil {
+			t.Fatalf("%s %s: response is not a JSON object: %s", method, path, respBody)
+		}
+	}
+	return decoded
+}
+
+// Compares the response with testdata/golden/<name>.json after masking IDs, timestamps and tokens
+func assertGolden(t *testing.T, fx *fixtures, name string, body []byte) {
+	t.Helper()
+
+	got := normalize(fx, body)
+	path := filepath.Join("testdata", "golden", name+".json")
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run go test ./internal/api -update: %v", err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(got)) {
+		t.Errorf("response does not match %s\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
+
+// Makes a response stable across runs: fixture IDs become <user:saul>, other UUIDs <uuid>,
+// timestamps <timestamp> and tokens <token>. Non JSON bodies are kept as a JSON string.
+func normalize(fx *fixtures, body []byte) []byte {
+
+	var decoded any
+	if len(body) == 0 {
+		decoded = nil
+	} else if err := json.Unmarshal(body, &decoded); err != nil {
+		decoded = string(body)
+	}
+
+	names := map[string]string{}
+	for name, id := range fx.ids {
+		names[id.String()] = "<" + name + ">"
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(mask(decoded, "", names))
+
+	return out.Bytes()
+}
+
+func mask(v any, key string, names map[string]string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			val[k] = mask(child, k, names)
+		}
+		return val
+	case []any:
+		for i, child := range val {
+			val[i] = mask(child, key, names)
+		}
+		return val
+	case string:
+		if key == "token" || key == "access_token" || key == "refresh_token" || key == "confirmation_token" || key == "key" {
+			return "<token>"
+		}
+		if key == "prefix" {
+			return "<prefix>"
+		}
+		if key == "secret" || key == "client_secret" {
+			return "<secret>"
+		}
+		if key == "next_cursor" {
+			return "<cursor>"
+		}
+		if name, ok := names[val]; ok {
+			return name
+		}
+		if _, err := uuid.Parse(val); err == nil {
+			return "<uuid>"
+		}
+		// IDs inside longer strings, such as media URLs
+		val = embeddedUUID.ReplaceAllStringFunc(val, func(id string) string {
+			if name, ok := names[id]; ok {
+				return name
+			}
+			return "<uuid>"
+		})
+		if _, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return "<timestamp>"
+		}
+		return val
+	case float64:
+		// Unix timestamps, such as the ones introspection returns
+		if key == "exp" || key == "iat" {
+			return "<unix>"
+		}
+	}
+	return v
+}
+
+// sseEvent is one event read from /api/stream
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// sseStream reads an open /api/stream response line by line
+type sseStream struct {
+	lines chan string
+}
+
+// Opens the stream, lastEventID is sent as the Last-Event-ID header when set. The connection
+// is closed when the test ends.
+func openStream(t *testing.T, srv *httptest.Server, path, token, lastEventID string) *sseStream {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token carrying its own scheme, such as "ApiKey <key>", is sent as it is
+	if token != "" && !strings.Contains(token, " ") {
+		token = "Bearer " + token
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("GET %s: expected 200, got %d: %s", path, resp.StatusCode, body)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected Content-Type text/event-stream, got %q", ct)
+	}
+
+	s := &sseStream{lines: make(chan string)}
+	go func() {
+		defer close(s.lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+	}()
+
+	return s
+}
+
+func (s *sseStream) line(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case line, ok := <-s.lines:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream")
+	}
+	return ""
+}
+
+// Next event, skipping comments and the retry field
+func (s *sseStream) next(t *testing.T) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+	for {
+		line := s.line(t)
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Type = value
+		case "data":
+			e.Data = value
+		case "":
+			if e.Type != "" {
+				return e
+			}
+		}
+	}
+}
+
+// Waits for a heartbeat comment
+func (s *sseStream) heartbeat(t *testing.T) {
+	t.Helper()
+
+	for s.line(t) != ": heartbeat" {
+	}
+}
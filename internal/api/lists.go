@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (a *API) createListHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	list, err := a.lists.Create(r.Context(), userID, params.Name, params.Public)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, listFromDB(list))
+}
+
+func (a *API) listListsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	lists, err := a.lists.Owned(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listsFromDB(lists))
+}
+
+func (a *API) getListHandler(w http.ResponseWriter, r *http.Request) {
+
+	listID, err := parseIDParam(r, "listID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Public lists can be read signed out
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	list, err := a.lists.Get(r.Context(), viewerID, listID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listFromDB(list))
+}
+
+func (a *API) updateListHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+
+	listID, err := parseIDParam(r, "listID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	list, err := a.lists.Update(r.Context(), userID, listID, params.Name, params.Public)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listFromDB(list))
+}
+
+func (a *API) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+
+	listID, err := parseIDParam(r, "listID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.lists.Delete(r.Context(), userID, listID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
+
+func (a *API) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+
+	listID, err := parseIDParam(r, "listID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	members, err := a.lists.Members(r.Context(), viewerID, listID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.UserID)
+	}
+
+	users, err := a.users.Summaries(r.Context(), ids)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, listMembersFromDB(members, users, a.media.URLs))
+}
+
+// Shared by adding and removing a member: authenticate, read {listID} and {userID} and apply change
+func (a *API) listMemberHandler(change func(ctx context.Context, userID, listID, memberID uuid.UUID) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		listID, err := parseIDParam(r, "listID")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		memberID, err := parseIDParam(r, "userID")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		userID, err := a.authenticate(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		if err := change(r.Context(), userID, listID, memberID); err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondNoContent(w)
+	}
+}
+
+func (a *API) listTimelineHandler(w http.ResponseWriter, r *http.Request) {
+
+	listID, err := parseIDParam(r, "listID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Like GET /api/chirps, signed in viewers don't see chirps from users who blocked or were muted by them
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	filter, err := chirpFilterFromQuery(r.URL.Query())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirps, err := a.lists.Timeline(r.Context(), viewerID, listID, filter)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	a.respondWithChirps(w, r, viewerID, chirps)
+}
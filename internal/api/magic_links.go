@@ -0,0 +1,70 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+)
+
+func (a *API) requestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	type response struct {
+		Message string `json:"message"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.magicLinks.Send(r.Context(), params.Email, clientIP(r)); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Same answer whether or not the address has an account
+	respondWithJson(w, http.StatusAccepted, response{
+		Message: "If an account uses this address, a login link is on its way",
+	})
+}
+
+func (a *API) verifyMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	session, err := a.magicLinks.Verify(r.Context(), params.Token)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Refresh token created for %v through a magic link\n", session.User.ID)
+
+	respondWithSession(w, session)
+}
+
+// The address the request came from without its port, a proxy in front of the server shows up
+// as the client
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+// Replaces the caller's avatar or banner with the image sent as the "image" field of a
+// multipart/form-data body
+func (a *API) uploadImageHandler(kind service.ImageKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userID, err := a.authenticate(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		data, err := a.readUpload(w, r, "image")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		user, err := a.media.SetImage(r.Context(), userID, kind, data)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithJson(w, http.StatusOK, userFromDB(user, a.media.URLs))
+	}
+}
+
+// Reads one file field of a multipart form, refusing bodies over MaxUploadBytes
+func (a *API) readUpload(w http.ResponseWriter, r *http.Request, field string) ([]byte, error) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.maxUploadBytes)
+
+	file, _, err := r.FormFile(field)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, apierror.New(
+			http.StatusRequestEntityTooLarge,
+			apierror.CodePayloadTooLarge,
+			fmt.Sprintf("Uploads are limited to %d bytes", a.maxUploadBytes),
+		)
+	}
+
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, apierror.Validation(apierror.FieldError{Field: field, Message: "is required"})
+	}
+
+	if err != nil {
+		return nil, apierror.BadRequest(apierror.CodeBadRequest, "Request body must be multipart/form-data").WithCause(err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, apierror.BadRequest(apierror.CodeBadRequest, "Reading the upload failed").WithCause(err)
+	}
+
+	return data, nil
+}
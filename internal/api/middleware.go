@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	scopeKey
+)
+
+// requirePermission only lets the request through when the access token's role grants perm,
+// the handler reads the caller back with principalFrom
+func (a *API) requirePermission(perm auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, err := a.principal(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		if !principal.Can(perm) {
+			respondWithError(w, r, apierror.Forbidden("Your role does not allow this"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey, principal)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireScope marks a route as open to personal API keys and OAuth clients holding scope. Routes
+// without it only take session tokens, so new routes are closed to them until given a scope.
+func requireScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), scopeKey, scope)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Checks an API key or app token against the scope set by requireScope, sessions always pass
+func checkScope(r *http.Request, principal auth.Principal) error {
+
+	if !principal.Delegated() {
+		return nil
+	}
+
+	scope, ok := r.Context().Value(scopeKey).(auth.Scope)
+
+	if !ok {
+		if principal.IsClient() {
+			return apierror.New(http.StatusForbidden, apierror.CodeInsufficientScope, "Apps can't use this endpoint on your behalf")
+		}
+		return apierror.New(http.StatusForbidden, apierror.CodeInsufficientScope, "API keys can't be used here, log in instead")
+	}
+
+	if !principal.HasScope(scope) {
+		if principal.IsClient() {
+			return apierror.New(http.StatusForbidden, apierror.CodeInsufficientScope, fmt.Sprintf("This app was not granted the %s scope", scope))
+		}
+		return apierror.New(http.StatusForbidden, apierror.CodeInsufficientScope, fmt.Sprintf("This API key lacks the %s scope", scope))
+	}
+
+	return nil
+}
+
+// The caller stored by requirePermission
+func principalFrom(r *http.Request) auth.Principal {
+	principal, _ := r.Context().Value(principalKey).(auth.Principal)
+	return principal
+}
+
+// Media files never change once written (every upload gets a new key), so browsers and CDNs may
+// keep them for a year. Only successful responses are marked, a 404 must not stick.
+func immutableCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&cacheWriter{ResponseWriter: w}, r)
+	})
+}
+
+type cacheWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if !cw.wroteHeader && (status == http.StatusOK || status == http.StatusNotModified) {
+		cw.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/itsmandrew/server-go/internal/moderation"
+)
+
+func (a *API) listModerationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJson(w, http.StatusOK, moderationRulesFromRules(a.moderation.ListRules(r.Context())))
+}
+
+func (a *API) createModerationRuleHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Kind    string `json:"kind"`
+		Pattern string `json:"pattern"`
+		Action  string `json:"action"`
+	}
+
+	// 1. Decode the params into our struct
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Store the rule, it applies to the next chirp
+	rule, err := a.moderation.CreateRule(r.Context(), moderation.Rule{
+		Kind:    moderation.Kind(params.Kind),
+		Pattern: params.Pattern,
+		Action:  moderation.Action(params.Action),
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created moderation rule: %v\n", rule)
+	respondWithJson(w, http.StatusCreated, moderationRuleFromRule(rule))
+}
+
+func (a *API) deleteModerationRuleHandler(w http.ResponseWriter, r *http.Request) {
+
+	ruleID, err := parseIDParam(r, "ruleID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.moderation.DeleteRule(r.Context(), ruleID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
+
+func (a *API) listModerationFlagsHandler(w http.ResponseWriter, r *http.Request) {
+
+	flags, err := a.moderation.ListFlags(r.Context())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, moderationFlagsFromDB(flags))
+}
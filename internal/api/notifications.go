@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+func (a *API) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := service.DefaultNotificationPageSize
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+
+		if err != nil {
+			respondWithError(w, r, apierror.Validation(apierror.FieldError{Field: "limit", Message: "must be a number"}))
+			return
+		}
+	}
+
+	page, err := a.notifications.List(r.Context(), userID, query.Get("cursor"), limit)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var actorIDs []uuid.UUID
+	for _, n := range page.Notifications {
+		actorIDs = append(actorIDs, n.ActorIDs...)
+	}
+
+	actors, err := a.users.Summaries(r.Context(), actorIDs)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, notificationPageFromService(page, actors, a.media.URLs))
+}
+
+// Marks the listed notifications as read, an empty body or no ids marks all of them
+func (a *API) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	type response struct {
+		Marked      int64 `json:"marked"`
+		UnreadCount int64 `json:"unread_count"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &params); err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	marked, unread, err := a.notifications.MarkRead(r.Context(), userID, params.IDs)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{Marked: marked, UnreadCount: unread})
+}
+
+func (a *API) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	prefs, err := a.notifications.Preferences(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, prefs)
+}
+
+// Takes the same kind -> channel -> enabled shape it returns, kinds and channels left out keep their value
+func (a *API) setNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	update := service.NotificationPreferences{}
+
+	if err := decodeJSON(r, &update); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	prefs, err := a.notifications.SetPreferences(r.Context(), userID, update)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+func (a *API) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Public       bool     `json:"public"`
+	}
+
+	// 1. Only a session may register apps
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Decode the body
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 3. Validate and store the hash of the secret
+	client, err := a.oauth.RegisterClient(r.Context(), userID, service.OAuthClientInput{
+		Name:         params.Name,
+		RedirectURIs: params.RedirectURIs,
+		Public:       params.Public,
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Registered OAuth client %v for %v\n", client.ID, userID)
+
+	// The only time the secret is shown
+	out := oauthClientFromDB(client.OauthClient)
+	out.ClientSecret = client.Secret
+	respondWithJson(w, http.StatusCreated, out)
+}
+
+func (a *API) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	clients, err := a.oauth.ListClients(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, oauthClientsFromDB(clients))
+}
+
+func (a *API) deleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	clientID, err := parseIDParam(r, "clientID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.oauth.DeleteClient(r.Context(), userID, clientID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
+
+// The consent page of the web app forwards the query string the app sent the user with
+func (a *API) oauthConsentHandler(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := a.authenticate(r); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	consent, err := a.oauth.Authorize(r.Context(), authorizeRequestFromQuery(r.URL.Query()))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, oauthConsentFromService(consent))
+}
+
+// The user's answer to the consent page, which then sends them to redirect_to
+func (a *API) oauthApproveHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		ResponseType        string `json:"response_type"`
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+		Approve             bool   `json:"approve"`
+	}
+
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	redirectTo, err := a.oauth.Approve(r.Context(), userID, service.AuthorizeRequest{
+		ResponseType:        params.ResponseType,
+		ClientID:            params.ClientID,
+		RedirectURI:         params.RedirectURI,
+		Scope:               params.Scope,
+		State:               params.State,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+	}, params.Approve)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{RedirectTo: redirectTo})
+}
+
+func (a *API) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	creds, err := clientCredentials(r)
+
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	token, err := a.oauth.Token(r.Context(), service.TokenRequest{
+		ClientCredentials: creds,
+		GrantType:         r.PostForm.Get("grant_type"),
+		Code:              r.PostForm.Get("code"),
+		RedirectURI:       r.PostForm.Get("redirect_uri"),
+		CodeVerifier:      r.PostForm.Get("code_verifier"),
+		RefreshToken:      r.PostForm.Get("refresh_token"),
+		Scope:             r.PostForm.Get("scope"),
+	})
+
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	noStore(w)
+	respondWithJson(w, http.StatusOK, oauthTokenFromService(token))
+}
+
+// RFC 7009, token_type_hint is accepted but not needed: refresh tokens are looked up first
+func (a *API) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+
+	creds, err := clientCredentials(r)
+
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	if err := a.oauth.Revoke(r.Context(), creds, r.PostForm.Get("token")); err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	// 200 with an empty body, as the RFC asks
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+}
+
+// RFC 7662
+func (a *API) oauthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+
+	creds, err := clientCredentials(r)
+
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	introspection, err := a.oauth.Introspect(r.Context(), creds, r.PostForm.Get("token"))
+
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	noStore(w)
+	respondWithJson(w, http.StatusOK, oauthIntrospectionFromService(introspection))
+}
+
+func authorizeRequestFromQuery(query url.Values) service.AuthorizeRequest {
+	return service.AuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// Parses the form and reads the client's credentials from HTTP Basic (RFC 6749 2.3.1) or the
+// client_id / client_secret form fields, a client may only use one of the two
+func clientCredentials(r *http.Request) (service.ClientCredentials, error) {
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/x-www-form-urlencoded" {
+		return service.ClientCredentials{}, &service.OAuthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "The body must be application/x-www-form-urlencoded"}
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return service.ClientCredentials{}, &service.OAuthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "The body is not a valid form"}
+	}
+
+	id, secret, ok := r.BasicAuth()
+
+	if !ok {
+		return service.ClientCredentials{
+			ClientID:     r.PostForm.Get("client_id"),
+			ClientSecret: r.PostForm.Get("client_secret"),
+		}, nil
+	}
+
+	if r.PostForm.Has("client_secret") {
+		return service.ClientCredentials{}, &service.OAuthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Send the client secret in the Authorization header or the body, not both"}
+	}
+
+	// Both are form-encoded before going into the header
+	id, idErr := url.QueryUnescape(id)
+	secret, secretErr := url.QueryUnescape(secret)
+
+	if idErr != nil || secretErr != nil {
+		return service.ClientCredentials{}, &service.OAuthError{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "Malformed Basic credentials"}
+	}
+
+	return service.ClientCredentials{ClientID: id, ClientSecret: secret}, nil
+}
+
+// Writes an OAuth error as RFC 6749 5.2 describes, anything else goes through respondWithError
+func respondWithOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		respondWithError(w, r, err)
+		return
+	}
+
+	type response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	// A client that tried Basic is told which scheme to use
+	if oauthErr.Status == http.StatusUnauthorized && r.Header.Get("Authorization") != "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+
+	noStore(w)
+	respondWithJson(w, oauthErr.Status, response{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
+
+// Tokens must not end up in a cache (RFC 6749 5.1)
+func noStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (a *API) listOIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+
+	type provider struct {
+		Name string `json:"name"`
+	}
+
+	names := a.oidc.Providers()
+
+	out := make([]provider, 0, len(names))
+	for _, name := range names {
+		out = append(out, provider{Name: name})
+	}
+
+	respondWithJson(w, http.StatusOK, out)
+}
+
+func (a *API) startOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	authURL, err := a.oidc.Start(r.Context(), r.PathValue("provider"))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{AuthorizationURL: authURL})
+}
+
+func (a *API) finishOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	session, err := a.oidc.Finish(r.Context(), r.PathValue("provider"), params.Code, params.State)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Refresh token created for %v through %s\n", session.User.ID, r.PathValue("provider"))
+
+	respondWithSession(w, session)
+}
+
+func (a *API) listIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	identities, err := a.oidc.Identities(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, identitiesFromDB(identities))
+}
+
+func (a *API) startLinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+
+	type response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	authURL, err := a.oidc.StartLink(r.Context(), userID, r.PathValue("provider"))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, response{AuthorizationURL: authURL})
+}
+
+func (a *API) finishLinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	identity, err := a.oidc.FinishLink(r.Context(), userID, r.PathValue("provider"), params.Code, params.State)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, identitiesFromDB([]database.UserIdentity{identity})[0])
+}
+
+func (a *API) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.oidc.Unlink(r.Context(), userID, r.PathValue("provider")); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
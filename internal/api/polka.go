@@ -0,0 +1,57 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+)
+
+// The only Polka event we act on, the rest are acknowledged and ignored
+const polkaUserUpgraded = "user.upgraded"
+
+// Polka, our payment provider, calls this when a user pays for Chirpy Red. Any 2xx tells it to
+// stop retrying.
+func (a *API) polkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID uuid.UUID `json:"user_id"`
+		} `json:"data"`
+	}
+
+	key, err := auth.GetAPIKey(r.Header)
+
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized(apierror.CodeUnauthorized, "Missing API key").WithCause(err))
+		return
+	}
+
+	if a.polkaKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(a.polkaKey)) != 1 {
+		respondWithError(w, r, apierror.Unauthorized(apierror.CodeUnauthorized, "Invalid API key").WithCause(errors.New("polka key mismatch")))
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if params.Event != polkaUserUpgraded {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := a.users.UpgradeToChirpyRed(r.Context(), params.Data.UserID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
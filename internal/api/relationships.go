@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Shared by follow, block, mute and their undos: authenticate, read {userID} and apply change
+func (a *API) relationshipHandler(change func(ctx context.Context, userID, targetID uuid.UUID) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		targetID, err := parseIDParam(r, "userID")
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		userID, err := a.authenticate(r)
+
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		if err := change(r.Context(), userID, targetID); err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondNoContent(w)
+	}
+}
+
+func (a *API) listBlocksHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	blocks, err := a.relationships.ListBlocks(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, blocksFromDB(blocks))
+}
+
+func (a *API) listMutesHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	mutes, err := a.relationships.ListMutes(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, mutesFromDB(mutes))
+}
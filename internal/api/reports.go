@@ -0,0 +1,211 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/stream"
+)
+
+// Body of the report endpoints
+type reportParameters struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+func (a *API) reportChirpHandler(w http.ResponseWriter, r *http.Request) {
+
+	chirpID, err := parseIDParam(r, "chirpID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 1. Validate the access token
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Decode the params into our struct
+	params := reportParameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 3. File the report against the chirp and its author
+	report, err := a.reports.ReportChirp(r.Context(), userID, chirpID, params.Reason, params.Details)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created report: %v\n", report.ID)
+	respondWithJson(w, http.StatusCreated, reportFromDB(report))
+}
+
+func (a *API) reportUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	targetID, err := parseIDParam(r, "userID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := reportParameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := a.reports.ReportUser(r.Context(), userID, targetID, params.Reason, params.Details)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created report: %v\n", report.ID)
+	respondWithJson(w, http.StatusCreated, reportFromDB(report))
+}
+
+func (a *API) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+
+	reports, err := a.reports.List(r.Context(), r.URL.Query().Get("status"))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, reportsFromDB(reports))
+}
+
+func (a *API) getReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	reportID, err := parseIDParam(r, "reportID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := a.reports.Get(r.Context(), reportID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+// Body of the triage, resolve and dismiss endpoints
+type reportDecision struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+// Reads the acting moderator, the report ID and the decision, shared by triage, resolve and dismiss
+func readReportDecision(r *http.Request) (actorID, reportID uuid.UUID, params reportDecision, err error) {
+
+	if reportID, err = parseIDParam(r, "reportID"); err != nil {
+		return
+	}
+
+	actorID = principalFrom(r).UserID
+	err = decodeJSON(r, &params)
+	return
+}
+
+func (a *API) triageReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	actorID, reportID, params, err := readReportDecision(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := a.reports.Triage(r.Context(), actorID, reportID, params.Note)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+func (a *API) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	actorID, reportID, params, err := readReportDecision(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := a.reports.Resolve(r.Context(), actorID, reportID, params.Action, params.Note)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Report %v resolved by %v: %s\n", report.ID, actorID, params.Action)
+
+	// To stream clients a hidden chirp is gone like a deleted one
+	if params.Action == service.ActionHideChirp && report.ChirpID.Valid {
+		a.publish(r.Context(), stream.TypeChirpDeleted, uuid.Nil, nil, ChirpDeleted{ID: report.ChirpID.UUID})
+	}
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+func (a *API) dismissReportHandler(w http.ResponseWriter, r *http.Request) {
+
+	actorID, reportID, params, err := readReportDecision(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	report, err := a.reports.Dismiss(r.Context(), actorID, reportID, params.Note)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, reportFromDB(report))
+}
+
+func (a *API) listModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	actions, err := a.reports.ListActions(r.Context())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, moderationActionsFromDB(actions))
+}
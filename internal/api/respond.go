@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+)
+
+func respondWithJson(w http.ResponseWriter, code int, payload interface{}) error {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(code)
+	w.Write(response)
+
+	return nil
+}
+
+// Writes any error as our JSON error envelope (or problem+json if the client asked for it)
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err)
+}
+
+func respondNoContent(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Decodes the JSON request body into dst, a malformed body is the client's fault (400)
+func decodeJSON(r *http.Request, dst any) error {
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return apierror.BadRequest(apierror.CodeInvalidJSON, "Request body must be valid JSON").WithCause(err)
+	}
+
+	return nil
+}
+
+// Parses a UUID path value such as {chirpID}
+func parseIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(strings.TrimSpace(r.PathValue(name)))
+
+	if err != nil {
+		return uuid.Nil, apierror.BadRequest(apierror.CodeInvalidID, fmt.Sprintf("%s must be a valid UUID", name)).WithCause(err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,880 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+// JSON shapes returned to clients, kept apart from the database models so a new column
+// never leaks into a response by accident
+
+// User is the caller's own account, the only response that carries an email
+type User struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	// Variant name -> URL, left out until an image is uploaded
+	Avatar map[string]string `json:"avatar,omitempty"`
+	Banner map[string]string `json:"banner,omitempty"`
+	// Set while the account is waiting to be deleted, logging in clears it
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// imageURLs resolves a stored image key, see MediaService.URLs
+type imageURLs func(kind service.ImageKind, key string) map[string]string
+
+func userFromDB(u database.GetUserByIDNoPasswordRow, urls imageURLs) User {
+	return User{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		Email:       u.Email,
+		Role:        u.Role,
+		Handle:      u.Handle,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		Location:    u.Location,
+		Website:     u.Website,
+		Avatar:      urls(service.ImageAvatar, u.AvatarKey),
+		Banner:      urls(service.ImageBanner, u.BannerKey),
+
+		DeletionScheduledAt: nullableTime(u.DeletionScheduledAt),
+	}
+}
+
+// Profile is what anyone can see about a user
+type Profile struct {
+	ID             uuid.UUID         `json:"id"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Handle         string            `json:"handle"`
+	DisplayName    string            `json:"display_name"`
+	Bio            string            `json:"bio"`
+	Location       string            `json:"location"`
+	Website        string            `json:"website"`
+	Avatar         map[string]string `json:"avatar,omitempty"`
+	Banner         map[string]string `json:"banner,omitempty"`
+	ChirpCount     int64             `json:"chirp_count"`
+	FollowerCount  int64             `json:"follower_count"`
+	FollowingCount int64             `json:"following_count"`
+}
+
+func profileFromDB(p database.GetUserProfileByHandleRow, urls imageURLs) Profile {
+	return Profile{
+		ID:             p.ID,
+		CreatedAt:      p.CreatedAt,
+		Handle:         p.Handle,
+		DisplayName:    p.DisplayName,
+		Bio:            p.Bio,
+		Location:       p.Location,
+		Website:        p.Website,
+		Avatar:         urls(service.ImageAvatar, p.AvatarKey),
+		Banner:         urls(service.ImageBanner, p.BannerKey),
+		ChirpCount:     p.ChirpCount,
+		FollowerCount:  p.FollowerCount,
+		FollowingCount: p.FollowingCount,
+	}
+}
+
+// Author is the summary of the user embedded in every chirp
+type Author struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	// The small avatar variant, left out when there is none
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	Author    Author    `json:"author"`
+	// The chirp this one answers, left out when it isn't a reply or the original was deleted
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+	Poll      *Poll      `json:"poll,omitempty"`
+}
+
+// authors comes from UserService.Summaries, a missing entry leaves only the author ID set. polls
+// comes from ChirpService.Polls, chirps without an entry have no poll.
+func chirpFromDB(c database.Chirp, authors map[uuid.UUID]database.GetUserSummariesRow, polls map[uuid.UUID]service.Poll, urls imageURLs) Chirp {
+	out := Chirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+		Author:    authorFromSummary(c.UserID, authors[c.UserID], urls),
+	}
+
+	if c.ReplyToID.Valid {
+		out.ReplyToID = &c.ReplyToID.UUID
+	}
+
+	if poll, ok := polls[c.ID]; ok {
+		p := pollFromService(poll)
+		out.Poll = &p
+	}
+	return out
+}
+
+type Poll struct {
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       time.Time    `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	// The tallies are left out until the viewer voted or the poll closed
+	Voters *int64 `json:"voters,omitempty"`
+	// The options the viewer voted for
+	Voted []uuid.UUID `json:"voted,omitempty"`
+}
+
+type PollOption struct {
+	ID    uuid.UUID `json:"id"`
+	Text  string    `json:"text"`
+	Votes *int64    `json:"votes,omitempty"`
+}
+
+func pollFromService(p service.Poll) Poll {
+	out := Poll{
+		Options:        make([]PollOption, 0, len(p.Options)),
+		MultipleChoice: p.MultipleChoice,
+		ClosesAt:       p.ClosesAt,
+		Closed:         p.Closed,
+		Voted:          p.Voted,
+	}
+
+	if p.Results {
+		out.Voters = &p.Voters
+	}
+
+	for _, o := range p.Options {
+		option := PollOption{ID: o.ID, Text: o.Text}
+		if p.Results {
+			option.Votes = &o.Votes
+		}
+		out.Options = append(out.Options, option)
+	}
+	return out
+}
+
+func authorFromSummary(id uuid.UUID, summary database.GetUserSummariesRow, urls imageURLs) Author {
+	return Author{
+		ID:          id,
+		Handle:      summary.Handle,
+		DisplayName: summary.DisplayName,
+		AvatarURL:   urls(service.ImageAvatar, summary.AvatarKey)["small"],
+	}
+}
+
+func chirpsFromDB(chirps []database.Chirp, authors map[uuid.UUID]database.GetUserSummariesRow, polls map[uuid.UUID]service.Poll, urls imageURLs) []Chirp {
+	// Always answer with a JSON array, even when there are no chirps yet
+	out := make([]Chirp, 0, len(chirps))
+	for _, c := range chirps {
+		out = append(out, chirpFromDB(c, authors, polls, urls))
+	}
+	return out
+}
+
+// Stream data of chirp_deleted, also sent when a moderator hides the chirp
+type ChirpDeleted struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// Stream data of like_count
+type LikeCount struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	LikeCount int64     `json:"like_count"`
+}
+
+// Distinct authors of chirps, in the order they first appear
+func authorIDs(chirps ...database.Chirp) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	for _, c := range chirps {
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			ids = append(ids, c.UserID)
+		}
+	}
+	return ids
+}
+
+func chirpIDs(chirps ...database.Chirp) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+// ScheduledChirp is a chirp of the caller waiting for its publish_at
+type ScheduledChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+	PublishAt time.Time  `json:"publish_at"`
+	// Why it couldn't be published, it stays in the list until cancelled
+	Failure *string `json:"failure,omitempty"`
+}
+
+func scheduledChirpFromDB(c database.ScheduledChirp) ScheduledChirp {
+	out := ScheduledChirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		ReplyToID: nullableID(c.ReplyToID),
+		PublishAt: c.PublishAt,
+	}
+
+	if c.Failure.Valid {
+		out.Failure = &c.Failure.String
+	}
+	return out
+}
+
+func scheduledChirpsFromDB(chirps []database.ScheduledChirp) []ScheduledChirp {
+	out := make([]ScheduledChirp, 0, len(chirps))
+	for _, c := range chirps {
+		out = append(out, scheduledChirpFromDB(c))
+	}
+	return out
+}
+
+type Draft struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+}
+
+func draftFromDB(d database.Draft) Draft {
+	return Draft{
+		ID:        d.ID,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		Body:      d.Body,
+	}
+}
+
+func draftsFromDB(drafts []database.Draft) []Draft {
+	out := make([]Draft, 0, len(drafts))
+	for _, d := range drafts {
+		out = append(out, draftFromDB(d))
+	}
+	return out
+}
+
+// List is a list of users curated by its owner
+type List struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	Name      string    `json:"name"`
+	Public    bool      `json:"public"`
+}
+
+func listFromDB(l database.List) List {
+	return List{
+		ID:        l.ID,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+		OwnerID:   l.OwnerID,
+		Name:      l.Name,
+		Public:    l.Public,
+	}
+}
+
+func listsFromDB(lists []database.List) []List {
+	out := make([]List, 0, len(lists))
+	for _, l := range lists {
+		out = append(out, listFromDB(l))
+	}
+	return out
+}
+
+type ListMember struct {
+	User    Author    `json:"user"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// users comes from UserService.Summaries, like the authors of chirps
+func listMembersFromDB(members []database.ListMember, users map[uuid.UUID]database.GetUserSummariesRow, urls imageURLs) []ListMember {
+	out := make([]ListMember, 0, len(members))
+	for _, m := range members {
+		out = append(out, ListMember{
+			User:    authorFromSummary(m.UserID, users[m.UserID], urls),
+			AddedAt: m.CreatedAt,
+		})
+	}
+	return out
+}
+
+// APIKey never carries the hash, the key itself is only set in the create response
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(k database.ApiKey) APIKey {
+	return APIKey{
+		ID:         k.ID,
+		CreatedAt:  k.CreatedAt,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		ExpiresAt:  nullableTime(k.ExpiresAt),
+		LastUsedAt: nullableTime(k.LastUsedAt),
+		RevokedAt:  nullableTime(k.RevokedAt),
+	}
+}
+
+func apiKeysFromDB(keys []database.ApiKey) []APIKey {
+	out := make([]APIKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, apiKeyFromDB(k))
+	}
+	return out
+}
+
+// OAuthClient never carries the secret hash, the secret itself is only set in the create response
+type OAuthClient struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	// Public clients have no secret and authenticate with PKCE alone
+	Public       bool   `json:"public"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(c database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ClientID:     c.ID,
+		CreatedAt:    c.CreatedAt,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Public:       !c.SecretHash.Valid,
+	}
+}
+
+func oauthClientsFromDB(clients []database.OauthClient) []OAuthClient {
+	out := make([]OAuthClient, 0, len(clients))
+	for _, c := range clients {
+		out = append(out, oauthClientFromDB(c))
+	}
+	return out
+}
+
+// OAuthConsent is what the consent screen shows the user before they approve an app
+type OAuthConsent struct {
+	ClientID    uuid.UUID `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scopes      []string  `json:"scopes"`
+	State       string    `json:"state,omitempty"`
+}
+
+func oauthConsentFromService(c service.Consent) OAuthConsent {
+	scopes := make([]string, len(c.Scopes))
+	for i, scope := range c.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	return OAuthConsent{
+		ClientID:    c.Client.ID,
+		ClientName:  c.Client.Name,
+		RedirectURI: c.RedirectURI,
+		Scopes:      scopes,
+		State:       c.State,
+	}
+}
+
+// OAuthToken is the token endpoint's answer (RFC 6749 5.1)
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+func oauthTokenFromService(t service.OAuthToken) OAuthToken {
+	return OAuthToken{
+		AccessToken:  t.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(t.ExpiresIn / time.Second),
+		RefreshToken: t.RefreshToken,
+		Scope:        auth.JoinScopes(t.Scopes),
+	}
+}
+
+// OAuthIntrospection is the introspection endpoint's answer (RFC 7662 2.2), only active is set
+// for an inactive token
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+func oauthIntrospectionFromService(i service.Introspection) OAuthIntrospection {
+	if !i.Active {
+		return OAuthIntrospection{}
+	}
+
+	return OAuthIntrospection{
+		Active:    true,
+		Scope:     auth.JoinScopes(i.Scopes),
+		ClientID:  i.ClientID.String(),
+		Subject:   i.UserID.String(),
+		IssuedAt:  i.IssuedAt.Unix(),
+		ExpiresAt: i.ExpiresAt.Unix(),
+		TokenType: i.TokenType,
+	}
+}
+
+// Identity is an account at an OpenID Connect provider linked to the caller
+type Identity struct {
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func identitiesFromDB(identities []database.UserIdentity) []Identity {
+	out := make([]Identity, 0, len(identities))
+	for _, i := range identities {
+		out = append(out, Identity{
+			Provider:    i.Provider,
+			Email:       i.Email,
+			CreatedAt:   i.CreatedAt,
+			LastLoginAt: i.LastLoginAt,
+		})
+	}
+	return out
+}
+
+type ModerationRule struct {
+	// Omitted for rules from the config file, those can't be deleted at runtime
+	ID      *uuid.UUID `json:"id,omitempty"`
+	Kind    string     `json:"kind"`
+	Pattern string     `json:"pattern"`
+	Action  string     `json:"action"`
+	Source  string     `json:"source"`
+}
+
+func moderationRuleFromRule(r moderation.Rule) ModerationRule {
+	rule := ModerationRule{
+		Kind:    string(r.Kind),
+		Pattern: r.Pattern,
+		Action:  string(r.Action),
+		Source:  r.Source,
+	}
+
+	if r.ID != uuid.Nil {
+		id := r.ID
+		rule.ID = &id
+	}
+
+	return rule
+}
+
+func moderationRulesFromRules(rules []moderation.Rule) []ModerationRule {
+	out := make([]ModerationRule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, moderationRuleFromRule(r))
+	}
+	return out
+}
+
+type ModerationFlag struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Reason      string    `json:"reason"`
+	ChirpID     uuid.UUID `json:"chirp_id"`
+	ChirpBody   string    `json:"chirp_body"`
+	ChirpUserID uuid.UUID `json:"chirp_user_id"`
+}
+
+func moderationFlagsFromDB(flags []database.ListModerationFlagsRow) []ModerationFlag {
+	out := make([]ModerationFlag, 0, len(flags))
+	for _, f := range flags {
+		out = append(out, ModerationFlag{
+			ID:          f.ID,
+			CreatedAt:   f.CreatedAt,
+			Reason:      f.Reason,
+			ChirpID:     f.ChirpID,
+			ChirpBody:   f.ChirpBody,
+			ChirpUserID: f.ChirpUserID,
+		})
+	}
+	return out
+}
+
+type Report struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ReporterID   uuid.UUID  `json:"reporter_id"`
+	TargetUserID uuid.UUID  `json:"target_user_id"`
+	ChirpID      *uuid.UUID `json:"chirp_id,omitempty"`
+	Reason       string     `json:"reason"`
+	Details      string     `json:"details"`
+	Status       string     `json:"status"`
+}
+
+func reportFromDB(r database.Report) Report {
+	return Report{
+		ID:           r.ID,
+		CreatedAt:    r.CreatedAt,
+		UpdatedAt:    r.UpdatedAt,
+		ReporterID:   r.ReporterID,
+		TargetUserID: r.TargetUserID,
+		ChirpID:      nullableID(r.ChirpID),
+		Reason:       r.Reason,
+		Details:      r.Details,
+		Status:       r.Status,
+	}
+}
+
+func reportsFromDB(reports []database.Report) []Report {
+	out := make([]Report, 0, len(reports))
+	for _, r := range reports {
+		out = append(out, reportFromDB(r))
+	}
+	return out
+}
+
+type ModerationAction struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Left out once the moderator's account is deleted
+	ActorID      *uuid.UUID `json:"actor_id,omitempty"`
+	ReportID     *uuid.UUID `json:"report_id,omitempty"`
+	Action       string     `json:"action"`
+	TargetUserID *uuid.UUID `json:"target_user_id,omitempty"`
+	ChirpID      *uuid.UUID `json:"chirp_id,omitempty"`
+	Note         string     `json:"note"`
+}
+
+func moderationActionsFromDB(actions []database.ModerationAction) []ModerationAction {
+	out := make([]ModerationAction, 0, len(actions))
+	for _, a := range actions {
+		out = append(out, ModerationAction{
+			ID:           a.ID,
+			CreatedAt:    a.CreatedAt,
+			ActorID:      nullableID(a.ActorID),
+			ReportID:     nullableID(a.ReportID),
+			Action:       a.Action,
+			TargetUserID: nullableID(a.TargetUserID),
+			ChirpID:      nullableID(a.ChirpID),
+			Note:         a.Note,
+		})
+	}
+	return out
+}
+
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	// Only set when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+func webhookFromDB(w database.Webhook) Webhook {
+	return Webhook{
+		ID:          w.ID,
+		CreatedAt:   w.CreatedAt,
+		UpdatedAt:   w.UpdatedAt,
+		URL:         w.Url,
+		Description: w.Description,
+		Events:      w.EventTypes,
+		Active:      w.Active,
+	}
+}
+
+func webhooksFromDB(webhooks []database.Webhook) []Webhook {
+	out := make([]Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		out = append(out, webhookFromDB(w))
+	}
+	return out
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID                `json:"id"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+	WebhookID      uuid.UUID                `json:"webhook_id"`
+	EventID        uuid.UUID                `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempts       int32                    `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int32                   `json:"last_status_code,omitempty"`
+	LastError      string                   `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time               `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage          `json:"payload,omitempty"`
+	AttemptLog     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	AttemptedAt  time.Time `json:"attempted_at"`
+	DurationMs   int32     `json:"duration_ms"`
+	StatusCode   *int32    `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body"`
+}
+
+// The list leaves out the payload, the single delivery adds it along with the attempt log
+func webhookDeliveryFromDB(d database.WebhookDelivery) WebhookDelivery {
+	out := WebhookDelivery{
+		ID:             d.ID,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: nullableInt32(d.LastStatusCode),
+		LastError:      d.LastError.String,
+		DeliveredAt:    nullableTime(d.DeliveredAt),
+	}
+
+	// Only meaningful while another attempt is coming
+	if d.Status == service.WebhookPending {
+		out.NextAttemptAt = &d.NextAttemptAt
+	}
+
+	return out
+}
+
+func webhookDeliveriesFromDB(deliveries []database.WebhookDelivery) []WebhookDelivery {
+	out := make([]WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		out = append(out, webhookDeliveryFromDB(d))
+	}
+	return out
+}
+
+func webhookDeliveryDetailFromDB(d database.WebhookDelivery, attempts []database.WebhookDeliveryAttempt) WebhookDelivery {
+	out := webhookDeliveryFromDB(d)
+	out.Payload = d.Payload
+	out.AttemptLog = make([]WebhookDeliveryAttempt, 0, len(attempts))
+
+	for _, a := range attempts {
+		out.AttemptLog = append(out.AttemptLog, WebhookDeliveryAttempt{
+			AttemptedAt:  a.AttemptedAt,
+			DurationMs:   a.DurationMs,
+			StatusCode:   nullableInt32(a.StatusCode),
+			Error:        a.Error.String,
+			ResponseBody: a.ResponseBody,
+		})
+	}
+
+	return out
+}
+
+// NULL columns are left out of the response rather than sent as the zero UUID
+func nullableID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func nullableTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullableInt32(n sql.NullInt32) *int32 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int32
+}
+
+// Relationship is an entry in the caller's block or mute list
+type Relationship struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func blocksFromDB(blocks []database.Block) []Relationship {
+	out := make([]Relationship, 0, len(blocks))
+	for _, b := range blocks {
+		out = append(out, Relationship{UserID: b.BlockedID, CreatedAt: b.CreatedAt})
+	}
+	return out
+}
+
+func mutesFromDB(mutes []database.Mute) []Relationship {
+	out := make([]Relationship, 0, len(mutes))
+	for _, m := range mutes {
+		out = append(out, Relationship{UserID: m.MutedID, CreatedAt: m.CreatedAt})
+	}
+	return out
+}
+
+// Like is an entry in the data export
+type Like struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func likesFromDB(likes []database.Like) []Like {
+	out := make([]Like, 0, len(likes))
+	for _, l := range likes {
+		out = append(out, Like{ChirpID: l.ChirpID, CreatedAt: l.CreatedAt})
+	}
+	return out
+}
+
+// Session is a login in the data export, the token itself is never included
+type Session struct {
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func sessionsFromDB(sessions []database.ListUserSessionsRow) []Session {
+	out := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, Session{
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+			ExpiresAt: s.ExpiresAt,
+			RevokedAt: nullableTime(s.RevokedAt),
+		})
+	}
+	return out
+}
+
+// Notification is one group of the inbox, Actors lists the most recent users behind it
+type Notification struct {
+	ID         uuid.UUID  `json:"id"`
+	Kind       string     `json:"kind"`
+	ChirpID    *uuid.UUID `json:"chirp_id,omitempty"`
+	Actors     []Author   `json:"actors"`
+	ActorCount int64      `json:"actor_count"`
+	Message    string     `json:"message"`
+	Read       bool       `json:"read"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unread_count"`
+	// Pass as ?cursor= for the next page, left out on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// What each kind of notification says, after the names of the actors
+var notificationVerbs = map[string]string{
+	service.NotifyMention: "mentioned you",
+	service.NotifyReply:   "replied to your chirp",
+	service.NotifyLike:    "liked your chirp",
+	service.NotifyFollow:  "followed you",
+}
+
+// actors comes from UserService.Summaries for every actor ID on the page
+func notificationPageFromService(page service.NotificationPage, actors map[uuid.UUID]database.GetUserSummariesRow, urls imageURLs) NotificationPage {
+	out := NotificationPage{
+		Notifications: make([]Notification, 0, len(page.Notifications)),
+		UnreadCount:   page.Unread,
+		NextCursor:    page.NextCursor,
+	}
+
+	for _, n := range page.Notifications {
+		item := Notification{
+			ID:         n.ID,
+			Kind:       n.Kind,
+			Actors:     make([]Author, 0, len(n.ActorIDs)),
+			ActorCount: n.ActorCount,
+			Read:       n.ReadAt.Valid,
+			CreatedAt:  n.CreatedAt,
+			UpdatedAt:  n.UpdatedAt,
+		}
+
+		if n.ChirpID.Valid {
+			item.ChirpID = &n.ChirpID.UUID
+		}
+
+		for _, id := range n.ActorIDs {
+			item.Actors = append(item.Actors, authorFromSummary(id, actors[id], urls))
+		}
+
+		item.Message = notificationMessage(item.Actors, n.ActorCount, notificationVerbs[n.Kind])
+		out.Notifications = append(out.Notifications, item)
+	}
+
+	return out
+}
+
+// "ann liked your chirp", "ann and bob liked your chirp", "ann and 4 others liked your chirp"
+func notificationMessage(actors []Author, count int64, verb string) string {
+
+	names := make([]string, 0, len(actors))
+	for _, a := range actors {
+		name := a.DisplayName
+		if name == "" {
+			name = a.Handle
+		}
+		names = append(names, name)
+	}
+
+	switch {
+	case len(names) == 0:
+		return fmt.Sprintf("%d people %s", count, verb)
+	case count == 1:
+		return fmt.Sprintf("%s %s", names[0], verb)
+	case count == 2 && len(names) == 2:
+		return fmt.Sprintf("%s and %s %s", names[0], names[1], verb)
+	case count == 2:
+		return fmt.Sprintf("%s and 1 other %s", names[0], verb)
+	default:
+		return fmt.Sprintf("%s and %d others %s", names[0], count-1, verb)
+	}
+}
@@ -0,0 +1,561 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+// Routes builds the ServeMux with every endpoint, main and the tests share it
+func (a *API) Routes() *http.ServeMux {
+
+	// Gives a blank, thread-safe routing table. Ready to attach paths
+	// to handler functions, and plug directly into an HTTP server
+	// Basically routing, "which code runs for which URL" is handled by ServeMux
+	mux := http.NewServeMux()
+
+	// Serving static stuff
+	mux.Handle(
+		"/app/",
+		http.StripPrefix(
+			"/app/",
+			a.middlewareMetricsInc(http.FileServer(http.Dir(a.staticDir)))),
+	)
+
+	mux.Handle(
+		"/app/assets/",
+		http.StripPrefix(
+			"/app/assets/",
+			a.middlewareMetricsInc(http.FileServer(http.Dir(filepath.Join(a.staticDir, "assets")))),
+		),
+	)
+
+	// Uploaded profile images, cached for a year
+	mux.Handle(
+		MediaPath,
+		http.StripPrefix(MediaPath, immutableCache(a.mediaHandler)),
+	)
+
+	// Liveness probe, the process is up
+	mux.HandleFunc("GET /api/healthz", livenessHandler)
+
+	// Readiness probe, the database is reachable and migrated
+	mux.HandleFunc("GET /api/readyz", a.readinessHandler)
+
+	// Every /admin route requires a role with the matching permission, see auth/rbac.go
+
+	// Check increments endpoint
+	mux.HandleFunc(
+		"GET /admin/metrics",
+		a.requirePermission(auth.PermViewMetrics, a.metricsHandler),
+	)
+
+	// Wipe or fill the database, dev and test platforms only
+	mux.HandleFunc(
+		"POST /admin/reset",
+		a.requirePermission(auth.PermResetData, a.requireDisposable(a.resetHandler)),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/seed",
+		a.requirePermission(auth.PermSeedData, a.requireDisposable(a.seedHandler)),
+	)
+
+	// Moderation rules are managed at runtime, changes apply without a restart
+	mux.HandleFunc(
+		"GET /admin/moderation/rules",
+		a.requirePermission(auth.PermManageModeration, a.listModerationRulesHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/moderation/rules",
+		a.requirePermission(auth.PermManageModeration, a.createModerationRuleHandler),
+	)
+
+	mux.HandleFunc(
+		"DELETE /admin/moderation/rules/{ruleID}",
+		a.requirePermission(auth.PermManageModeration, a.deleteModerationRuleHandler),
+	)
+
+	// Chirps the pipeline flagged for review
+	mux.HandleFunc(
+		"GET /admin/moderation/flags",
+		a.requirePermission(auth.PermReviewModeration, a.listModerationFlagsHandler),
+	)
+
+	// Report queue, every decision is recorded in the moderation log
+	mux.HandleFunc(
+		"GET /admin/reports",
+		a.requirePermission(auth.PermReviewModeration, a.listReportsHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /admin/reports/{reportID}",
+		a.requirePermission(auth.PermReviewModeration, a.getReportHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/reports/{reportID}/triage",
+		a.requirePermission(auth.PermReviewModeration, a.triageReportHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/reports/{reportID}/resolve",
+		a.requirePermission(auth.PermReviewModeration, a.resolveReportHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/reports/{reportID}/dismiss",
+		a.requirePermission(auth.PermReviewModeration, a.dismissReportHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /admin/moderation/actions",
+		a.requirePermission(auth.PermReviewModeration, a.listModerationActionsHandler),
+	)
+
+	// Partner webhooks, the signing secret is only in the create response
+	mux.HandleFunc(
+		"GET /admin/webhooks",
+		a.requirePermission(auth.PermManageWebhooks, a.listWebhooksHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/webhooks",
+		a.requirePermission(auth.PermManageWebhooks, a.createWebhookHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /admin/webhooks/{webhookID}",
+		a.requirePermission(auth.PermManageWebhooks, a.getWebhookHandler),
+	)
+
+	mux.HandleFunc(
+		"PUT /admin/webhooks/{webhookID}",
+		a.requirePermission(auth.PermManageWebhooks, a.updateWebhookHandler),
+	)
+
+	mux.HandleFunc(
+		"DELETE /admin/webhooks/{webhookID}",
+		a.requirePermission(auth.PermManageWebhooks, a.deleteWebhookHandler),
+	)
+
+	// Delivery log, newest first, and manual redelivery
+	mux.HandleFunc(
+		"GET /admin/webhooks/{webhookID}/deliveries",
+		a.requirePermission(auth.PermManageWebhooks, a.listWebhookDeliveriesHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /admin/webhooks/{webhookID}/deliveries/{deliveryID}",
+		a.requirePermission(auth.PermManageWebhooks, a.getWebhookDeliveryHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /admin/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver",
+		a.requirePermission(auth.PermManageWebhooks, a.redeliverWebhookHandler),
+	)
+
+	// Promote or demote users, the first admin comes from `chirpy promote-admin`
+	mux.HandleFunc(
+		"PUT /admin/users/{userID}/role",
+		a.requirePermission(auth.PermManageRoles, a.setUserRoleHandler),
+	)
+
+	// Create users
+	mux.HandleFunc(
+		"POST /api/users",
+		a.createUserHandler,
+	)
+
+	// Personal API keys for bots and scripts, managed with a session only. The routes below
+	// wrapped in requireScope also take a key holding the scope.
+	mux.HandleFunc(
+		"POST /api/keys",
+		a.createAPIKeyHandler,
+	)
+
+	mux.HandleFunc(
+		"GET /api/keys",
+		a.listAPIKeysHandler,
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/keys/{keyID}",
+		a.revokeAPIKeyHandler,
+	)
+
+	// OAuth2 for third-party apps. Registering an app and answering the consent screen take a
+	// session, the token, revocation and introspection endpoints authenticate the app itself.
+	mux.HandleFunc(
+		"POST /api/oauth/clients",
+		a.createOAuthClientHandler,
+	)
+
+	mux.HandleFunc(
+		"GET /api/oauth/clients",
+		a.listOAuthClientsHandler,
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/oauth/clients/{clientID}",
+		a.deleteOAuthClientHandler,
+	)
+
+	mux.HandleFunc(
+		"GET /api/oauth/authorize",
+		a.oauthConsentHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/oauth/authorize",
+		a.oauthApproveHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/oauth/token",
+		a.oauthTokenHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/oauth/revoke",
+		a.oauthRevokeHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/oauth/introspect",
+		a.oauthIntrospectHandler,
+	)
+
+	// Create chirps
+	mux.HandleFunc(
+		"POST /api/chirps",
+		requireScope(auth.ScopeChirpsWrite, a.createChirpHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/chirps",
+		requireScope(auth.ScopeChirpsRead, a.getChirpsHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/chirps/{chirpID}",
+		requireScope(auth.ScopeChirpsRead, a.getIndividualChirpHandler),
+	)
+
+	// Drafts are private to their author
+	mux.HandleFunc(
+		"POST /api/drafts",
+		requireScope(auth.ScopeChirpsWrite, a.createDraftHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/drafts",
+		requireScope(auth.ScopeChirpsRead, a.listDraftsHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/drafts/{draftID}",
+		requireScope(auth.ScopeChirpsRead, a.getDraftHandler),
+	)
+
+	mux.HandleFunc(
+		"PUT /api/drafts/{draftID}",
+		requireScope(auth.ScopeChirpsWrite, a.updateDraftHandler),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/drafts/{draftID}",
+		requireScope(auth.ScopeChirpsWrite, a.deleteDraftHandler),
+	)
+
+	// Live chirps, deletions and like counts as Server-Sent Events
+	mux.HandleFunc(
+		"GET /api/stream",
+		requireScope(auth.ScopeChirpsRead, a.streamHandler),
+	)
+
+	// Payment provider callbacks, authenticated with POLKA_KEY instead of a user token
+	mux.HandleFunc(
+		"POST /api/polka/webhooks",
+		a.polkaWebhookHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/login",
+		a.loginUserHandler,
+	)
+
+	// Sign in with an external OpenID Connect provider: start returns the provider's URL, the web
+	// app's callback page posts back the code and state the provider redirected with
+	mux.HandleFunc(
+		"GET /api/login/oidc",
+		a.listOIDCProvidersHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/login/oidc/{provider}",
+		a.startOIDCLoginHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/login/oidc/{provider}/callback",
+		a.finishOIDCLoginHandler,
+	)
+
+	// Passwordless login: the first emails a link to the web app, which posts its token back
+	mux.HandleFunc(
+		"POST /api/login/magic",
+		a.requestMagicLinkHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/login/magic/verify",
+		a.verifyMagicLinkHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/refresh",
+		a.refreshHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/revoke",
+		a.revokeUpdateHandler,
+	)
+
+	mux.HandleFunc(
+		"PUT /api/users",
+		a.updateUserHandler,
+	)
+
+	// The caller's own account, "me" is a reserved handle so it never shadows a profile
+	mux.HandleFunc(
+		"GET /api/users/me",
+		requireScope(auth.ScopeUsersRead, a.getMeHandler),
+	)
+
+	// Schedules the account for deletion, logging in again within the grace period cancels it
+	mux.HandleFunc(
+		"DELETE /api/users/me",
+		a.deleteMeHandler,
+	)
+
+	// Everything stored about the caller as a ZIP of JSON files
+	mux.HandleFunc(
+		"GET /api/users/me/export",
+		a.exportHandler,
+	)
+
+	// The caller's chirps queued with publish_at, hidden from everyone until they are published
+	mux.HandleFunc(
+		"GET /api/users/me/scheduled",
+		requireScope(auth.ScopeChirpsRead, a.listScheduledChirpsHandler),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/users/me/scheduled/{scheduledID}",
+		requireScope(auth.ScopeChirpsWrite, a.cancelScheduledChirpHandler),
+	)
+
+	// Providers linked to the account, the only one can't be unlinked without a password
+	mux.HandleFunc(
+		"GET /api/users/me/identities",
+		a.listIdentitiesHandler,
+	)
+
+	// Links a provider to the account, like a sign-in but finished from the same session
+	mux.HandleFunc(
+		"POST /api/users/me/identities/{provider}",
+		a.startLinkIdentityHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/users/me/identities/{provider}/callback",
+		a.finishLinkIdentityHandler,
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/users/me/identities/{provider}",
+		a.unlinkIdentityHandler,
+	)
+
+	// Profile images, resized into the variants listed in internal/imaging
+	mux.HandleFunc(
+		"PUT /api/users/me/avatar",
+		requireScope(auth.ScopeUsersWrite, a.uploadImageHandler(service.ImageAvatar)),
+	)
+
+	mux.HandleFunc(
+		"PUT /api/users/me/banner",
+		requireScope(auth.ScopeUsersWrite, a.uploadImageHandler(service.ImageBanner)),
+	)
+
+	// Public profiles
+	mux.HandleFunc(
+		"GET /api/users/{handle}",
+		a.getProfileHandler,
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/chirps/{chirp_id}",
+		requireScope(auth.ScopeChirpsWrite, a.deleteChirpFromID),
+	)
+
+	// Likes, both are idempotent
+	mux.HandleFunc(
+		"POST /api/chirps/{chirpID}/like",
+		requireScope(auth.ScopeChirpsWrite, a.likeHandler(a.chirps.Like)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/chirps/{chirpID}/like",
+		requireScope(auth.ScopeChirpsWrite, a.likeHandler(a.chirps.Unlike)),
+	)
+
+	// Bookmarks are private, both are idempotent
+	mux.HandleFunc(
+		"POST /api/chirps/{chirpID}/bookmark",
+		requireScope(auth.ScopeChirpsWrite, a.bookmarkHandler(a.chirps.Bookmark)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/chirps/{chirpID}/bookmark",
+		requireScope(auth.ScopeChirpsWrite, a.bookmarkHandler(a.chirps.Unbookmark)),
+	)
+
+	mux.HandleFunc(
+		"GET /api/bookmarks",
+		requireScope(auth.ScopeChirpsRead, a.listBookmarksHandler),
+	)
+
+	// One vote per user, answers the poll with its tallies
+	mux.HandleFunc(
+		"POST /api/chirps/{chirpID}/vote",
+		requireScope(auth.ScopeChirpsWrite, a.votePollHandler),
+	)
+
+	// Reporting abusive content
+	mux.HandleFunc(
+		"POST /api/chirps/{chirpID}/report",
+		a.reportChirpHandler,
+	)
+
+	mux.HandleFunc(
+		"POST /api/users/{userID}/report",
+		a.reportUserHandler,
+	)
+
+	// Follows, blocks and mutes, the relationship service must be set before Routes is called
+	mux.HandleFunc(
+		"POST /api/users/{userID}/follow",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Follow)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/users/{userID}/follow",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Unfollow)),
+	)
+
+	mux.HandleFunc(
+		"POST /api/users/{userID}/block",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Block)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/users/{userID}/block",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Unblock)),
+	)
+
+	mux.HandleFunc(
+		"GET /api/users/me/blocks",
+		requireScope(auth.ScopeUsersRead, a.listBlocksHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /api/users/{userID}/mute",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Mute)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/users/{userID}/mute",
+		requireScope(auth.ScopeUsersWrite, a.relationshipHandler(a.relationships.Unmute)),
+	)
+
+	mux.HandleFunc(
+		"GET /api/users/me/mutes",
+		requireScope(auth.ScopeUsersRead, a.listMutesHandler),
+	)
+
+	// Lists of users, public ones can be read by anyone, private ones only by their owner
+	mux.HandleFunc(
+		"POST /api/lists",
+		requireScope(auth.ScopeUsersWrite, a.createListHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/lists",
+		requireScope(auth.ScopeUsersRead, a.listListsHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/lists/{listID}",
+		requireScope(auth.ScopeUsersRead, a.getListHandler),
+	)
+
+	mux.HandleFunc(
+		"PUT /api/lists/{listID}",
+		requireScope(auth.ScopeUsersWrite, a.updateListHandler),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/lists/{listID}",
+		requireScope(auth.ScopeUsersWrite, a.deleteListHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/lists/{listID}/members",
+		requireScope(auth.ScopeUsersRead, a.listMembersHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /api/lists/{listID}/members/{userID}",
+		requireScope(auth.ScopeUsersWrite, a.listMemberHandler(a.lists.AddMember)),
+	)
+
+	mux.HandleFunc(
+		"DELETE /api/lists/{listID}/members/{userID}",
+		requireScope(auth.ScopeUsersWrite, a.listMemberHandler(a.lists.RemoveMember)),
+	)
+
+	// The chirps of the list's members, filtered like GET /api/chirps
+	mux.HandleFunc(
+		"GET /api/lists/{listID}/chirps",
+		requireScope(auth.ScopeChirpsRead, a.listTimelineHandler),
+	)
+
+	// Mentions, replies, likes and follows, grouped per chirp
+	mux.HandleFunc(
+		"GET /api/notifications",
+		requireScope(auth.ScopeNotificationsRead, a.listNotificationsHandler),
+	)
+
+	mux.HandleFunc(
+		"POST /api/notifications/read",
+		requireScope(auth.ScopeNotificationsWrite, a.markNotificationsReadHandler),
+	)
+
+	mux.HandleFunc(
+		"GET /api/notifications/preferences",
+		requireScope(auth.ScopeNotificationsRead, a.getNotificationPreferencesHandler),
+	)
+
+	mux.HandleFunc(
+		"PUT /api/notifications/preferences",
+		requireScope(auth.ScopeNotificationsWrite, a.setNotificationPreferencesHandler),
+	)
+
+	return mux
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/service"
+	"github.com/itsmandrew/server-go/internal/stream"
+)
+
+// How long EventSource clients wait before reconnecting, in milliseconds
+const streamRetry = 3000
+
+// Pushes chirp events as Server-Sent Events until the client goes away
+func (a *API) streamHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Anonymous clients get the public stream, signed in ones also lose blocked and muted authors
+	viewerID, err := a.optionalViewer(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := a.streams.Filter(r.Context(), viewerID, service.StreamQuery{
+		Author:   query.Get("author"),
+		Tag:      query.Get("tag"),
+		Timeline: query.Get("timeline"),
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// EventSource sends the ID of the last event it got when it reconnects
+	sub := a.hub.Subscribe(r.Header.Get("Last-Event-ID"), filter)
+	defer sub.Close()
+
+	// The stream outlives the server's WriteTimeout, every write below is flushed right away
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Stream: clearing the write deadline: %v", err)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the events
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	for _, e := range sub.Replay {
+		writeEvent(w, e)
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(a.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+
+		case e, ok := <-sub.Events:
+			// Dropped for being too slow, the client reconnects with Last-Event-ID
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Event data is compact JSON, so it always fits on a single data line
+func writeEvent(w io.Writer, e stream.Event) {
+	if e.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", e.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+}
+
+// Best effort, the request already succeeded so a failed publish is only logged
+func (a *API) publish(ctx context.Context, typ string, authorID uuid.UUID, tags []string, data any) {
+
+	if a.events == nil {
+		return
+	}
+
+	e, err := stream.NewEvent(typ, authorID, tags, data)
+	if err == nil {
+		err = a.events.Publish(ctx, e)
+	}
+
+	if err != nil {
+		log.Printf("Publishing %s event: %v", typ, err)
+	}
+}
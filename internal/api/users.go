@@ -0,0 +1,155 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+// Handler for creating a user
+func (a *API) createUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// Optional, derived from the email when left out
+		Handle string `json:"handle"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	user, err := a.users.Create(r.Context(), params.Email, params.Password, params.Handle)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created user: %v\n", user.ID)
+	respondWithJson(w, http.StatusCreated, User{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		Role:      user.Role,
+		Handle:    user.Handle,
+	})
+}
+
+// Partial update of the caller's account, fields left out of the body keep their value
+func (a *API) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email       *string `json:"email"`
+		Password    *string `json:"password"`
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Location    *string `json:"location"`
+		Website     *string `json:"website"`
+	}
+
+	// 1. Validate the access token
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 2. Decode the body
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// 3. Validate and save
+	user, err := a.users.Update(r.Context(), userID, service.UserUpdate{
+		Email:       params.Email,
+		Password:    params.Password,
+		Handle:      params.Handle,
+		DisplayName: params.DisplayName,
+		Bio:         params.Bio,
+		Location:    params.Location,
+		Website:     params.Website,
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, userFromDB(user, a.media.URLs))
+}
+
+func (a *API) getMeHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := a.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	user, err := a.users.Me(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, userFromDB(user, a.media.URLs))
+}
+
+// Public profile page, no authentication needed
+func (a *API) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+
+	profile, err := a.users.Profile(r.Context(), r.PathValue("handle"))
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, profileFromDB(profile, a.media.URLs))
+}
+
+func (a *API) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := parseIDParam(r, "userID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	actorID := principalFrom(r).UserID
+	user, err := a.users.SetRole(r.Context(), actorID, userID, params.Role)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("User %v set the role of %v to %s\n", actorID, user.ID, user.Role)
+	respondWithJson(w, http.StatusOK, userFromDB(user, a.media.URLs))
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/service"
+)
+
+func (a *API) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhooks, err := a.webhooks.List(r.Context())
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, webhooksFromDB(webhooks))
+}
+
+func (a *API) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		URL         string   `json:"url"`
+		Description string   `json:"description"`
+		Events      []string `json:"events"`
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	webhook, err := a.webhooks.Create(r.Context(), service.WebhookInput{
+		URL:         params.URL,
+		Description: params.Description,
+		Events:      params.Events,
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	log.Printf("Created webhook %v for %s\n", webhook.ID, webhook.Url)
+
+	// The only time the secret is shown, the partner needs it to verify the signatures
+	out := webhookFromDB(webhook)
+	out.Secret = webhook.Secret
+	respondWithJson(w, http.StatusCreated, out)
+}
+
+func (a *API) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	webhook, err := a.webhooks.Get(r.Context(), webhookID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, webhookFromDB(webhook))
+}
+
+// Partial update, missing fields keep their value
+func (a *API) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		URL         *string   `json:"url"`
+		Description *string   `json:"description"`
+		Events      *[]string `json:"events"`
+		Active      *bool     `json:"active"`
+	}
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := parameters{}
+
+	if err := decodeJSON(r, &params); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	webhook, err := a.webhooks.Update(r.Context(), webhookID, service.WebhookUpdate{
+		URL:         params.URL,
+		Description: params.Description,
+		Events:      params.Events,
+		Active:      params.Active,
+	})
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, webhookFromDB(webhook))
+}
+
+func (a *API) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if err := a.webhooks.Delete(r.Context(), webhookID); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondNoContent(w)
+}
+
+func (a *API) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := service.DefaultWebhookDeliveryPageSize
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+
+		if err != nil {
+			respondWithError(w, r, apierror.Validation(apierror.FieldError{Field: "limit", Message: "must be a number"}))
+			return
+		}
+	}
+
+	deliveries, err := a.webhooks.Deliveries(r.Context(), webhookID, query.Get("status"), limit)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, webhookDeliveriesFromDB(deliveries))
+}
+
+// One delivery with its payload and every attempt made
+func (a *API) getWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveryID, err := parseIDParam(r, "deliveryID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	delivery, attempts, err := a.webhooks.Delivery(r.Context(), webhookID, deliveryID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, webhookDeliveryDetailFromDB(delivery, attempts))
+}
+
+// Queues the delivery again, the worker sends it on its next round
+func (a *API) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhookID, err := parseIDParam(r, "webhookID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveryID, err := parseIDParam(r, "deliveryID")
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	delivery, err := a.webhooks.Redeliver(r.Context(), webhookID, deliveryID)
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJson(w, http.StatusAccepted, webhookDeliveryFromDB(delivery))
+}
@@ -0,0 +1,194 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Code is a stable, machine-readable error identifier clients can switch on
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeInvalidJSON        Code = "invalid_json"
+	CodeInvalidID          Code = "invalid_id"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeContentRejected    Code = "content_rejected"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidToken       Code = "invalid_token"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeForbidden          Code = "forbidden"
+	CodeInsufficientScope  Code = "insufficient_scope"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodePayloadTooLarge    Code = "payload_too_large"
+	CodeInternal           Code = "internal_error"
+	// An upstream service such as an identity provider failed or could not be reached
+	CodeProviderUnavailable Code = "provider_unavailable"
+)
+
+// Media type for RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is returned by handlers and services, it carries the HTTP status, a stable code,
+// a message that is safe to show to clients and optionally the internal cause for logging
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCause attaches the underlying error, it is logged but never sent to the client
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(code Code, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+func Unauthorized(code Code, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Validation is a 422 listing every field that failed
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidationFailed, "Request validation failed")
+	e.Fields = fields
+	return e
+}
+
+// Internal hides err behind a generic message, the cause only ends up in the logs
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "Something went wrong").WithCause(err)
+}
+
+// From turns any error into an *Error, unknown errors become a 500
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal(err)
+}
+
+type envelope struct {
+	Error envelopeBody `json:"error"`
+}
+
+type envelopeBody struct {
+	Code    Code         `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// Problem is the RFC 7807 representation, code and fields are extension members
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// Write sends err to the client, as problem+json when the request asks for it and as the
+// {"error": {...}} envelope otherwise. Server errors are logged with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+
+	apiErr := From(err)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, apiErr)
+	}
+
+	var (
+		payload     any
+		contentType string
+	)
+
+	if wantsProblem(r) {
+		contentType = ProblemContentType
+		payload = Problem{
+			Type:     "urn:chirpy:problem:" + string(apiErr.Code),
+			Title:    http.StatusText(apiErr.Status),
+			Status:   apiErr.Status,
+			Detail:   apiErr.Message,
+			Instance: r.URL.Path,
+			Code:     apiErr.Code,
+			Fields:   apiErr.Fields,
+		}
+	} else {
+		contentType = "application/json"
+		payload = envelope{Error: envelopeBody{
+			Code:    apiErr.Code,
+			Message: apiErr.Message,
+			Fields:  apiErr.Fields,
+		}}
+	}
+
+	body, marshalErr := json.Marshal(payload)
+	if marshalErr != nil {
+		log.Printf("Marshalling error response failed: %v", marshalErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
+
+// Clients opt into RFC 7807 responses through the Accept header
+func wantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteEnvelope(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+	w := httptest.NewRecorder()
+
+	Write(w, r, Validation(FieldError{Field: "email", Message: "is required"}))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+
+	var body envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	if body.Error.Code != CodeValidationFailed || len(body.Error.Fields) != 1 || body.Error.Fields[0].Field != "email" {
+		t.Errorf("unexpected envelope %+v", body.Error)
+	}
+}
+
+func TestWriteProblemJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/chirps/123", nil)
+	r.Header.Set("Accept", "application/json, application/problem+json;q=0.9")
+	w := httptest.NewRecorder()
+
+	Write(w, r, NotFound("Chirp not found"))
+
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("expected %s, got %q", ProblemContentType, ct)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	if problem.Status != http.StatusNotFound || problem.Code != CodeNotFound || problem.Instance != "/api/chirps/123" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+}
+
+func TestWriteHidesInternalErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	w := httptest.NewRecorder()
+
+	Write(w, r, errors.New(`pq: relation "chirps" does not exist`))
+
+	var body envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	if w.Code != http.StatusInternalServerError || body.Error.Code != CodeInternal || body.Error.Message != "Something went wrong" {
+		t.Errorf("expected a generic 500, got %d %+v", w.Code, body.Error)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope is a slice of the API a personal API key may use, session tokens have every scope
+type Scope string
+
+const (
+	ScopeChirpsRead         Scope = "chirps:read"
+	ScopeChirpsWrite        Scope = "chirps:write"
+	ScopeUsersRead          Scope = "users:read"
+	ScopeUsersWrite         Scope = "users:write"
+	ScopeNotificationsRead  Scope = "notifications:read"
+	ScopeNotificationsWrite Scope = "notifications:write"
+)
+
+// Scopes lists every scope a key can be given
+var Scopes = []Scope{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeNotificationsRead,
+	ScopeNotificationsWrite,
+}
+
+// ParseScope checks s is a known scope
+func ParseScope(s string) (Scope, error) {
+	if !slices.Contains(Scopes, Scope(s)) {
+		return "", fmt.Errorf("unknown scope %q", s)
+	}
+	return Scope(s), nil
+}
+
+// ParseScopes reads an OAuth scope parameter, space separated scopes of which there must be one
+func ParseScopes(s string) ([]Scope, error) {
+
+	var scopes []Scope
+	for _, field := range strings.Fields(s) {
+		scope, err := ParseScope(field)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, errors.New("no scope")
+	}
+	return scopes, nil
+}
+
+// JoinScopes is the inverse of ParseScopes
+func JoinScopes(scopes []Scope) string {
+	fields := make([]string, len(scopes))
+	for i, scope := range scopes {
+		fields[i] = string(scope)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Every key starts with this, it tells keys and JWTs apart and makes leaked keys easy to scan for
+const apiKeyPrefix = "chirpy_"
+
+// Characters of the key kept as its visible prefix, enough to tell a user's keys apart
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+// MakeAPIKey returns a new personal API key along with the prefix to display for it. Only
+// HashAPIKey(key) is stored.
+func MakeAPIKey() (key, prefix string, err error) {
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// IsAPIKey reports whether a bearer token is a personal API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// HashAPIKey is the value stored and looked up for key. The key carries 256 random bits, so a
+// plain SHA-256 is enough, unlike passwords which need bcrypt.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
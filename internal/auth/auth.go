@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -15,9 +16,13 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PasswordCost is the bcrypt cost of new password hashes. Tests lower it to bcrypt.MinCost, a
+// hash is checked at the cost it was made with whatever this is set to later.
+var PasswordCost = bcrypt.DefaultCost
+
 func HashedPassword(password string) (string, error) {
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
 
 	if err != nil {
 		log.Println("Encrypt failed, see error")
@@ -39,16 +44,45 @@ func CheckPasswordHash(hash, password string) error {
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// Claims are the registered JWT claims plus the user's role. Tokens issued to an OAuth client
+// also carry its id and the space separated scopes the user granted it.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role     Role   `json:"role,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+func MakeJWT(userID uuid.UUID, role Role, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(newClaims(userID, role, expiresIn), tokenSecret)
+}
+
+// MakeClientJWT issues an access token to an OAuth client acting for userID, limited to scopes
+func MakeClientJWT(userID uuid.UUID, role Role, clientID uuid.UUID, scopes []Scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+
+	claims := newClaims(userID, role, expiresIn)
+	claims.ClientID = clientID.String()
+	claims.Scope = JoinScopes(scopes)
+
+	return signJWT(claims, tokenSecret)
+}
+
+func newClaims(userID uuid.UUID, role Role, expiresIn time.Duration) Claims {
 
 	now := time.Now().UTC()
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject:   userID.String(),
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role: role,
 	}
+}
+
+func signJWT(claims Claims, tokenSecret string) (string, error) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -62,29 +96,71 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return ss, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ValidateJWT checks the signature and expiry and returns who the token was issued to
+func ValidateJWT(tokenString, tokenSecret string) (Principal, error) {
+
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return claims.Principal()
+}
+
+// ParseJWT checks the signature and expiry and returns the claims, for callers that need more
+// than the Principal, such as the issue and expiry times
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
 
 	token, err := jwt.ParseWithClaims(tokenString,
-		&jwt.RegisteredClaims{},
+		&Claims{},
 		func(token *jwt.Token) (interface{}, error) {
+			// Only accept the algorithm we sign with, never let the token pick it
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
 			return []byte(tokenSecret), nil
 		},
 	)
 
-	var nullID uuid.UUID
-
 	if err != nil {
-		log.Fatal(err)
-		return nullID, err
+		return nil, err
 	}
 
-	subject := token.Claims.(*jwt.RegisteredClaims).Subject
-	uid, err := uuid.Parse(subject)
+	return token.Claims.(*Claims), nil
+}
+
+// Principal returns who the token was issued to
+func (claims *Claims) Principal() (Principal, error) {
+
+	uid, err := uuid.Parse(claims.Subject)
 
 	if err != nil {
-		return uuid.UUID{}, err
+		return Principal{}, err
+	}
+
+	// Tokens issued before roles existed belong to regular users
+	role := claims.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	if _, err := ParseRole(string(role)); err != nil {
+		return Principal{}, err
 	}
-	return uid, nil
+
+	principal := Principal{UserID: uid, Role: role}
+
+	if claims.ClientID != "" {
+		if principal.ClientID, err = uuid.Parse(claims.ClientID); err != nil {
+			return Principal{}, err
+		}
+		// A client token without scopes can't do anything, it must not fall back to a session
+		if principal.Scopes, err = ParseScopes(claims.Scope); err != nil {
+			return Principal{}, err
+		}
+	}
+
+	return principal, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -98,6 +174,23 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return strings.TrimPrefix(token, "Bearer "), nil
 }
 
+// GetAPIKey reads an "Authorization: ApiKey <key>" header, used by the services calling our webhooks
+func GetAPIKey(headers http.Header) (string, error) {
+
+	header := headers.Get("Authorization")
+
+	if header == "" {
+		return "", errors.New("no Authorization field found")
+	}
+
+	key, ok := strings.CutPrefix(header, "ApiKey ")
+	if !ok || key == "" {
+		return "", errors.New("malformed Authorization field, expected ApiKey <key>")
+	}
+
+	return key, nil
+}
+
 func MakeRefreshToken() (string, error) {
 
 	key := make([]byte, 32)
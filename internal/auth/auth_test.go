@@ -47,7 +47,7 @@ func TestMakeAndValidateJWT(t *testing.T) {
 	expiresIn := 5 * time.Minute
 
 	// Make JWT and assert no error and non-empty token strings
-	tokenString, err := MakeJWT(userID, secret, expiresIn)
+	tokenString, err := MakeJWT(userID, RoleModerator, secret, expiresIn)
 
 	if err != nil {
 		t.Fatalf("MakeJWT returned an unexpected error: %v", err)
@@ -57,13 +57,17 @@ func TestMakeAndValidateJWT(t *testing.T) {
 		t.Fatalf("MakeJWT returned an empty token string")
 	}
 
-	parsedID, err := ValidateJWT(tokenString, secret)
+	principal, err := ValidateJWT(tokenString, secret)
 	if err != nil {
 		t.Fatalf("ValidateJWT returned an unexpected error: %v", err)
 	}
 
-	if parsedID != userID {
-		t.Errorf("ValidateJWT returned %q; expected %q", parsedID, userID)
+	if principal.UserID != userID {
+		t.Errorf("ValidateJWT returned %q; expected %q", principal.UserID, userID)
+	}
+
+	if principal.Role != RoleModerator {
+		t.Errorf("ValidateJWT returned role %q; expected %q", principal.Role, RoleModerator)
 	}
 }
 
@@ -94,3 +98,186 @@ func TestGetBearerTokenFail(t *testing.T) {
 		t.Fatalf("expected error for missing Authorization header, got token %q", token)
 	}
 }
+
+func TestGetAPIKey(t *testing.T) {
+
+	header := http.Header{}
+	header.Set("Authorization", "ApiKey f271c81ff7084ee5b99a5091b42d486e")
+
+	key, err := GetAPIKey(header)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if key != "f271c81ff7084ee5b99a5091b42d486e" {
+		t.Errorf("expected the key after the scheme, got %q", key)
+	}
+
+	for _, value := range []string{"", "Bearer f271c81ff7084ee5b99a5091b42d486e", "ApiKey "} {
+		header.Set("Authorization", value)
+
+		if key, err := GetAPIKey(header); err == nil {
+			t.Errorf("expected an error for %q, got key %q", value, key)
+		}
+	}
+}
+
+func TestValidateJWTRejectsBadTokens(t *testing.T) {
+
+	userID := uuid.New()
+
+	expired, err := MakeJWT(userID, RoleUser, "my-super-secret", -time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an unexpected error: %v", err)
+	}
+
+	cases := map[string]struct {
+		token  string
+		secret string
+	}{
+		"wrong secret": {token: expired, secret: "another-secret"},
+		"expired":      {token: expired, secret: "my-super-secret"},
+		"garbage":      {token: "not.a.jwt", secret: "my-super-secret"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ValidateJWT(tc.token, tc.secret); err == nil {
+				t.Error("expected ValidateJWT to return an error, got nil")
+			}
+		})
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+
+	cases := []struct {
+		role Role
+		perm Permission
+		want bool
+	}{
+		{RoleUser, PermReviewModeration, false},
+		{RoleModerator, PermReviewModeration, true},
+		{RoleModerator, PermManageModeration, false},
+		{RoleModerator, PermResetData, false},
+		{RoleAdmin, PermManageRoles, true},
+		{RoleAdmin, PermViewMetrics, true},
+		{RoleModerator, PermManageWebhooks, false},
+		{RoleAdmin, PermManageWebhooks, true},
+		{"superuser", PermViewMetrics, false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.role.Can(tc.perm); got != tc.want {
+			t.Errorf("%s.Can(%s) = %v; expected %v", tc.role, tc.perm, got, tc.want)
+		}
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsAPIKey(key) || !strings.HasPrefix(key, prefix) || len(prefix) >= len(key) {
+		t.Errorf("unexpected key %q with prefix %q", key, prefix)
+	}
+
+	other, _, _ := MakeAPIKey()
+	if key == other || HashAPIKey(key) == HashAPIKey(other) {
+		t.Error("expected two keys to differ")
+	}
+
+	if HashAPIKey(key) != HashAPIKey(key) || strings.Contains(HashAPIKey(key), key) {
+		t.Error("expected a stable hash that does not contain the key")
+	}
+
+	if IsAPIKey("header.payload.signature") {
+		t.Error("expected a JWT not to be taken for an API key")
+	}
+}
+
+func TestPrincipalScopes(t *testing.T) {
+	session := Principal{UserID: uuid.New(), Role: RoleUser}
+	key := Principal{UserID: session.UserID, Role: RoleUser, APIKeyID: uuid.New(), Scopes: []Scope{ScopeChirpsRead}}
+
+	if !session.HasScope(ScopeChirpsWrite) {
+		t.Error("expected a session to have every scope")
+	}
+
+	if !key.HasScope(ScopeChirpsRead) || key.HasScope(ScopeChirpsWrite) {
+		t.Errorf("expected the key to be limited to %v", key.Scopes)
+	}
+
+	if _, err := ParseScope("chirps:delete"); err == nil {
+		t.Error("expected an unknown scope to be rejected")
+	}
+}
+
+func TestMakeClientJWT(t *testing.T) {
+	userID, clientID := uuid.New(), uuid.New()
+	scopes := []Scope{ScopeChirpsRead, ScopeUsersRead}
+
+	token, err := MakeClientJWT(userID, RoleUser, clientID, scopes, "secret", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := ValidateJWT(token, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if principal.UserID != userID || principal.ClientID != clientID || !principal.IsClient() || principal.IsAPIKey() {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	if !principal.HasScope(ScopeChirpsRead) || principal.HasScope(ScopeChirpsWrite) {
+		t.Errorf("expected the token to be limited to %v, got %v", scopes, principal.Scopes)
+	}
+
+	session, _ := MakeJWT(userID, RoleUser, "secret", time.Minute)
+	if principal, _ := ValidateJWT(session, "secret"); principal.Delegated() {
+		t.Error("expected a session token not to be delegated")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" chirps:read  users:read chirps:read ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := JoinScopes(scopes); got != "chirps:read users:read" {
+		t.Errorf("JoinScopes = %q", got)
+	}
+
+	for _, bad := range []string{"", "   ", "chirps:read chirps:delete"} {
+		if _, err := ParseScopes(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	// The example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Errorf("PKCEChallenge = %q; expected %q", got, challenge)
+	}
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("expected the verifier to match")
+	}
+
+	if VerifyPKCE(verifier+"x", challenge) || VerifyPKCE("short", PKCEChallenge("short")) {
+		t.Error("expected a wrong or too short verifier to be rejected")
+	}
+
+	if ValidCodeVerifier(strings.Repeat("a", 42)) || ValidCodeVerifier(strings.Repeat("a", 42)+"!") || !ValidCodeVerifier(strings.Repeat("a", 128)) {
+		t.Error("unexpected code_verifier validation")
+	}
+}
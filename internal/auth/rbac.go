@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Role is stored on the user and carried in the access token
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists every role, lowest privilege first
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// ParseRole checks s is a known role
+func ParseRole(s string) (Role, error) {
+	if !slices.Contains(Roles, Role(s)) {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return Role(s), nil
+}
+
+// Permission is a single capability a route can require
+type Permission string
+
+const (
+	PermViewMetrics      Permission = "metrics:view"
+	PermResetData        Permission = "data:reset"
+	PermSeedData         Permission = "data:seed"
+	PermManageRoles      Permission = "roles:manage"
+	PermManageModeration Permission = "moderation:manage"
+	PermReviewModeration Permission = "moderation:review"
+	PermManageWebhooks   Permission = "webhooks:manage"
+)
+
+// What each role may do, regular users have no admin permissions at all
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {
+		PermReviewModeration,
+	},
+	RoleAdmin: {
+		PermViewMetrics,
+		PermResetData,
+		PermSeedData,
+		PermManageRoles,
+		PermManageModeration,
+		PermReviewModeration,
+		PermManageWebhooks,
+	},
+}
+
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID uuid.UUID
+	Role   Role
+
+	// Set when the caller used a personal API key, which is limited to Scopes
+	APIKeyID uuid.UUID
+	// Set when the caller is an OAuth client acting for the user, also limited to Scopes
+	ClientID uuid.UUID
+	Scopes   []Scope
+}
+
+// IsAPIKey reports whether the caller authenticated with a personal API key
+func (p Principal) IsAPIKey() bool {
+	return p.APIKeyID != uuid.Nil
+}
+
+// IsClient reports whether the caller is a third-party app holding an OAuth access token
+func (p Principal) IsClient() bool {
+	return p.ClientID != uuid.Nil
+}
+
+// Delegated reports whether the caller only holds the Scopes it was given rather than a session
+func (p Principal) Delegated() bool {
+	return p.IsAPIKey() || p.IsClient()
+}
+
+// HasScope reports whether the caller may use the routes under scope, always true for a session
+func (p Principal) HasScope(scope Scope) bool {
+	return !p.Delegated() || slices.Contains(p.Scopes, scope)
+}
+
+func (p Principal) Can(perm Permission) bool {
+	return p.Role.Can(perm)
+}
@@ -0,0 +1,656 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Env var pointing at an optional YAML or TOML config file
+const FileEnvVar = "CHIRPY_CONFIG"
+
+// Shortest JWT secret we accept, HS256 wants at least 256 bits of key material
+const minJWTSecretLength = 32
+
+// Platforms the server runs on. Only dev and test hold data that may be thrown away, which
+// unlocks the admin reset and seed tooling.
+const (
+	PlatformDev  = "dev"
+	PlatformTest = "test"
+	PlatformProd = "prod"
+)
+
+var platforms = []string{PlatformDev, PlatformTest, PlatformProd}
+
+// Disposable reports whether the data on platform may be wiped and reseeded
+func Disposable(platform string) bool {
+	return platform == PlatformDev || platform == PlatformTest
+}
+
+// Config holds every setting the server needs, loaded once at startup
+type Config struct {
+	Port      int
+	DBURL     string
+	Platform  string
+	JWTSecret string
+
+	// Applies pending migrations on boot, otherwise the server refuses to start until they are run
+	AutoMigrate bool
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	ChirpMaxLength int
+	BannedWords    []string
+
+	// How often chirps scheduled with publish_at are checked for being due
+	ChirpPublishInterval time.Duration
+
+	// How often rules changed through the admin API (possibly on another instance) are picked up
+	ModerationReloadInterval time.Duration
+
+	// How long a deleted account can still be recovered by logging in, and how often expired ones are purged
+	AccountDeletionGracePeriod time.Duration
+	AccountPurgeInterval       time.Duration
+
+	// Shared secret Polka sends with its webhooks, empty refuses every webhook
+	PolkaKey string
+
+	Stream   StreamConfig
+	Outbox   OutboxConfig
+	Webhooks WebhooksConfig
+
+	Server ServerConfig
+	Media  MediaConfig
+	OIDC   OIDCConfig
+	Mail   MailConfig
+}
+
+// ServerConfig holds the http.Server timeouts
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+// StreamConfig controls the live chirp stream at /api/stream
+type StreamConfig struct {
+	// Comment lines sent on idle connections so proxies don't close them
+	HeartbeatInterval time.Duration
+	// How many recent events are kept for clients resuming with Last-Event-ID
+	ReplayBuffer int
+}
+
+// OutboxConfig controls the domain event dispatcher, see internal/events
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Delivered events are kept this long for inspection, then deleted
+	Retention time.Duration
+}
+
+// WebhooksConfig controls the deliveries to the partner webhooks
+type WebhooksConfig struct {
+	PollInterval time.Duration
+	// Per request, a slower receiver counts as a failed attempt
+	Timeout     time.Duration
+	MaxAttempts int
+	// Wait before the first retry, doubled on every later one
+	RetryDelay time.Duration
+}
+
+// MediaConfig controls profile image uploads
+type MediaConfig struct {
+	// Uploaded images are stored here and served under /app/media/
+	Dir            string
+	MaxUploadBytes int
+}
+
+// MailConfig controls outgoing email and the magic login links sent with it
+type MailConfig struct {
+	// host:port of the SMTP server. Empty writes the emails to the log on dev and test and
+	// disables magic links on prod.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+
+	// The web app page that receives the token (?token=...) and posts it to /api/login/magic/verify
+	MagicLinkURL string
+	MagicLinkTTL time.Duration
+}
+
+// OIDCConfig lists the OpenID Connect providers users can sign in with
+type OIDCConfig struct {
+	// Where the web app receives the providers' redirects, registered with every provider
+	RedirectURL string
+	Providers   []OIDCProvider
+}
+
+// OIDCProvider is configured by OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET
+type OIDCProvider struct {
+	// Lower-case, it appears in the login URLs (/api/login/oidc/{name})
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// Addr is the listen address for http.Server
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// Every key we understand, config files use the lower-case form ("server.read_timeout" -> SERVER_READ_TIMEOUT)
+var knownKeys = []string{
+	"PORT",
+	"DB_URL",
+	"AUTO_MIGRATE",
+	"PLATFORM",
+	"JWT_SECRET",
+	"ACCESS_TOKEN_TTL",
+	"REFRESH_TOKEN_TTL",
+	"CHIRP_MAX_LENGTH",
+	"BANNED_WORDS",
+	"CHIRP_PUBLISH_INTERVAL",
+	"MODERATION_RELOAD_INTERVAL",
+	"ACCOUNT_DELETION_GRACE_PERIOD",
+	"ACCOUNT_PURGE_INTERVAL",
+	"STREAM_HEARTBEAT_INTERVAL",
+	"STREAM_REPLAY_BUFFER",
+	"POLKA_KEY",
+	"OUTBOX_POLL_INTERVAL",
+	"OUTBOX_BATCH_SIZE",
+	"OUTBOX_RETENTION",
+	"WEBHOOK_POLL_INTERVAL",
+	"WEBHOOK_TIMEOUT",
+	"WEBHOOK_MAX_ATTEMPTS",
+	"WEBHOOK_RETRY_DELAY",
+	"SERVER_READ_TIMEOUT",
+	"SERVER_READ_HEADER_TIMEOUT",
+	"SERVER_WRITE_TIMEOUT",
+	"SERVER_IDLE_TIMEOUT",
+	"SERVER_SHUTDOWN_TIMEOUT",
+	"MEDIA_DIR",
+	"MEDIA_MAX_UPLOAD_BYTES",
+	"OIDC_PROVIDERS",
+	"OIDC_REDIRECT_URL",
+	"SMTP_ADDR",
+	"SMTP_USERNAME",
+	"SMTP_PASSWORD",
+	"MAIL_FROM",
+	"MAGIC_LINK_URL",
+	"MAGIC_LINK_TTL",
+}
+
+// The per provider keys, their number depends on OIDC_PROVIDERS
+var oidcProviderKey = regexp.MustCompile(`^OIDC_[A-Z0-9]+_(ISSUER|CLIENT_ID|CLIENT_SECRET)$`)
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+func isKnownKey(key string) bool {
+	return slices.Contains(knownKeys, key) || oidcProviderKey.MatchString(key)
+}
+
+// Default values, anything that isn't listed here has to be provided
+var defaults = map[string]string{
+	"PORT":                          "8080",
+	"PLATFORM":                      PlatformProd,
+	"AUTO_MIGRATE":                  "false",
+	"ACCESS_TOKEN_TTL":              "1h",
+	"REFRESH_TOKEN_TTL":             "1440h",
+	"CHIRP_MAX_LENGTH":              "140",
+	"BANNED_WORDS":                  "kerfuffle,sharbert,fornax",
+	"CHIRP_PUBLISH_INTERVAL":        "15s",
+	"MODERATION_RELOAD_INTERVAL":    "1m",
+	"ACCOUNT_DELETION_GRACE_PERIOD": "720h",
+	"ACCOUNT_PURGE_INTERVAL":        "1h",
+	"STREAM_HEARTBEAT_INTERVAL":     "15s",
+	"STREAM_REPLAY_BUFFER":          "1000",
+	"OUTBOX_POLL_INTERVAL":          "1s",
+	"OUTBOX_BATCH_SIZE":             "100",
+	"OUTBOX_RETENTION":              "168h",
+	"WEBHOOK_POLL_INTERVAL":         "1s",
+	"WEBHOOK_TIMEOUT":               "10s",
+	"WEBHOOK_MAX_ATTEMPTS":          "8",
+	"WEBHOOK_RETRY_DELAY":           "30s",
+	"SERVER_READ_TIMEOUT":           "10s",
+	"SERVER_READ_HEADER_TIMEOUT":    "5s",
+	"SERVER_WRITE_TIMEOUT":          "15s",
+	"SERVER_IDLE_TIMEOUT":           "60s",
+	"SERVER_SHUTDOWN_TIMEOUT":       "20s",
+	"MEDIA_DIR":                     "media",
+	"MEDIA_MAX_UPLOAD_BYTES":        "5242880",
+	"MAIL_FROM":                     "Chirpy <no-reply@localhost>",
+	"MAGIC_LINK_URL":                "http://localhost:8080/app/login/magic",
+	"MAGIC_LINK_TTL":                "15m",
+}
+
+// ValidationError lists every problem found in the configuration, so they can all be fixed in one go
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load builds the Config from (lowest to highest precedence) defaults, the optional config file
+// named by path or $CHIRPY_CONFIG, .env and the process environment, then validates it
+func Load(path string) (*Config, error) {
+
+	// loads .env into the process’s env vars; does not override variables that are already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+
+	if path == "" {
+		path = os.Getenv(FileEnvVar)
+	}
+
+	values := map[string]string{}
+
+	if path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values = fileValues
+		log.Printf("Loaded config file %s", path)
+	}
+
+	for _, key := range knownKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			values[key] = v
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		if key, v, _ := strings.Cut(kv, "="); oidcProviderKey.MatchString(key) {
+			values[key] = v
+		}
+	}
+
+	return parse(values)
+}
+
+// Parses and validates raw values keyed by env var name
+func parse(values map[string]string) (*Config, error) {
+
+	p := parser{values: values}
+	cfg := &Config{
+		Port:      p.int("PORT"),
+		DBURL:     p.string("DB_URL"),
+		Platform:  p.string("PLATFORM"),
+		JWTSecret: p.string("JWT_SECRET"),
+
+		AutoMigrate: p.bool("AUTO_MIGRATE"),
+
+		AccessTokenTTL:  p.duration("ACCESS_TOKEN_TTL"),
+		RefreshTokenTTL: p.duration("REFRESH_TOKEN_TTL"),
+
+		ChirpMaxLength: p.int("CHIRP_MAX_LENGTH"),
+		BannedWords:    p.list("BANNED_WORDS"),
+
+		ChirpPublishInterval: p.duration("CHIRP_PUBLISH_INTERVAL"),
+
+		ModerationReloadInterval: p.duration("MODERATION_RELOAD_INTERVAL"),
+
+		AccountDeletionGracePeriod: p.duration("ACCOUNT_DELETION_GRACE_PERIOD"),
+		AccountPurgeInterval:       p.duration("ACCOUNT_PURGE_INTERVAL"),
+
+		Stream: StreamConfig{
+			HeartbeatInterval: p.duration("STREAM_HEARTBEAT_INTERVAL"),
+			ReplayBuffer:      p.int("STREAM_REPLAY_BUFFER"),
+		},
+
+		PolkaKey: p.string("POLKA_KEY"),
+
+		Outbox: OutboxConfig{
+			PollInterval: p.duration("OUTBOX_POLL_INTERVAL"),
+			BatchSize:    p.int("OUTBOX_BATCH_SIZE"),
+			Retention:    p.duration("OUTBOX_RETENTION"),
+		},
+
+		Webhooks: WebhooksConfig{
+			PollInterval: p.duration("WEBHOOK_POLL_INTERVAL"),
+			Timeout:      p.duration("WEBHOOK_TIMEOUT"),
+			MaxAttempts:  p.int("WEBHOOK_MAX_ATTEMPTS"),
+			RetryDelay:   p.duration("WEBHOOK_RETRY_DELAY"),
+		},
+
+		Server: ServerConfig{
+			ReadTimeout:       p.duration("SERVER_READ_TIMEOUT"),
+			ReadHeaderTimeout: p.duration("SERVER_READ_HEADER_TIMEOUT"),
+			WriteTimeout:      p.duration("SERVER_WRITE_TIMEOUT"),
+			IdleTimeout:       p.duration("SERVER_IDLE_TIMEOUT"),
+			ShutdownTimeout:   p.duration("SERVER_SHUTDOWN_TIMEOUT"),
+		},
+
+		Media: MediaConfig{
+			Dir:            p.string("MEDIA_DIR"),
+			MaxUploadBytes: p.int("MEDIA_MAX_UPLOAD_BYTES"),
+		},
+
+		OIDC: p.oidc(),
+
+		Mail: MailConfig{
+			SMTPAddr:     p.string("SMTP_ADDR"),
+			SMTPUsername: p.string("SMTP_USERNAME"),
+			SMTPPassword: p.string("SMTP_PASSWORD"),
+			From:         p.string("MAIL_FROM"),
+			MagicLinkURL: p.string("MAGIC_LINK_URL"),
+			MagicLinkTTL: p.duration("MAGIC_LINK_TTL"),
+		},
+	}
+
+	cfg.validate(&p)
+
+	if len(p.problems) > 0 {
+		return nil, &ValidationError{Problems: p.problems}
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate(p *parser) {
+
+	if c.DBURL == "" {
+		p.fail("DB_URL is required")
+	}
+
+	if c.JWTSecret == "" {
+		p.fail("JWT_SECRET is required")
+	} else if len(c.JWTSecret) < minJWTSecretLength {
+		p.fail(fmt.Sprintf("JWT_SECRET must be at least %d characters", minJWTSecretLength))
+	}
+
+	if !slices.Contains(platforms, c.Platform) {
+		p.fail(fmt.Sprintf("PLATFORM must be one of %s, got %q", strings.Join(platforms, ", "), c.Platform))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		p.fail(fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+
+	if c.AccessTokenTTL <= 0 {
+		p.fail("ACCESS_TOKEN_TTL must be positive")
+	}
+
+	if c.RefreshTokenTTL <= 0 {
+		p.fail("REFRESH_TOKEN_TTL must be positive")
+	} else if c.RefreshTokenTTL < c.AccessTokenTTL {
+		p.fail("REFRESH_TOKEN_TTL must not be shorter than ACCESS_TOKEN_TTL")
+	}
+
+	if c.ChirpMaxLength <= 0 {
+		p.fail("CHIRP_MAX_LENGTH must be positive")
+	}
+
+	if c.ChirpPublishInterval <= 0 {
+		p.fail("CHIRP_PUBLISH_INTERVAL must be positive")
+	}
+
+	if c.ModerationReloadInterval <= 0 {
+		p.fail("MODERATION_RELOAD_INTERVAL must be positive")
+	}
+
+	if c.AccountDeletionGracePeriod < 0 {
+		p.fail("ACCOUNT_DELETION_GRACE_PERIOD must not be negative")
+	}
+
+	if c.AccountPurgeInterval <= 0 {
+		p.fail("ACCOUNT_PURGE_INTERVAL must be positive")
+	}
+
+	if c.Stream.HeartbeatInterval <= 0 {
+		p.fail("STREAM_HEARTBEAT_INTERVAL must be positive")
+	}
+
+	if c.Stream.ReplayBuffer < 0 {
+		p.fail("STREAM_REPLAY_BUFFER must not be negative")
+	}
+
+	if c.Outbox.PollInterval <= 0 {
+		p.fail("OUTBOX_POLL_INTERVAL must be positive")
+	}
+
+	if c.Outbox.BatchSize <= 0 {
+		p.fail("OUTBOX_BATCH_SIZE must be positive")
+	}
+
+	if c.Outbox.Retention < 0 {
+		p.fail("OUTBOX_RETENTION must not be negative")
+	}
+
+	if c.Webhooks.PollInterval <= 0 {
+		p.fail("WEBHOOK_POLL_INTERVAL must be positive")
+	}
+
+	if c.Webhooks.Timeout <= 0 {
+		p.fail("WEBHOOK_TIMEOUT must be positive")
+	}
+
+	if c.Webhooks.MaxAttempts <= 0 {
+		p.fail("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+
+	if c.Webhooks.RetryDelay <= 0 {
+		p.fail("WEBHOOK_RETRY_DELAY must be positive")
+	}
+
+	if c.Server.ShutdownTimeout <= 0 {
+		p.fail("SERVER_SHUTDOWN_TIMEOUT must be positive")
+	}
+
+	if c.Media.Dir == "" {
+		p.fail("MEDIA_DIR must not be empty")
+	}
+
+	if c.Media.MaxUploadBytes <= 0 {
+		p.fail("MEDIA_MAX_UPLOAD_BYTES must be positive")
+	}
+
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		p.fail(fmt.Sprintf("MAIL_FROM must be an email address, got %q", c.Mail.From))
+	}
+
+	if c.Mail.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Mail.SMTPAddr); err != nil {
+			p.fail(fmt.Sprintf("SMTP_ADDR must be host:port, got %q", c.Mail.SMTPAddr))
+		}
+	}
+
+	if !isAbsoluteURL(c.Mail.MagicLinkURL) {
+		p.fail("MAGIC_LINK_URL must be an absolute URL")
+	}
+
+	if c.Mail.MagicLinkTTL <= 0 {
+		p.fail("MAGIC_LINK_TTL must be positive")
+	}
+
+	if len(c.OIDC.Providers) > 0 && !isAbsoluteURL(c.OIDC.RedirectURL) {
+		p.fail("OIDC_REDIRECT_URL must be an absolute URL when OIDC_PROVIDERS is set")
+	}
+
+	for _, provider := range c.OIDC.Providers {
+		prefix := "OIDC_" + strings.ToUpper(provider.Name)
+
+		if !isAbsoluteURL(provider.Issuer) {
+			p.fail(prefix + "_ISSUER must be an absolute URL")
+		}
+
+		if provider.ClientID == "" {
+			p.fail(prefix + "_CLIENT_ID is required")
+		}
+	}
+}
+
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// Collects conversion problems instead of stopping at the first one
+type parser struct {
+	values   map[string]string
+	problems []string
+}
+
+func (p *parser) fail(problem string) {
+	p.problems = append(p.problems, problem)
+}
+
+func (p *parser) string(key string) string {
+	if v, ok := p.values[key]; ok {
+		return strings.TrimSpace(v)
+	}
+	return defaults[key]
+}
+
+func (p *parser) int(key string) int {
+	raw := p.string(key)
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		p.fail(fmt.Sprintf("%s must be an integer, got %q", key, raw))
+	}
+	return n
+}
+
+func (p *parser) bool(key string) bool {
+	raw := p.string(key)
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.fail(fmt.Sprintf("%s must be true or false, got %q", key, raw))
+	}
+	return b
+}
+
+func (p *parser) duration(key string) time.Duration {
+	raw := p.string(key)
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		p.fail(fmt.Sprintf("%s must be a duration such as 15s or 1h, got %q", key, raw))
+	}
+	return d
+}
+
+func (p *parser) list(key string) []string {
+	var items []string
+
+	for _, item := range strings.Split(p.string(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Reads the providers named by OIDC_PROVIDERS from their own keys
+func (p *parser) oidc() OIDCConfig {
+
+	cfg := OIDCConfig{RedirectURL: p.string("OIDC_REDIRECT_URL")}
+
+	for _, name := range p.list("OIDC_PROVIDERS") {
+		if !oidcProviderName.MatchString(name) {
+			p.fail(fmt.Sprintf("OIDC_PROVIDERS names must be lower-case letters and digits, got %q", name))
+			continue
+		}
+
+		if slices.ContainsFunc(cfg.Providers, func(o OIDCProvider) bool { return o.Name == name }) {
+			p.fail(fmt.Sprintf("OIDC_PROVIDERS lists %q twice", name))
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name)
+		cfg.Providers = append(cfg.Providers, OIDCProvider{
+			Name:         name,
+			Issuer:       p.string(prefix + "_ISSUER"),
+			ClientID:     p.string(prefix + "_CLIENT_ID"),
+			ClientSecret: p.string(prefix + "_CLIENT_SECRET"),
+		})
+	}
+
+	return cfg
+}
+
+// Reads a YAML or TOML file (picked by extension) and flattens it into env var style keys
+func readFile(path string) (map[string]string, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten("", raw, values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func flatten(prefix string, raw map[string]any, out map[string]string) error {
+
+	// Sorted so the first unknown key reported is stable
+	for _, k := range slices.Sorted(maps.Keys(raw)) {
+		key := strings.ToUpper(prefix + k)
+
+		switch v := raw[k].(type) {
+		case map[string]any:
+			if err := flatten(key+"_", v, out); err != nil {
+				return err
+			}
+			continue
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+
+		if !isKnownKey(key) {
+			return fmt.Errorf("unknown key %q", strings.ToLower(key))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := parse(map[string]string{
+		"DB_URL":     "postgres://localhost/chirpy",
+		"JWT_SECRET": testSecret,
+	})
+
+	if err != nil {
+		t.Fatalf("parse returned unexpected error: %v", err)
+	}
+
+	if cfg.Addr() != ":8080" {
+		t.Errorf("expected default addr :8080, got %q", cfg.Addr())
+	}
+
+	if cfg.AccessTokenTTL != time.Hour {
+		t.Errorf("expected access token TTL of 1h, got %v", cfg.AccessTokenTTL)
+	}
+
+	if cfg.RefreshTokenTTL != 60*24*time.Hour {
+		t.Errorf("expected refresh token TTL of 60 days, got %v", cfg.RefreshTokenTTL)
+	}
+
+	if cfg.ChirpMaxLength != 140 {
+		t.Errorf("expected chirp max length of 140, got %d", cfg.ChirpMaxLength)
+	}
+
+	if !slices.Equal(cfg.BannedWords, []string{"kerfuffle", "sharbert", "fornax"}) {
+		t.Errorf("unexpected default banned words %v", cfg.BannedWords)
+	}
+
+	if cfg.ChirpPublishInterval != 15*time.Second {
+		t.Errorf("expected scheduled chirps to be checked every 15s, got %v", cfg.ChirpPublishInterval)
+	}
+
+	if cfg.Platform != PlatformProd {
+		t.Errorf("expected the prod platform by default, got %q", cfg.Platform)
+	}
+
+	if cfg.AccountDeletionGracePeriod != 30*24*time.Hour {
+		t.Errorf("expected a deletion grace period of 30 days, got %v", cfg.AccountDeletionGracePeriod)
+	}
+
+	if cfg.Outbox.Retention != 7*24*time.Hour {
+		t.Errorf("expected an outbox retention of 7 days, got %v", cfg.Outbox.Retention)
+	}
+
+	if cfg.Webhooks.MaxAttempts != 8 || cfg.Webhooks.RetryDelay != 30*time.Second {
+		t.Errorf("expected 8 webhook attempts from 30s, got %d from %v", cfg.Webhooks.MaxAttempts, cfg.Webhooks.RetryDelay)
+	}
+
+	if cfg.Mail.SMTPAddr != "" || cfg.Mail.MagicLinkTTL != 15*time.Minute {
+		t.Errorf("expected no SMTP server and 15m magic links, got %q and %v", cfg.Mail.SMTPAddr, cfg.Mail.MagicLinkTTL)
+	}
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	_, err := parse(map[string]string{
+		"JWT_SECRET":       "short",
+		"PORT":             "eighty",
+		"ACCESS_TOKEN_TTL": "soon",
+		"PLATFORM":         "production",
+		"AUTO_MIGRATE":     "yes please",
+		"SMTP_ADDR":        "smtp.example.com",
+		"MAGIC_LINK_TTL":   "-1m",
+	})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	for _, want := range []string{"DB_URL", "JWT_SECRET", "PORT", "ACCESS_TOKEN_TTL", "PLATFORM", "AUTO_MIGRATE", "SMTP_ADDR", "MAGIC_LINK_TTL"} {
+		found := false
+		for _, problem := range verr.Problems {
+			if strings.HasPrefix(problem, want) {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("expected a problem about %s, got %v", want, verr.Problems)
+		}
+	}
+}
+
+func TestLoadFilesAndEnvOverride(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	files := map[string]string{
+		"chirpy.yaml": `
+db_url: postgres://localhost/chirpy
+jwt_secret: ` + testSecret + `
+port: 9090
+auto_migrate: true
+banned_words: [foo, bar]
+server:
+  read_timeout: 3s
+`,
+		"chirpy.toml": `
+db_url = "postgres://localhost/chirpy"
+jwt_secret = "` + testSecret + `"
+port = 9090
+auto_migrate = true
+banned_words = ["foo", "bar"]
+
+[server]
+read_timeout = "3s"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Setenv("CHIRP_MAX_LENGTH", "280")
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load returned unexpected error: %v", err)
+			}
+
+			if cfg.Port != 9090 {
+				t.Errorf("expected port from file, got %d", cfg.Port)
+			}
+
+			if !cfg.AutoMigrate {
+				t.Error("expected auto_migrate from file")
+			}
+
+			if cfg.Server.ReadTimeout != 3*time.Second {
+				t.Errorf("expected nested read timeout from file, got %v", cfg.Server.ReadTimeout)
+			}
+
+			if !slices.Equal(cfg.BannedWords, []string{"foo", "bar"}) {
+				t.Errorf("expected banned words from file, got %v", cfg.BannedWords)
+			}
+
+			if cfg.ChirpMaxLength != 280 {
+				t.Errorf("expected env to override chirp max length, got %d", cfg.ChirpMaxLength)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	if err := os.WriteFile(path, []byte("jwt_secrett: oops\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "jwt_secrett") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	content := `
+db_url: postgres://localhost/chirpy
+jwt_secret: ` + testSecret + `
+oidc:
+  providers: [google, gitlab]
+  redirect_url: https://chirpy.example/login/callback
+  google:
+    issuer: https://accounts.google.com
+    client_id: chirpy-google
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "from-env")
+	t.Setenv("OIDC_GITLAB_ISSUER", "https://gitlab.com")
+	t.Setenv("OIDC_GITLAB_CLIENT_ID", "chirpy-gitlab")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %v", err)
+	}
+
+	want := []OIDCProvider{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "chirpy-google", ClientSecret: "from-env"},
+		{Name: "gitlab", Issuer: "https://gitlab.com", ClientID: "chirpy-gitlab"},
+	}
+
+	if !slices.Equal(cfg.OIDC.Providers, want) {
+		t.Errorf("expected providers %+v, got %+v", want, cfg.OIDC.Providers)
+	}
+}
+
+func TestParseOIDCProblems(t *testing.T) {
+	_, err := parse(map[string]string{
+		"DB_URL":             "postgres://localhost/chirpy",
+		"JWT_SECRET":         testSecret,
+		"OIDC_PROVIDERS":     "google,Bad_Name",
+		"OIDC_GOOGLE_ISSUER": "accounts.google.com",
+	})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	for _, want := range []string{"OIDC_REDIRECT_URL", "OIDC_PROVIDERS", "OIDC_GOOGLE_ISSUER", "OIDC_GOOGLE_CLIENT_ID"} {
+		if !slices.ContainsFunc(verr.Problems, func(p string) bool { return strings.HasPrefix(p, want) }) {
+			t.Errorf("expected a problem about %s, got %v", want, verr.Problems)
+		}
+	}
+}
@@ -6,33 +6,318 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
+type Block struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Bookmark struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Chirp struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Body      string        `json:"body"`
+	UserID    uuid.UUID     `json:"user_id"`
+	HiddenAt  sql.NullTime  `json:"hidden_at"`
+	ReplyToID uuid.NullUUID `json:"reply_to_id"`
+}
+
+type Draft struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
 	Body      string    `json:"body"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Like struct {
 	UserID    uuid.UUID `json:"user_id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type List struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	Name      string    `json:"name"`
+	Public    bool      `json:"public"`
+}
+
+type ListMember struct {
+	ListID    uuid.UUID `json:"list_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MagicLink struct {
+	TokenHash     string       `json:"token_hash"`
+	UserID        uuid.UUID    `json:"user_id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	InvalidatedAt sql.NullTime `json:"invalidated_at"`
+}
+
+type MagicLinkRequest struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Email     string    `json:"email"`
+	Ip        string    `json:"ip"`
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	ActorID      uuid.NullUUID `json:"actor_id"`
+	ReportID     uuid.NullUUID `json:"report_id"`
+	Action       string        `json:"action"`
+	TargetUserID uuid.NullUUID `json:"target_user_id"`
+	ChirpID      uuid.NullUUID `json:"chirp_id"`
+	Note         string        `json:"note"`
+}
+
+type ModerationFlag struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Reason    string    `json:"reason"`
+}
+
+type ModerationRule struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+}
+
+type Mute struct {
+	MuterID   uuid.UUID `json:"muter_id"`
+	MutedID   uuid.UUID `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Notification struct {
+	ID        uuid.UUID     `json:"id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Kind      string        `json:"kind"`
+	ChirpID   uuid.NullUUID `json:"chirp_id"`
+	GroupKey  string        `json:"group_key"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	ReadAt    sql.NullTime  `json:"read_at"`
+}
+
+type NotificationActor struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+	ActorID        uuid.UUID `json:"actor_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Kind    string    `json:"kind"`
+	Channel string    `json:"channel"`
+	Enabled bool      `json:"enabled"`
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string    `json:"code_hash"`
+	CreatedAt     time.Time `json:"created_at"`
+	ClientID      uuid.UUID `json:"client_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RedirectUri   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type OauthClient struct {
+	ID           uuid.UUID      `json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	OwnerID      uuid.UUID      `json:"owner_id"`
+	Name         string         `json:"name"`
+	SecretHash   sql.NullString `json:"secret_hash"`
+	RedirectUris []string       `json:"redirect_uris"`
+}
+
+type OidcLoginState struct {
+	StateHash    string        `json:"state_hash"`
+	Provider     string        `json:"provider"`
+	Nonce        string        `json:"nonce"`
+	CodeVerifier string        `json:"code_verifier"`
+	CreatedAt    time.Time     `json:"created_at"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	LinkUserID   uuid.NullUUID `json:"link_user_id"`
+}
+
+type Outbox struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	DeliveredTo   []string        `json:"delivered_to"`
+	LastError     sql.NullString  `json:"last_error"`
+	DispatchedAt  sql.NullTime    `json:"dispatched_at"`
+}
+
+type Poll struct {
+	ChirpID        uuid.UUID `json:"chirp_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ClosesAt       time.Time `json:"closes_at"`
+	MultipleChoice bool      `json:"multiple_choice"`
+}
+
+type PollOption struct {
+	ID       uuid.UUID `json:"id"`
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	Position int32     `json:"position"`
+	Text     string    `json:"text"`
+}
+
+type PollVote struct {
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	OptionID uuid.UUID `json:"option_id"`
+}
+
+type PollVoter struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type RefreshToken struct {
-	Token     string       `json:"token"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	UserID    uuid.UUID    `json:"user_id"`
-	ExpiresAt time.Time    `json:"expires_at"`
-	RevokedAt sql.NullTime `json:"revoked_at"`
+	Token     string        `json:"token"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	RevokedAt sql.NullTime  `json:"revoked_at"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scopes    []string      `json:"scopes"`
+}
+
+type Report struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	ReporterID   uuid.UUID     `json:"reporter_id"`
+	TargetUserID uuid.UUID     `json:"target_user_id"`
+	ChirpID      uuid.NullUUID `json:"chirp_id"`
+	Reason       string        `json:"reason"`
+	Details      string        `json:"details"`
+	Status       string        `json:"status"`
+}
+
+type ScheduledChirp struct {
+	ID        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	UserID    uuid.UUID      `json:"user_id"`
+	Body      string         `json:"body"`
+	ReplyToID uuid.NullUUID  `json:"reply_to_id"`
+	PublishAt time.Time      `json:"publish_at"`
+	Failure   sql.NullString `json:"failure"`
 }
 
 type User struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	ID                  uuid.UUID    `json:"id"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+	Email               string       `json:"email"`
+	HashedPassword      string       `json:"hashed_password"`
+	IsChirpyRed         bool         `json:"is_chirpy_red"`
+	SuspendedAt         sql.NullTime `json:"suspended_at"`
+	Role                string       `json:"role"`
+	Handle              string       `json:"handle"`
+	DisplayName         string       `json:"display_name"`
+	Bio                 string       `json:"bio"`
+	Location            string       `json:"location"`
+	Website             string       `json:"website"`
+	AvatarKey           string       `json:"avatar_key"`
+	BannerKey           string       `json:"banner_key"`
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+	EmailVerifiedAt     sql.NullTime `json:"email_verified_at"`
+}
+
+type UserIdentity struct {
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type Webhook struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Url         string    `json:"url"`
+	Description string    `json:"description"`
+	EventTypes  []string  `json:"event_types"`
+	Secret      string    `json:"secret"`
+	Active      bool      `json:"active"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode sql.NullInt32   `json:"last_status_code"`
+	LastError      sql.NullString  `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID           uuid.UUID      `json:"id"`
+	DeliveryID   uuid.UUID      `json:"delivery_id"`
+	AttemptedAt  time.Time      `json:"attempted_at"`
+	DurationMs   int32          `json:"duration_ms"`
+	StatusCode   sql.NullInt32  `json:"status_code"`
+	Error        sql.NullString `json:"error"`
+	ResponseBody string         `json:"response_body"`
 }
@@ -7,22 +7,50 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*)
+FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+    SET deletion_scheduled_at = NULL,
+        updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
-RETURNING id, created_at, updated_at, email
+RETURNING id, created_at, updated_at, email, role, handle
 `
 
 type CreateUserParams struct {
 	Email          string `json:"email"`
 	HashedPassword string `json:"hashed_password"`
+	Handle         string `json:"handle"`
 }
 
 type CreateUserRow struct {
@@ -30,20 +58,65 @@ type CreateUserRow struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Handle    string    `json:"handle"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Role,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const deleteDueUsers = `-- name: DeleteDueUsers :many
+DELETE
+FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id, avatar_key, banner_key
+`
+
+type DeleteDueUsersRow struct {
+	ID        uuid.UUID `json:"id"`
+	AvatarKey string    `json:"avatar_key"`
+	BannerKey string    `json:"banner_key"`
+}
+
+// Returns the image keys so the uploaded files can be removed too
+func (q *Queries) DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]DeleteDueUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, deleteDueUsers, deletionScheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteDueUsersRow
+	for rows.Next() {
+		var i DeleteDueUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.AvatarKey,
+			&i.BannerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 TRUNCATE TABLE users CASCADE
 `
@@ -54,7 +127,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, role, handle, display_name, bio, location, website, avatar_key, banner_key, deletion_scheduled_at, email_verified_at
 FROM users
 WHERE email = $1
 `
@@ -69,21 +142,72 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.DeletionScheduledAt,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, suspended_at, role, handle, display_name, bio, location, website, avatar_key, banner_key, deletion_scheduled_at, email_verified_at
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.SuspendedAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.DeletionScheduledAt,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByIDNoPassword = `-- name: GetUserByIDNoPassword :one
-SELECT id, created_at, updated_at, email
+SELECT id, created_at, updated_at, email, role, handle, display_name, bio, location, website, avatar_key, banner_key, deletion_scheduled_at
 FROM users
 WHERE id = $1
 `
 
 type GetUserByIDNoPasswordRow struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
+	ID                  uuid.UUID    `json:"id"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+	Email               string       `json:"email"`
+	Role                string       `json:"role"`
+	Handle              string       `json:"handle"`
+	DisplayName         string       `json:"display_name"`
+	Bio                 string       `json:"bio"`
+	Location            string       `json:"location"`
+	Website             string       `json:"website"`
+	AvatarKey           string       `json:"avatar_key"`
+	BannerKey           string       `json:"banner_key"`
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
 }
 
 func (q *Queries) GetUserByIDNoPassword(ctx context.Context, id uuid.UUID) (GetUserByIDNoPasswordRow, error) {
@@ -94,37 +218,288 @@ func (q *Queries) GetUserByIDNoPassword(ctx context.Context, id uuid.UUID) (GetU
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const getUserIDsByHandles = `-- name: GetUserIDsByHandles :many
+SELECT id, handle
+FROM users
+WHERE lower(handle) = ANY($1::text[])
+`
+
+type GetUserIDsByHandlesRow struct {
+	ID     uuid.UUID `json:"id"`
+	Handle string    `json:"handle"`
+}
+
+// Resolves @mentions, handles must be passed lower cased
+func (q *Queries) GetUserIDsByHandles(ctx context.Context, handles []string) ([]GetUserIDsByHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserIDsByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserIDsByHandlesRow
+	for rows.Next() {
+		var i GetUserIDsByHandlesRow
+		if err := rows.Scan(&i.ID, &i.Handle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserProfileByHandle = `-- name: GetUserProfileByHandle :one
+SELECT
+    id, created_at, handle, display_name, bio, location, website, avatar_key, banner_key,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.hidden_at IS NULL) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE lower(handle) = lower($1)
+`
+
+type GetUserProfileByHandleRow struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	AvatarKey      string    `json:"avatar_key"`
+	BannerKey      string    `json:"banner_key"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+// Public profile, never select the email here
+func (q *Queries) GetUserProfileByHandle(ctx context.Context, lower string) (GetUserProfileByHandleRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileByHandle, lower)
+	var i GetUserProfileByHandleRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.BannerKey,
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
 
-const updateIsChirpyRedByID = `-- name: UpdateIsChirpyRedByID :exec
+const getUserSummaries = `-- name: GetUserSummaries :many
+SELECT id, handle, display_name, avatar_key
+FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+type GetUserSummariesRow struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarKey   string    `json:"avatar_key"`
+}
+
+// Batch lookup of the authors embedded in chirp responses
+func (q *Queries) GetUserSummaries(ctx context.Context, ids []uuid.UUID) ([]GetUserSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserSummaries, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSummariesRow
+	for rows.Next() {
+		var i GetUserSummariesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :exec
 UPDATE users
-    SET is_chirpy_red = false,
+    SET deletion_scheduled_at = $2,
         updated_at = NOW()
 WHERE id = $1
 `
 
-func (q *Queries) UpdateIsChirpyRedByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateIsChirpyRedByID, id)
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID    `json:"id"`
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
 	return err
 }
 
-const updateUserPassword = `-- name: UpdateUserPassword :exec
+const suspendUser = `-- name: SuspendUser :exec
 UPDATE users
-    SET hashed_password = $1,
+    SET suspended_at = NOW(),
+        updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, suspendUser, id)
+	return err
+}
+
+const updateIsChirpyRedByID = `-- name: UpdateIsChirpyRedByID :execrows
+UPDATE users
+    SET is_chirpy_red = true,
+        updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) UpdateIsChirpyRedByID(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateIsChirpyRedByID, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :exec
+UPDATE users
+    SET email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,
         email = $2,
+        hashed_password = $3,
+        handle = $4,
+        display_name = $5,
+        bio = $6,
+        location = $7,
+        website = $8,
         updated_at = NOW()
-WHERE id = $3
+WHERE id = $1
 `
 
-type UpdateUserPasswordParams struct {
-	HashedPassword string    `json:"hashed_password"`
-	Email          string    `json:"email"`
+type UpdateUserParams struct {
 	ID             uuid.UUID `json:"id"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
 }
 
-func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.Email, arg.ID)
+// A new email is unverified again
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
+	_, err := q.db.ExecContext(ctx, updateUser,
+		arg.ID,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+	)
+	return err
+}
+
+const updateUserAvatar = `-- name: UpdateUserAvatar :exec
+UPDATE users
+    SET avatar_key = $2,
+        updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserAvatarParams struct {
+	ID        uuid.UUID `json:"id"`
+	AvatarKey string    `json:"avatar_key"`
+}
+
+func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserAvatar, arg.ID, arg.AvatarKey)
+	return err
+}
+
+const updateUserBanner = `-- name: UpdateUserBanner :exec
+UPDATE users
+    SET banner_key = $2,
+        updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserBannerParams struct {
+	ID        uuid.UUID `json:"id"`
+	BannerKey string    `json:"banner_key"`
+}
+
+func (q *Queries) UpdateUserBanner(ctx context.Context, arg UpdateUserBannerParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserBanner, arg.ID, arg.BannerKey)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :execrows
+UPDATE users
+    SET role = $2,
+        updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :exec
+UPDATE users
+    SET email_verified_at = COALESCE(email_verified_at, NOW()),
+        updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, verifyUserEmail, id)
 	return err
 }
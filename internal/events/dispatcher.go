@@ -0,0 +1,245 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Handler reacts to one event. An error, or a panic, has the event retried later.
+type Handler func(ctx context.Context, e Event) error
+
+// Options tune the Dispatcher, zero values get the defaults below
+type Options struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Delay before the first retry, doubled on every attempt up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// How long a claimed batch is hidden from the other instances, must outlast the delivery
+	Lease time.Duration
+	// Dispatched events older than this are deleted, zero keeps them forever
+	Retention time.Duration
+}
+
+const (
+	defaultPollInterval  = time.Second
+	defaultBatchSize     = 100
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = time.Hour
+	defaultLease         = time.Minute
+
+	// How often the dispatched events past Retention are deleted
+	purgeInterval = time.Hour
+)
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Dispatcher delivers the outbox to the subscribers. Any number of instances can run one, each
+// event is claimed by one of them at a time.
+type Dispatcher struct {
+	store store.OutboxStore
+	opts  Options
+
+	mu          sync.RWMutex
+	subscribers []subscriber
+}
+
+func NewDispatcher(s store.OutboxStore, opts Options) *Dispatcher {
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = defaultMaxRetryDelay
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultLease
+	}
+
+	return &Dispatcher{store: s, opts: opts}
+}
+
+// Subscribe registers h for every event. The name is recorded with the events h handled, so it
+// must be unique and stay the same across releases.
+func (d *Dispatcher) Subscribe(name string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if slices.ContainsFunc(d.subscribers, func(s subscriber) bool { return s.name == name }) {
+		panic(fmt.Sprintf("events: subscriber %q registered twice", name))
+	}
+
+	d.subscribers = append(d.subscribers, subscriber{name: name, handler: h})
+}
+
+// Run dispatches every PollInterval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+
+	poll := time.NewTicker(d.opts.PollInterval)
+	defer poll.Stop()
+
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			d.drain(ctx)
+		case <-purge.C:
+			d.purge(ctx)
+		}
+	}
+}
+
+// Keeps claiming while full batches come back, so a backlog doesn't wait for the next tick
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil {
+			log.Printf("Dispatching events: %v", err)
+			return
+		}
+		if n < d.opts.BatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) purge(ctx context.Context) {
+
+	if d.opts.Retention <= 0 {
+		return
+	}
+
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-d.opts.Retention), Valid: true}
+
+	n, err := d.store.DeleteDispatchedOutboxEvents(ctx, cutoff)
+	if err != nil {
+		log.Printf("Purging dispatched events: %v", err)
+		return
+	}
+
+	if n > 0 {
+		log.Printf("Purged %d dispatched events", n)
+	}
+}
+
+// DispatchOnce claims one batch of due events, oldest first, and hands each to the subscribers
+// that haven't handled it yet. It returns how many events were claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+
+	rows, err := d.store.ClaimOutboxEvents(ctx, database.ClaimOutboxEventsParams{
+		LeaseMs:   int32(d.opts.Lease.Milliseconds()),
+		BatchSize: int32(d.opts.BatchSize),
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("ClaimOutboxEvents: %w", err)
+	}
+
+	d.mu.RLock()
+	subscribers := slices.Clone(d.subscribers)
+	d.mu.RUnlock()
+
+	for _, row := range rows {
+		if err := d.dispatch(ctx, row, subscribers); err != nil {
+			return len(rows), err
+		}
+	}
+
+	return len(rows), nil
+}
+
+// Delivers one event and records the outcome, only failing when that can't be stored. The
+// lease then runs out and the event is delivered again.
+func (d *Dispatcher) dispatch(ctx context.Context, row database.Outbox, subscribers []subscriber) error {
+
+	event := fromRow(row)
+	delivered := slices.Clone(row.DeliveredTo)
+
+	var failures []string
+	for _, s := range subscribers {
+		if slices.Contains(delivered, s.name) {
+			continue
+		}
+
+		if err := call(ctx, s.handler, event); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", s.name, err))
+			continue
+		}
+
+		delivered = append(delivered, s.name)
+	}
+
+	if len(failures) == 0 {
+		err := d.store.CompleteOutboxEvent(ctx, database.CompleteOutboxEventParams{
+			ID:          row.ID,
+			DeliveredTo: delivered,
+		})
+
+		if err != nil {
+			return fmt.Errorf("CompleteOutboxEvent: %w", err)
+		}
+		return nil
+	}
+
+	lastError := strings.Join(failures, "; ")
+	retryIn := d.retryDelay(int(row.Attempts))
+	log.Printf("Event %v (%s) failed, retrying in %v: %s", row.ID, row.Type, retryIn, lastError)
+
+	err := d.store.RetryOutboxEvent(ctx, database.RetryOutboxEventParams{
+		ID:          row.ID,
+		DeliveredTo: delivered,
+		LastError:   sql.NullString{String: lastError, Valid: true},
+		RetryInMs:   int32(retryIn.Milliseconds()),
+	})
+
+	if err != nil {
+		return fmt.Errorf("RetryOutboxEvent: %w", err)
+	}
+	return nil
+}
+
+// RetryDelay doubled for every earlier attempt, capped at MaxRetryDelay
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.opts.RetryDelay
+	for range attempts {
+		delay *= 2
+		if delay >= d.opts.MaxRetryDelay {
+			return d.opts.MaxRetryDelay
+		}
+	}
+	return min(delay, d.opts.MaxRetryDelay)
+}
+
+// A panicking subscriber fails the delivery instead of taking the dispatcher down
+func call(ctx context.Context, h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprint("panic: ", r))
+		}
+	}()
+
+	return h(ctx, e)
+}
@@ -0,0 +1,179 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Short, so a test can wait out a retry
+const testRetryDelay = 10 * time.Millisecond
+
+func record(t *testing.T, s store.Store, typ string) {
+	t.Helper()
+
+	if err := events.Record(context.Background(), s, typ, events.UserUpgradedPayload{UserID: uuid.New()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dispatchOnce(t *testing.T, d *events.Dispatcher) int {
+	t.Helper()
+
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDispatchDeliversInOrder(t *testing.T) {
+	s := store.NewMemory()
+	record(t, s, events.UserRegistered)
+	record(t, s, events.ChirpCreated)
+
+	d := events.NewDispatcher(s, events.Options{})
+
+	got := map[string][]string{}
+	for _, name := range []string{"search", "mailer"} {
+		d.Subscribe(name, func(ctx context.Context, e events.Event) error {
+			got[name] = append(got[name], e.Type)
+			return nil
+		})
+	}
+
+	if n := dispatchOnce(t, d); n != 2 {
+		t.Fatalf("expected 2 events claimed, got %d", n)
+	}
+
+	want := []string{events.UserRegistered, events.ChirpCreated}
+	for name, types := range got {
+		if !slices.Equal(types, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, types)
+		}
+	}
+
+	if n := dispatchOnce(t, d); n != 0 {
+		t.Errorf("expected dispatched events to stay dispatched, %d were claimed again", n)
+	}
+}
+
+func TestDispatchRetriesOnlyTheFailedSubscriber(t *testing.T) {
+	s := store.NewMemory()
+	record(t, s, events.ChirpDeleted)
+
+	d := events.NewDispatcher(s, events.Options{RetryDelay: testRetryDelay})
+
+	var searchCalls, mailerCalls int
+	d.Subscribe("search", func(ctx context.Context, e events.Event) error {
+		searchCalls++
+		return nil
+	})
+	d.Subscribe("mailer", func(ctx context.Context, e events.Event) error {
+		mailerCalls++
+		if mailerCalls == 1 {
+			return errors.New("smtp down")
+		}
+		if mailerCalls == 2 {
+			panic("nil template")
+		}
+		return nil
+	})
+
+	dispatchOnce(t, d)
+
+	rows, err := s.ListOutboxEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := rows[0]
+	if row.DispatchedAt.Valid || row.Attempts != 1 || row.LastError.String != "mailer: smtp down" {
+		t.Errorf("expected a pending retry with the error recorded, got %+v", row)
+	}
+
+	if !slices.Equal(row.DeliveredTo, []string{"search"}) {
+		t.Errorf("expected search to be recorded as delivered, got %v", row.DeliveredTo)
+	}
+
+	// Not due yet
+	if n := dispatchOnce(t, d); n != 0 {
+		t.Fatalf("expected the retry to wait, %d events were claimed", n)
+	}
+
+	// The panic is a failure like any other, the third attempt goes through
+	for range 2 {
+		time.Sleep(4 * testRetryDelay)
+		dispatchOnce(t, d)
+	}
+
+	if searchCalls != 1 || mailerCalls != 3 {
+		t.Errorf("expected 1 search and 3 mailer calls, got %d and %d", searchCalls, mailerCalls)
+	}
+
+	rows, err = s.ListOutboxEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows[0].DispatchedAt.Valid {
+		t.Errorf("expected the event to be dispatched, got %+v", rows[0])
+	}
+}
+
+func TestClaimedEventsAreLeased(t *testing.T) {
+	s := store.NewMemory()
+	record(t, s, events.UserUpgraded)
+
+	// Another instance claims the event and dies before recording the outcome
+	_, err := s.ClaimOutboxEvents(context.Background(), database.ClaimOutboxEventsParams{LeaseMs: 50, BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := events.NewDispatcher(s, events.Options{})
+	var delivered int
+	other.Subscribe("billing", func(ctx context.Context, e events.Event) error {
+		delivered++
+		return nil
+	})
+
+	if n := dispatchOnce(t, other); n != 0 {
+		t.Fatalf("expected the leased event to be skipped, %d were claimed", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if dispatchOnce(t, other); delivered != 1 {
+		t.Errorf("expected the event to be delivered once the lease ran out, got %d deliveries", delivered)
+	}
+}
+
+func TestRecordRollsBackWithTheTransaction(t *testing.T) {
+	s := store.NewMemory()
+
+	err := s.InTx(context.Background(), func(tx store.Store) error {
+		record(t, tx, events.UserRegistered)
+		return errors.New("signup failed")
+	})
+
+	if err == nil {
+		t.Fatal("expected InTx to return the error")
+	}
+
+	rows, err := s.ListOutboxEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 0 {
+		t.Errorf("expected the event to be rolled back, got %d rows", len(rows))
+	}
+}
@@ -0,0 +1,99 @@
+// Package events is the domain event bus. Services record events in the outbox table in the
+// same transaction as the change they describe, the Dispatcher then hands them to the subscribers
+// at least once.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Event types, subscribers outside this repo match on them so they never change
+const (
+	ChirpCreated   = "chirp.created"
+	ChirpDeleted   = "chirp.deleted"
+	UserRegistered = "user.registered"
+	UserUpgraded   = "user.upgraded"
+)
+
+// Types lists every event type
+var Types = []string{ChirpCreated, ChirpDeleted, UserRegistered, UserUpgraded}
+
+// Event is one outbox row as handed to the subscribers. The same event can arrive more than
+// once, subscribers dedupe on ID.
+type Event struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type ChirpCreatedPayload struct {
+	ChirpID   uuid.UUID  `json:"chirp_id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Body      string     `json:"body"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+}
+
+// Reasons a chirp goes away
+const (
+	DeletedByAuthor    = "author"
+	DeletedByModerator = "moderation"
+)
+
+type ChirpDeletedPayload struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Reason  string    `json:"reason"`
+}
+
+// The email is left out on purpose, events leave the service
+type UserRegisteredPayload struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+}
+
+type UserUpgradedPayload struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Record adds an event to the outbox. Pass the Store of the transaction making the change, so
+// the event is stored if and only if the change is.
+func Record(ctx context.Context, s store.OutboxStore, typ string, payload any) error {
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding %s payload: %w", typ, err)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	err = s.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		ID:      id,
+		Type:    typ,
+		Payload: data,
+	})
+
+	if err != nil {
+		return fmt.Errorf("CreateOutboxEvent: %w", err)
+	}
+	return nil
+}
+
+func fromRow(row database.Outbox) Event {
+	return Event{
+		ID:         row.ID,
+		Type:       row.Type,
+		OccurredAt: row.CreatedAt,
+		Payload:    row.Payload,
+	}
+}
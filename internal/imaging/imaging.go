@@ -0,0 +1,160 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Decoders for every accepted upload format
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Formats we accept, as named by image.DecodeConfig
+var formats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+	"webp": true,
+}
+
+// Every variant is re-encoded as JPEG, which also drops any metadata (EXIF, GPS) in the upload
+const (
+	ContentType = "image/jpeg"
+	Extension   = ".jpg"
+	jpegQuality = 85
+)
+
+// ErrInvalidImage wraps every reason an upload is refused, the message is safe to show to clients
+var ErrInvalidImage = errors.New("invalid image")
+
+// Variant is one rendered size of an upload
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// Spec describes a kind of upload: the dimensions it must have and the variants rendered from it
+type Spec struct {
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	Variants  []Variant
+}
+
+// Avatars are cropped to a square
+var Avatar = Spec{
+	MinWidth:  100,
+	MinHeight: 100,
+	MaxWidth:  4096,
+	MaxHeight: 4096,
+	Variants: []Variant{
+		{Name: "large", Width: 400, Height: 400},
+		{Name: "medium", Width: 128, Height: 128},
+		{Name: "small", Width: 48, Height: 48},
+	},
+}
+
+// Banners are cropped to 3:1
+var Banner = Spec{
+	MinWidth:  600,
+	MinHeight: 200,
+	MaxWidth:  6000,
+	MaxHeight: 4096,
+	Variants: []Variant{
+		{Name: "large", Width: 1500, Height: 500},
+		{Name: "small", Width: 600, Height: 200},
+	},
+}
+
+// Rendered is a variant ready to be stored
+type Rendered struct {
+	Variant
+	Data []byte
+}
+
+// Decode checks the format and dimensions from the header before decoding the whole image,
+// so a small file claiming to be 100000x100000 pixels is refused without allocating it
+func Decode(data []byte, spec Spec) (image.Image, error) {
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w: must be a JPEG, PNG, GIF or WebP image", ErrInvalidImage)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not be read", ErrInvalidImage)
+	}
+
+	if !formats[format] {
+		return nil, fmt.Errorf("%w: must be a JPEG, PNG, GIF or WebP image", ErrInvalidImage)
+	}
+
+	if cfg.Width < spec.MinWidth || cfg.Height < spec.MinHeight {
+		return nil, fmt.Errorf("%w: must be at least %dx%d pixels", ErrInvalidImage, spec.MinWidth, spec.MinHeight)
+	}
+
+	if cfg.Width > spec.MaxWidth || cfg.Height > spec.MaxHeight {
+		return nil, fmt.Errorf("%w: must be at most %dx%d pixels", ErrInvalidImage, spec.MaxWidth, spec.MaxHeight)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not be read", ErrInvalidImage)
+	}
+
+	return img, nil
+}
+
+// Render produces every variant of spec from img
+func Render(img image.Image, spec Spec) ([]Rendered, error) {
+
+	rendered := make([]Rendered, 0, len(spec.Variants))
+
+	for _, v := range spec.Variants {
+		var buf bytes.Buffer
+		if err := encode(&buf, Cover(img, v.Width, v.Height)); err != nil {
+			return nil, fmt.Errorf("encoding %s variant: %w", v.Name, err)
+		}
+		rendered = append(rendered, Rendered{Variant: v, Data: buf.Bytes()})
+	}
+
+	return rendered, nil
+}
+
+// Cover scales img to fill width x height, cropping whatever sticks out evenly on both sides
+func Cover(img image.Image, width, height int) image.Image {
+
+	src := img.Bounds()
+
+	// Largest centered rectangle of the source with the target aspect ratio
+	crop := src
+	if src.Dx()*height > src.Dy()*width {
+		w := src.Dy() * width / height
+		crop.Min.X += (src.Dx() - w) / 2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := src.Dx() * height / width
+		crop.Min.Y += (src.Dy() - h) / 2
+		crop.Max.Y = crop.Min.Y + h
+	}
+
+	// JPEG has no alpha channel, transparent areas end up white
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Over, nil)
+
+	return dst
+}
+
+func encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
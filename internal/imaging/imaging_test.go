@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	cases := map[string]struct {
+		data  []byte
+		valid bool
+	}{
+		"ok":           {encodePNG(t, 200, 150), true},
+		"too small":    {encodePNG(t, 99, 300), false},
+		"too large":    {encodePNG(t, 4097, 100), false},
+		"not an image": {[]byte("GIF89a but not really"), false},
+		"empty":        {nil, false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(tc.data, Avatar)
+
+			if tc.valid && err != nil {
+				t.Fatalf("expected a valid image, got %v", err)
+			}
+
+			if !tc.valid && !errors.Is(err, ErrInvalidImage) {
+				t.Fatalf("expected ErrInvalidImage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCover(t *testing.T) {
+	// A 300x100 image, left third red, middle green, right third blue
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for x := range 300 {
+		c := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}[x/100]
+		for y := range 100 {
+			src.Set(x, y, c)
+		}
+	}
+
+	dst := Cover(src, 50, 50)
+
+	if got := dst.Bounds(); got.Dx() != 50 || got.Dy() != 50 {
+		t.Fatalf("expected 50x50, got %v", got)
+	}
+
+	// The square crop keeps the middle of the image
+	r, g, b, _ := dst.At(25, 25).RGBA()
+	if g>>8 < 200 || r>>8 > 50 || b>>8 > 50 {
+		t.Errorf("expected the center to stay green, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestRender(t *testing.T) {
+	img, err := Decode(encodePNG(t, 900, 300), Banner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := Render(img, Banner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variants) != len(Banner.Variants) {
+		t.Fatalf("expected %d variants, got %d", len(Banner.Variants), len(variants))
+	}
+
+	for _, v := range variants {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if format != "jpeg" || cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Errorf("%s: expected a %dx%d jpeg, got a %dx%d %s", v.Name, v.Width, v.Height, cfg.Width, cfg.Height, format)
+		}
+	}
+}
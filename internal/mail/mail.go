@@ -0,0 +1,121 @@
+// Package mail sends the emails Chirpy writes to its users, such as magic login links. SMTP sends
+// them for real, Log writes them to the server log for development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig points at the server that relays the emails
+type SMTPConfig struct {
+	// host:port
+	Addr string
+	// Both empty skips authentication, PLAIN auth otherwise (net/smtp only sends it over TLS or to localhost)
+	Username string
+	Password string
+	From     string
+}
+
+// SMTP sends through an SMTP server, upgrading to TLS when the server offers STARTTLS
+type SMTP struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+// NewSMTP checks the sender address, the server is only contacted by Send
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("sender %q: %w", cfg.From, err)
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("SMTP server %q: %w", cfg.Addr, err)
+	}
+
+	return &SMTP{cfg: cfg, from: from}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("recipient %q: %w", msg.To, err)
+	}
+
+	data, err := compose(s.from, to, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" || s.cfg.Password != "" {
+		host, _, _ := net.SplitHostPort(s.cfg.Addr)
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)
+	}
+
+	// net/smtp has no context support, run it aside so a cancelled request doesn't wait on it
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.cfg.Addr, auth, s.from.Address, []string{to.Address}, data)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Log writes the emails to the server log instead of sending them, for dev and test
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Builds the RFC 5322 message. The addresses come out of ParseAddress and the subject is
+// encoded, so none of them can smuggle in a header.
+func compose(from, to *mail.Address, msg Message, date time.Time) ([]byte, error) {
+
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("subject must be a single line")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompose(t *testing.T) {
+	from := &mail.Address{Name: "Chirpy", Address: "no-reply@chirpy.example"}
+	to := &mail.Address{Address: "jesse@breakingbad.com"}
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	data, err := compose(from, to, Message{Subject: "Your login link ✨", Body: "Hello\nClick here"}, date)
+	if err != nil {
+		t.Fatalf("compose returned unexpected error: %v", err)
+	}
+
+	want := "From: \"Chirpy\" <no-reply@chirpy.example>\r\n" +
+		"To: <jesse@breakingbad.com>\r\n" +
+		"Subject: =?utf-8?q?Your_login_link_=E2=9C=A8?=\r\n" +
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Hello\r\nClick here"
+
+	if string(data) != want {
+		t.Errorf("unexpected message:\n%s\nwant:\n%s", data, want)
+	}
+
+	if _, err := compose(from, to, Message{Subject: "Hi\r\nBcc: evil@example.com"}, date); err == nil {
+		t.Error("expected a multi-line subject to be refused")
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(ln, received)
+
+	mailer, err := NewSMTP(SMTPConfig{Addr: ln.Addr().String(), From: "Chirpy <no-reply@chirpy.example>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mailer.Send(context.Background(), Message{To: "jesse@breakingbad.com", Subject: "Hi", Body: "Yo"}); err != nil {
+		t.Fatalf("Send returned unexpected error: %v", err)
+	}
+
+	commands := <-received
+	for _, want := range []string{"MAIL FROM:<no-reply@chirpy.example>", "RCPT TO:<jesse@breakingbad.com>", "Subject: Hi", "Yo"} {
+		if !containsPrefix(commands, want) {
+			t.Errorf("expected the server to receive %q, got %q", want, commands)
+		}
+	}
+
+	if err := mailer.Send(context.Background(), Message{To: "not an address"}); err == nil {
+		t.Error("expected an invalid recipient to be refused")
+	}
+}
+
+// Speaks just enough SMTP for net/smtp.SendMail and reports every line it read
+func serveSMTP(ln net.Listener, received chan<- []string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	var lines []string
+	reply("220 localhost ESMTP")
+
+	for inData := false; ; {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			received <- lines
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		switch {
+		case inData && line == ".":
+			inData = false
+			reply("250 OK")
+		case inData:
+		case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+			reply("250 localhost")
+		case line == "DATA":
+			inData = true
+			reply("354 Go ahead")
+		case line == "QUIT":
+			reply("221 Bye")
+			received <- lines
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func containsPrefix(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+	return false
+}
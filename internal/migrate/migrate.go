@@ -0,0 +1,138 @@
+// Package migrate applies the embedded goose migrations in sql/schema and reports how the
+// database compares to them. The sqlc code in internal/database is generated from the same
+// files, so a database at the latest version is exactly what the queries expect.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/itsmandrew/server-go/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// ErrOutdated is returned by Check when migrations are pending
+var ErrOutdated = errors.New("database schema is outdated")
+
+// Migrator runs the migrations against one database
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// Status compares the version recorded in goose_db_version with the embedded migrations
+type Status struct {
+	Current int64
+	Latest  int64
+	Pending int64
+}
+
+// Migration is one embedded migration and whether it was applied
+type Migration struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+
+	// Instances starting together take turns, the second one finds nothing left to do
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("loading migrations: %w", err)
+	}
+
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies every pending migration, returning the versions it applied
+func (m *Migrator) Up(ctx context.Context) ([]int64, error) {
+
+	results, err := m.provider.Up(ctx)
+
+	var applied []int64
+	for _, r := range results {
+		if r.Error == nil {
+			applied = append(applied, r.Source.Version)
+		}
+	}
+
+	return applied, err
+}
+
+// Down rolls back the newest applied migration, returning its version
+func (m *Migrator) Down(ctx context.Context) (int64, error) {
+
+	result, err := m.provider.Down(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Source.Version, nil
+}
+
+// Migrations lists every embedded migration, oldest first
+func (m *Migrator) Migrations(ctx context.Context) ([]Migration, error) {
+
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, len(statuses))
+	for i, s := range statuses {
+		migrations[i] = Migration{
+			Version: s.Source.Version,
+			Name:    s.Source.Path,
+			Applied: s.State == goose.StateApplied,
+		}
+	}
+
+	return migrations, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+
+	migrations, err := m.Migrations(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+
+	current, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{Current: current}
+	for _, migration := range migrations {
+		status.Latest = max(status.Latest, migration.Version)
+		if !migration.Applied {
+			status.Pending++
+		}
+	}
+
+	return status, nil
+}
+
+// Check fails with ErrOutdated unless every migration has been applied
+func (m *Migrator) Check(ctx context.Context) error {
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Pending > 0 {
+		return fmt.Errorf("%w: at version %d with %d pending migrations, the latest is %d",
+			ErrOutdated, status.Current, status.Pending, status.Latest)
+	}
+
+	return nil
+}
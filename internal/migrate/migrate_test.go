@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"database/sql"
+	"path"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// Loading the provider parses every embedded migration without touching the database
+func TestEmbeddedMigrations(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	sources := m.provider.ListSources()
+	if len(sources) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	// Versions follow each other without gaps, a gap usually means a file was renamed by mistake
+	for i, source := range sources {
+		if source.Version != int64(i+1) {
+			t.Errorf("expected version %d, got %d (%s)", i+1, source.Version, path.Base(source.Path))
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action is what happens to a chirp when a rule matches
+type Action string
+
+const (
+	// ActionMask replaces the match with asterisks and lets the chirp through
+	ActionMask Action = "mask"
+	// ActionFlag lets the chirp through but queues it for a moderator to review
+	ActionFlag Action = "flag"
+	// ActionReject refuses the chirp
+	ActionReject Action = "reject"
+)
+
+// Kind is how a rule's pattern is matched
+type Kind string
+
+const (
+	// KindWord matches whole words after Unicode and leetspeak normalization
+	KindWord Kind = "word"
+	// KindRegex matches a regular expression against the raw text
+	KindRegex Kind = "regex"
+)
+
+// What masked text is replaced with
+const maskText = "****"
+
+// Rule is a single entry of a word list or a regex rule
+type Rule struct {
+	// ID is uuid.Nil for rules that come from the config file
+	ID      uuid.UUID
+	Kind    Kind
+	Pattern string
+	Action  Action
+	Source  string
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %q", r.Action, r.Kind, r.Pattern)
+}
+
+// Validate checks the rule can be compiled into a filter
+func (r Rule) Validate() error {
+
+	switch r.Action {
+	case ActionMask, ActionFlag, ActionReject:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+
+	switch r.Kind {
+	case KindWord:
+		// Words are matched token by token, so a pattern with spaces or punctuation could never match
+		if r.Pattern == "" || strings.ContainsFunc(r.Pattern, func(r rune) bool { return !isWordRune(r) }) {
+			return fmt.Errorf("word %q must be a single word of letters and digits", r.Pattern)
+		}
+	case KindRegex:
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", r.Pattern, err)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+
+	return nil
+}
+
+// Match records a rule that fired and the text it fired on
+type Match struct {
+	Rule Rule
+	Text string
+}
+
+// Verdict is the outcome of running a chirp through the pipeline
+type Verdict struct {
+	// Text has every masked match replaced
+	Text    string
+	Matches []Match
+}
+
+func (v Verdict) has(action Action) bool {
+	for _, m := range v.Matches {
+		if m.Rule.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (v Verdict) Rejected() bool {
+	return v.has(ActionReject)
+}
+
+func (v Verdict) Flagged() bool {
+	return v.has(ActionFlag)
+}
+
+// Filter is one link of the pipeline, it may rewrite the text and reports what it matched
+type Filter interface {
+	Apply(text string) (string, []Match)
+}
+
+// Pipeline runs every filter in order, each one sees the text left by the previous one
+type Pipeline struct {
+	filters []Filter
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+func (p *Pipeline) Check(text string) Verdict {
+	verdict := Verdict{Text: text}
+
+	for _, f := range p.filters {
+		var matches []Match
+		verdict.Text, matches = f.Apply(verdict.Text)
+		verdict.Matches = append(verdict.Matches, matches...)
+	}
+
+	return verdict
+}
+
+// Build splits the rules by kind into a word filter followed by a regex filter
+func Build(rules []Rule) (*Pipeline, error) {
+
+	var words, regexes []Rule
+
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+
+		if r.Kind == KindWord {
+			words = append(words, r)
+		} else {
+			regexes = append(regexes, r)
+		}
+	}
+
+	regexFilter, err := NewRegexFilter(regexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPipeline(NewWordFilter(words), regexFilter), nil
+}
+
+// WordFilter matches whole words, so "Kerfuffle!" and "k3rfuffl3" both hit "kerfuffle"
+// while spacing, newlines and punctuation around them are left untouched
+type WordFilter struct {
+	words map[string]Rule
+}
+
+func NewWordFilter(rules []Rule) *WordFilter {
+	f := &WordFilter{words: make(map[string]Rule, len(rules))}
+
+	for _, r := range rules {
+		key := normalize(r.Pattern)
+
+		// When the same word is listed twice the harshest action wins
+		if existing, ok := f.words[key]; ok && severity(existing.Action) >= severity(r.Action) {
+			continue
+		}
+		f.words[key] = r
+	}
+
+	return f
+}
+
+func (f *WordFilter) Apply(text string) (string, []Match) {
+
+	if len(f.words) == 0 {
+		return text, nil
+	}
+
+	var (
+		out     strings.Builder
+		matches []Match
+	)
+
+	rest := text
+	for len(rest) > 0 {
+		start := strings.IndexFunc(rest, isWordRune)
+		if start < 0 {
+			out.WriteString(rest)
+			break
+		}
+
+		out.WriteString(rest[:start])
+		rest = rest[start:]
+
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+
+		word := rest[:end]
+		rest = rest[end:]
+
+		rule, ok := f.words[normalize(word)]
+		if !ok {
+			out.WriteString(word)
+			continue
+		}
+
+		matches = append(matches, Match{Rule: rule, Text: word})
+
+		if rule.Action == ActionMask {
+			out.WriteString(maskText)
+		} else {
+			out.WriteString(word)
+		}
+	}
+
+	return out.String(), matches
+}
+
+// RegexFilter runs admin supplied regular expressions over the text
+type RegexFilter struct {
+	rules    []Rule
+	compiled []*regexp.Regexp
+}
+
+func NewRegexFilter(rules []Rule) (*RegexFilter, error) {
+	f := &RegexFilter{}
+
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", r.Pattern, err)
+		}
+
+		f.rules = append(f.rules, r)
+		f.compiled = append(f.compiled, re)
+	}
+
+	return f, nil
+}
+
+func (f *RegexFilter) Apply(text string) (string, []Match) {
+	var matches []Match
+
+	for i, re := range f.compiled {
+		rule := f.rules[i]
+
+		for _, found := range re.FindAllString(text, -1) {
+			matches = append(matches, Match{Rule: rule, Text: found})
+		}
+
+		if rule.Action == ActionMask {
+			text = re.ReplaceAllLiteralString(text, maskText)
+		}
+	}
+
+	return text, matches
+}
+
+func severity(a Action) int {
+	switch a {
+	case ActionReject:
+		return 2
+	case ActionFlag:
+		return 1
+	}
+	return 0
+}
+
+// Leetspeak substitutions undone before matching
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+}
+
+// Letters, digits, combining marks and the leetspeak symbols make up a word
+func isWordRune(r rune) bool {
+	if _, ok := leet[r]; ok {
+		return true
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// Folds compatibility forms (ｋ -> k), strips accents (é -> e) and undoes leetspeak
+func normalize(word string) string {
+
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	folded, _, err := transform.String(t, word)
+	if err != nil {
+		folded = word
+	}
+
+	return strings.Map(func(r rune) rune {
+		if sub, ok := leet[r]; ok {
+			return sub
+		}
+		return unicode.ToLower(r)
+	}, folded)
+}
@@ -0,0 +1,109 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWordFilter(t *testing.T) {
+	pipeline, err := Build(WordList([]string{"kerfuffle", "sharbert", "fornax"}, ActionMask, "config"))
+	if err != nil {
+		t.Fatalf("Build returned unexpected error: %v", err)
+	}
+
+	cases := map[string]struct {
+		input string
+		want  string
+	}{
+		"plain":           {"I had a kerfuffle", "I had a ****"},
+		"punctuation":     {"Kerfuffle! What a SHARBERT.", "****! What a ****."},
+		"keeps spacing":   {"fornax  is\nhere\tnow", "****  is\nhere\tnow"},
+		"leetspeak":       {"k3rfuffl3 and $h@rb3rt", "**** and ****"},
+		"accents":         {"kérfüffle", "****"},
+		"fullwidth":       {"ｆｏｒｎａｘ", "****"},
+		"substrings kept": {"fornaxes kerfuffled", "fornaxes kerfuffled"},
+		"clean":           {"Nothing to see here", "Nothing to see here"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			verdict := pipeline.Check(tc.input)
+
+			if verdict.Text != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, verdict.Text)
+			}
+
+			if verdict.Rejected() || verdict.Flagged() {
+				t.Errorf("mask rules should neither reject nor flag, got %+v", verdict.Matches)
+			}
+		})
+	}
+}
+
+func TestActions(t *testing.T) {
+	pipeline, err := Build([]Rule{
+		{Kind: KindWord, Pattern: "spam", Action: ActionReject},
+		{Kind: KindWord, Pattern: "scam", Action: ActionFlag},
+		{Kind: KindRegex, Pattern: `(?i)\b\d{3}-\d{3}-\d{4}\b`, Action: ActionMask},
+	})
+	if err != nil {
+		t.Fatalf("Build returned unexpected error: %v", err)
+	}
+
+	verdict := pipeline.Check("Buy SPAM now!")
+	if !verdict.Rejected() {
+		t.Errorf("expected reject, got %+v", verdict)
+	}
+
+	verdict = pipeline.Check("not a scam, call 555-123-4567")
+	if !verdict.Flagged() || verdict.Rejected() {
+		t.Errorf("expected flag only, got %+v", verdict)
+	}
+
+	if verdict.Text != "not a scam, call ****" {
+		t.Errorf("expected the phone number to be masked, got %q", verdict.Text)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	invalid := []Rule{
+		{Kind: KindWord, Pattern: "two words", Action: ActionMask},
+		{Kind: KindWord, Pattern: "!!", Action: ActionMask},
+		{Kind: KindRegex, Pattern: "(unclosed", Action: ActionMask},
+		{Kind: KindWord, Pattern: "ok", Action: "delete"},
+		{Kind: "glob", Pattern: "ok*", Action: ActionMask},
+	}
+
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected %v to be invalid", r)
+		}
+	}
+}
+
+type staticSource []Rule
+
+func (s staticSource) LoadRules(ctx context.Context) ([]Rule, error) {
+	return s, nil
+}
+
+func TestModeratorReload(t *testing.T) {
+	source := staticSource{}
+	m, err := NewModerator(WordList([]string{"fornax"}, ActionMask, "config"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Check("buy gold").Text != "buy gold" {
+		t.Fatal("expected no match before reload")
+	}
+
+	m.source = staticSource{{Kind: KindWord, Pattern: "gold", Action: ActionMask, Source: "database"}}
+	if err := m.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Check("buy gold fornax").Text; got != "buy **** ****" {
+		t.Errorf("expected both base and loaded rules to apply, got %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RuleSource provides the rules managed at runtime, e.g. through the admin endpoints
+type RuleSource interface {
+	LoadRules(ctx context.Context) ([]Rule, error)
+}
+
+// Moderator combines the static rules from the config with the ones from a RuleSource
+// and swaps in a freshly built pipeline whenever it is reloaded
+type Moderator struct {
+	base   []Rule
+	source RuleSource
+
+	mu       sync.RWMutex
+	pipeline *Pipeline
+	rules    []Rule
+}
+
+// NewModerator starts with just the base rules, call Reload to pull in the source
+func NewModerator(base []Rule, source RuleSource) (*Moderator, error) {
+	pipeline, err := Build(base)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Moderator{
+		base:     base,
+		source:   source,
+		pipeline: pipeline,
+		rules:    base,
+	}, nil
+}
+
+// WordList turns a plain list of words, like the banned words from the config, into rules
+func WordList(words []string, action Action, source string) []Rule {
+	rules := make([]Rule, 0, len(words))
+	for _, w := range words {
+		rules = append(rules, Rule{Kind: KindWord, Pattern: w, Action: action, Source: source})
+	}
+	return rules
+}
+
+func (m *Moderator) Check(text string) Verdict {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pipeline.Check(text)
+}
+
+// Rules returns every active rule
+func (m *Moderator) Rules() []Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.rules)
+}
+
+// Reload rebuilds the pipeline from the base rules plus the source, the old pipeline
+// stays in place when anything fails
+func (m *Moderator) Reload(ctx context.Context) error {
+
+	rules := slices.Clone(m.base)
+
+	if m.source != nil {
+		loaded, err := m.source.LoadRules(ctx)
+		if err != nil {
+			return fmt.Errorf("loading moderation rules: %w", err)
+		}
+		rules = append(rules, loaded...)
+	}
+
+	pipeline, err := Build(rules)
+	if err != nil {
+		return fmt.Errorf("building moderation pipeline: %w", err)
+	}
+
+	m.mu.Lock()
+	m.pipeline = pipeline
+	m.rules = rules
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads every interval until ctx is done, so rules changed on another
+// instance show up here without a restart
+func (m *Moderator) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reload(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Moderation reload failed: %v", err)
+			}
+		}
+	}
+}
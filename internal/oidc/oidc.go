@@ -0,0 +1,234 @@
+// Package oidc signs users in with an external OpenID Connect provider: discovery of the
+// provider's endpoints, the authorization code flow with PKCE and the verification of the ID
+// token against the provider's published keys (JWKS). See oidctest for a local provider to test
+// against.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default timeout of the requests to the provider
+const requestTimeout = 10 * time.Second
+
+// Largest discovery, JWKS or token response we read
+const maxResponseBytes = 1 << 20
+
+// ErrInvalidIDToken is wrapped by every error Verify returns for a token that must not be trusted
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// TokenError is an error response of the token endpoint (RFC 6749 5.2), usually an expired or
+// replayed code
+type TokenError struct {
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	if e.Description == "" {
+		return "token endpoint: " + e.Code
+	}
+	return fmt.Sprintf("token endpoint: %s: %s", e.Code, e.Description)
+}
+
+// Config registers Chirpy with a provider
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Provider talks to one OpenID Connect provider. The discovery document is fetched on first use
+// and kept, the keys are refetched when a token is signed with one we don't know.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+// The parts of the discovery document (OpenID Connect Discovery 1.0, section 3) we use
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// NewProvider returns a Provider for cfg, nil client uses one with a 10s timeout
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL is where the user signs in with the provider, which then redirects them to the
+// RedirectURL with the code and state. The code challenge is the S256 one of the verifier later
+// given to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization_endpoint: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades the authorization code for the raw ID token, which must then go through Verify
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	// client_secret_basic is the default of the spec, client_secret_post only for providers
+	// that don't support it
+	basic := p.cfg.ClientSecret != "" && (len(md.TokenAuthMethods) == 0 || slices.Contains(md.TokenAuthMethods, "client_secret_basic"))
+
+	if !basic {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint: status %d: %w", resp.StatusCode, err)
+	}
+
+	if body.Error != "" {
+		return "", &TokenError{Code: body.Error, Description: body.ErrorDescription}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: unexpected status %d", resp.StatusCode)
+	}
+
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token endpoint: no id_token in the response")
+	}
+
+	return body.IDToken, nil
+}
+
+// Fetches the discovery document once, a failure is retried on the next call
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	md := &metadata{}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", md); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	// The issuer must be the exact one we configured (OpenID Connect Discovery 1.0, 4.3)
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match the configured %q", md.Issuer, p.cfg.Issuer)
+	}
+
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery: the document lacks an authorization, token or jwks endpoint")
+	}
+
+	p.metadata = md
+	return md, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v any) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", rawURL, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", rawURL, err)
+	}
+
+	return nil
+}
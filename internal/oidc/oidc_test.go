@@ -0,0 +1,187 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/oidc"
+	"github.com/itsmandrew/server-go/internal/oidc/oidctest"
+)
+
+const redirectURL = "https://chirpy.example/login/callback"
+
+var walter = oidctest.User{Subject: "1234", Email: "walt@heisenberg.com", EmailVerified: true, Name: "Walter White"}
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+
+	server := oidctest.NewServer("chirpy", "s3cret")
+	t.Cleanup(server.Close)
+
+	return server, oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  redirectURL,
+	}, nil)
+}
+
+// Runs the whole flow and returns the verified identity
+func signIn(t *testing.T, server *oidctest.Server, provider *oidc.Provider, user oidctest.User) (oidc.Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 43)
+	authURL, err := provider.AuthCodeURL(ctx, "the-state", "the-nonce", auth.PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	redirect, err := server.Login(authURL, user)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	u, _ := url.Parse(redirect)
+	if got := u.Query().Get("state"); got != "the-state" {
+		t.Fatalf("expected the state back, got %q", got)
+	}
+
+	idToken, err := provider.Exchange(ctx, u.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	return provider.Verify(ctx, idToken, "the-nonce")
+}
+
+func TestSignIn(t *testing.T) {
+	server, provider := newProvider(t)
+
+	identity, err := signIn(t, server, provider, walter)
+	if err != nil {
+		t.Fatalf("Verify returned unexpected error: %v", err)
+	}
+
+	want := oidc.Identity{Subject: "1234", Email: "walt@heisenberg.com", EmailVerified: true, Name: "Walter White"}
+	if identity != want {
+		t.Errorf("expected %+v, got %+v", want, identity)
+	}
+}
+
+func TestExchangeRejectsReplayedCode(t *testing.T) {
+	server, provider := newProvider(t)
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 43)
+	authURL, _ := provider.AuthCodeURL(ctx, "state", "nonce", auth.PKCEChallenge(verifier))
+	redirect, _ := server.Login(authURL, walter)
+	u, _ := url.Parse(redirect)
+	code := u.Query().Get("code")
+
+	if _, err := provider.Exchange(ctx, code, strings.Repeat("w", 43)); err == nil {
+		t.Fatal("expected a wrong verifier to be refused")
+	}
+
+	var tokenErr *oidc.TokenError
+	if _, err := provider.Exchange(ctx, code, verifier); !errors.As(err, &tokenErr) || tokenErr.Code != "invalid_grant" {
+		t.Errorf("expected invalid_grant for a used code, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedClaims(t *testing.T) {
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"foreign azp":    func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "other"}; c["azp"] = "other" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"future iat":     func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			server, provider := newProvider(t)
+			server.TamperClaims(tamper)
+
+			if _, err := signIn(t, server, provider, walter); !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsStringEmailVerified(t *testing.T) {
+	server, provider := newProvider(t)
+	server.TamperClaims(func(c jwt.MapClaims) { c["email_verified"] = "true" })
+
+	identity, err := signIn(t, server, provider, walter)
+	if err != nil || !identity.EmailVerified {
+		t.Errorf("expected a verified email, got %+v, %v", identity, err)
+	}
+}
+
+func TestVerifyRejectsOtherKeys(t *testing.T) {
+	server, provider := newProvider(t)
+	ctx := context.Background()
+
+	if _, err := signIn(t, server, provider, walter); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed with a key the provider never published
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": server.Issuer(), "aud": "chirpy", "sub": "1234"})
+	raw, _ := forged.SignedString([]byte("s3cret"))
+
+	if _, err := provider.Verify(ctx, raw, ""); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("expected an HS256 token to be refused, got %v", err)
+	}
+}
+
+func TestVerifyRefetchesRotatedKeys(t *testing.T) {
+	server, provider := newProvider(t)
+
+	if _, err := signIn(t, server, provider, walter); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new kid is unknown and the keys were just fetched, so the refetch is held back
+	server.RotateKey()
+
+	if _, err := signIn(t, server, provider, walter); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Errorf("expected the unknown key to be refused within a minute of the last fetch, got %v", err)
+	}
+
+	// A fresh Provider picks up the rotated key
+	fresh := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  redirectURL,
+	}, nil)
+
+	if _, err := signIn(t, server, fresh, walter); err != nil {
+		t.Errorf("expected the rotated key to be fetched, got %v", err)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	server, _ := newProvider(t)
+
+	provider := oidc.NewProvider(oidc.Config{Issuer: server.Issuer() + "/", ClientID: "chirpy", RedirectURL: redirectURL}, nil)
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Error("expected a trailing slash in the issuer to be refused")
+	}
+}
@@ -0,0 +1,191 @@
+// Package seed generates fake but plausible users, follows and chirps for local demos and load
+// tests. The same Options always produce the same Dataset, so a demo can be rebuilt exactly.
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Options controls the size of the generated data
+type Options struct {
+	Seed           uint64
+	Users          int
+	ChirpsPerUser  int
+	FollowsPerUser int
+}
+
+// Limits keep an accidental request from filling the disk
+const (
+	MaxUsers          = 10000
+	MaxChirpsPerUser  = 100
+	MaxFollowsPerUser = 100
+)
+
+// Default is a small network that is quick to create
+var Default = Options{
+	Seed:           1,
+	Users:          25,
+	ChirpsPerUser:  5,
+	FollowsPerUser: 5,
+}
+
+// Problem is an option outside the limits, Field is its JSON name
+type Problem struct {
+	Field   string
+	Message string
+}
+
+// Problems lists every option outside the limits
+func (o Options) Problems() []Problem {
+	var problems []Problem
+
+	if o.Users < 1 || o.Users > MaxUsers {
+		problems = append(problems, Problem{"users", fmt.Sprintf("must be between 1 and %d", MaxUsers)})
+	}
+
+	if o.ChirpsPerUser < 0 || o.ChirpsPerUser > MaxChirpsPerUser {
+		problems = append(problems, Problem{"chirps_per_user", fmt.Sprintf("must be between 0 and %d", MaxChirpsPerUser)})
+	}
+
+	if o.FollowsPerUser < 0 || o.FollowsPerUser > MaxFollowsPerUser {
+		problems = append(problems, Problem{"follows_per_user", fmt.Sprintf("must be between 0 and %d", MaxFollowsPerUser)})
+	} else if o.FollowsPerUser > 0 && o.FollowsPerUser >= o.Users {
+		problems = append(problems, Problem{"follows_per_user", "must be lower than users"})
+	}
+
+	return problems
+}
+
+// User is a generated account. Emails use the reserved example.com domain.
+type User struct {
+	Email       string
+	Handle      string
+	DisplayName string
+	Bio         string
+	Location    string
+}
+
+// Chirp and Follow refer to users by their index in Dataset.Users
+type Chirp struct {
+	Author int
+	Body   string
+}
+
+type Follow struct {
+	Follower int
+	Followee int
+}
+
+type Dataset struct {
+	Users   []User
+	Chirps  []Chirp
+	Follows []Follow
+}
+
+// Generate builds the dataset described by opts, which must be valid
+func Generate(opts Options) Dataset {
+
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15))
+
+	var data Dataset
+	handles := map[string]bool{}
+
+	for range opts.Users {
+		first, last := pick(rng, firstNames), pick(rng, lastNames)
+
+		handle := strings.ToLower(first + "_" + last)
+		for n := 2; handles[handle]; n++ {
+			handle = strings.ToLower(fmt.Sprintf("%s_%s%d", first, last, n))
+		}
+		handles[handle] = true
+
+		data.Users = append(data.Users, User{
+			Email:       handle + "@example.com",
+			Handle:      handle,
+			DisplayName: first + " " + last,
+			Bio:         pick(rng, bios),
+			Location:    pick(rng, cities),
+		})
+	}
+
+	for i := range data.Users {
+		followed := map[int]bool{i: true}
+
+		// FollowsPerUser is lower than Users, so this always finds enough distinct followees
+		for len(followed) <= opts.FollowsPerUser {
+			followee := rng.IntN(len(data.Users))
+			if !followed[followee] {
+				followed[followee] = true
+				data.Follows = append(data.Follows, Follow{Follower: i, Followee: followee})
+			}
+		}
+	}
+
+	// Interleaved by round rather than grouped per user, so a timeline looks like a real one
+	for range opts.ChirpsPerUser {
+		for i := range data.Users {
+			data.Chirps = append(data.Chirps, Chirp{Author: i, Body: chirpBody(rng)})
+		}
+	}
+
+	return data
+}
+
+func chirpBody(rng *rand.Rand) string {
+	return fmt.Sprintf(pick(rng, chirpTemplates), pick(rng, topics))
+}
+
+func pick(rng *rand.Rand, items []string) string {
+	return items[rng.IntN(len(items))]
+}
+
+var firstNames = []string{
+	"Ada", "Alan", "Amara", "Ben", "Carmen", "Chen", "Dana", "Diego", "Elena", "Farah",
+	"Grace", "Hana", "Ivan", "Jamal", "Kira", "Leo", "Maya", "Nikhil", "Olga", "Pablo",
+	"Quinn", "Rosa", "Sam", "Tariq", "Uma", "Victor", "Wen", "Yara", "Zoe", "Omar",
+}
+
+var lastNames = []string{
+	"Adeyemi", "Berg", "Castillo", "Dubois", "Eriksen", "Fischer", "Garcia", "Hughes", "Ito", "Jensen",
+	"Kowalski", "Lopez", "Moreau", "Nakamura", "Okafor", "Petrov", "Quinn", "Rossi", "Silva", "Tanaka",
+	"Urban", "Varga", "Walsh", "Xu", "Yilmaz", "Zhang",
+}
+
+var cities = []string{
+	"Albuquerque", "Amsterdam", "Austin", "Berlin", "Buenos Aires", "Cape Town", "Denver", "Lagos",
+	"Lisbon", "Melbourne", "Mumbai", "Osaka", "Seoul", "Toronto", "Warsaw",
+}
+
+var bios = []string{
+	"Coffee first, code second.",
+	"Backend engineer. Opinions are my own.",
+	"Amateur baker, professional overthinker.",
+	"Trail runner and weekend photographer.",
+	"Reading too many books at once.",
+	"Building small things on the internet.",
+	"Chasing the perfect espresso.",
+	"Plant parent of 23.",
+	"",
+}
+
+var topics = []string{
+	"Go generics", "sourdough", "the new coffee place", "Postgres indexes", "trail running",
+	"my houseplants", "board games", "mechanical keyboards", "the weather", "jazz records",
+	"code reviews", "the city marathon", "tabs vs spaces", "a good book", "the night market",
+}
+
+// Every template has one %s for the topic and stays well under the chirp length limit
+var chirpTemplates = []string{
+	"Hot take: %s is underrated.",
+	"Spent the whole evening on %s and no regrets.",
+	"Anyone else thinking about %s today?",
+	"Finally figured out %s. Only took three coffees.",
+	"Reminder that %s exists and it's great.",
+	"Not sure how I feel about %s yet.",
+	"Just wrote a long thread about %s, then deleted it.",
+	"Today's small win: %s.",
+	"Can we talk about %s for a second?",
+	"Weekend plans: %s and a nap.",
+}
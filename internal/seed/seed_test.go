@@ -0,0 +1,71 @@
+package seed
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	opts := Options{Seed: 42, Users: 50, ChirpsPerUser: 3, FollowsPerUser: 4}
+
+	first, second := Generate(opts), Generate(opts)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("expected the same dataset for the same seed")
+	}
+
+	opts.Seed = 43
+	if reflect.DeepEqual(first, Generate(opts)) {
+		t.Error("expected a different dataset for another seed")
+	}
+}
+
+func TestGenerateShape(t *testing.T) {
+	opts := Options{Seed: 7, Users: 200, ChirpsPerUser: 2, FollowsPerUser: 10}
+	data := Generate(opts)
+
+	if len(data.Users) != 200 || len(data.Chirps) != 400 || len(data.Follows) != 2000 {
+		t.Fatalf("unexpected sizes: %d users, %d chirps, %d follows", len(data.Users), len(data.Chirps), len(data.Follows))
+	}
+
+	// Handles must pass the signup validation and be unique
+	validHandle := regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+	handles := map[string]bool{}
+	for _, u := range data.Users {
+		if !validHandle.MatchString(u.Handle) || handles[u.Handle] {
+			t.Errorf("invalid or duplicate handle %q", u.Handle)
+		}
+		handles[u.Handle] = true
+	}
+
+	follows := map[Follow]bool{}
+	for _, f := range data.Follows {
+		if f.Follower == f.Followee || follows[f] {
+			t.Errorf("self or duplicate follow %+v", f)
+		}
+		follows[f] = true
+	}
+
+	for _, c := range data.Chirps {
+		if len(c.Body) > 140 {
+			t.Errorf("chirp over the length limit: %q", c.Body)
+		}
+	}
+}
+
+func TestProblems(t *testing.T) {
+	if problems := Default.Problems(); len(problems) > 0 {
+		t.Errorf("default options are invalid: %v", problems)
+	}
+
+	for _, opts := range []Options{
+		{Users: 0},
+		{Users: MaxUsers + 1},
+		{Users: 10, ChirpsPerUser: -1},
+		{Users: 5, FollowsPerUser: 5},
+	} {
+		if len(opts.Problems()) == 0 {
+			t.Errorf("expected %+v to be rejected", opts)
+		}
+	}
+}
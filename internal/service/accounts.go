@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// AccountService handles what users can do with their account as a whole: exporting their data
+// and deleting it. Deletion is scheduled rather than immediate, logging in during the grace period
+// cancels it, and PurgeDue removes the accounts whose grace period is over.
+type AccountService struct {
+	store       store.Store
+	media       *MediaService
+	gracePeriod time.Duration
+}
+
+func NewAccountService(s store.Store, media *MediaService, gracePeriod time.Duration) *AccountService {
+	return &AccountService{store: s, media: media, gracePeriod: gracePeriod}
+}
+
+// AccountExport is everything stored about a user, minus password hashes and tokens
+type AccountExport struct {
+	User     database.GetUserByIDNoPasswordRow
+	Chirps   []database.Chirp
+	Likes    []database.Like
+	Sessions []database.ListUserSessionsRow
+}
+
+// Users without a password confirm a deletion with the refresh token of a login this recent
+const deletionLoginWindow = 10 * time.Minute
+
+// ScheduleDeletion makes the user prove it is them again and schedules the account for deletion:
+// with their password, or for users who sign in with a provider or a magic link, with the refresh
+// token of a login made within deletionLoginWindow. Every session is revoked, so the only way back
+// in is logging in, which cancels the deletion.
+func (s *AccountService) ScheduleDeletion(ctx context.Context, userID uuid.UUID, password, refreshToken string) (time.Time, error) {
+
+	user, err := s.store.GetUserByID(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return time.Time{}, apierror.Internal(fmt.Errorf("GetUserByID: %w", err))
+	}
+
+	if user.HashedPassword != "" {
+		if password == "" {
+			return time.Time{}, apierror.Validation(apierror.FieldError{Field: "password", Message: "is required"})
+		}
+
+		if err := auth.CheckPasswordHash(user.HashedPassword, password); err != nil {
+			return time.Time{}, apierror.Unauthorized(apierror.CodeInvalidCredentials, "Password is incorrect")
+		}
+	} else if err := s.checkRecentLogin(ctx, userID, refreshToken); err != nil {
+		return time.Time{}, err
+	}
+
+	due := time.Now().UTC().Add(s.gracePeriod)
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		err := tx.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{
+			ID:                  userID,
+			DeletionScheduledAt: sql.NullTime{Time: due, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("ScheduleUserDeletion: %w", err)
+		}
+
+		if err := tx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			return fmt.Errorf("RevokeUserRefreshTokens: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return time.Time{}, apierror.Internal(err)
+	}
+
+	return due, nil
+}
+
+// The refresh token must be the user's own, from a login rather than an OAuth client, and still
+// live. Refreshing doesn't replace it, so its creation time is when the user logged in.
+func (s *AccountService) checkRecentLogin(ctx context.Context, userID uuid.UUID, refreshToken string) error {
+
+	if refreshToken == "" {
+		return apierror.Validation(apierror.FieldError{Field: "refresh_token", Message: "is required for an account without a password"})
+	}
+
+	stale := apierror.Unauthorized(apierror.CodeInvalidCredentials, fmt.Sprintf("Log in again, the refresh_token must come from a login within the last %v", deletionLoginWindow))
+
+	token, err := s.store.GetUserFromRefreshToken(ctx, refreshToken)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return stale
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("GetUserFromRefreshToken: %w", err))
+	}
+
+	now := time.Now().UTC()
+
+	if token.UserID != userID || token.ClientID.Valid || token.RevokedAt.Valid || now.After(token.ExpiresAt) || now.Sub(token.CreatedAt) > deletionLoginWindow {
+		return stale
+	}
+
+	return nil
+}
+
+// Export gathers the user's profile, chirps (hidden ones included), likes and sessions
+func (s *AccountService) Export(ctx context.Context, userID uuid.UUID) (AccountExport, error) {
+
+	user, err := s.store.GetUserByIDNoPassword(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccountExport{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return AccountExport{}, apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	chirps, err := s.store.ListChirpsByAuthor(ctx, userID)
+	if err != nil {
+		return AccountExport{}, apierror.Internal(fmt.Errorf("ListChirpsByAuthor: %w", err))
+	}
+
+	likes, err := s.store.ListLikesByUser(ctx, userID)
+	if err != nil {
+		return AccountExport{}, apierror.Internal(fmt.Errorf("ListLikesByUser: %w", err))
+	}
+
+	sessions, err := s.store.ListUserSessions(ctx, userID)
+	if err != nil {
+		return AccountExport{}, apierror.Internal(fmt.Errorf("ListUserSessions: %w", err))
+	}
+
+	return AccountExport{
+		User:     user,
+		Chirps:   chirps,
+		Likes:    likes,
+		Sessions: sessions,
+	}, nil
+}
+
+// PurgeDue deletes the accounts whose grace period is over. The foreign keys cascade the delete
+// to everything they own, only the images on disk are cleaned up here.
+func (s *AccountService) PurgeDue(ctx context.Context) (int, error) {
+
+	deleted, err := s.store.DeleteDueUsers(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("DeleteDueUsers: %w", err)
+	}
+
+	for _, u := range deleted {
+		s.media.DeleteImage(ctx, ImageAvatar, u.AvatarKey)
+		s.media.DeleteImage(ctx, ImageBanner, u.BannerKey)
+	}
+
+	return len(deleted), nil
+}
+
+// PurgeEvery runs PurgeDue every interval until ctx is cancelled
+func (s *AccountService) PurgeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Account purge failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Deleted %d accounts past their grace period", n)
+			}
+		}
+	}
+}
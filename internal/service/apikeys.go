@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+const (
+	maxAPIKeyNameLength = 50
+
+	// Unexpired, unrevoked keys a user may hold at once
+	maxActiveAPIKeys = 20
+)
+
+// APIKeyService lets users mint personal API keys for their bots and scripts. The keys are
+// checked by AuthService.Authenticate.
+type APIKeyService struct {
+	store store.APIKeyStore
+}
+
+func NewAPIKeyService(s store.Store) *APIKeyService {
+	return &APIKeyService{store: s}
+}
+
+// APIKeyInput describes a new key, a nil ExpiresAt never expires
+type APIKeyInput struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// CreatedAPIKey is a new key along with its secret, which is not stored and can't be shown again
+type CreatedAPIKey struct {
+	database.ApiKey
+	Secret string
+}
+
+func (s *APIKeyService) Create(ctx context.Context, userID uuid.UUID, in APIKeyInput) (CreatedAPIKey, error) {
+
+	name := strings.TrimSpace(in.Name)
+	var fields []apierror.FieldError
+
+	switch {
+	case name == "":
+		fields = append(fields, apierror.FieldError{Field: "name", Message: "is required"})
+	case len(name) > maxAPIKeyNameLength:
+		fields = append(fields, apierror.FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxAPIKeyNameLength)})
+	}
+
+	scopes := []string{}
+	for _, raw := range in.Scopes {
+		scope, err := auth.ParseScope(raw)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q, must be one of %s", raw, joinScopes(auth.Scopes))})
+			continue
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+	slices.Sort(scopes)
+
+	if len(in.Scopes) == 0 {
+		fields = append(fields, apierror.FieldError{Field: "scopes", Message: "must list at least one scope"})
+	}
+
+	var expiresAt sql.NullTime
+	if in.ExpiresAt != nil {
+		if !in.ExpiresAt.After(time.Now()) {
+			fields = append(fields, apierror.FieldError{Field: "expires_at", Message: "must be in the future"})
+		}
+		expiresAt = sql.NullTime{Time: in.ExpiresAt.UTC(), Valid: true}
+	}
+
+	if len(fields) > 0 {
+		return CreatedAPIKey{}, apierror.Validation(fields...)
+	}
+
+	active, err := s.store.CountActiveAPIKeys(ctx, userID)
+	if err != nil {
+		return CreatedAPIKey{}, apierror.Internal(fmt.Errorf("CountActiveAPIKeys: %w", err))
+	}
+
+	if active >= maxActiveAPIKeys {
+		return CreatedAPIKey{}, apierror.Conflict(fmt.Sprintf("You already have %d active API keys, revoke one first", maxActiveAPIKeys))
+	}
+
+	secret, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		return CreatedAPIKey{}, apierror.Internal(fmt.Errorf("MakeAPIKey: %w", err))
+	}
+
+	key, err := s.store.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(secret),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+
+	if err != nil {
+		return CreatedAPIKey{}, apierror.Internal(fmt.Errorf("CreateAPIKey: %w", err))
+	}
+
+	return CreatedAPIKey{ApiKey: key, Secret: secret}, nil
+}
+
+// List returns every key of the user, revoked and expired ones included, newest first
+func (s *APIKeyService) List(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error) {
+	keys, err := s.store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListAPIKeys: %w", err))
+	}
+	return keys, nil
+}
+
+// Revoke stops the key from working right away, it stays in the list
+func (s *APIKeyService) Revoke(ctx context.Context, userID, keyID uuid.UUID) error {
+
+	_, err := s.store.RevokeAPIKey(ctx, database.RevokeAPIKeyParams{ID: keyID, UserID: userID})
+
+	// Someone else's key is not found either
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound("API key not found")
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("RevokeAPIKey: %w", err))
+	}
+
+	return nil
+}
+
+func joinScopes(scopes []auth.Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Session is what a successful login hands back to the client
+type Session struct {
+	User         database.User
+	AccessToken  string
+	RefreshToken string
+}
+
+// AuthService issues and checks access / refresh tokens
+type AuthService struct {
+	users           store.UserStore
+	refreshTokens   store.RefreshTokenStore
+	apiKeys         store.APIKeyStore
+	jwtSecret       string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+type AuthConfig struct {
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+func NewAuthService(s store.Store, cfg AuthConfig) *AuthService {
+	return &AuthService{
+		users:           s,
+		refreshTokens:   s,
+		apiKeys:         s,
+		jwtSecret:       cfg.JWTSecret,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+	}
+}
+
+// Login checks the credentials and starts a session with a fresh access and refresh token
+func (s *AuthService) Login(ctx context.Context, email, password string) (Session, error) {
+
+	if err := validateCredentials(email, password); err != nil {
+		return Session{}, err
+	}
+
+	// Same answer for an unknown email and a wrong password, so we don't leak which emails exist
+	invalidCredentials := apierror.Unauthorized(apierror.CodeInvalidCredentials, "Email or password is incorrect")
+
+	user, err := s.users.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, invalidCredentials
+	}
+
+	if err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("GetUserByEmail: %w", err))
+	}
+
+	// Checks if our response body password is equal to the encrypted password in our database
+	if err := auth.CheckPasswordHash(user.HashedPassword, password); err != nil {
+		return Session{}, invalidCredentials
+	}
+
+	return s.StartSession(ctx, user)
+}
+
+// StartSession mints the access and refresh token of a user who proved who they are, by password
+// or otherwise. Suspended users are turned away and a scheduled deletion is called off.
+func (s *AuthService) StartSession(ctx context.Context, user database.User) (Session, error) {
+
+	// Suspended by a moderator, their refresh tokens were revoked at the same time
+	if user.SuspendedAt.Valid {
+		return Session{}, apierror.Forbidden("Account is suspended")
+	}
+
+	// Logging in during the grace period keeps the account
+	if user.DeletionScheduledAt.Valid {
+		if err := s.users.CancelUserDeletion(ctx, user.ID); err != nil {
+			return Session{}, apierror.Internal(fmt.Errorf("CancelUserDeletion: %w", err))
+		}
+		user.DeletionScheduledAt = sql.NullTime{}
+	}
+
+	// Create a JWT token for our user that logins in (access token)
+	accessToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), s.jwtSecret, s.accessTokenTTL)
+	if err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("MakeJWT: %w", err))
+	}
+
+	// Create a refresh token (string form) and store it
+	refreshToken, _ := auth.MakeRefreshToken()
+
+	created, err := s.refreshTokens.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.refreshTokenTTL),
+	})
+
+	if err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("CreateRefreshToken: %w", err))
+	}
+
+	return Session{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: created.Token,
+	}, nil
+}
+
+// Refresh trades a valid refresh token for a new access token
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (string, error) {
+
+	invalidToken := apierror.Unauthorized(apierror.CodeInvalidToken, "Refresh token is invalid, expired or revoked")
+
+	dbToken, err := s.refreshTokens.GetUserFromRefreshToken(ctx, refreshToken)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", invalidToken
+	}
+
+	if err != nil {
+		return "", apierror.Internal(fmt.Errorf("GetUserFromRefreshToken: %w", err))
+	}
+
+	// Tokens issued to an OAuth client are refreshed at /api/oauth/token, here they would come
+	// back as an unscoped session token
+	if dbToken.RevokedAt.Valid || time.Now().UTC().After(dbToken.ExpiresAt) || dbToken.ClientID.Valid {
+		return "", invalidToken
+	}
+
+	// The role is read again so promotions and demotions apply from the next refresh
+	user, err := s.users.GetUserByIDNoPassword(ctx, dbToken.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", invalidToken
+	}
+
+	if err != nil {
+		return "", apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	accessToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), s.jwtSecret, s.accessTokenTTL)
+	if err != nil {
+		return "", apierror.Internal(fmt.Errorf("MakeJWT: %w", err))
+	}
+
+	return accessToken, nil
+}
+
+// Revoke marks the refresh token as unusable
+func (s *AuthService) Revoke(ctx context.Context, refreshToken string) error {
+	if err := s.refreshTokens.RevokeRefreshToken(ctx, refreshToken); err != nil {
+		return apierror.Internal(fmt.Errorf("RevokeRefreshToken: %w", err))
+	}
+	return nil
+}
+
+// Authenticate validates an access token or a personal API key and returns the user and role it
+// was issued for
+func (s *AuthService) Authenticate(ctx context.Context, token string) (auth.Principal, error) {
+
+	if auth.IsAPIKey(token) {
+		return s.authenticateAPIKey(ctx, token)
+	}
+
+	// Checks to see if the token is a AccessToken vs RefreshToken (accessToken has 3 dots) -> Sanity Check
+	if len(strings.Split(token, ".")) != 3 {
+		return auth.Principal{}, apierror.Unauthorized(apierror.CodeInvalidToken, "Invalid token format")
+	}
+
+	principal, err := auth.ValidateJWT(token, s.jwtSecret)
+
+	if err != nil || principal.UserID == uuid.Nil {
+		return auth.Principal{}, apierror.Unauthorized(apierror.CodeInvalidToken, "Access token is invalid or expired").WithCause(err)
+	}
+
+	return principal, nil
+}
+
+// Unlike a JWT the key is checked against the database on every request, so revoking it, or
+// suspending or deleting the account, takes effect right away
+func (s *AuthService) authenticateAPIKey(ctx context.Context, key string) (auth.Principal, error) {
+
+	invalidKey := apierror.Unauthorized(apierror.CodeInvalidToken, "API key is invalid, expired or revoked")
+
+	row, err := s.apiKeys.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.Principal{}, invalidKey
+	}
+
+	if err != nil {
+		return auth.Principal{}, apierror.Internal(fmt.Errorf("GetAPIKeyByHash: %w", err))
+	}
+
+	if row.RevokedAt.Valid || (row.ExpiresAt.Valid && !time.Now().UTC().Before(row.ExpiresAt.Time)) {
+		return auth.Principal{}, invalidKey
+	}
+
+	if row.SuspendedAt.Valid || row.DeletionScheduledAt.Valid {
+		return auth.Principal{}, apierror.Forbidden("Account is suspended or scheduled for deletion")
+	}
+
+	// Only informational, a failed write must not lock the bot out
+	if err := s.apiKeys.TouchAPIKey(ctx, row.ID); err != nil {
+		log.Printf("Recording the use of API key %v failed: %v", row.ID, err)
+	}
+
+	scopes := make([]auth.Scope, 0, len(row.Scopes))
+	for _, scope := range row.Scopes {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+
+	return auth.Principal{
+		UserID:   row.UserID,
+		Role:     auth.Role(row.Role),
+		APIKeyID: row.ID,
+		Scopes:   scopes,
+	}, nil
+}
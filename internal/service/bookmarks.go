@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// Bookmark saves the chirp for userID, bookmarking it again is a no-op. Like likes, chirps the user
+// can't see 404. Nobody else, not even the author, learns about it.
+func (s *ChirpService) Bookmark(ctx context.Context, userID, chirpID uuid.UUID) error {
+
+	if _, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, chirpID); err != nil {
+		return err
+	}
+
+	err := s.store.CreateBookmark(ctx, database.CreateBookmarkParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("CreateBookmark: %w", err))
+	}
+
+	return nil
+}
+
+// Unbookmark removes the bookmark, if any
+func (s *ChirpService) Unbookmark(ctx context.Context, userID, chirpID uuid.UUID) error {
+
+	err := s.store.DeleteBookmark(ctx, database.DeleteBookmarkParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteBookmark: %w", err))
+	}
+
+	return nil
+}
+
+// Bookmarks returns a page of the chirps userID bookmarked and can still see, the last bookmarked
+// first. BeforeID pages by when the chirp was bookmarked rather than posted.
+func (s *ChirpService) Bookmarks(ctx context.Context, userID uuid.UUID, filter ChirpFilter) ([]database.Chirp, error) {
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	chirps, err := s.store.ListBookmarkedChirps(ctx, database.ListBookmarkedChirpsParams{
+		UserID:   userID,
+		AuthorID: filter.AuthorID,
+		BeforeID: filter.BeforeID,
+		PageSize: int32(filter.Limit),
+	})
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListBookmarkedChirps: %w", err))
+	}
+
+	return chirps, nil
+}
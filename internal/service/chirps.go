@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// At most this many users are notified of a mention, the rest of the handles are left as text
+const maxMentions = 10
+
+// Page sizes of every chirp listing: GET /api/chirps, list timelines and bookmarks
+const (
+	DefaultChirpPageSize = 50
+	MaxChirpPageSize     = 100
+)
+
+// A handle preceded by @, but not as part of an email address or another word
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// ChirpService owns the chirp rules: length limit, moderation and ownership
+type ChirpService struct {
+	store     store.Store
+	maxLength int
+	moderator ContentModerator
+	notifier  Notifier
+}
+
+func NewChirpService(s store.Store, maxLength int, moderator ContentModerator, notifier Notifier) *ChirpService {
+	return &ChirpService{
+		store:     s,
+		maxLength: maxLength,
+		moderator: moderator,
+		notifier:  notifier,
+	}
+}
+
+// Create validates and moderates the body, then stores the chirp for userID. replyToID, when set,
+// must be a chirp the author can see. poll, when set, is checked and stored along with the chirp.
+func (s *ChirpService) Create(ctx context.Context, userID uuid.UUID, body string, replyToID uuid.NullUUID, poll *PollInput) (database.Chirp, error) {
+
+	verdict, err := s.validate(body)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	if poll != nil {
+		if err := s.validatePoll(poll, &verdict); err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	parent, err := s.replyParent(ctx, userID, replyToID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	var chirp database.Chirp
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		chirp, err = s.insert(ctx, tx, userID, verdict, replyToID)
+		if err != nil || poll == nil {
+			return err
+		}
+
+		return createPoll(ctx, tx, chirp.ID, poll)
+	})
+
+	if err != nil {
+		return database.Chirp{}, apierror.Internal(err)
+	}
+
+	s.notifyChirp(ctx, chirp, parent)
+
+	return chirp, nil
+}
+
+// The chirp replyToID points at, which the author must be able to see. No reply, no parent.
+func (s *ChirpService) replyParent(ctx context.Context, userID uuid.UUID, replyToID uuid.NullUUID) (database.Chirp, error) {
+
+	if !replyToID.Valid {
+		return database.Chirp{}, nil
+	}
+
+	parent, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, replyToID.UUID)
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return database.Chirp{}, apierror.Validation(apierror.FieldError{Field: "reply_to_id", Message: "is not a chirp you can reply to"})
+	}
+
+	return parent, err
+}
+
+// Stores the chirp, its moderation flag and the chirp.created event together, tx must be a transaction
+func (s *ChirpService) insert(ctx context.Context, tx store.Store, userID uuid.UUID, verdict moderation.Verdict, replyToID uuid.NullUUID) (database.Chirp, error) {
+
+	chirp, err := tx.CreateChirp(ctx, database.CreateChirpParams{
+		Body:      verdict.Text,
+		UserID:    userID,
+		ReplyToID: replyToID,
+	})
+
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("CreateChirp: %w", err)
+	}
+
+	// Flagged chirps are published but queued for a moderator to look at
+	if verdict.Flagged() {
+		_, err := tx.CreateModerationFlag(ctx, database.CreateModerationFlagParams{
+			ChirpID: chirp.ID,
+			Reason:  flagReason(verdict),
+		})
+
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("CreateModerationFlag: %w", err)
+		}
+	}
+
+	payload := events.ChirpCreatedPayload{
+		ChirpID: chirp.ID,
+		UserID:  chirp.UserID,
+		Body:    chirp.Body,
+	}
+
+	if chirp.ReplyToID.Valid {
+		payload.ReplyToID = &chirp.ReplyToID.UUID
+	}
+
+	if err := events.Record(ctx, tx, events.ChirpCreated, payload); err != nil {
+		return database.Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+// Tells the author of the parent about a reply and the mentioned users about the mention. The
+// parent's author already gets the reply, a mention of them on top would be noise.
+func (s *ChirpService) notifyChirp(ctx context.Context, chirp, parent database.Chirp) {
+
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+
+	if chirp.ReplyToID.Valid {
+		s.notifier.Notify(ctx, NotificationEvent{
+			Kind:        NotifyReply,
+			RecipientID: parent.UserID,
+			ActorID:     chirp.UserID,
+			ChirpID:     chirpID,
+		})
+	}
+
+	handles := Mentions(chirp.Body)
+	if len(handles) == 0 {
+		return
+	}
+
+	users, err := s.store.GetUserIDsByHandles(ctx, handles)
+	if err != nil {
+		log.Printf("Resolving the mentions of chirp %v: %v", chirp.ID, err)
+		return
+	}
+
+	for _, u := range users {
+		if chirp.ReplyToID.Valid && u.ID == parent.UserID {
+			continue
+		}
+
+		s.notifier.Notify(ctx, NotificationEvent{
+			Kind:        NotifyMention,
+			RecipientID: u.ID,
+			ActorID:     chirp.UserID,
+			ChirpID:     chirpID,
+		})
+	}
+}
+
+// Mentions returns the distinct lower cased handles mentioned in body, in order, at most maxMentions
+func Mentions(body string) []string {
+
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(m[1])
+		if slices.Contains(handles, handle) {
+			continue
+		}
+
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+// ChirpFilter narrows and pages the chirp listings, newest first. The next page starts after
+// BeforeID, the last chirp of the previous one.
+type ChirpFilter struct {
+	AuthorID uuid.NullUUID
+	BeforeID uuid.NullUUID
+	Limit    int
+}
+
+func (f ChirpFilter) validate() error {
+	if f.Limit < 1 || f.Limit > MaxChirpPageSize {
+		return apierror.Validation(apierror.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", MaxChirpPageSize),
+		})
+	}
+	return nil
+}
+
+// List returns a page of visible chirps, viewerID (when set) hides chirps from users who blocked or were muted by them
+func (s *ChirpService) List(ctx context.Context, viewerID uuid.NullUUID, filter ChirpFilter) ([]database.Chirp, error) {
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	chirps, err := s.store.GetChirps(ctx, database.GetChirpsParams{
+		ViewerID: viewerID,
+		AuthorID: filter.AuthorID,
+		BeforeID: filter.BeforeID,
+		PageSize: int32(filter.Limit),
+	})
+
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("GetChirps: %w", err))
+	}
+
+	return chirps, nil
+}
+
+// Get returns a single chirp, a viewer blocked by the author gets a 404 as if it didn't exist
+func (s *ChirpService) Get(ctx context.Context, viewerID uuid.NullUUID, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.store.GetIndividualChirp(ctx, database.GetIndividualChirpParams{
+		ID:       chirpID,
+		ViewerID: viewerID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Chirp{}, apierror.NotFound("Chirp not found")
+	}
+
+	if err != nil {
+		return database.Chirp{}, apierror.Internal(fmt.Errorf("GetIndividualChirp: %w", err))
+	}
+
+	return chirp, nil
+}
+
+// Delete removes the chirp, only its author may do so
+func (s *ChirpService) Delete(ctx context.Context, userID, chirpID uuid.UUID) error {
+
+	chirp, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if chirp.UserID != userID {
+		return apierror.Forbidden("Only the author can delete this chirp")
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		if err := tx.DeleteChirpByID(ctx, chirpID); err != nil {
+			return fmt.Errorf("DeleteChirpByID: %w", err)
+		}
+
+		return events.Record(ctx, tx, events.ChirpDeleted, events.ChirpDeletedPayload{
+			ChirpID: chirp.ID,
+			UserID:  chirp.UserID,
+			Reason:  events.DeletedByAuthor,
+		})
+	})
+
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	return nil
+}
+
+// Checks the chirp against the length limit and runs it through the moderation pipeline
+func (s *ChirpService) validate(body string) (moderation.Verdict, error) {
+
+	if strings.TrimSpace(body) == "" {
+		return moderation.Verdict{}, apierror.Validation(apierror.FieldError{Field: "body", Message: "is required"})
+	}
+
+	if len(body) > s.maxLength {
+		return moderation.Verdict{}, apierror.Validation(apierror.FieldError{
+			Field:   "body",
+			Message: fmt.Sprintf("must be at most %d characters", s.maxLength),
+		})
+	}
+
+	verdict := s.moderator.Check(body)
+
+	if verdict.Rejected() {
+		return moderation.Verdict{}, apierror.New(http.StatusUnprocessableEntity, apierror.CodeContentRejected, "Chirp violates the content rules")
+	}
+
+	return verdict, nil
+}
+
+// LikeState is a chirp with its like count after a like or unlike
+type LikeState struct {
+	Chirp database.Chirp
+	Likes int64
+}
+
+// Like marks the chirp as liked by userID, liking it again is a no-op. Chirps the user can't see 404.
+func (s *ChirpService) Like(ctx context.Context, userID, chirpID uuid.UUID) (LikeState, error) {
+
+	chirp, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, chirpID)
+	if err != nil {
+		return LikeState{}, err
+	}
+
+	err = s.store.CreateLike(ctx, database.CreateLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+
+	if err != nil {
+		return LikeState{}, apierror.Internal(fmt.Errorf("CreateLike: %w", err))
+	}
+
+	s.notifier.Notify(ctx, NotificationEvent{
+		Kind:        NotifyLike,
+		RecipientID: chirp.UserID,
+		ActorID:     userID,
+		ChirpID:     uuid.NullUUID{UUID: chirp.ID, Valid: true},
+	})
+
+	return s.likeState(ctx, chirp)
+}
+
+// Unlike removes the like, if any. Like Like, chirps the user can't see 404.
+func (s *ChirpService) Unlike(ctx context.Context, userID, chirpID uuid.UUID) (LikeState, error) {
+
+	chirp, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, chirpID)
+	if err != nil {
+		return LikeState{}, err
+	}
+
+	err = s.store.DeleteLike(ctx, database.DeleteLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+
+	if err != nil {
+		return LikeState{}, apierror.Internal(fmt.Errorf("DeleteLike: %w", err))
+	}
+
+	return s.likeState(ctx, chirp)
+}
+
+func (s *ChirpService) likeState(ctx context.Context, chirp database.Chirp) (LikeState, error) {
+
+	likes, err := s.store.CountLikes(ctx, chirp.ID)
+	if err != nil {
+		return LikeState{}, apierror.Internal(fmt.Errorf("CountLikes: %w", err))
+	}
+
+	return LikeState{Chirp: chirp, Likes: likes}, nil
+}
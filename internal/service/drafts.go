@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// A user can keep this many drafts at once
+const maxDrafts = 100
+
+// DraftService keeps the chirps users are still writing. Drafts are private to their author and
+// are only length checked; moderation runs when they are posted as chirps.
+type DraftService struct {
+	store     store.Store
+	maxLength int
+}
+
+func NewDraftService(s store.Store, maxLength int) *DraftService {
+	return &DraftService{store: s, maxLength: maxLength}
+}
+
+// Create saves a new draft for userID
+func (s *DraftService) Create(ctx context.Context, userID uuid.UUID, body string) (database.Draft, error) {
+
+	if err := s.validate(body); err != nil {
+		return database.Draft{}, err
+	}
+
+	drafts, err := s.List(ctx, userID)
+	if err != nil {
+		return database.Draft{}, err
+	}
+
+	if len(drafts) >= maxDrafts {
+		return database.Draft{}, apierror.Conflict(fmt.Sprintf("You can keep at most %d drafts, delete some first", maxDrafts))
+	}
+
+	draft, err := s.store.CreateDraft(ctx, database.CreateDraftParams{
+		UserID: userID,
+		Body:   body,
+	})
+
+	if err != nil {
+		return database.Draft{}, apierror.Internal(fmt.Errorf("CreateDraft: %w", err))
+	}
+
+	return draft, nil
+}
+
+// List returns the user's drafts, the last edited first
+func (s *DraftService) List(ctx context.Context, userID uuid.UUID) ([]database.Draft, error) {
+
+	drafts, err := s.store.ListDrafts(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListDrafts: %w", err))
+	}
+
+	return drafts, nil
+}
+
+// Get returns one of the user's drafts, anyone else's 404s
+func (s *DraftService) Get(ctx context.Context, userID, draftID uuid.UUID) (database.Draft, error) {
+
+	draft, err := s.store.GetDraft(ctx, database.GetDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Draft{}, apierror.NotFound("Draft not found")
+	}
+
+	if err != nil {
+		return database.Draft{}, apierror.Internal(fmt.Errorf("GetDraft: %w", err))
+	}
+
+	return draft, nil
+}
+
+// Update replaces the body of one of the user's drafts
+func (s *DraftService) Update(ctx context.Context, userID, draftID uuid.UUID, body string) (database.Draft, error) {
+
+	if err := s.validate(body); err != nil {
+		return database.Draft{}, err
+	}
+
+	draft, err := s.store.UpdateDraft(ctx, database.UpdateDraftParams{
+		ID:     draftID,
+		UserID: userID,
+		Body:   body,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Draft{}, apierror.NotFound("Draft not found")
+	}
+
+	if err != nil {
+		return database.Draft{}, apierror.Internal(fmt.Errorf("UpdateDraft: %w", err))
+	}
+
+	return draft, nil
+}
+
+// Delete removes one of the user's drafts
+func (s *DraftService) Delete(ctx context.Context, userID, draftID uuid.UUID) error {
+
+	n, err := s.store.DeleteDraft(ctx, database.DeleteDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteDraft: %w", err))
+	}
+
+	if n == 0 {
+		return apierror.NotFound("Draft not found")
+	}
+
+	return nil
+}
+
+// Same limits as a chirp, so any draft can be posted as is
+func (s *DraftService) validate(body string) error {
+
+	if strings.TrimSpace(body) == "" {
+		return apierror.Validation(apierror.FieldError{Field: "body", Message: "is required"})
+	}
+
+	if len(body) > s.maxLength {
+		return apierror.Validation(apierror.FieldError{
+			Field:   "body",
+			Message: fmt.Sprintf("must be at most %d characters", s.maxLength),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// List limits
+const (
+	maxLists          = 20
+	maxListMembers    = 500
+	maxListNameLength = 25
+)
+
+// UNIQUE (owner_id, name) on lists
+const listNameConstraint = "lists_owner_id_name_key"
+
+// ListService manages the lists of users curated by their owner. Public lists can be read by
+// anyone, private ones only by their owner; to everyone else they don't exist.
+type ListService struct {
+	store store.Store
+}
+
+func NewListService(s store.Store) *ListService {
+	return &ListService{store: s}
+}
+
+// Create adds a list owned by ownerID
+func (s *ListService) Create(ctx context.Context, ownerID uuid.UUID, name string, public bool) (database.List, error) {
+
+	name, err := validateListName(name)
+	if err != nil {
+		return database.List{}, err
+	}
+
+	lists, err := s.Owned(ctx, ownerID)
+	if err != nil {
+		return database.List{}, err
+	}
+
+	if len(lists) >= maxLists {
+		return database.List{}, apierror.Conflict(fmt.Sprintf("You can have at most %d lists", maxLists))
+	}
+
+	list, err := s.store.CreateList(ctx, database.CreateListParams{
+		OwnerID: ownerID,
+		Name:    name,
+		Public:  public,
+	})
+
+	if database.IsUniqueViolationOf(err, listNameConstraint) {
+		return database.List{}, apierror.Conflict("You already have a list with this name")
+	}
+
+	if err != nil {
+		return database.List{}, apierror.Internal(fmt.Errorf("CreateList: %w", err))
+	}
+
+	return list, nil
+}
+
+// Owned returns every list of ownerID, public or not, the oldest first
+func (s *ListService) Owned(ctx context.Context, ownerID uuid.UUID) ([]database.List, error) {
+
+	lists, err := s.store.ListListsByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListListsByOwner: %w", err))
+	}
+
+	return lists, nil
+}
+
+// Get returns a list viewerID may see: a public one or one of their own
+func (s *ListService) Get(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID) (database.List, error) {
+
+	list, err := s.store.GetList(ctx, listID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.List{}, apierror.NotFound("List not found")
+	}
+
+	if err != nil {
+		return database.List{}, apierror.Internal(fmt.Errorf("GetList: %w", err))
+	}
+
+	if !list.Public && (!viewerID.Valid || viewerID.UUID != list.OwnerID) {
+		return database.List{}, apierror.NotFound("List not found")
+	}
+
+	return list, nil
+}
+
+// Update renames the list and changes its visibility, only its owner may do so
+func (s *ListService) Update(ctx context.Context, userID, listID uuid.UUID, name string, public bool) (database.List, error) {
+
+	if _, err := s.owned(ctx, userID, listID); err != nil {
+		return database.List{}, err
+	}
+
+	name, err := validateListName(name)
+	if err != nil {
+		return database.List{}, err
+	}
+
+	list, err := s.store.UpdateList(ctx, database.UpdateListParams{
+		ID:     listID,
+		Name:   name,
+		Public: public,
+	})
+
+	if database.IsUniqueViolationOf(err, listNameConstraint) {
+		return database.List{}, apierror.Conflict("You already have a list with this name")
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.List{}, apierror.NotFound("List not found")
+	}
+
+	if err != nil {
+		return database.List{}, apierror.Internal(fmt.Errorf("UpdateList: %w", err))
+	}
+
+	return list, nil
+}
+
+// Delete removes the list, its members keep their accounts
+func (s *ListService) Delete(ctx context.Context, userID, listID uuid.UUID) error {
+
+	if _, err := s.owned(ctx, userID, listID); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteList(ctx, listID); err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteList: %w", err))
+	}
+
+	return nil
+}
+
+// Members returns who is on a list viewerID may see, in the order they were added
+func (s *ListService) Members(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID) ([]database.ListMember, error) {
+
+	if _, err := s.Get(ctx, viewerID, listID); err != nil {
+		return nil, err
+	}
+
+	members, err := s.store.ListListMembers(ctx, listID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListListMembers: %w", err))
+	}
+
+	return members, nil
+}
+
+// AddMember puts memberID on one of userID's lists, adding them twice is a no-op and neither can
+// have blocked the other. Members aren't told, the list only gathers chirps they already published.
+func (s *ListService) AddMember(ctx context.Context, userID, listID, memberID uuid.UUID) error {
+
+	if _, err := s.owned(ctx, userID, listID); err != nil {
+		return err
+	}
+
+	_, err := s.store.GetUserByIDNoPassword(ctx, memberID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	// Like a follow, a block either way keeps the two apart
+	for _, params := range []database.IsBlockedParams{
+		{BlockerID: memberID, BlockedID: userID},
+		{BlockerID: userID, BlockedID: memberID},
+	} {
+		blocked, err := s.store.IsBlocked(ctx, params)
+
+		if err != nil {
+			return apierror.Internal(fmt.Errorf("IsBlocked: %w", err))
+		}
+
+		if blocked {
+			return apierror.Forbidden("You can't add this user to a list")
+		}
+	}
+
+	members, err := s.store.ListListMembers(ctx, listID)
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("ListListMembers: %w", err))
+	}
+
+	if len(members) >= maxListMembers {
+		return apierror.Conflict(fmt.Sprintf("A list can have at most %d members", maxListMembers))
+	}
+
+	err = s.store.AddListMember(ctx, database.AddListMemberParams{
+		ListID: listID,
+		UserID: memberID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("AddListMember: %w", err))
+	}
+
+	return nil
+}
+
+// RemoveMember takes memberID off one of userID's lists, if they are on it
+func (s *ListService) RemoveMember(ctx context.Context, userID, listID, memberID uuid.UUID) error {
+
+	if _, err := s.owned(ctx, userID, listID); err != nil {
+		return err
+	}
+
+	err := s.store.RemoveListMember(ctx, database.RemoveListMemberParams{
+		ListID: listID,
+		UserID: memberID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("RemoveListMember: %w", err))
+	}
+
+	return nil
+}
+
+// Timeline returns a page of the chirps of the list's members, filtered for viewerID and paged
+// like ChirpService.List
+func (s *ListService) Timeline(ctx context.Context, viewerID uuid.NullUUID, listID uuid.UUID, filter ChirpFilter) ([]database.Chirp, error) {
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.Get(ctx, viewerID, listID); err != nil {
+		return nil, err
+	}
+
+	chirps, err := s.store.GetListChirps(ctx, database.GetListChirpsParams{
+		ListID:   listID,
+		ViewerID: viewerID,
+		AuthorID: filter.AuthorID,
+		BeforeID: filter.BeforeID,
+		PageSize: int32(filter.Limit),
+	})
+
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("GetListChirps: %w", err))
+	}
+
+	return chirps, nil
+}
+
+// The list if userID owns it. Others get a 404 for private lists and a 403 for public ones.
+func (s *ListService) owned(ctx context.Context, userID, listID uuid.UUID) (database.List, error) {
+
+	list, err := s.Get(ctx, uuid.NullUUID{UUID: userID, Valid: true}, listID)
+	if err != nil {
+		return database.List{}, err
+	}
+
+	if list.OwnerID != userID {
+		return database.List{}, apierror.Forbidden("Only the owner can change this list")
+	}
+
+	return list, nil
+}
+
+func validateListName(name string) (string, error) {
+
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", apierror.Validation(apierror.FieldError{Field: "name", Message: "is required"})
+	}
+
+	if len(name) > maxListNameLength {
+		return "", apierror.Validation(apierror.FieldError{
+			Field:   "name",
+			Message: fmt.Sprintf("must be at most %d characters", maxListNameLength),
+		})
+	}
+
+	return name, nil
+}
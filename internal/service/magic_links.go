@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/mail"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Within a window an address can be sent at most this many links, and a client can ask for at
+// most this many links to any address. Further requests are dropped before they are queued.
+const (
+	maxMagicLinksPerWindow    = 5
+	maxMagicLinkRequestsPerIP = 20
+	magicLinkWindow           = time.Hour
+)
+
+// Requests waiting for SendQueued, further ones are dropped like those over the rate limit
+const magicLinkQueueSize = 100
+
+// MagicLinkConfig controls the login links
+type MagicLinkConfig struct {
+	// The web app page the link opens, the token is added as ?token=
+	URL string
+	TTL time.Duration
+}
+
+// MagicLinkService logs users in with a link sent to their email instead of a password. Links
+// work once, before TTL runs out and until a newer one is sent; only their hash is stored.
+type MagicLinkService struct {
+	store    store.Store
+	mailer   mail.Mailer
+	sessions *AuthService
+	cfg      MagicLinkConfig
+	queue    chan string
+}
+
+// A nil mailer disables magic links
+func NewMagicLinkService(s store.Store, mailer mail.Mailer, sessions *AuthService, cfg MagicLinkConfig) *MagicLinkService {
+	return &MagicLinkService{store: s, mailer: mailer, sessions: sessions, cfg: cfg, queue: make(chan string, magicLinkQueueSize)}
+}
+
+// Send queues a login link for the user with this address, asked for by the client at ip, and
+// returns without looking the address up. Unknown addresses, requests over the rate limits and
+// mailer failures all get the same answer in the same time, so the caller can't tell which emails
+// exist. SendQueued does the work.
+func (s *MagicLinkService) Send(ctx context.Context, email, ip string) error {
+
+	if s.mailer == nil {
+		return apierror.NotFound("Magic-link login is not enabled")
+	}
+
+	if fields := emailErrors(email); len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+
+	limited := false
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		window := int32(magicLinkWindow / time.Second)
+
+		if err := tx.DeleteOldMagicLinkRequests(ctx, window); err != nil {
+			return fmt.Errorf("DeleteOldMagicLinkRequests: %w", err)
+		}
+
+		recent, err := tx.CountRecentMagicLinkRequests(ctx, database.CountRecentMagicLinkRequestsParams{
+			Email:         email,
+			Ip:            ip,
+			WindowSeconds: window,
+		})
+		if err != nil {
+			return fmt.Errorf("CountRecentMagicLinkRequests: %w", err)
+		}
+
+		if recent.ByEmail >= maxMagicLinksPerWindow || recent.ByIp >= maxMagicLinkRequestsPerIP {
+			limited = true
+			return nil
+		}
+
+		err = tx.CreateMagicLinkRequest(ctx, database.CreateMagicLinkRequestParams{
+			Email: email,
+			Ip:    ip,
+		})
+		if err != nil {
+			return fmt.Errorf("CreateMagicLinkRequest: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	if limited {
+		log.Printf("Magic link not sent, over %d requests for the address or %d from %s within %v\n", maxMagicLinksPerWindow, maxMagicLinkRequestsPerIP, ip, magicLinkWindow)
+		return nil
+	}
+
+	select {
+	case s.queue <- email:
+	default:
+		log.Printf("Magic link not sent, %d requests are already waiting\n", magicLinkQueueSize)
+	}
+
+	return nil
+}
+
+// SendQueued sends the links queued by Send, one at a time, until ctx is cancelled. Failures are
+// only logged, the request that queued the link was answered long ago.
+func (s *MagicLinkService) SendQueued(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case email := <-s.queue:
+			if err := s.send(ctx, email); err != nil && ctx.Err() == nil {
+				log.Printf("Sending magic link failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *MagicLinkService) send(ctx context.Context, email string) error {
+
+	user, err := s.store.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %w", err)
+	}
+
+	token, err := auth.MakeOAuthSecret()
+	if err != nil {
+		return fmt.Errorf("MakeOAuthSecret: %w", err)
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+
+		if err := tx.DeleteDeadMagicLinks(ctx); err != nil {
+			return fmt.Errorf("DeleteDeadMagicLinks: %w", err)
+		}
+
+		if err := tx.InvalidateMagicLinks(ctx, user.ID); err != nil {
+			return fmt.Errorf("InvalidateMagicLinks: %w", err)
+		}
+
+		err = tx.CreateMagicLink(ctx, database.CreateMagicLinkParams{
+			TokenHash: auth.HashAPIKey(token),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().UTC().Add(s.cfg.TTL),
+		})
+		if err != nil {
+			return fmt.Errorf("CreateMagicLink: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("magic link URL: %w", err)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Hi @%s,\n\nUse this link to log in to Chirpy:\n\n%s\n\nIt works once and expires in %v. "+
+			"If you didn't ask for it, you can ignore this email.\n", user.Handle, link, s.cfg.TTL),
+	})
+
+	if err != nil {
+		return fmt.Errorf("sending to %v: %w", user.ID, err)
+	}
+
+	return nil
+}
+
+// Verify exchanges the token of a link for a session, the same one a password login starts
+func (s *MagicLinkService) Verify(ctx context.Context, token string) (Session, error) {
+
+	if s.mailer == nil {
+		return Session{}, apierror.NotFound("Magic-link login is not enabled")
+	}
+
+	if token == "" {
+		return Session{}, apierror.Validation(apierror.FieldError{Field: "token", Message: "is required"})
+	}
+
+	invalidLink := apierror.Unauthorized(apierror.CodeInvalidToken, "Login link is invalid, expired or already used")
+
+	link, err := s.store.ConsumeMagicLink(ctx, auth.HashAPIKey(token))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, invalidLink
+	}
+
+	if err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("ConsumeMagicLink: %w", err))
+	}
+
+	// The link went to the user's email, opening it proves they own it
+	if err := s.store.VerifyUserEmail(ctx, link.UserID); err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("VerifyUserEmail: %w", err))
+	}
+
+	user, err := s.store.GetUserByID(ctx, link.UserID)
+	if err != nil {
+		return Session{}, apierror.Internal(fmt.Errorf("GetUserByID: %w", err))
+	}
+
+	return s.sessions.StartSession(ctx, user)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/imaging"
+	"github.com/itsmandrew/server-go/internal/storage"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// ImageKind is which of the profile images an upload replaces
+type ImageKind string
+
+const (
+	ImageAvatar ImageKind = "avatar"
+	ImageBanner ImageKind = "banner"
+)
+
+var imageSpecs = map[ImageKind]imaging.Spec{
+	ImageAvatar: imaging.Avatar,
+	ImageBanner: imaging.Banner,
+}
+
+// MediaService turns profile image uploads into resized variants. Every upload gets a fresh
+// key, "avatars/<userID>/<uploadID>", with one file per variant under it, so the files never
+// change once written and can be cached forever.
+type MediaService struct {
+	store   store.UserStore
+	storage storage.Storage
+}
+
+func NewMediaService(s store.UserStore, st storage.Storage) *MediaService {
+	return &MediaService{store: s, storage: st}
+}
+
+// SetImage validates the upload, stores its variants and points the user at them. The previous
+// image is deleted afterwards.
+func (s *MediaService) SetImage(ctx context.Context, userID uuid.UUID, kind ImageKind, data []byte) (database.GetUserByIDNoPasswordRow, error) {
+
+	spec, ok := imageSpecs[kind]
+	if !ok {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("unknown image kind %q", kind))
+	}
+
+	img, err := imaging.Decode(data, spec)
+
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Validation(apierror.FieldError{
+			Field:   "image",
+			Message: strings.TrimPrefix(err.Error(), imaging.ErrInvalidImage.Error()+": "),
+		})
+	}
+
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("decoding %s: %w", kind, err))
+	}
+
+	user, err := s.store.GetUserByIDNoPassword(ctx, userID)
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	variants, err := imaging.Render(img, spec)
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("rendering %s: %w", kind, err))
+	}
+
+	key := fmt.Sprintf("%ss/%s/%s", kind, userID, uuid.New())
+
+	for _, v := range variants {
+		if err := s.storage.Put(ctx, variantKey(key, v.Name), bytes.NewReader(v.Data), imaging.ContentType); err != nil {
+			s.deleteVariants(ctx, key, spec)
+			return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("storing %s: %w", kind, err))
+		}
+	}
+
+	var previous string
+	switch kind {
+	case ImageAvatar:
+		previous, user.AvatarKey = user.AvatarKey, key
+		err = s.store.UpdateUserAvatar(ctx, database.UpdateUserAvatarParams{ID: userID, AvatarKey: key})
+	case ImageBanner:
+		previous, user.BannerKey = user.BannerKey, key
+		err = s.store.UpdateUserBanner(ctx, database.UpdateUserBannerParams{ID: userID, BannerKey: key})
+	}
+
+	if err != nil {
+		s.deleteVariants(ctx, key, spec)
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("saving %s key: %w", kind, err))
+	}
+
+	if previous != "" {
+		s.deleteVariants(ctx, previous, spec)
+	}
+
+	return user, nil
+}
+
+// URLs maps variant names to where they are served, nil when no image was uploaded
+func (s *MediaService) URLs(kind ImageKind, key string) map[string]string {
+
+	if key == "" {
+		return nil
+	}
+
+	urls := map[string]string{}
+	for _, v := range imageSpecs[kind].Variants {
+		urls[v.Name] = s.storage.URL(variantKey(key, v.Name))
+	}
+	return urls
+}
+
+// DeleteImage removes every variant stored under key, used once the user row is already gone
+func (s *MediaService) DeleteImage(ctx context.Context, kind ImageKind, key string) {
+	if key == "" {
+		return
+	}
+	s.deleteVariants(ctx, key, imageSpecs[kind])
+}
+
+// Best effort, a leftover file only costs disk space
+func (s *MediaService) deleteVariants(ctx context.Context, key string, spec imaging.Spec) {
+	for _, v := range spec.Variants {
+		if err := s.storage.Delete(ctx, variantKey(key, v.Name)); err != nil {
+			log.Printf("Deleting %s: %v", variantKey(key, v.Name), err)
+		}
+	}
+}
+
+func variantKey(key, variant string) string {
+	return key + "/" + variant + imaging.Extension
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Source label for rules kept in the moderation_rules table
+const dbRuleSource = "database"
+
+// ContentModerator runs text through the moderation pipeline
+type ContentModerator interface {
+	Check(text string) moderation.Verdict
+}
+
+// ModerationRuleSource feeds the moderation_rules table to a moderation.Moderator
+type ModerationRuleSource struct {
+	store store.ModerationStore
+}
+
+func NewModerationRuleSource(s store.ModerationStore) *ModerationRuleSource {
+	return &ModerationRuleSource{store: s}
+}
+
+func (src *ModerationRuleSource) LoadRules(ctx context.Context) ([]moderation.Rule, error) {
+	rows, err := src.store.ListModerationRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]moderation.Rule, 0, len(rows))
+	for _, row := range rows {
+		rules = append(rules, ruleFromDB(row))
+	}
+	return rules, nil
+}
+
+func ruleFromDB(row database.ModerationRule) moderation.Rule {
+	return moderation.Rule{
+		ID:      row.ID,
+		Kind:    moderation.Kind(row.Kind),
+		Pattern: row.Pattern,
+		Action:  moderation.Action(row.Action),
+		Source:  dbRuleSource,
+	}
+}
+
+// ModerationService lets admins manage the rules at runtime and review flagged chirps
+type ModerationService struct {
+	store     store.ModerationStore
+	moderator *moderation.Moderator
+}
+
+func NewModerationService(s store.ModerationStore, moderator *moderation.Moderator) *ModerationService {
+	return &ModerationService{store: s, moderator: moderator}
+}
+
+// ListRules returns the rules currently in effect, from the config and the database
+func (s *ModerationService) ListRules(ctx context.Context) []moderation.Rule {
+	return s.moderator.Rules()
+}
+
+// CreateRule stores a new rule and reloads the pipeline so it applies right away
+func (s *ModerationService) CreateRule(ctx context.Context, rule moderation.Rule) (moderation.Rule, error) {
+
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+
+	if err := rule.Validate(); err != nil {
+		return moderation.Rule{}, apierror.Validation(apierror.FieldError{Field: "rule", Message: err.Error()})
+	}
+
+	row, err := s.store.CreateModerationRule(ctx, database.CreateModerationRuleParams{
+		Kind:    string(rule.Kind),
+		Pattern: rule.Pattern,
+		Action:  string(rule.Action),
+	})
+
+	if database.IsUniqueViolation(err) {
+		return moderation.Rule{}, apierror.Conflict("A rule with this kind and pattern already exists")
+	}
+
+	if err != nil {
+		return moderation.Rule{}, apierror.Internal(fmt.Errorf("CreateModerationRule: %w", err))
+	}
+
+	if err := s.moderator.Reload(ctx); err != nil {
+		return moderation.Rule{}, apierror.Internal(err)
+	}
+
+	return ruleFromDB(row), nil
+}
+
+// DeleteRule removes a database rule, rules from the config can't be deleted at runtime
+func (s *ModerationService) DeleteRule(ctx context.Context, ruleID uuid.UUID) error {
+
+	deleted, err := s.store.DeleteModerationRule(ctx, ruleID)
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteModerationRule: %w", err))
+	}
+
+	if deleted == 0 {
+		return apierror.NotFound("Moderation rule not found")
+	}
+
+	if err := s.moderator.Reload(ctx); err != nil {
+		return apierror.Internal(err)
+	}
+
+	return nil
+}
+
+// ListFlags returns the chirps the pipeline flagged for review
+func (s *ModerationService) ListFlags(ctx context.Context) ([]database.ListModerationFlagsRow, error) {
+	flags, err := s.store.ListModerationFlags(ctx)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListModerationFlags: %w", err))
+	}
+	return flags, nil
+}
+
+// Describes which rules fired, stored as the reason on moderation_flags
+func flagReason(verdict moderation.Verdict) string {
+	var reasons []string
+	for _, m := range verdict.Matches {
+		if m.Rule.Action == moderation.ActionFlag {
+			reasons = append(reasons, m.Rule.String())
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
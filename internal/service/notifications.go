@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Notification kinds, also the keys of the preferences
+const (
+	NotifyMention = "mention"
+	NotifyReply   = "reply"
+	NotifyLike    = "like"
+	NotifyFollow  = "follow"
+)
+
+var NotificationKinds = []string{NotifyMention, NotifyReply, NotifyLike, NotifyFollow}
+
+// Page sizes of GET /api/notifications, and how many actors each group lists by name
+const (
+	DefaultNotificationPageSize = 20
+	MaxNotificationPageSize     = 100
+	notificationActorsShown     = 3
+)
+
+// NotificationEvent is one interaction worth telling RecipientID about. ChirpID is the liked
+// chirp, or the chirp that mentions or replies, and is unset for follows.
+type NotificationEvent struct {
+	Kind        string
+	RecipientID uuid.UUID
+	ActorID     uuid.UUID
+	ChirpID     uuid.NullUUID
+}
+
+// Notifier is told about interactions by the chirp and relationship services
+type Notifier interface {
+	Notify(ctx context.Context, e NotificationEvent)
+}
+
+// NotificationChannel delivers notifications somewhere. Users can turn every kind on or off per
+// channel, so email or push only need a new channel, the callers stay the same.
+type NotificationChannel interface {
+	// Name is the key used in the preferences, e.g. "in_app"
+	Name() string
+	Deliver(ctx context.Context, e NotificationEvent) error
+}
+
+// InAppChannel writes to the notifications table read by GET /api/notifications
+type InAppChannel struct {
+	store store.NotificationStore
+}
+
+func NewInAppChannel(s store.NotificationStore) *InAppChannel {
+	return &InAppChannel{store: s}
+}
+
+func (c *InAppChannel) Name() string {
+	return "in_app"
+}
+
+// Deliver adds the actor to the unread group of the event, e.g. every like on the same chirp
+func (c *InAppChannel) Deliver(ctx context.Context, e NotificationEvent) error {
+
+	n, err := c.store.UpsertNotification(ctx, database.UpsertNotificationParams{
+		UserID:   e.RecipientID,
+		Kind:     e.Kind,
+		ChirpID:  e.ChirpID,
+		GroupKey: groupKey(e),
+	})
+
+	if err != nil {
+		return fmt.Errorf("UpsertNotification: %w", err)
+	}
+
+	err = c.store.AddNotificationActor(ctx, database.AddNotificationActorParams{
+		NotificationID: n.ID,
+		ActorID:        e.ActorID,
+	})
+
+	if err != nil {
+		return fmt.Errorf("AddNotificationActor: %w", err)
+	}
+	return nil
+}
+
+// Likes group per chirp and follows all together. A mention or reply is its own chirp, so its
+// group only ever holds one actor.
+func groupKey(e NotificationEvent) string {
+	if e.Kind == NotifyFollow {
+		return e.Kind
+	}
+	return e.Kind + ":" + e.ChirpID.UUID.String()
+}
+
+// NotificationService sends interactions to the delivery channels and serves the in-app inbox
+type NotificationService struct {
+	store    store.Store
+	channels []NotificationChannel
+}
+
+func NewNotificationService(s store.Store, channels ...NotificationChannel) *NotificationService {
+	return &NotificationService{store: s, channels: channels}
+}
+
+var _ Notifier = (*NotificationService)(nil)
+
+// Notify delivers e on every channel the recipient didn't turn off. Nobody is notified about
+// their own actions, nor about users they blocked or muted or who blocked them. Failures are
+// logged, the interaction itself already succeeded.
+func (s *NotificationService) Notify(ctx context.Context, e NotificationEvent) {
+
+	if e.RecipientID == e.ActorID {
+		return
+	}
+
+	if err := s.notify(ctx, e); err != nil {
+		log.Printf("Notifying %v of %s: %v", e.RecipientID, e.Kind, err)
+	}
+}
+
+func (s *NotificationService) notify(ctx context.Context, e NotificationEvent) error {
+
+	hidden, err := s.store.IsInteractionHidden(ctx, database.IsInteractionHiddenParams{
+		RecipientID: e.RecipientID,
+		ActorID:     e.ActorID,
+	})
+
+	if err != nil {
+		return fmt.Errorf("IsInteractionHidden: %w", err)
+	}
+
+	if hidden {
+		return nil
+	}
+
+	prefs, err := s.Preferences(ctx, e.RecipientID)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range s.channels {
+		if !prefs[e.Kind][ch.Name()] {
+			continue
+		}
+
+		if err := ch.Deliver(ctx, e); err != nil {
+			return fmt.Errorf("%s: %w", ch.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// NotificationGroup is one entry of the inbox, ActorIDs holds the most recent actors
+type NotificationGroup struct {
+	database.ListNotificationsRow
+	ActorIDs []uuid.UUID
+}
+
+type NotificationPage struct {
+	Notifications []NotificationGroup
+	Unread        int64
+	// Empty on the last page
+	NextCursor string
+}
+
+// List returns a page of the user's notifications, most recent activity first. cursor is the
+// NextCursor of the previous page, empty for the first one.
+func (s *NotificationService) List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (NotificationPage, error) {
+
+	if limit < 1 || limit > MaxNotificationPageSize {
+		return NotificationPage{}, apierror.Validation(apierror.FieldError{
+			Field:   "limit",
+			Message: fmt.Sprintf("must be between 1 and %d", MaxNotificationPageSize),
+		})
+	}
+
+	params := database.ListNotificationsParams{
+		UserID: userID,
+		// One extra row tells whether there is a next page
+		PageSize: int32(limit + 1),
+	}
+
+	if cursor != "" {
+		updatedAt, id, err := decodeNotificationCursor(cursor)
+		if err != nil {
+			return NotificationPage{}, apierror.Validation(apierror.FieldError{Field: "cursor", Message: "is invalid"})
+		}
+		params.BeforeUpdatedAt = sql.NullTime{Time: updatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	rows, err := s.store.ListNotifications(ctx, params)
+	if err != nil {
+		return NotificationPage{}, apierror.Internal(fmt.Errorf("ListNotifications: %w", err))
+	}
+
+	var page NotificationPage
+
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		page.NextCursor = encodeNotificationCursor(last.UpdatedAt, last.ID)
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	actors := map[uuid.UUID][]uuid.UUID{}
+	if len(ids) > 0 {
+		list, err := s.store.ListNotificationActors(ctx, ids)
+		if err != nil {
+			return NotificationPage{}, apierror.Internal(fmt.Errorf("ListNotificationActors: %w", err))
+		}
+
+		// Already most recent first
+		for _, a := range list {
+			if len(actors[a.NotificationID]) < notificationActorsShown {
+				actors[a.NotificationID] = append(actors[a.NotificationID], a.ActorID)
+			}
+		}
+	}
+
+	page.Notifications = make([]NotificationGroup, 0, len(rows))
+	for _, row := range rows {
+		page.Notifications = append(page.Notifications, NotificationGroup{ListNotificationsRow: row, ActorIDs: actors[row.ID]})
+	}
+
+	page.Unread, err = s.store.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return NotificationPage{}, apierror.Internal(fmt.Errorf("CountUnreadNotifications: %w", err))
+	}
+
+	return page, nil
+}
+
+// MarkRead marks the given notifications as read, or all of them when ids is empty. It returns
+// how many were marked and how many are still unread.
+func (s *NotificationService) MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, int64, error) {
+
+	params := database.MarkNotificationsReadParams{UserID: userID}
+	if len(ids) > 0 {
+		params.Ids = ids
+	}
+
+	marked, err := s.store.MarkNotificationsRead(ctx, params)
+	if err != nil {
+		return 0, 0, apierror.Internal(fmt.Errorf("MarkNotificationsRead: %w", err))
+	}
+
+	unread, err := s.store.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return 0, 0, apierror.Internal(fmt.Errorf("CountUnreadNotifications: %w", err))
+	}
+
+	return marked, unread, nil
+}
+
+// NotificationPreferences maps kind -> channel -> enabled
+type NotificationPreferences map[string]map[string]bool
+
+// Preferences lists every kind and channel, anything the user never changed is enabled
+func (s *NotificationService) Preferences(ctx context.Context, userID uuid.UUID) (NotificationPreferences, error) {
+
+	stored, err := s.store.ListNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListNotificationPreferences: %w", err))
+	}
+
+	prefs := NotificationPreferences{}
+	for _, kind := range NotificationKinds {
+		prefs[kind] = map[string]bool{}
+		for _, ch := range s.channels {
+			prefs[kind][ch.Name()] = true
+		}
+	}
+
+	for _, p := range stored {
+		// Rows for a channel that was removed since are ignored
+		if _, ok := prefs[p.Kind][p.Channel]; ok {
+			prefs[p.Kind][p.Channel] = p.Enabled
+		}
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences applies the kinds and channels present in update, the others keep their value
+func (s *NotificationService) SetPreferences(ctx context.Context, userID uuid.UUID, update NotificationPreferences) (NotificationPreferences, error) {
+
+	var fields []apierror.FieldError
+	for kind, channels := range update {
+		if !slices.Contains(NotificationKinds, kind) {
+			fields = append(fields, apierror.FieldError{
+				Field:   kind,
+				Message: fmt.Sprintf("must be one of %s", strings.Join(NotificationKinds, ", ")),
+			})
+			continue
+		}
+
+		for channel := range channels {
+			if !slices.ContainsFunc(s.channels, func(ch NotificationChannel) bool { return ch.Name() == channel }) {
+				fields = append(fields, apierror.FieldError{Field: kind + "." + channel, Message: "is not a notification channel"})
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		// Map order is random, keep the response stable
+		slices.SortFunc(fields, func(a, b apierror.FieldError) int { return strings.Compare(a.Field, b.Field) })
+		return nil, apierror.Validation(fields...)
+	}
+
+	for kind, channels := range update {
+		for channel, enabled := range channels {
+			err := s.store.SetNotificationPreference(ctx, database.SetNotificationPreferenceParams{
+				UserID:  userID,
+				Kind:    kind,
+				Channel: channel,
+				Enabled: enabled,
+			})
+
+			if err != nil {
+				return nil, apierror.Internal(fmt.Errorf("SetNotificationPreference: %w", err))
+			}
+		}
+	}
+
+	return s.Preferences(ctx, userID)
+}
+
+// Cursors are opaque to clients: the (updated_at, id) of the last notification on the page
+func encodeNotificationCursor(updatedAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(updatedAt.Format(time.RFC3339Nano) + "|" + id.String()))
+}
+
+func decodeNotificationCursor(cursor string) (time.Time, uuid.UUID, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, fmt.Errorf("malformed cursor")
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	return updatedAt, parsed, nil
+}
@@ -0,0 +1,695 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+const (
+	maxOAuthClientNameLength = 50
+	maxRedirectURIs          = 10
+
+	// How long the app has to exchange an authorization code, RFC 6749 recommends at most 10 minutes
+	oauthCodeTTL = 10 * time.Minute
+)
+
+// Grant types accepted by the token endpoint
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuthError is an error of the token, revocation and introspection endpoints, which answer in the
+// RFC 6749 format ({"error": ..., "error_description": ...}) rather than our own envelope
+type OAuthError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func oauthError(code, description string) *OAuthError {
+	status := http.StatusBadRequest
+	if code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+// OAuthService is the authorization server third-party apps use to act for a user: client
+// registration, the authorization code flow with PKCE and the token, revocation (RFC 7009) and
+// introspection (RFC 7662) endpoints. The access tokens are JWTs limited to the granted scopes,
+// the refresh tokens live in refresh_tokens tagged with the client.
+type OAuthService struct {
+	store           store.Store
+	jwtSecret       string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+// Shares its config with AuthService, app tokens live as long as the ones handed out at login
+func NewOAuthService(s store.Store, cfg AuthConfig) *OAuthService {
+	return &OAuthService{
+		store:           s,
+		jwtSecret:       cfg.JWTSecret,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+	}
+}
+
+// OAuthClientInput registers an app. Public clients (mobile and single page apps) can't keep a
+// secret, they get none and rely on PKCE alone.
+type OAuthClientInput struct {
+	Name         string
+	RedirectURIs []string
+	Public       bool
+}
+
+// RegisteredOAuthClient is a new client along with its secret, which is not stored and can't be
+// shown again. Secret is empty for public clients.
+type RegisteredOAuthClient struct {
+	database.OauthClient
+	Secret string
+}
+
+func (s *OAuthService) RegisterClient(ctx context.Context, ownerID uuid.UUID, in OAuthClientInput) (RegisteredOAuthClient, error) {
+
+	name := strings.TrimSpace(in.Name)
+	var fields []apierror.FieldError
+
+	switch {
+	case name == "":
+		fields = append(fields, apierror.FieldError{Field: "name", Message: "is required"})
+	case len(name) > maxOAuthClientNameLength:
+		fields = append(fields, apierror.FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxOAuthClientNameLength)})
+	}
+
+	redirectURIs := []string{}
+	for _, raw := range in.RedirectURIs {
+		if err := validateRedirectURI(raw); err != nil {
+			fields = append(fields, apierror.FieldError{Field: "redirect_uris", Message: fmt.Sprintf("%q %v", raw, err)})
+			continue
+		}
+		if !slices.Contains(redirectURIs, raw) {
+			redirectURIs = append(redirectURIs, raw)
+		}
+	}
+
+	switch {
+	case len(in.RedirectURIs) == 0:
+		fields = append(fields, apierror.FieldError{Field: "redirect_uris", Message: "must list at least one URI"})
+	case len(redirectURIs) > maxRedirectURIs:
+		fields = append(fields, apierror.FieldError{Field: "redirect_uris", Message: fmt.Sprintf("must list at most %d URIs", maxRedirectURIs)})
+	}
+
+	if len(fields) > 0 {
+		return RegisteredOAuthClient{}, apierror.Validation(fields...)
+	}
+
+	var (
+		secret     string
+		secretHash sql.NullString
+	)
+
+	if !in.Public {
+		var err error
+		if secret, err = auth.MakeOAuthSecret(); err != nil {
+			return RegisteredOAuthClient{}, apierror.Internal(fmt.Errorf("MakeOAuthSecret: %w", err))
+		}
+		secretHash = sql.NullString{String: auth.HashAPIKey(secret), Valid: true}
+	}
+
+	client, err := s.store.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		OwnerID:      ownerID,
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: redirectURIs,
+	})
+
+	if err != nil {
+		return RegisteredOAuthClient{}, apierror.Internal(fmt.Errorf("CreateOAuthClient: %w", err))
+	}
+
+	return RegisteredOAuthClient{OauthClient: client, Secret: secret}, nil
+}
+
+// Redirect URIs are compared exactly, so they must be absolute and without a fragment. Plain http
+// is only allowed for loopback addresses, used by native apps (RFC 8252).
+func validateRedirectURI(raw string) error {
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return errors.New("must not have a fragment")
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+
+	return errors.New("must use https, or http on a loopback address")
+}
+
+// ListClients returns the apps the user registered, newest first
+func (s *OAuthService) ListClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error) {
+	clients, err := s.store.ListOAuthClients(ctx, ownerID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListOAuthClients: %w", err))
+	}
+	return clients, nil
+}
+
+// DeleteClient removes an app along with its pending codes and refresh tokens. Access tokens
+// already issued run until they expire.
+func (s *OAuthService) DeleteClient(ctx context.Context, ownerID, clientID uuid.UUID) error {
+
+	deleted, err := s.store.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{ID: clientID, OwnerID: ownerID})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteOAuthClient: %w", err))
+	}
+
+	// Someone else's client is not found either
+	if deleted == 0 {
+		return apierror.NotFound("OAuth client not found")
+	}
+
+	return nil
+}
+
+// AuthorizeRequest holds the query parameters of an authorization request (RFC 6749 4.1.1, RFC
+// 7636 4.3)
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// Consent is what the user is asked to approve
+type Consent struct {
+	Client      database.OauthClient
+	RedirectURI string
+	Scopes      []auth.Scope
+	State       string
+}
+
+// Authorize checks an authorization request and returns what the consent screen shows. The
+// errors are ours rather than redirects to the app, a request we can't verify must never send
+// the user to its redirect_uri.
+func (s *OAuthService) Authorize(ctx context.Context, req AuthorizeRequest) (Consent, error) {
+
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return Consent{}, apierror.Validation(apierror.FieldError{Field: "client_id", Message: "is not a registered client"})
+	}
+
+	client, err := s.store.GetOAuthClient(ctx, clientID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Consent{}, apierror.Validation(apierror.FieldError{Field: "client_id", Message: "is not a registered client"})
+	}
+
+	if err != nil {
+		return Consent{}, apierror.Internal(fmt.Errorf("GetOAuthClient: %w", err))
+	}
+
+	// May be left out when the client registered a single one (RFC 6749 3.1.2.3)
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return Consent{}, apierror.Validation(apierror.FieldError{Field: "redirect_uri", Message: "is not registered for this client"})
+	}
+
+	var fields []apierror.FieldError
+
+	if req.ResponseType != "code" {
+		fields = append(fields, apierror.FieldError{Field: "response_type", Message: `must be "code"`})
+	}
+
+	scopes, err := auth.ParseScopes(req.Scope)
+	if err != nil {
+		fields = append(fields, apierror.FieldError{Field: "scope", Message: fmt.Sprintf("must list scopes among %s", joinScopes(auth.Scopes))})
+	}
+
+	// PKCE is required of every client, confidential ones included (OAuth 2.1)
+	if req.CodeChallengeMethod != "S256" {
+		fields = append(fields, apierror.FieldError{Field: "code_challenge_method", Message: `must be "S256"`})
+	}
+
+	if len(req.CodeChallenge) != 43 {
+		fields = append(fields, apierror.FieldError{Field: "code_challenge", Message: "must be the base64url SHA-256 of the code_verifier"})
+	}
+
+	if len(fields) > 0 {
+		return Consent{}, apierror.Validation(fields...)
+	}
+
+	return Consent{Client: client, RedirectURI: redirectURI, Scopes: scopes, State: req.State}, nil
+}
+
+// Approve records the user's answer to the consent screen and returns where to send them back:
+// the redirect_uri with a single use code, or with error=access_denied when they declined
+func (s *OAuthService) Approve(ctx context.Context, userID uuid.UUID, req AuthorizeRequest, approved bool) (string, error) {
+
+	consent, err := s.Authorize(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+
+	if approved {
+		code, err := auth.MakeOAuthSecret()
+		if err != nil {
+			return "", apierror.Internal(fmt.Errorf("MakeOAuthSecret: %w", err))
+		}
+
+		err = s.store.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashAPIKey(code),
+			ClientID:      consent.Client.ID,
+			UserID:        userID,
+			RedirectUri:   consent.RedirectURI,
+			Scopes:        scopeStrings(consent.Scopes),
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().UTC().Add(oauthCodeTTL),
+		})
+
+		if err != nil {
+			return "", apierror.Internal(fmt.Errorf("CreateOAuthAuthorizationCode: %w", err))
+		}
+
+		params.Set("code", code)
+	} else {
+		params.Set("error", "access_denied")
+	}
+
+	if consent.State != "" {
+		params.Set("state", consent.State)
+	}
+
+	// The registered URI may carry a query of its own, which is kept
+	u, err := url.Parse(consent.RedirectURI)
+	if err != nil {
+		return "", apierror.Internal(fmt.Errorf("parsing redirect_uri: %w", err))
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// ClientCredentials authenticate an app at the token endpoints, from HTTP Basic or the form.
+// Public clients only send their id.
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// TokenRequest is the form posted to the token endpoint (RFC 6749 4.1.3 and 6)
+type TokenRequest struct {
+	ClientCredentials
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+// OAuthToken is the token endpoint's answer
+type OAuthToken struct {
+	AccessToken  string
+	ExpiresIn    time.Duration
+	RefreshToken string
+	Scopes       []auth.Scope
+}
+
+// Token exchanges an authorization code or a refresh token for a new access and refresh token.
+// Refresh tokens are rotated, the one presented stops working.
+func (s *OAuthService) Token(ctx context.Context, req TokenRequest) (OAuthToken, error) {
+
+	client, err := s.authenticateClient(ctx, req.ClientCredentials)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantRefreshToken:
+		return s.refresh(ctx, client, req)
+	case "":
+		return OAuthToken{}, oauthError("invalid_request", "grant_type is required")
+	}
+
+	return OAuthToken{}, oauthError("unsupported_grant_type", fmt.Sprintf("grant_type must be %q or %q", GrantAuthorizationCode, GrantRefreshToken))
+}
+
+func (s *OAuthService) exchangeCode(ctx context.Context, client database.OauthClient, req TokenRequest) (OAuthToken, error) {
+
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		return OAuthToken{}, oauthError("invalid_request", "code, redirect_uri and code_verifier are required")
+	}
+
+	invalidGrant := oauthError("invalid_grant", "Authorization code is invalid, expired or was already used")
+
+	// Consumed whatever happens next, a code that failed once can't be retried. Only the client it
+	// was issued to can consume it, so another client can't burn it.
+	code, err := s.store.ConsumeOAuthAuthorizationCode(ctx, database.ConsumeOAuthAuthorizationCodeParams{
+		CodeHash: auth.HashAPIKey(req.Code),
+		ClientID: client.ID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthToken{}, invalidGrant
+	}
+
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(fmt.Errorf("ConsumeOAuthAuthorizationCode: %w", err))
+	}
+
+	if !time.Now().UTC().Before(code.ExpiresAt) {
+		return OAuthToken{}, invalidGrant
+	}
+
+	if code.RedirectUri != req.RedirectURI {
+		return OAuthToken{}, oauthError("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+
+	if !auth.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return OAuthToken{}, oauthError("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	scopes, err := parseStoredScopes(code.Scopes)
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(err)
+	}
+
+	var token OAuthToken
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		token, err = s.issue(ctx, tx, client, code.UserID, scopes, scopes)
+		return err
+	})
+
+	return token, err
+}
+
+func (s *OAuthService) refresh(ctx context.Context, client database.OauthClient, req TokenRequest) (OAuthToken, error) {
+
+	if req.RefreshToken == "" {
+		return OAuthToken{}, oauthError("invalid_request", "refresh_token is required")
+	}
+
+	invalidGrant := oauthError("invalid_grant", "Refresh token is invalid, expired or revoked")
+
+	current, err := s.store.GetUserFromRefreshToken(ctx, req.RefreshToken)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthToken{}, invalidGrant
+	}
+
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(fmt.Errorf("GetUserFromRefreshToken: %w", err))
+	}
+
+	// Session tokens and other apps' tokens are left alone, they are not this client's to rotate
+	if !current.ClientID.Valid || current.ClientID.UUID != client.ID {
+		return OAuthToken{}, invalidGrant
+	}
+
+	granted, err := parseStoredScopes(current.Scopes)
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(err)
+	}
+
+	// The app may ask for fewer scopes than it was granted, never more (RFC 6749 6)
+	scopes := granted
+	if req.Scope != "" {
+		scopes, err = auth.ParseScopes(req.Scope)
+		if err != nil || slices.ContainsFunc(scopes, func(scope auth.Scope) bool { return !slices.Contains(granted, scope) }) {
+			return OAuthToken{}, oauthError("invalid_scope", "scope must be among the scopes granted by the user")
+		}
+	}
+
+	var token OAuthToken
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+
+		// Revokes the token only if it is still live, two refreshes racing each other don't
+		// both get a new one
+		if _, err := tx.ClaimRefreshToken(ctx, req.RefreshToken); errors.Is(err, sql.ErrNoRows) {
+			return invalidGrant
+		} else if err != nil {
+			return apierror.Internal(fmt.Errorf("ClaimRefreshToken: %w", err))
+		}
+
+		// The new refresh token keeps the whole grant, only the access token is narrowed
+		token, err = s.issue(ctx, tx, client, current.UserID, granted, scopes)
+		return err
+	})
+
+	return token, err
+}
+
+// Issues an access token limited to scopes and a refresh token carrying the whole grant
+func (s *OAuthService) issue(ctx context.Context, tx store.Store, client database.OauthClient, userID uuid.UUID, granted, scopes []auth.Scope) (OAuthToken, error) {
+
+	// The role is read again, and suspended or departing users can't hand out new tokens
+	user, err := tx.GetUserByID(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (user.SuspendedAt.Valid || user.DeletionScheduledAt.Valid)) {
+		return OAuthToken{}, oauthError("invalid_grant", "The user who granted access is no longer active")
+	}
+
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(fmt.Errorf("GetUserByID: %w", err))
+	}
+
+	accessToken, err := auth.MakeClientJWT(user.ID, auth.Role(user.Role), client.ID, scopes, s.jwtSecret, s.accessTokenTTL)
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(fmt.Errorf("MakeClientJWT: %w", err))
+	}
+
+	refreshToken, _ := auth.MakeRefreshToken()
+
+	_, err = tx.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.refreshTokenTTL),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    scopeStrings(granted),
+	})
+
+	if err != nil {
+		return OAuthToken{}, apierror.Internal(fmt.Errorf("CreateRefreshToken: %w", err))
+	}
+
+	return OAuthToken{
+		AccessToken:  accessToken,
+		ExpiresIn:    s.accessTokenTTL,
+		RefreshToken: refreshToken,
+		Scopes:       scopes,
+	}, nil
+}
+
+// Revoke implements RFC 7009 for the client's refresh tokens. Unknown tokens and other clients'
+// tokens are ignored, the app can't tell them apart from a successful revocation. Access tokens
+// are JWTs that can't be revoked one by one, they are short lived instead.
+func (s *OAuthService) Revoke(ctx context.Context, creds ClientCredentials, token string) error {
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		return oauthError("invalid_request", "token is required")
+	}
+
+	current, err := s.store.GetUserFromRefreshToken(ctx, token)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := auth.ValidateJWT(token, s.jwtSecret); err == nil {
+			return oauthError("unsupported_token_type", "Access tokens can't be revoked, they expire on their own")
+		}
+		return nil
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("GetUserFromRefreshToken: %w", err))
+	}
+
+	if !current.ClientID.Valid || current.ClientID.UUID != client.ID {
+		return nil
+	}
+
+	if err := s.store.RevokeRefreshToken(ctx, token); err != nil {
+		return apierror.Internal(fmt.Errorf("RevokeRefreshToken: %w", err))
+	}
+
+	return nil
+}
+
+// Introspection is the RFC 7662 answer, everything but Active is left out for inactive tokens
+type Introspection struct {
+	Active    bool
+	Scopes    []auth.Scope
+	ClientID  uuid.UUID
+	UserID    uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// "access_token" or "refresh_token"
+	TokenType string
+}
+
+// Introspect tells a confidential client whether one of its tokens is live and what it grants.
+// Other clients' tokens and session tokens are reported inactive, so a client can't probe them.
+func (s *OAuthService) Introspect(ctx context.Context, creds ClientCredentials, token string) (Introspection, error) {
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return Introspection{}, err
+	}
+
+	// The endpoint would otherwise let anyone holding a public client id check tokens
+	if !client.SecretHash.Valid {
+		return Introspection{}, oauthError("unauthorized_client", "Only confidential clients may introspect tokens")
+	}
+
+	if token == "" {
+		return Introspection{}, oauthError("invalid_request", "token is required")
+	}
+
+	if claims, err := auth.ParseJWT(token, s.jwtSecret); err == nil {
+		principal, err := claims.Principal()
+		if err != nil || principal.ClientID != client.ID {
+			return Introspection{}, nil
+		}
+
+		return Introspection{
+			Active:    true,
+			Scopes:    principal.Scopes,
+			ClientID:  client.ID,
+			UserID:    principal.UserID,
+			IssuedAt:  claims.IssuedAt.Time,
+			ExpiresAt: claims.ExpiresAt.Time,
+			TokenType: "access_token",
+		}, nil
+	}
+
+	current, err := s.store.GetUserFromRefreshToken(ctx, token)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Introspection{}, nil
+	}
+
+	if err != nil {
+		return Introspection{}, apierror.Internal(fmt.Errorf("GetUserFromRefreshToken: %w", err))
+	}
+
+	if !current.ClientID.Valid || current.ClientID.UUID != client.ID || current.RevokedAt.Valid || !time.Now().UTC().Before(current.ExpiresAt) {
+		return Introspection{}, nil
+	}
+
+	scopes, err := parseStoredScopes(current.Scopes)
+	if err != nil {
+		return Introspection{}, apierror.Internal(err)
+	}
+
+	return Introspection{
+		Active:    true,
+		Scopes:    scopes,
+		ClientID:  client.ID,
+		UserID:    current.UserID,
+		IssuedAt:  current.CreatedAt,
+		ExpiresAt: current.ExpiresAt,
+		TokenType: "refresh_token",
+	}, nil
+}
+
+// Confidential clients must present their secret, public clients must not have one to present
+func (s *OAuthService) authenticateClient(ctx context.Context, creds ClientCredentials) (database.OauthClient, error) {
+
+	invalidClient := oauthError("invalid_client", "Client authentication failed")
+
+	clientID, err := uuid.Parse(creds.ClientID)
+	if err != nil {
+		return database.OauthClient{}, invalidClient
+	}
+
+	client, err := s.store.GetOAuthClient(ctx, clientID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, invalidClient
+	}
+
+	if err != nil {
+		return database.OauthClient{}, apierror.Internal(fmt.Errorf("GetOAuthClient: %w", err))
+	}
+
+	if !client.SecretHash.Valid {
+		if creds.ClientSecret != "" {
+			return database.OauthClient{}, invalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashAPIKey(creds.ClientSecret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, invalidClient
+	}
+
+	return client, nil
+}
+
+func scopeStrings(scopes []auth.Scope) []string {
+	out := make([]string, len(scopes))
+	for i, scope := range scopes {
+		out[i] = string(scope)
+	}
+	return out
+}
+
+func parseStoredScopes(stored []string) ([]auth.Scope, error) {
+	scopes, err := auth.ParseScopes(strings.Join(stored, " "))
+	if err != nil {
+		return nil, fmt.Errorf("stored scopes %v: %w", stored, err)
+	}
+	return scopes, nil
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/oidc"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// How long the user has to sign in at the provider and come back
+const oidcLoginTTL = 10 * time.Minute
+
+// One account per provider and user, see sql/schema/018_oidc.sql
+const identityUserProviderConstraint = "user_identities_user_id_provider_key"
+
+// OIDCService signs users in with external OpenID Connect providers. The first sign-in links the
+// provider's account to the Chirpy user with the same verified email, or creates one; later ones
+// find the user by the provider's subject. Sessions are the ones a password login starts.
+type OIDCService struct {
+	store     store.Store
+	users     *UserService
+	sessions  *AuthService
+	providers []*oidc.Provider
+}
+
+func NewOIDCService(s store.Store, users *UserService, sessions *AuthService, providers []*oidc.Provider) *OIDCService {
+	return &OIDCService{store: s, users: users, sessions: sessions, providers: providers}
+}
+
+// Providers names the configured providers, in configuration order
+func (s *OIDCService) Providers() []string {
+	names := make([]string, len(s.providers))
+	for i, p := range s.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Start begins a sign-in with the provider and returns the URL to send the user to. The state,
+// nonce and PKCE verifier are kept server side until Finish.
+func (s *OIDCService) Start(ctx context.Context, providerName string) (string, error) {
+	return s.start(ctx, providerName, uuid.NullUUID{})
+}
+
+// StartLink begins linking the provider to userID's account, the same way as a sign-in but
+// finished by FinishLink from the user's session
+func (s *OIDCService) StartLink(ctx context.Context, userID uuid.UUID, providerName string) (string, error) {
+	return s.start(ctx, providerName, uuid.NullUUID{UUID: userID, Valid: true})
+}
+
+func (s *OIDCService) start(ctx context.Context, providerName string, linkUserID uuid.NullUUID) (string, error) {
+
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.DeleteExpiredOIDCLoginStates(ctx); err != nil {
+		return "", apierror.Internal(fmt.Errorf("DeleteExpiredOIDCLoginStates: %w", err))
+	}
+
+	secrets := make([]string, 3)
+	for i := range secrets {
+		if secrets[i], err = auth.MakeOAuthSecret(); err != nil {
+			return "", apierror.Internal(fmt.Errorf("MakeOAuthSecret: %w", err))
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		return "", providerUnavailable(provider, err)
+	}
+
+	err = s.store.CreateOIDCLoginState(ctx, database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashAPIKey(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTTL),
+		LinkUserID:   linkUserID,
+	})
+
+	if err != nil {
+		return "", apierror.Internal(fmt.Errorf("CreateOIDCLoginState: %w", err))
+	}
+
+	return authURL, nil
+}
+
+// Finish completes the sign-in with the code and state the provider redirected back with
+func (s *OIDCService) Finish(ctx context.Context, providerName, code, state string) (Session, error) {
+
+	provider, identity, err := s.finish(ctx, providerName, code, state, uuid.NullUUID{})
+	if err != nil {
+		return Session{}, err
+	}
+
+	user, err := s.resolveUser(ctx, provider.Name(), identity)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return s.sessions.StartSession(ctx, user)
+}
+
+// FinishLink completes a link started by StartLink, only the user who started it can finish it.
+// Both sides were signed in, so the provider's account joins this one whatever its email.
+func (s *OIDCService) FinishLink(ctx context.Context, userID uuid.UUID, providerName, code, state string) (database.UserIdentity, error) {
+
+	provider, identity, err := s.finish(ctx, providerName, code, state, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		return database.UserIdentity{}, err
+	}
+
+	linked, err := s.store.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+	})
+
+	switch {
+	case err == nil && linked.UserID == userID:
+		return linked, nil
+	case err == nil:
+		return database.UserIdentity{}, apierror.Conflict(fmt.Sprintf("This %s account is already linked to another user", provider.Name()))
+	case !errors.Is(err, sql.ErrNoRows):
+		return database.UserIdentity{}, apierror.Internal(fmt.Errorf("GetUserIdentity: %w", err))
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return database.UserIdentity{}, err
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		linked, err = tx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			Provider: provider.Name(),
+			Subject:  identity.Subject,
+			UserID:   userID,
+			Email:    identity.Email,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The provider vouches for the account's own email only when it is the one it checked
+		if identity.EmailVerified && strings.EqualFold(identity.Email, user.Email) {
+			return tx.VerifyUserEmail(ctx, userID)
+		}
+		return nil
+	})
+
+	if database.IsUniqueViolationOf(err, identityUserProviderConstraint) {
+		return database.UserIdentity{}, apierror.Conflict(fmt.Sprintf("Your account is already linked to another %s account", provider.Name()))
+	}
+
+	if database.IsUniqueViolation(err) {
+		return database.UserIdentity{}, apierror.Conflict(fmt.Sprintf("This %s account is already linked to another user", provider.Name()))
+	}
+
+	if err != nil {
+		return database.UserIdentity{}, apierror.Internal(fmt.Errorf("linking identity: %w", err))
+	}
+
+	return linked, nil
+}
+
+// Checks the state, which must have been started for linkUserID, or for a sign-in when it is
+// NULL, and exchanges the code for the provider's verified identity
+func (s *OIDCService) finish(ctx context.Context, providerName, code, state string, linkUserID uuid.NullUUID) (*oidc.Provider, oidc.Identity, error) {
+
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, oidc.Identity{}, err
+	}
+
+	var fields []apierror.FieldError
+	if code == "" {
+		fields = append(fields, apierror.FieldError{Field: "code", Message: "is required"})
+	}
+	if state == "" {
+		fields = append(fields, apierror.FieldError{Field: "state", Message: "is required"})
+	}
+	if len(fields) > 0 {
+		return nil, oidc.Identity{}, apierror.Validation(fields...)
+	}
+
+	invalidState := apierror.Unauthorized(apierror.CodeInvalidToken, "This sign-in is invalid or expired, start again")
+
+	login, err := s.store.ConsumeOIDCLoginState(ctx, auth.HashAPIKey(state))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, oidc.Identity{}, invalidState
+	}
+
+	if err != nil {
+		return nil, oidc.Identity{}, apierror.Internal(fmt.Errorf("ConsumeOIDCLoginState: %w", err))
+	}
+
+	// A state started with another provider would hand that provider's nonce to this one, and a
+	// link started by someone else would join the provider's account to theirs
+	if login.Provider != provider.Name() || login.LinkUserID != linkUserID || time.Now().UTC().After(login.ExpiresAt) {
+		return nil, oidc.Identity{}, invalidState
+	}
+
+	rejected := apierror.Unauthorized(apierror.CodeInvalidCredentials, fmt.Sprintf("Sign-in with %s failed, try again", provider.Name()))
+
+	rawIDToken, err := provider.Exchange(ctx, code, login.CodeVerifier)
+
+	var tokenErr *oidc.TokenError
+	if errors.As(err, &tokenErr) {
+		return nil, oidc.Identity{}, rejected.WithCause(err)
+	}
+
+	if err != nil {
+		return nil, oidc.Identity{}, providerUnavailable(provider, err)
+	}
+
+	identity, err := provider.Verify(ctx, rawIDToken, login.Nonce)
+
+	if errors.Is(err, oidc.ErrInvalidIDToken) {
+		return nil, oidc.Identity{}, rejected.WithCause(err)
+	}
+
+	if err != nil {
+		return nil, oidc.Identity{}, providerUnavailable(provider, err)
+	}
+
+	return provider, identity, nil
+}
+
+// Finds the user the identity belongs to, linking it or creating the user on its first sign-in
+func (s *OIDCService) resolveUser(ctx context.Context, providerName string, identity oidc.Identity) (database.User, error) {
+
+	linked, err := s.store.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: providerName,
+		Subject:  identity.Subject,
+	})
+
+	switch {
+	case err == nil:
+		err = s.store.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			Provider: providerName,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		})
+		if err != nil {
+			return database.User{}, apierror.Internal(fmt.Errorf("TouchUserIdentity: %w", err))
+		}
+		return s.getUser(ctx, linked.UserID)
+
+	case !errors.Is(err, sql.ErrNoRows):
+		return database.User{}, apierror.Internal(fmt.Errorf("GetUserIdentity: %w", err))
+	}
+
+	// Matching on an email the provider didn't check would let anyone claim an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, apierror.Forbidden(fmt.Sprintf("%s has not verified the email address of this account", providerName))
+	}
+
+	// The provider checked the email, so the user it links is verified
+	link := func(tx store.Store, userID uuid.UUID) error {
+		_, err := tx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			Provider: providerName,
+			Subject:  identity.Subject,
+			UserID:   userID,
+			Email:    identity.Email,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.VerifyUserEmail(ctx, userID)
+	}
+
+	existing, err := s.store.GetUserByEmail(ctx, identity.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		created, err := s.users.CreateWithoutPassword(ctx, identity.Email, link)
+		if err != nil {
+			return database.User{}, err
+		}
+		return s.getUser(ctx, created.ID)
+	}
+
+	if err != nil {
+		return database.User{}, apierror.Internal(fmt.Errorf("GetUserByEmail: %w", err))
+	}
+
+	// Nobody proved owning the email when the account was registered, it could be anyone's. Its
+	// owner links the provider from their session instead.
+	if !existing.EmailVerifiedAt.Valid {
+		return database.User{}, apierror.Conflict(fmt.Sprintf("An account with this email already exists, log in to it and link %s from there", providerName))
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		return link(tx, existing.ID)
+	})
+
+	if database.IsUniqueViolationOf(err, identityUserProviderConstraint) {
+		return database.User{}, apierror.Conflict(fmt.Sprintf("This account is already linked to another %s account", providerName))
+	}
+
+	if err != nil {
+		return database.User{}, apierror.Internal(fmt.Errorf("linking identity: %w", err))
+	}
+
+	return s.getUser(ctx, existing.ID)
+}
+
+// Identities lists the providers linked to the user
+func (s *OIDCService) Identities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error) {
+
+	identities, err := s.store.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListUserIdentities: %w", err))
+	}
+
+	return identities, nil
+}
+
+// Unlink removes a linked provider, unless the user would be left without a way to sign in
+func (s *OIDCService) Unlink(ctx context.Context, userID uuid.UUID, providerName string) error {
+
+	identities, err := s.Identities(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	linked := false
+	for _, i := range identities {
+		linked = linked || i.Provider == providerName
+	}
+
+	if !linked {
+		return apierror.NotFound("This provider is not linked to your account")
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.HashedPassword == "" && len(identities) == 1 {
+		return apierror.Conflict("Set a password before unlinking your only sign-in provider")
+	}
+
+	if _, err := s.store.DeleteUserIdentity(ctx, database.DeleteUserIdentityParams{UserID: userID, Provider: providerName}); err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteUserIdentity: %w", err))
+	}
+
+	return nil
+}
+
+func (s *OIDCService) provider(name string) (*oidc.Provider, error) {
+	for _, p := range s.providers {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, apierror.NotFound("Unknown sign-in provider")
+}
+
+func (s *OIDCService) getUser(ctx context.Context, userID uuid.UUID) (database.User, error) {
+
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return database.User{}, apierror.Internal(fmt.Errorf("GetUserByID: %w", err))
+	}
+
+	return user, nil
+}
+
+func providerUnavailable(provider *oidc.Provider, err error) error {
+	return apierror.New(http.StatusBadGateway, apierror.CodeProviderUnavailable, fmt.Sprintf("%s could not be reached, try again later", provider.Name())).WithCause(err)
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/moderation"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Poll limits
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+// PollInput is the poll sent along with a new chirp
+type PollInput struct {
+	Options        []string
+	ClosesAt       time.Time
+	MultipleChoice bool
+}
+
+// Poll is a chirp's poll as one viewer sees it. Until they voted or the poll closed, Results is
+// false and the tallies are left at zero so nobody votes for whatever is winning.
+type Poll struct {
+	ChirpID        uuid.UUID
+	ClosesAt       time.Time
+	MultipleChoice bool
+	Options        []PollOption
+	Closed         bool
+	Results        bool
+	// Users who voted, whatever the number of options they picked
+	Voters int64
+	// The options the viewer voted for
+	Voted []uuid.UUID
+}
+
+type PollOption struct {
+	ID    uuid.UUID
+	Text  string
+	Votes int64
+}
+
+// Checks the poll like the body of its chirp: shape, length and moderation. The matches of the
+// options are added to verdict, so a flagged option flags the chirp.
+func (s *ChirpService) validatePoll(poll *PollInput, verdict *moderation.Verdict) error {
+
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return apierror.Validation(apierror.FieldError{
+			Field:   "poll.options",
+			Message: fmt.Sprintf("must have between %d and %d options", minPollOptions, maxPollOptions),
+		})
+	}
+
+	var fields []apierror.FieldError
+	var seen []string
+
+	for i, option := range poll.Options {
+		field := fmt.Sprintf("poll.options[%d]", i)
+		text := strings.TrimSpace(option)
+
+		switch {
+		case text == "":
+			fields = append(fields, apierror.FieldError{Field: field, Message: "is required"})
+		case len(text) > maxPollOptionLength:
+			fields = append(fields, apierror.FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", maxPollOptionLength)})
+		case slices.Contains(seen, strings.ToLower(text)):
+			fields = append(fields, apierror.FieldError{Field: field, Message: "repeats another option"})
+		}
+
+		seen = append(seen, strings.ToLower(text))
+	}
+
+	now := time.Now().UTC()
+
+	if !poll.ClosesAt.After(now) {
+		fields = append(fields, apierror.FieldError{Field: "poll.closes_at", Message: "must be in the future"})
+	} else if poll.ClosesAt.After(now.Add(maxPollDuration)) {
+		fields = append(fields, apierror.FieldError{Field: "poll.closes_at", Message: "must be within 7 days"})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+
+	for i, option := range poll.Options {
+		optionVerdict := s.moderator.Check(strings.TrimSpace(option))
+
+		if optionVerdict.Rejected() {
+			return apierror.New(http.StatusUnprocessableEntity, apierror.CodeContentRejected, "Chirp violates the content rules")
+		}
+
+		poll.Options[i] = optionVerdict.Text
+		verdict.Matches = append(verdict.Matches, optionVerdict.Matches...)
+	}
+
+	return nil
+}
+
+// Stores the poll of a new chirp, tx must be the transaction that created the chirp
+func createPoll(ctx context.Context, tx store.Store, chirpID uuid.UUID, poll *PollInput) error {
+
+	err := tx.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:        chirpID,
+		ClosesAt:       poll.ClosesAt.UTC(),
+		MultipleChoice: poll.MultipleChoice,
+	})
+
+	if err != nil {
+		return fmt.Errorf("CreatePoll: %w", err)
+	}
+
+	for i, text := range poll.Options {
+		err := tx.CreatePollOption(ctx, database.CreatePollOptionParams{
+			ChirpID:  chirpID,
+			Position: int32(i),
+			Text:     text,
+		})
+
+		if err != nil {
+			return fmt.Errorf("CreatePollOption: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Polls returns the polls of the chirps that have one, keyed by chirp ID, with the tallies
+// viewerID may see. A NULL viewer only sees the results of closed polls.
+func (s *ChirpService) Polls(ctx context.Context, viewerID uuid.NullUUID, chirpIDs []uuid.UUID) (map[uuid.UUID]Poll, error) {
+
+	polls, err := loadPolls(ctx, s.store, viewerID, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, poll := range polls {
+		if !poll.Results {
+			poll.Voters = 0
+			for i := range poll.Options {
+				poll.Options[i].Votes = 0
+			}
+		}
+
+		polls[id] = poll
+	}
+
+	return polls, nil
+}
+
+// Loads the polls with every tally, whether viewerID may see them or not
+func loadPolls(ctx context.Context, q store.Store, viewerID uuid.NullUUID, chirpIDs []uuid.UUID) (map[uuid.UUID]Poll, error) {
+
+	polls := map[uuid.UUID]Poll{}
+
+	if len(chirpIDs) == 0 {
+		return polls, nil
+	}
+
+	rows, err := q.GetPolls(ctx, database.GetPollsParams{
+		ViewerID: viewerID,
+		ChirpIds: chirpIDs,
+	})
+
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("GetPolls: %w", err))
+	}
+
+	now := time.Now().UTC()
+
+	for _, row := range rows {
+		poll, ok := polls[row.ChirpID]
+		if !ok {
+			poll = Poll{
+				ChirpID:        row.ChirpID,
+				ClosesAt:       row.ClosesAt,
+				MultipleChoice: row.MultipleChoice,
+				Closed:         !now.Before(row.ClosesAt),
+				Voters:         row.Voters,
+			}
+		}
+
+		poll.Options = append(poll.Options, PollOption{
+			ID:    row.OptionID,
+			Text:  row.Text,
+			Votes: row.Votes,
+		})
+
+		if row.Voted {
+			poll.Voted = append(poll.Voted, row.OptionID)
+		}
+
+		polls[row.ChirpID] = poll
+	}
+
+	for id, poll := range polls {
+		poll.Results = poll.Closed || len(poll.Voted) > 0
+		polls[id] = poll
+	}
+
+	return polls, nil
+}
+
+// Vote records the options userID picked in the poll of chirpID and returns the poll with the
+// tallies as they are right after the vote. Everyone votes once, picking one option or, for
+// multiple choice polls, several.
+func (s *ChirpService) Vote(ctx context.Context, userID, chirpID uuid.UUID, optionIDs []uuid.UUID) (Poll, error) {
+
+	viewerID := uuid.NullUUID{UUID: userID, Valid: true}
+
+	if _, err := s.Get(ctx, viewerID, chirpID); err != nil {
+		return Poll{}, err
+	}
+
+	polls, err := s.Polls(ctx, viewerID, []uuid.UUID{chirpID})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	poll, ok := polls[chirpID]
+	if !ok {
+		return Poll{}, apierror.NotFound("Chirp has no poll")
+	}
+
+	closed := apierror.Conflict("Poll is closed")
+
+	if poll.Closed {
+		return Poll{}, closed
+	}
+
+	if len(poll.Voted) > 0 {
+		return Poll{}, apierror.Conflict("You already voted in this poll")
+	}
+
+	if err := validateBallot(poll, optionIDs); err != nil {
+		return Poll{}, err
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		// The poll may have closed since it was read, the insert checks again
+		added, err := tx.CreatePollVoter(ctx, database.CreatePollVoterParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+
+		if err != nil {
+			return fmt.Errorf("CreatePollVoter: %w", err)
+		}
+
+		if added == 0 {
+			return closed
+		}
+
+		for _, optionID := range optionIDs {
+			err := tx.CreatePollVote(ctx, database.CreatePollVoteParams{
+				ChirpID:  chirpID,
+				UserID:   userID,
+				OptionID: optionID,
+			})
+
+			if err != nil {
+				return fmt.Errorf("CreatePollVote: %w", err)
+			}
+		}
+
+		// Read again with the vote in, so the tallies include everyone else's votes too
+		polls, err = loadPolls(ctx, tx, viewerID, []uuid.UUID{chirpID})
+		return err
+	})
+
+	// Lost the race against another request of the same user
+	if database.IsUniqueViolation(err) {
+		return Poll{}, apierror.Conflict("You already voted in this poll")
+	}
+
+	if errors.Is(err, closed) {
+		return Poll{}, closed
+	}
+
+	if err != nil {
+		return Poll{}, apierror.Internal(err)
+	}
+
+	return polls[chirpID], nil
+}
+
+// The picked options must belong to the poll, without repeats, and be a single one unless the
+// poll is multiple choice
+func validateBallot(poll Poll, optionIDs []uuid.UUID) error {
+
+	if len(optionIDs) == 0 {
+		return apierror.Validation(apierror.FieldError{Field: "option_ids", Message: "is required"})
+	}
+
+	if !poll.MultipleChoice && len(optionIDs) > 1 {
+		return apierror.Validation(apierror.FieldError{Field: "option_ids", Message: "must contain a single option"})
+	}
+
+	for i, id := range optionIDs {
+		if !slices.ContainsFunc(poll.Options, func(o PollOption) bool { return o.ID == id }) {
+			return apierror.Validation(apierror.FieldError{Field: "option_ids", Message: "contains an option of another poll"})
+		}
+
+		if slices.Contains(optionIDs[:i], id) {
+			return apierror.Validation(apierror.FieldError{Field: "option_ids", Message: "repeats an option"})
+		}
+	}
+
+	return nil
+}
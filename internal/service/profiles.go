@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itsmandrew/server-go/internal/apierror"
+)
+
+// Profile field limits, counted in characters
+const (
+	minHandleLength      = 3
+	maxHandleLength      = 30
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Handles that would collide with routes under /api/users
+var reservedHandles = map[string]bool{
+	"me": true,
+}
+
+func handleErrors(handle string) []apierror.FieldError {
+
+	fail := func(message string) []apierror.FieldError {
+		return []apierror.FieldError{{Field: "handle", Message: message}}
+	}
+
+	if len(handle) < minHandleLength || len(handle) > maxHandleLength {
+		return fail(fmt.Sprintf("must be between %d and %d characters", minHandleLength, maxHandleLength))
+	}
+
+	if !handlePattern.MatchString(handle) {
+		return fail("may only contain letters, digits and underscores")
+	}
+
+	if reservedHandles[strings.ToLower(handle)] {
+		return fail("is reserved")
+	}
+
+	return nil
+}
+
+// Checks every field set in the update, all failures are reported together
+func validateUpdate(update UserUpdate) error {
+
+	var fields []apierror.FieldError
+
+	if update.Email != nil {
+		fields = append(fields, emailErrors(*update.Email)...)
+	}
+
+	if update.Password != nil {
+		fields = append(fields, passwordErrors(*update.Password)...)
+	}
+
+	if update.Handle != nil {
+		fields = append(fields, handleErrors(*update.Handle)...)
+	}
+
+	limits := []struct {
+		field string
+		value *string
+		max   int
+	}{
+		{"display_name", update.DisplayName, maxDisplayNameLength},
+		{"bio", update.Bio, maxBioLength},
+		{"location", update.Location, maxLocationLength},
+		{"website", update.Website, maxWebsiteLength},
+	}
+
+	for _, l := range limits {
+		if l.value != nil && utf8.RuneCountInString(*l.value) > l.max {
+			fields = append(fields, apierror.FieldError{Field: l.field, Message: fmt.Sprintf("must be at most %d characters", l.max)})
+		}
+	}
+
+	if update.Website != nil && *update.Website != "" && !validWebsite(*update.Website) {
+		fields = append(fields, apierror.FieldError{Field: "website", Message: "must be an http or https URL"})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+
+	return nil
+}
+
+func validWebsite(website string) bool {
+	u, err := url.Parse(website)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Derives a handle from the local part of the email, "walter.white@..." becomes "walterwhite".
+// Attempts after the first add a random suffix in case the plain one is taken.
+func generateHandle(email string, attempt int) string {
+
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	handle := strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, local)
+
+	// Leave room for the suffix
+	handle = handle[:min(len(handle), maxHandleLength-5)]
+
+	if len(handle) < minHandleLength || reservedHandles[handle] {
+		handle = "user_" + handle
+	}
+
+	if attempt > 0 {
+		handle = fmt.Sprintf("%s_%04d", handle, rand.IntN(10000))
+	}
+
+	return handle
+}
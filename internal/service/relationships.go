@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// RelationshipService manages the follows, blocks and mutes users set on each other. All of them are
+// idempotent, blocking someone twice or unmuting someone who isn't muted is not an error.
+type RelationshipService struct {
+	store    store.Store
+	notifier Notifier
+}
+
+func NewRelationshipService(s store.Store, notifier Notifier) *RelationshipService {
+	return &RelationshipService{store: s, notifier: notifier}
+}
+
+// Follow makes userID a follower of targetID, unless targetID blocked them
+func (s *RelationshipService) Follow(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	if err := s.checkTarget(ctx, userID, targetID); err != nil {
+		return err
+	}
+
+	blocked, err := s.store.IsBlocked(ctx, database.IsBlockedParams{
+		BlockerID: targetID,
+		BlockedID: userID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("IsBlocked: %w", err))
+	}
+
+	if blocked {
+		return apierror.Forbidden("You can't follow this user")
+	}
+
+	err = s.store.CreateFollow(ctx, database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("CreateFollow: %w", err))
+	}
+
+	s.notifier.Notify(ctx, NotificationEvent{
+		Kind:        NotifyFollow,
+		RecipientID: targetID,
+		ActorID:     userID,
+	})
+	return nil
+}
+
+func (s *RelationshipService) Unfollow(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	err := s.store.DeleteFollow(ctx, database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: targetID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteFollow: %w", err))
+	}
+	return nil
+}
+
+// Block stops targetID from seeing userID's chirps, any follow between the two is dropped and
+// neither stays a member of the other's lists
+func (s *RelationshipService) Block(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	if err := s.checkTarget(ctx, userID, targetID); err != nil {
+		return err
+	}
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		err := tx.CreateBlock(ctx, database.CreateBlockParams{
+			BlockerID: userID,
+			BlockedID: targetID,
+		})
+
+		if err != nil {
+			return fmt.Errorf("CreateBlock: %w", err)
+		}
+
+		for _, follow := range []database.DeleteFollowParams{
+			{FollowerID: targetID, FolloweeID: userID},
+			{FollowerID: userID, FolloweeID: targetID},
+		} {
+			if err := tx.DeleteFollow(ctx, follow); err != nil {
+				return fmt.Errorf("DeleteFollow: %w", err)
+			}
+		}
+
+		// Neither stays on the other's lists, like a block keeps them from being added
+		for _, membership := range []database.RemoveListMembershipsParams{
+			{OwnerID: userID, UserID: targetID},
+			{OwnerID: targetID, UserID: userID},
+		} {
+			if err := tx.RemoveListMemberships(ctx, membership); err != nil {
+				return fmt.Errorf("RemoveListMemberships: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	return nil
+}
+
+func (s *RelationshipService) Unblock(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	err := s.store.DeleteBlock(ctx, database.DeleteBlockParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteBlock: %w", err))
+	}
+	return nil
+}
+
+func (s *RelationshipService) ListBlocks(ctx context.Context, userID uuid.UUID) ([]database.Block, error) {
+	blocks, err := s.store.ListBlocks(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListBlocks: %w", err))
+	}
+	return blocks, nil
+}
+
+// Mute hides targetID's chirps from userID's chirp lists, targetID isn't told
+func (s *RelationshipService) Mute(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	if err := s.checkTarget(ctx, userID, targetID); err != nil {
+		return err
+	}
+
+	err := s.store.CreateMute(ctx, database.CreateMuteParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("CreateMute: %w", err))
+	}
+	return nil
+}
+
+func (s *RelationshipService) Unmute(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	err := s.store.DeleteMute(ctx, database.DeleteMuteParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteMute: %w", err))
+	}
+	return nil
+}
+
+func (s *RelationshipService) ListMutes(ctx context.Context, userID uuid.UUID) ([]database.Mute, error) {
+	mutes, err := s.store.ListMutes(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListMutes: %w", err))
+	}
+	return mutes, nil
+}
+
+// The target must exist and can't be the user themselves
+func (s *RelationshipService) checkTarget(ctx context.Context, userID, targetID uuid.UUID) error {
+
+	if userID == targetID {
+		return apierror.Validation(apierror.FieldError{Field: "userID", Message: "can't be yourself"})
+	}
+
+	_, err := s.store.GetUserByIDNoPassword(ctx, targetID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	return nil
+}
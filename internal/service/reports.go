@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Reason categories a report can be filed under
+var ReportReasons = []string{"spam", "harassment", "hate", "violence", "misinformation", "other"}
+
+// Report statuses, open and triaged reports are still waiting on a moderator
+const (
+	ReportOpen      = "open"
+	ReportTriaged   = "triaged"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// Actions recorded in moderation_actions, the last three are the ways to resolve a report
+const (
+	ActionTriage      = "triage"
+	ActionDismiss     = "dismiss"
+	ActionHideChirp   = "hide_chirp"
+	ActionSuspendUser = "suspend_user"
+	ActionWarnUser    = "warn_user"
+)
+
+// Longest free text a reporter or moderator can attach
+const maxReportTextLength = 500
+
+// ReportService lets users report chirps and other users, and moderators work through the queue
+type ReportService struct {
+	store store.Store
+}
+
+func NewReportService(s store.Store) *ReportService {
+	return &ReportService{store: s}
+}
+
+// ReportChirp files a report against a chirp and its author
+func (s *ReportService) ReportChirp(ctx context.Context, reporterID, chirpID uuid.UUID, reason, details string) (database.Report, error) {
+
+	if err := validateReport(reason, details); err != nil {
+		return database.Report{}, err
+	}
+
+	chirp, err := s.store.GetIndividualChirp(ctx, database.GetIndividualChirpParams{
+		ID:       chirpID,
+		ViewerID: uuid.NullUUID{UUID: reporterID, Valid: true},
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Report{}, apierror.NotFound("Chirp not found")
+	}
+
+	if err != nil {
+		return database.Report{}, apierror.Internal(fmt.Errorf("GetIndividualChirp: %w", err))
+	}
+
+	return s.create(ctx, database.CreateReportParams{
+		ReporterID:   reporterID,
+		TargetUserID: chirp.UserID,
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:       reason,
+		Details:      strings.TrimSpace(details),
+	})
+}
+
+// ReportUser files a report against a user
+func (s *ReportService) ReportUser(ctx context.Context, reporterID, userID uuid.UUID, reason, details string) (database.Report, error) {
+
+	if err := validateReport(reason, details); err != nil {
+		return database.Report{}, err
+	}
+
+	_, err := s.store.GetUserByIDNoPassword(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Report{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return database.Report{}, apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	return s.create(ctx, database.CreateReportParams{
+		ReporterID:   reporterID,
+		TargetUserID: userID,
+		Reason:       reason,
+		Details:      strings.TrimSpace(details),
+	})
+}
+
+func (s *ReportService) create(ctx context.Context, params database.CreateReportParams) (database.Report, error) {
+
+	if params.ReporterID == params.TargetUserID {
+		return database.Report{}, apierror.Validation(apierror.FieldError{Field: "target", Message: "you can't report yourself"})
+	}
+
+	report, err := s.store.CreateReport(ctx, params)
+
+	if database.IsUniqueViolation(err) {
+		return database.Report{}, apierror.Conflict("You already have a pending report about this")
+	}
+
+	if err != nil {
+		return database.Report{}, apierror.Internal(fmt.Errorf("CreateReport: %w", err))
+	}
+
+	return report, nil
+}
+
+func validateReport(reason, details string) error {
+	var fields []apierror.FieldError
+
+	if !slices.Contains(ReportReasons, reason) {
+		fields = append(fields, apierror.FieldError{
+			Field:   "reason",
+			Message: "must be one of " + strings.Join(ReportReasons, ", "),
+		})
+	}
+
+	if len(details) > maxReportTextLength {
+		fields = append(fields, apierror.FieldError{
+			Field:   "details",
+			Message: fmt.Sprintf("must be at most %d characters", maxReportTextLength),
+		})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+// List returns the reports with the given status, or every report when status is empty
+func (s *ReportService) List(ctx context.Context, status string) ([]database.Report, error) {
+
+	statuses := []string{ReportOpen, ReportTriaged, ReportResolved, ReportDismissed}
+
+	if status != "" && !slices.Contains(statuses, status) {
+		return nil, apierror.Validation(apierror.FieldError{
+			Field:   "status",
+			Message: "must be one of " + strings.Join(statuses, ", "),
+		})
+	}
+
+	reports, err := s.store.ListReports(ctx, status)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListReports: %w", err))
+	}
+	return reports, nil
+}
+
+func (s *ReportService) Get(ctx context.Context, reportID uuid.UUID) (database.Report, error) {
+
+	report, err := s.store.GetReport(ctx, reportID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Report{}, apierror.NotFound("Report not found")
+	}
+
+	if err != nil {
+		return database.Report{}, apierror.Internal(fmt.Errorf("GetReport: %w", err))
+	}
+
+	return report, nil
+}
+
+// Triage marks an open report as being looked at
+func (s *ReportService) Triage(ctx context.Context, actorID, reportID uuid.UUID, note string) (database.Report, error) {
+
+	report, err := s.pending(ctx, reportID, note)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	if report.Status != ReportOpen {
+		return database.Report{}, apierror.Conflict("Report is already triaged")
+	}
+
+	return s.settle(ctx, actorID, report, ActionTriage, ReportTriaged, note, nil)
+}
+
+// Dismiss closes a report without acting on it
+func (s *ReportService) Dismiss(ctx context.Context, actorID, reportID uuid.UUID, note string) (database.Report, error) {
+
+	report, err := s.pending(ctx, reportID, note)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	return s.settle(ctx, actorID, report, ActionDismiss, ReportDismissed, note, nil)
+}
+
+// Resolve closes a report by hiding the chirp, suspending the reported user or warning them
+func (s *ReportService) Resolve(ctx context.Context, actorID, reportID uuid.UUID, action, note string) (database.Report, error) {
+
+	report, err := s.pending(ctx, reportID, note)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	var apply func(tx store.Store) error
+
+	switch action {
+	case ActionHideChirp:
+		if !report.ChirpID.Valid {
+			return database.Report{}, apierror.Validation(apierror.FieldError{Field: "action", Message: "report is not about a chirp"})
+		}
+
+		// A hidden chirp is gone as far as anyone outside is concerned
+		apply = func(tx store.Store) error {
+			if err := tx.HideChirp(ctx, report.ChirpID.UUID); err != nil {
+				return fmt.Errorf("HideChirp: %w", err)
+			}
+
+			return events.Record(ctx, tx, events.ChirpDeleted, events.ChirpDeletedPayload{
+				ChirpID: report.ChirpID.UUID,
+				UserID:  report.TargetUserID,
+				Reason:  events.DeletedByModerator,
+			})
+		}
+
+	case ActionSuspendUser:
+		apply = func(tx store.Store) error {
+			if err := tx.SuspendUser(ctx, report.TargetUserID); err != nil {
+				return fmt.Errorf("SuspendUser: %w", err)
+			}
+
+			// Ends their sessions, access tokens run out on their own
+			if err := tx.RevokeUserRefreshTokens(ctx, report.TargetUserID); err != nil {
+				return fmt.Errorf("RevokeUserRefreshTokens: %w", err)
+			}
+
+			return nil
+		}
+
+	case ActionWarnUser:
+		// The warning is the entry in the moderation log
+
+	default:
+		return database.Report{}, apierror.Validation(apierror.FieldError{
+			Field:   "action",
+			Message: fmt.Sprintf("must be one of %s, %s, %s", ActionHideChirp, ActionSuspendUser, ActionWarnUser),
+		})
+	}
+
+	return s.settle(ctx, actorID, report, action, ReportResolved, note, apply)
+}
+
+// ListActions returns the moderation log, oldest first
+func (s *ReportService) ListActions(ctx context.Context) ([]database.ModerationAction, error) {
+	actions, err := s.store.ListModerationActions(ctx)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListModerationActions: %w", err))
+	}
+	return actions, nil
+}
+
+// Loads a report that is still open or triaged
+func (s *ReportService) pending(ctx context.Context, reportID uuid.UUID, note string) (database.Report, error) {
+
+	if len(note) > maxReportTextLength {
+		return database.Report{}, apierror.Validation(apierror.FieldError{
+			Field:   "note",
+			Message: fmt.Sprintf("must be at most %d characters", maxReportTextLength),
+		})
+	}
+
+	report, err := s.Get(ctx, reportID)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	if report.Status != ReportOpen && report.Status != ReportTriaged {
+		return database.Report{}, apierror.Conflict(fmt.Sprintf("Report is already %s", report.Status))
+	}
+
+	return report, nil
+}
+
+// Moves the report to its new status, applies the action, if any, and records who did what in
+// the moderation log, all in one transaction. Moving the report first locks it, so of two
+// moderators settling it at once only one acts and the other gets a conflict.
+func (s *ReportService) settle(ctx context.Context, actorID uuid.UUID, report database.Report, action, status, note string, apply func(tx store.Store) error) (database.Report, error) {
+
+	var updated database.Report
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		updated, err = tx.UpdateReportStatus(ctx, database.UpdateReportStatusParams{
+			ID:     report.ID,
+			Status: status,
+		})
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return apierror.Conflict("Report was already handled by another moderator")
+		}
+
+		if err != nil {
+			return apierror.Internal(fmt.Errorf("UpdateReportStatus: %w", err))
+		}
+
+		if apply != nil {
+			if err := apply(tx); err != nil {
+				return apierror.Internal(err)
+			}
+		}
+
+		_, err = tx.CreateModerationAction(ctx, database.CreateModerationActionParams{
+			ActorID:      uuid.NullUUID{UUID: actorID, Valid: true},
+			ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+			Action:       action,
+			TargetUserID: uuid.NullUUID{UUID: report.TargetUserID, Valid: true},
+			ChirpID:      report.ChirpID,
+			Note:         strings.TrimSpace(note),
+		})
+
+		if err != nil {
+			return apierror.Internal(fmt.Errorf("CreateModerationAction: %w", err))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// How long a reset confirmation token stays valid
+const resetTokenTTL = time.Minute
+
+// ResetService empties tables on the dev and test platforms. A reset takes two calls: Request
+// hands out a short lived, single use token for exactly the tables asked for, and Confirm only
+// truncates them when it gets that token back from the same admin. A stray or replayed request
+// can't wipe anything on its own.
+type ResetService struct {
+	store store.Truncater
+
+	mu      sync.Mutex
+	pending map[string]pendingReset
+}
+
+type pendingReset struct {
+	actorID   uuid.UUID
+	tables    []string
+	expiresAt time.Time
+}
+
+// ResetConfirmation is what the admin has to send back to go ahead with the reset
+type ResetConfirmation struct {
+	Token     string
+	Tables    []string
+	ExpiresAt time.Time
+}
+
+func NewResetService(s store.Truncater) *ResetService {
+	return &ResetService{store: s, pending: map[string]pendingReset{}}
+}
+
+// Request validates the tables (every table when none are given) and issues a confirmation token
+func (s *ResetService) Request(ctx context.Context, actorID uuid.UUID, tables []string) (ResetConfirmation, error) {
+
+	tables, err := resetTables(tables)
+	if err != nil {
+		return ResetConfirmation{}, err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return ResetConfirmation{}, apierror.Internal(fmt.Errorf("MakeRefreshToken: %w", err))
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(resetTokenTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for t, p := range s.pending {
+		if now.After(p.expiresAt) {
+			delete(s.pending, t)
+		}
+	}
+
+	s.pending[token] = pendingReset{actorID: actorID, tables: tables, expiresAt: expiresAt}
+
+	return ResetConfirmation{Token: token, Tables: tables, ExpiresAt: expiresAt}, nil
+}
+
+// Confirm truncates the tables once the token matches the earlier Request, returning what was reset
+func (s *ResetService) Confirm(ctx context.Context, actorID uuid.UUID, token string, tables []string) ([]string, error) {
+
+	tables, err := resetTables(tables)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	p, ok := s.pending[token]
+	// Used up even when it doesn't match, a guessed token gets a single try
+	delete(s.pending, token)
+	s.mu.Unlock()
+
+	if !ok || p.actorID != actorID || !slices.Equal(p.tables, tables) || time.Now().UTC().After(p.expiresAt) {
+		return nil, apierror.Validation(apierror.FieldError{
+			Field:   "confirmation_token",
+			Message: "is invalid or expired, or was issued for other tables",
+		})
+	}
+
+	if err := s.store.Truncate(ctx, tables...); err != nil {
+		return nil, apierror.Internal(fmt.Errorf("Truncate: %w", err))
+	}
+
+	return tables, nil
+}
+
+// Sorted and deduplicated so the same set always compares equal, empty means every table
+func resetTables(tables []string) ([]string, error) {
+
+	if len(tables) == 0 {
+		return slices.Sorted(slices.Values(store.Tables)), nil
+	}
+
+	tables = slices.Compact(slices.Sorted(slices.Values(tables)))
+
+	for _, table := range tables {
+		if !slices.Contains(store.Tables, table) {
+			return nil, apierror.Validation(apierror.FieldError{
+				Field:   "tables",
+				Message: fmt.Sprintf("unknown table %q", table),
+			})
+		}
+	}
+
+	return tables, nil
+}
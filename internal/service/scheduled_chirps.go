@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// Due chirps published per transaction, the rest wait for the next round
+const scheduledChirpBatchSize = 50
+
+// Scheduling further ahead is most likely a typo in the year
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// Schedule checks the chirp like Create and queues it until publishAt. The body is moderated
+// again when it is published, against the rules of that day.
+func (s *ChirpService) Schedule(ctx context.Context, userID uuid.UUID, body string, replyToID uuid.NullUUID, publishAt time.Time) (database.ScheduledChirp, error) {
+
+	if _, err := s.validate(body); err != nil {
+		return database.ScheduledChirp{}, err
+	}
+
+	now := time.Now().UTC()
+
+	if !publishAt.After(now) {
+		return database.ScheduledChirp{}, apierror.Validation(apierror.FieldError{Field: "publish_at", Message: "must be in the future"})
+	}
+
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return database.ScheduledChirp{}, apierror.Validation(apierror.FieldError{Field: "publish_at", Message: "must be within a year"})
+	}
+
+	if _, err := s.replyParent(ctx, userID, replyToID); err != nil {
+		return database.ScheduledChirp{}, err
+	}
+
+	scheduled, err := s.store.CreateScheduledChirp(ctx, database.CreateScheduledChirpParams{
+		UserID:    userID,
+		Body:      body,
+		ReplyToID: replyToID,
+		PublishAt: publishAt.UTC(),
+	})
+
+	if err != nil {
+		return database.ScheduledChirp{}, apierror.Internal(fmt.Errorf("CreateScheduledChirp: %w", err))
+	}
+
+	return scheduled, nil
+}
+
+// ListScheduled returns the user's queued chirps, the next one first, including those that failed
+func (s *ChirpService) ListScheduled(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error) {
+
+	scheduled, err := s.store.ListScheduledChirps(ctx, userID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListScheduledChirps: %w", err))
+	}
+
+	return scheduled, nil
+}
+
+// CancelScheduled drops a queued chirp of the user before it is published
+func (s *ChirpService) CancelScheduled(ctx context.Context, userID, scheduledID uuid.UUID) error {
+
+	n, err := s.store.DeleteScheduledChirp(ctx, database.DeleteScheduledChirpParams{
+		ID:     scheduledID,
+		UserID: userID,
+	})
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteScheduledChirp: %w", err))
+	}
+
+	if n == 0 {
+		return apierror.NotFound("Scheduled chirp not found")
+	}
+
+	return nil
+}
+
+// PublishDue publishes the chirps whose publish_at has passed and returns how many went out.
+// Claiming, publishing and removing them from the queue share one transaction: the rows stay
+// locked until it commits, other instances skip them, and a crash rolls everything back for
+// the next round. Chirps that can no longer be published keep the reason and aren't retried.
+// Once committed, every published chirp is handed to published, which may be nil.
+func (s *ChirpService) PublishDue(ctx context.Context, published func(ctx context.Context, chirp database.Chirp)) (int, error) {
+
+	type publishedChirp struct {
+		chirp, parent database.Chirp
+	}
+
+	var done []publishedChirp
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		done = nil
+
+		due, err := tx.ClaimDueScheduledChirps(ctx, scheduledChirpBatchSize)
+		if err != nil {
+			return fmt.Errorf("ClaimDueScheduledChirps: %w", err)
+		}
+
+		for _, scheduled := range due {
+			chirp, parent, err := s.publishScheduled(ctx, tx, scheduled)
+
+			var apiErr *apierror.Error
+			if errors.As(err, &apiErr) && apiErr.Status < 500 {
+				err := tx.FailScheduledChirp(ctx, database.FailScheduledChirpParams{
+					ID:      scheduled.ID,
+					Failure: sql.NullString{String: failureReason(apiErr), Valid: true},
+				})
+				if err != nil {
+					return fmt.Errorf("FailScheduledChirp: %w", err)
+				}
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := tx.DeletePublishedScheduledChirp(ctx, scheduled.ID); err != nil {
+				return fmt.Errorf("DeletePublishedScheduledChirp: %w", err)
+			}
+
+			done = append(done, publishedChirp{chirp: chirp, parent: parent})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range done {
+		s.notifyChirp(ctx, p.chirp, p.parent)
+
+		if published != nil {
+			published(ctx, p.chirp)
+		}
+	}
+
+	return len(done), nil
+}
+
+// Runs the checks of Create again, the rules or the parent may have changed since it was queued
+func (s *ChirpService) publishScheduled(ctx context.Context, tx store.Store, scheduled database.ScheduledChirp) (database.Chirp, database.Chirp, error) {
+
+	verdict, err := s.validate(scheduled.Body)
+	if err != nil {
+		return database.Chirp{}, database.Chirp{}, err
+	}
+
+	parent, err := s.replyParent(ctx, scheduled.UserID, scheduled.ReplyToID)
+	if err != nil {
+		return database.Chirp{}, database.Chirp{}, err
+	}
+
+	chirp, err := s.insert(ctx, tx, scheduled.UserID, verdict, scheduled.ReplyToID)
+	if err != nil {
+		return database.Chirp{}, database.Chirp{}, err
+	}
+
+	return chirp, parent, nil
+}
+
+// The message shown to the author, with the fields that failed validation
+func failureReason(err *apierror.Error) string {
+
+	if len(err.Fields) == 0 {
+		return err.Message
+	}
+
+	reasons := make([]string, len(err.Fields))
+	for i, f := range err.Fields {
+		reasons[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// PublishEvery runs PublishDue every interval until ctx is cancelled
+func (s *ChirpService) PublishEvery(ctx context.Context, interval time.Duration, published func(ctx context.Context, chirp database.Chirp)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PublishDue(ctx, published)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Publishing scheduled chirps failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Published %d scheduled chirps", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/seed"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// SeedPassword is the password of every seeded user
+const SeedPassword = "chirpy-seed"
+
+// SeedResult counts what was created
+type SeedResult struct {
+	Users   int
+	Chirps  int
+	Follows int
+}
+
+// SeedService writes a seed.Dataset through the store. It skips the chirp moderation and the
+// signup validation, the generated data is known to be clean.
+type SeedService struct {
+	store store.Store
+}
+
+func NewSeedService(s store.Store) *SeedService {
+	return &SeedService{store: s}
+}
+
+// Seed generates the dataset for opts and stores it. Seeding the same options twice conflicts
+// on the emails, reset first to rebuild a demo.
+func (s *SeedService) Seed(ctx context.Context, opts seed.Options) (SeedResult, error) {
+
+	if problems := opts.Problems(); len(problems) > 0 {
+		fields := make([]apierror.FieldError, len(problems))
+		for i, p := range problems {
+			fields[i] = apierror.FieldError{Field: p.Field, Message: p.Message}
+		}
+		return SeedResult{}, apierror.Validation(fields...)
+	}
+
+	data := seed.Generate(opts)
+
+	// Hashed once, bcrypt is deliberately slow and every user shares the password
+	hashed, err := auth.HashedPassword(SeedPassword)
+	if err != nil {
+		return SeedResult{}, apierror.Internal(fmt.Errorf("HashedPassword: %w", err))
+	}
+
+	ids := make([]uuid.UUID, len(data.Users))
+
+	for i, u := range data.Users {
+		created, err := s.store.CreateUser(ctx, database.CreateUserParams{
+			Email:          u.Email,
+			HashedPassword: hashed,
+			Handle:         u.Handle,
+		})
+
+		if database.IsUniqueViolation(err) {
+			return SeedResult{}, apierror.Conflict(fmt.Sprintf("User %s already exists, reset before seeding again", u.Email))
+		}
+
+		if err != nil {
+			return SeedResult{}, apierror.Internal(fmt.Errorf("CreateUser: %w", err))
+		}
+
+		err = s.store.UpdateUser(ctx, database.UpdateUserParams{
+			ID:             created.ID,
+			Email:          u.Email,
+			HashedPassword: hashed,
+			Handle:         u.Handle,
+			DisplayName:    u.DisplayName,
+			Bio:            u.Bio,
+			Location:       u.Location,
+		})
+
+		if err != nil {
+			return SeedResult{}, apierror.Internal(fmt.Errorf("UpdateUser: %w", err))
+		}
+
+		ids[i] = created.ID
+	}
+
+	for _, f := range data.Follows {
+		err := s.store.CreateFollow(ctx, database.CreateFollowParams{
+			FollowerID: ids[f.Follower],
+			FolloweeID: ids[f.Followee],
+		})
+
+		if err != nil {
+			return SeedResult{}, apierror.Internal(fmt.Errorf("CreateFollow: %w", err))
+		}
+	}
+
+	for _, c := range data.Chirps {
+		_, err := s.store.CreateChirp(ctx, database.CreateChirpParams{
+			Body:   c.Body,
+			UserID: ids[c.Author],
+		})
+
+		if err != nil {
+			return SeedResult{}, apierror.Internal(fmt.Errorf("CreateChirp: %w", err))
+		}
+	}
+
+	return SeedResult{
+		Users:   len(data.Users),
+		Chirps:  len(data.Chirps),
+		Follows: len(data.Follows),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/store"
+	"github.com/itsmandrew/server-go/internal/stream"
+)
+
+// TimelineHome limits the stream to the viewer and the users they follow
+const TimelineHome = "home"
+
+// StreamQuery is what a client asks /api/stream for, every field is optional
+type StreamQuery struct {
+	// Author is a user ID or a handle
+	Author   string
+	Tag      string
+	Timeline string
+}
+
+// StreamService turns a StreamQuery into the filter the hub applies. Follows, blocks and mutes are
+// read when the client connects, changes apply from its next reconnect.
+type StreamService struct {
+	store store.Store
+}
+
+func NewStreamService(s store.Store) *StreamService {
+	return &StreamService{store: s}
+}
+
+// Filter builds the filter for viewerID, the home timeline requires a signed in viewer
+func (s *StreamService) Filter(ctx context.Context, viewerID uuid.NullUUID, q StreamQuery) (stream.Filter, error) {
+
+	filter := stream.Filter{Tag: stream.NormalizeTag(q.Tag)}
+
+	switch q.Timeline {
+	case "":
+	case TimelineHome:
+		if !viewerID.Valid {
+			return stream.Filter{}, apierror.Unauthorized(apierror.CodeUnauthorized, "The home timeline requires signing in")
+		}
+
+		followees, err := s.store.ListFolloweeIDs(ctx, viewerID.UUID)
+		if err != nil {
+			return stream.Filter{}, apierror.Internal(fmt.Errorf("ListFolloweeIDs: %w", err))
+		}
+
+		filter.Authors = map[uuid.UUID]bool{viewerID.UUID: true}
+		for _, id := range followees {
+			filter.Authors[id] = true
+		}
+	default:
+		return stream.Filter{}, apierror.Validation(apierror.FieldError{
+			Field:   "timeline",
+			Message: fmt.Sprintf("must be %s", TimelineHome),
+		})
+	}
+
+	if q.Author != "" {
+		authorID, err := s.resolveAuthor(ctx, q.Author)
+		if err != nil {
+			return stream.Filter{}, err
+		}
+
+		// Combined with the home timeline, only that author if they are on it
+		if filter.Authors == nil || filter.Authors[authorID] {
+			filter.Authors = map[uuid.UUID]bool{authorID: true}
+		} else {
+			filter.Authors = map[uuid.UUID]bool{}
+		}
+	}
+
+	if viewerID.Valid {
+		hidden, err := s.hiddenAuthors(ctx, viewerID.UUID)
+		if err != nil {
+			return stream.Filter{}, err
+		}
+		filter.Hidden = hidden
+	}
+
+	return filter, nil
+}
+
+// Accepts an ID or a handle, with or without the @
+func (s *StreamService) resolveAuthor(ctx context.Context, author string) (uuid.UUID, error) {
+
+	if id, err := uuid.Parse(author); err == nil {
+		return id, nil
+	}
+
+	profile, err := s.store.GetUserProfileByHandle(ctx, strings.TrimPrefix(author, "@"))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, apierror.NotFound("Author not found")
+	}
+
+	if err != nil {
+		return uuid.Nil, apierror.Internal(fmt.Errorf("GetUserProfileByHandle: %w", err))
+	}
+
+	return profile.ID, nil
+}
+
+// Same rule as the chirp list: nothing from users who blocked the viewer or who the viewer muted
+func (s *StreamService) hiddenAuthors(ctx context.Context, viewerID uuid.UUID) (map[uuid.UUID]bool, error) {
+
+	blockers, err := s.store.ListBlockerIDs(ctx, viewerID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListBlockerIDs: %w", err))
+	}
+
+	mutes, err := s.store.ListMutes(ctx, viewerID)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListMutes: %w", err))
+	}
+
+	hidden := map[uuid.UUID]bool{}
+	for _, id := range blockers {
+		hidden[id] = true
+	}
+	for _, m := range mutes {
+		hidden[m.MutedID] = true
+	}
+
+	return hidden, nil
+}
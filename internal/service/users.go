@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/auth"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/store"
+)
+
+// bcrypt refuses anything longer
+const maxPasswordBytes = 72
+
+// Unique index on lower(handle), see sql/schema/010_profiles.sql
+const handleConstraint = "users_handle_lower_key"
+
+// How many generated handles Create tries before giving up
+const maxHandleAttempts = 5
+
+// UserService owns signup and account updates
+type UserService struct {
+	store store.Store
+}
+
+func NewUserService(s store.Store) *UserService {
+	return &UserService{store: s}
+}
+
+// Create hashes the password and stores a new user, a taken email or handle is a 409. Without a
+// handle one is derived from the email.
+func (s *UserService) Create(ctx context.Context, email, password, handle string) (database.CreateUserRow, error) {
+
+	fields := credentialErrors(email, password)
+	if handle != "" {
+		fields = append(fields, handleErrors(handle)...)
+	}
+
+	if len(fields) > 0 {
+		return database.CreateUserRow{}, apierror.Validation(fields...)
+	}
+
+	hashedPassword, err := auth.HashedPassword(password)
+	if err != nil {
+		return database.CreateUserRow{}, apierror.Internal(fmt.Errorf("hashing password: %w", err))
+	}
+
+	return s.create(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Handle:         handle,
+	}, nil)
+}
+
+// CreateWithoutPassword stores a user who signs in some other way, with a handle derived from the
+// email. The empty hashed_password matches no password until the user sets one. link runs in the
+// transaction that inserts the user, so the user never exists without what it records.
+func (s *UserService) CreateWithoutPassword(ctx context.Context, email string, link func(tx store.Store, userID uuid.UUID) error) (database.CreateUserRow, error) {
+
+	if fields := emailErrors(email); len(fields) > 0 {
+		return database.CreateUserRow{}, apierror.Validation(fields...)
+	}
+
+	return s.create(ctx, database.CreateUserParams{Email: email}, link)
+}
+
+func (s *UserService) create(ctx context.Context, params database.CreateUserParams, link func(tx store.Store, userID uuid.UUID) error) (database.CreateUserRow, error) {
+
+	if params.Handle != "" {
+		user, err := s.createUser(ctx, params, link)
+		return user, createUserError(err)
+	}
+
+	// The first candidate is the email's local part, the rest add a random suffix. Every attempt
+	// is its own transaction, a unique violation aborts the one it happens in.
+	for attempt := range maxHandleAttempts {
+		params.Handle = generateHandle(params.Email, attempt)
+
+		user, err := s.createUser(ctx, params, link)
+		if database.IsUniqueViolationOf(err, handleConstraint) {
+			continue
+		}
+		return user, createUserError(err)
+	}
+
+	return database.CreateUserRow{}, apierror.Internal(fmt.Errorf("no free handle for %s after %d attempts", params.Email, maxHandleAttempts))
+}
+
+// Stores the user and its user.registered event together
+func (s *UserService) createUser(ctx context.Context, params database.CreateUserParams, link func(tx store.Store, userID uuid.UUID) error) (database.CreateUserRow, error) {
+
+	var user database.CreateUserRow
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		var err error
+		user, err = tx.CreateUser(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		if link != nil {
+			if err := link(tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		return events.Record(ctx, tx, events.UserRegistered, events.UserRegisteredPayload{
+			UserID: user.ID,
+			Handle: user.Handle,
+		})
+	})
+
+	return user, err
+}
+
+func createUserError(err error) error {
+
+	if database.IsUniqueViolationOf(err, handleConstraint) {
+		return apierror.Conflict("This handle is taken")
+	}
+
+	if database.IsUniqueViolation(err) {
+		return apierror.Conflict("A user with this email already exists")
+	}
+
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("CreateUser: %w", err))
+	}
+
+	return nil
+}
+
+// UserUpdate is a partial update of the caller's account, nil fields are left as they are
+type UserUpdate struct {
+	Email       *string
+	Password    *string
+	Handle      *string
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+}
+
+func (u UserUpdate) empty() bool {
+	return u.Email == nil && u.Password == nil && u.Handle == nil &&
+		u.DisplayName == nil && u.Bio == nil && u.Location == nil && u.Website == nil
+}
+
+// Update applies the fields set in update to the user, returning the updated user
+func (s *UserService) Update(ctx context.Context, userID uuid.UUID, update UserUpdate) (database.GetUserByIDNoPasswordRow, error) {
+
+	if update.empty() {
+		return database.GetUserByIDNoPasswordRow{}, apierror.BadRequest(apierror.CodeBadRequest, "Nothing to update")
+	}
+
+	if err := validateUpdate(update); err != nil {
+		return database.GetUserByIDNoPasswordRow{}, err
+	}
+
+	user, err := s.store.GetUserByID(ctx, userID)
+
+	// The token outlived its user
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.GetUserByIDNoPasswordRow{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("GetUserByID: %w", err))
+	}
+
+	params := database.UpdateUserParams{
+		ID:             user.ID,
+		Email:          valueOr(update.Email, user.Email),
+		HashedPassword: user.HashedPassword,
+		Handle:         valueOr(update.Handle, user.Handle),
+		DisplayName:    valueOr(update.DisplayName, user.DisplayName),
+		Bio:            valueOr(update.Bio, user.Bio),
+		Location:       valueOr(update.Location, user.Location),
+		Website:        valueOr(update.Website, user.Website),
+	}
+
+	if update.Password != nil {
+		params.HashedPassword, err = auth.HashedPassword(*update.Password)
+		if err != nil {
+			return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("hashing password: %w", err))
+		}
+	}
+
+	err = s.store.InTx(ctx, func(tx store.Store) error {
+		if err := tx.UpdateUser(ctx, params); err != nil {
+			return err
+		}
+
+		// Links sent to the old address must not verify the new one
+		if params.Email != user.Email {
+			return tx.InvalidateMagicLinks(ctx, user.ID)
+		}
+		return nil
+	})
+
+	if database.IsUniqueViolationOf(err, handleConstraint) {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Conflict("This handle is taken")
+	}
+
+	if database.IsUniqueViolation(err) {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Conflict("A user with this email already exists")
+	}
+
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("UpdateUser: %w", err))
+	}
+
+	return s.Me(ctx, userID)
+}
+
+// Me returns the caller's own account, the only place the email is shown
+func (s *UserService) Me(ctx context.Context, userID uuid.UUID) (database.GetUserByIDNoPasswordRow, error) {
+
+	user, err := s.store.GetUserByIDNoPassword(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.GetUserByIDNoPasswordRow{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	return user, nil
+}
+
+// Profile looks up the public profile behind a handle, ignoring case
+func (s *UserService) Profile(ctx context.Context, handle string) (database.GetUserProfileByHandleRow, error) {
+
+	profile, err := s.store.GetUserProfileByHandle(ctx, strings.TrimPrefix(handle, "@"))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.GetUserProfileByHandleRow{}, apierror.NotFound("User not found")
+	}
+
+	if err != nil {
+		return database.GetUserProfileByHandleRow{}, apierror.Internal(fmt.Errorf("GetUserProfileByHandle: %w", err))
+	}
+
+	return profile, nil
+}
+
+// Summaries loads the handle and display name of every user in ids with a single query
+func (s *UserService) Summaries(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]database.GetUserSummariesRow, error) {
+
+	summaries := make(map[uuid.UUID]database.GetUserSummariesRow, len(ids))
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := s.store.GetUserSummaries(ctx, ids)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("GetUserSummaries: %w", err))
+	}
+
+	for _, row := range rows {
+		summaries[row.ID] = row
+	}
+
+	return summaries, nil
+}
+
+// SetRole changes the role of a user, it shows up in their access token from the next refresh
+func (s *UserService) SetRole(ctx context.Context, actorID, userID uuid.UUID, role string) (database.GetUserByIDNoPasswordRow, error) {
+
+	parsed, err := auth.ParseRole(role)
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Validation(apierror.FieldError{
+			Field:   "role",
+			Message: fmt.Sprintf("must be one of %s, %s, %s", auth.RoleUser, auth.RoleModerator, auth.RoleAdmin),
+		})
+	}
+
+	// Keeps an admin from locking everyone out by demoting themselves
+	if actorID == userID {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Conflict("You can't change your own role")
+	}
+
+	updated, err := s.store.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+		ID:   userID,
+		Role: string(parsed),
+	})
+
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("UpdateUserRole: %w", err))
+	}
+
+	if updated == 0 {
+		return database.GetUserByIDNoPasswordRow{}, apierror.NotFound("User not found")
+	}
+
+	user, err := s.store.GetUserByIDNoPassword(ctx, userID)
+	if err != nil {
+		return database.GetUserByIDNoPasswordRow{}, apierror.Internal(fmt.Errorf("GetUserByIDNoPassword: %w", err))
+	}
+
+	return user, nil
+}
+
+// UpgradeToChirpyRed gives the user Chirpy Red and records the user.upgraded event with it.
+// Upgrading twice is harmless, the flag just stays set.
+func (s *UserService) UpgradeToChirpyRed(ctx context.Context, userID uuid.UUID) error {
+
+	err := s.store.InTx(ctx, func(tx store.Store) error {
+		n, err := tx.UpdateIsChirpyRedByID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("UpdateIsChirpyRedByID: %w", err)
+		}
+
+		if n == 0 {
+			return apierror.NotFound("User not found")
+		}
+
+		return events.Record(ctx, tx, events.UserUpgraded, events.UserUpgradedPayload{UserID: userID})
+	})
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	return nil
+}
+
+// PromoteFirstAdmin bootstraps a fresh install, once there is an admin the rest are promoted through the API
+func (s *UserService) PromoteFirstAdmin(ctx context.Context, email string) (database.User, error) {
+
+	admins, err := s.store.CountUsersByRole(ctx, string(auth.RoleAdmin))
+	if err != nil {
+		return database.User{}, fmt.Errorf("CountUsersByRole: %w", err)
+	}
+
+	if admins > 0 {
+		return database.User{}, errors.New("an admin already exists, use PUT /admin/users/{userID}/role instead")
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("no user with email %s, sign up first", email)
+	}
+
+	if err != nil {
+		return database.User{}, fmt.Errorf("GetUserByEmail: %w", err)
+	}
+
+	if _, err := s.store.UpdateUserRole(ctx, database.UpdateUserRoleParams{ID: user.ID, Role: string(auth.RoleAdmin)}); err != nil {
+		return database.User{}, fmt.Errorf("UpdateUserRole: %w", err)
+	}
+
+	user.Role = string(auth.RoleAdmin)
+	return user, nil
+}
+
+// Validates the email / password pair sent on signup and login
+func validateCredentials(email, password string) error {
+	if fields := credentialErrors(email, password); len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+func credentialErrors(email, password string) []apierror.FieldError {
+	return append(emailErrors(email), passwordErrors(password)...)
+}
+
+func emailErrors(email string) []apierror.FieldError {
+	if strings.TrimSpace(email) == "" {
+		return []apierror.FieldError{{Field: "email", Message: "is required"}}
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return []apierror.FieldError{{Field: "email", Message: "must be a valid email address"}}
+	}
+	return nil
+}
+
+func passwordErrors(password string) []apierror.FieldError {
+	if password == "" {
+		return []apierror.FieldError{{Field: "password", Message: "is required"}}
+	}
+	if len(password) > maxPasswordBytes {
+		return []apierror.FieldError{{Field: "password", Message: fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)}}
+	}
+	return nil
+}
+
+func valueOr(field *string, current string) string {
+	if field == nil {
+		return current
+	}
+	return *field
+}
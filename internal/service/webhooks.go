@@ -0,0 +1,532 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/apierror"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/internal/events"
+	"github.com/itsmandrew/server-go/internal/store"
+	"github.com/itsmandrew/server-go/internal/webhook"
+)
+
+// Delivery statuses, a failed attempt leaves the delivery pending until the attempts run out
+const (
+	WebhookPending   = "pending"
+	WebhookSucceeded = "succeeded"
+	WebhookDead      = "dead"
+)
+
+var webhookStatuses = []string{WebhookPending, WebhookSucceeded, WebhookDead}
+
+const (
+	DefaultWebhookDeliveryPageSize = 50
+	MaxWebhookDeliveryPageSize     = 100
+)
+
+const (
+	maxWebhookURLLength         = 2048
+	maxWebhookDescriptionLength = 200
+
+	// Deliveries claimed per round, they are sent one after the other
+	webhookBatchSize = 10
+
+	// The retry delay doubles up to this
+	maxWebhookRetryDelay = 6 * time.Hour
+
+	// How much of the receiver's response goes into the delivery log
+	maxLoggedResponseBytes = 1024
+
+	webhookUserAgent = "Chirpy-Webhooks/1.0"
+)
+
+// WebhookConfig controls the outgoing deliveries
+type WebhookConfig struct {
+	// Per request, a slower receiver counts as a failed attempt
+	Timeout time.Duration
+	// Attempts before a delivery is dead, a redelivery starts over
+	MaxAttempts int
+	// Wait before the first retry, doubled on every later one
+	RetryDelay time.Duration
+}
+
+// WebhookService manages the partner webhooks and delivers the domain events to them. Events
+// arrive through HandleEvent, subscribed to the events.Dispatcher, and are sent by DeliverDue.
+type WebhookService struct {
+	store  store.Store
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func NewWebhookService(s store.Store, cfg WebhookConfig) *WebhookService {
+	return &WebhookService{
+		store: s,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect is a misconfigured endpoint, following it would hand the payload to someone else
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// WebhookInput registers a webhook, no events means every event type
+type WebhookInput struct {
+	URL         string
+	Description string
+	Events      []string
+}
+
+// WebhookUpdate is a partial update, nil fields are left as they are
+type WebhookUpdate struct {
+	URL         *string
+	Description *string
+	Events      *[]string
+	Active      *bool
+}
+
+// Create registers a webhook with a new signing secret, which is only returned here
+func (s *WebhookService) Create(ctx context.Context, in WebhookInput) (database.Webhook, error) {
+
+	eventTypes, fields := webhookErrors(in.URL, in.Description, in.Events)
+	if len(fields) > 0 {
+		return database.Webhook{}, apierror.Validation(fields...)
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return database.Webhook{}, apierror.Internal(fmt.Errorf("generating webhook secret: %w", err))
+	}
+
+	row, err := s.store.CreateWebhook(ctx, database.CreateWebhookParams{
+		Url:         strings.TrimSpace(in.URL),
+		Description: strings.TrimSpace(in.Description),
+		EventTypes:  eventTypes,
+		Secret:      secret,
+	})
+
+	if err != nil {
+		return database.Webhook{}, apierror.Internal(fmt.Errorf("CreateWebhook: %w", err))
+	}
+
+	return row, nil
+}
+
+func (s *WebhookService) List(ctx context.Context) ([]database.Webhook, error) {
+	webhooks, err := s.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListWebhooks: %w", err))
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) Get(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+
+	row, err := s.store.GetWebhook(ctx, id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Webhook{}, apierror.NotFound("Webhook not found")
+	}
+
+	if err != nil {
+		return database.Webhook{}, apierror.Internal(fmt.Errorf("GetWebhook: %w", err))
+	}
+
+	return row, nil
+}
+
+// Update changes the URL, description, event filter or active flag. Deliveries of an inactive
+// webhook are held back and sent once it is active again.
+func (s *WebhookService) Update(ctx context.Context, id uuid.UUID, update WebhookUpdate) (database.Webhook, error) {
+
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return database.Webhook{}, err
+	}
+
+	params := database.UpdateWebhookParams{
+		ID:          id,
+		Url:         strings.TrimSpace(valueOr(update.URL, current.Url)),
+		Description: strings.TrimSpace(valueOr(update.Description, current.Description)),
+		EventTypes:  current.EventTypes,
+		Active:      current.Active,
+	}
+
+	requested := current.EventTypes
+	if update.Events != nil {
+		requested = *update.Events
+	}
+
+	eventTypes, fields := webhookErrors(params.Url, params.Description, requested)
+	if len(fields) > 0 {
+		return database.Webhook{}, apierror.Validation(fields...)
+	}
+	params.EventTypes = eventTypes
+
+	if update.Active != nil {
+		params.Active = *update.Active
+	}
+
+	row, err := s.store.UpdateWebhook(ctx, params)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Webhook{}, apierror.NotFound("Webhook not found")
+	}
+
+	if err != nil {
+		return database.Webhook{}, apierror.Internal(fmt.Errorf("UpdateWebhook: %w", err))
+	}
+
+	return row, nil
+}
+
+// Delete removes the webhook along with its deliveries and their log
+func (s *WebhookService) Delete(ctx context.Context, id uuid.UUID) error {
+
+	deleted, err := s.store.DeleteWebhook(ctx, id)
+	if err != nil {
+		return apierror.Internal(fmt.Errorf("DeleteWebhook: %w", err))
+	}
+
+	if deleted == 0 {
+		return apierror.NotFound("Webhook not found")
+	}
+
+	return nil
+}
+
+// Deliveries lists the webhook's most recent deliveries, optionally only those with status
+func (s *WebhookService) Deliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]database.WebhookDelivery, error) {
+
+	var fields []apierror.FieldError
+
+	if status != "" && !slices.Contains(webhookStatuses, status) {
+		fields = append(fields, apierror.FieldError{Field: "status", Message: "must be one of " + strings.Join(webhookStatuses, ", ")})
+	}
+
+	if limit < 1 || limit > MaxWebhookDeliveryPageSize {
+		fields = append(fields, apierror.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxWebhookDeliveryPageSize)})
+	}
+
+	if len(fields) > 0 {
+		return nil, apierror.Validation(fields...)
+	}
+
+	if _, err := s.Get(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.store.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{
+		WebhookID: webhookID,
+		Status:    status,
+		RowLimit:  int32(limit),
+	})
+
+	if err != nil {
+		return nil, apierror.Internal(fmt.Errorf("ListWebhookDeliveries: %w", err))
+	}
+
+	return deliveries, nil
+}
+
+// Delivery returns one delivery with its log, oldest attempt first
+func (s *WebhookService) Delivery(ctx context.Context, webhookID, deliveryID uuid.UUID) (database.WebhookDelivery, []database.WebhookDeliveryAttempt, error) {
+
+	delivery, err := s.store.GetWebhookDelivery(ctx, database.GetWebhookDeliveryParams{ID: deliveryID, WebhookID: webhookID})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.WebhookDelivery{}, nil, apierror.NotFound("Delivery not found")
+	}
+
+	if err != nil {
+		return database.WebhookDelivery{}, nil, apierror.Internal(fmt.Errorf("GetWebhookDelivery: %w", err))
+	}
+
+	attempts, err := s.store.ListWebhookDeliveryAttempts(ctx, deliveryID)
+	if err != nil {
+		return database.WebhookDelivery{}, nil, apierror.Internal(fmt.Errorf("ListWebhookDeliveryAttempts: %w", err))
+	}
+
+	return delivery, attempts, nil
+}
+
+// Redeliver queues the delivery again right away with a fresh set of attempts, whatever its
+// status. The receiver gets the same payload and delivery ID, with a new timestamp.
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (database.WebhookDelivery, error) {
+
+	delivery, err := s.store.RedeliverWebhookDelivery(ctx, database.RedeliverWebhookDeliveryParams{ID: deliveryID, WebhookID: webhookID})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.WebhookDelivery{}, apierror.NotFound("Delivery not found")
+	}
+
+	if err != nil {
+		return database.WebhookDelivery{}, apierror.Internal(fmt.Errorf("RedeliverWebhookDelivery: %w", err))
+	}
+
+	return delivery, nil
+}
+
+// The body partners receive, the same for every attempt
+type webhookPayload struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// HandleEvent queues a delivery of e for every webhook that takes it, subscribe it to the
+// events.Dispatcher. A second copy of the same event is ignored.
+func (s *WebhookService) HandleEvent(ctx context.Context, e events.Event) error {
+
+	webhooks, err := s.store.ListWebhooksForEvent(ctx, database.ListWebhooksForEventParams{
+		EventType:  e.Type,
+		OccurredAt: e.OccurredAt,
+	})
+
+	if err != nil {
+		return fmt.Errorf("ListWebhooksForEvent: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		ID:         e.ID,
+		Type:       e.Type,
+		OccurredAt: e.OccurredAt,
+		Data:       e.Payload,
+	})
+
+	if err != nil {
+		return fmt.Errorf("encoding webhook payload: %w", err)
+	}
+
+	for _, w := range webhooks {
+		err := s.store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			WebhookID: w.ID,
+			EventID:   e.ID,
+			EventType: e.Type,
+			Payload:   payload,
+		})
+
+		// Deleted since it was listed
+		if database.IsForeignKeyViolation(err) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("CreateWebhookDelivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DeliverEvery runs DeliverDue every interval until ctx is cancelled
+func (s *WebhookService) DeliverEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keeps going while full batches come back
+			for ctx.Err() == nil {
+				n, err := s.DeliverDue(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Webhook delivery failed: %v", err)
+				}
+				if err != nil || n < webhookBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DeliverDue claims a batch of due deliveries and sends them, returning how many were claimed
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+
+	// Long enough for every request of the batch to time out
+	lease := s.cfg.Timeout*webhookBatchSize + time.Minute
+
+	deliveries, err := s.store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseMs:   int32(lease.Milliseconds()),
+		BatchSize: webhookBatchSize,
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("ClaimWebhookDeliveries: %w", err)
+	}
+
+	for _, d := range deliveries {
+		if err := s.deliver(ctx, d); err != nil {
+			return len(deliveries), err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// One attempt at d, logged and recorded on the delivery
+func (s *WebhookService) deliver(ctx context.Context, d database.WebhookDelivery) error {
+
+	w, err := s.store.GetWebhook(ctx, d.WebhookID)
+
+	// Deleted since the claim, the delivery went with it
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("GetWebhook: %w", err)
+	}
+
+	started := time.Now().UTC()
+	statusCode, responseBody, sendErr := s.send(ctx, w, d)
+
+	// Shutting down, the lease runs out and the attempt is made again
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	attempt := database.CreateWebhookDeliveryAttemptParams{
+		DeliveryID:   d.ID,
+		AttemptedAt:  started,
+		DurationMs:   int32(time.Since(started).Milliseconds()),
+		StatusCode:   sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+		ResponseBody: responseBody,
+	}
+
+	result := database.UpdateWebhookDeliveryResultParams{
+		ID:             d.ID,
+		Status:         WebhookSucceeded,
+		NextAttemptAt:  started,
+		LastStatusCode: attempt.StatusCode,
+		DeliveredAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}
+
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+		result.LastError = attempt.Error
+		result.DeliveredAt = sql.NullTime{}
+
+		if int(d.Attempts)+1 >= s.cfg.MaxAttempts {
+			result.Status = WebhookDead
+			log.Printf("Webhook delivery %v to %s is dead after %d attempts: %v", d.ID, w.Url, d.Attempts+1, sendErr)
+		} else {
+			result.Status = WebhookPending
+			result.NextAttemptAt = time.Now().UTC().Add(s.retryDelay(int(d.Attempts)))
+		}
+	}
+
+	if err := s.store.CreateWebhookDeliveryAttempt(ctx, attempt); err != nil {
+		return fmt.Errorf("CreateWebhookDeliveryAttempt: %w", err)
+	}
+
+	if err := s.store.UpdateWebhookDeliveryResult(ctx, result); err != nil {
+		return fmt.Errorf("UpdateWebhookDeliveryResult: %w", err)
+	}
+
+	return nil
+}
+
+// POSTs the signed payload, anything but a 2xx is an error. Returns the status code (0 without
+// a response) and the start of the response body.
+func (s *WebhookService) send(ctx context.Context, w database.Webhook, d database.WebhookDelivery) (int, string, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set(webhook.EventHeader, d.EventType)
+	req.Header.Set(webhook.DeliveryHeader, d.ID.String())
+	webhook.SetHeaders(req.Header, w.Secret, time.Now(), d.Payload)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(body), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, string(body), nil
+}
+
+// RetryDelay doubled for every earlier attempt, capped at maxWebhookRetryDelay
+func (s *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := s.cfg.RetryDelay
+	for range attempts {
+		delay *= 2
+		if delay >= maxWebhookRetryDelay {
+			return maxWebhookRetryDelay
+		}
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
+
+// Validates a webhook, returning the event types deduplicated and sorted
+func webhookErrors(rawURL, description string, eventTypes []string) ([]string, []apierror.FieldError) {
+
+	var fields []apierror.FieldError
+
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+
+	switch {
+	case rawURL == "":
+		fields = append(fields, apierror.FieldError{Field: "url", Message: "is required"})
+	case len(rawURL) > maxWebhookURLLength:
+		fields = append(fields, apierror.FieldError{Field: "url", Message: fmt.Sprintf("must be at most %d characters", maxWebhookURLLength)})
+	case err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "":
+		fields = append(fields, apierror.FieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	}
+
+	if len(strings.TrimSpace(description)) > maxWebhookDescriptionLength {
+		fields = append(fields, apierror.FieldError{Field: "description", Message: fmt.Sprintf("must be at most %d characters", maxWebhookDescriptionLength)})
+	}
+
+	types := []string{}
+	for _, t := range eventTypes {
+		if !slices.Contains(events.Types, t) {
+			fields = append(fields, apierror.FieldError{
+				Field:   "events",
+				Message: fmt.Sprintf("unknown event type %q, must be one of %s", t, strings.Join(events.Types, ", ")),
+			})
+			continue
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	slices.Sort(types)
+
+	return types, fields
+}
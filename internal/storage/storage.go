@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage holds uploaded files under slash separated keys such as "avatars/<userID>/<id>/large.jpg"
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Delete is a no-op for keys that don't exist
+	Delete(ctx context.Context, key string) error
+	// URL is where clients fetch the file from
+	URL(key string) string
+}
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Rejects keys that could escape the storage root once joined to a path
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "../") && key != ".."
+}
+
+// Local keeps files on disk under root, they are served by Handler at baseURL
+type Local struct {
+	root    string
+	baseURL string
+}
+
+var _ Storage = (*Local)(nil)
+
+// NewLocal creates root if needed, baseURL is the path Handler is mounted at, e.g. "/app/media/"
+func NewLocal(root, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("creating media directory: %w", err)
+	}
+	return &Local{root: root, baseURL: strings.TrimSuffix(baseURL, "/") + "/"}, nil
+}
+
+// Put writes to a temporary file first so readers never see a partial upload
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+
+	if !validKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	dst := filepath.Join(l.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+
+	if !validKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	err := os.Remove(filepath.Join(l.root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + key
+}
+
+// Handler serves the stored files, requests are relative to baseURL (wrap it in http.StripPrefix).
+// Directories are never listed.
+func (l *Local) Handler() http.Handler {
+	files := http.FileServer(http.Dir(l.root))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
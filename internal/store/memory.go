@@ -0,0 +1,937 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/lib/pq"
+)
+
+// Memory is an in-process Store for tests and local hacking. It mimics the Postgres behaviour
+// the services rely on: sql.ErrNoRows for missing rows, *pq.Error for constraint violations
+// and ON DELETE CASCADE from users.
+type Memory struct {
+	mu sync.RWMutex
+	// Serializes InTx, see memory_tx.go
+	txMu sync.Mutex
+
+	users         map[uuid.UUID]database.User
+	chirps        []database.Chirp
+	refreshTokens map[string]database.RefreshToken
+	apiKeys       []database.ApiKey
+	oauthClients  []database.OauthClient
+	oauthCodes    []database.OauthAuthorizationCode
+
+	identities      []database.UserIdentity
+	oidcLoginStates []database.OidcLoginState
+	magicLinks      []database.MagicLink
+	// Not tied to users, so DeleteUsers leaves them like TRUNCATE users CASCADE does
+	magicLinkRequests []database.MagicLinkRequest
+
+	drafts          []database.Draft
+	scheduledChirps []database.ScheduledChirp
+
+	polls       []database.Poll
+	pollOptions []database.PollOption
+	pollVoters  []database.PollVoter
+	pollVotes   []database.PollVote
+
+	moderationRules []database.ModerationRule
+	moderationFlags []database.ModerationFlag
+
+	reports           []database.Report
+	moderationActions []database.ModerationAction
+
+	blocks  []database.Block
+	mutes   []database.Mute
+	follows []database.Follow
+
+	likes     []database.Like
+	bookmarks []database.Bookmark
+
+	lists       []database.List
+	listMembers []database.ListMember
+
+	notifications           []database.Notification
+	notificationActors      []database.NotificationActor
+	notificationPreferences []database.NotificationPreference
+
+	outbox []database.Outbox
+
+	webhooks                []database.Webhook
+	webhookDeliveries       []database.WebhookDelivery
+	webhookDeliveryAttempts []database.WebhookDeliveryAttempt
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:         map[uuid.UUID]database.User{},
+		refreshTokens: map[string]database.RefreshToken{},
+	}
+}
+
+// Same errors lib/pq hands back, so database.IsUniqueViolation works on both stores
+func uniqueViolation(constraint string) error {
+	return &pq.Error{Code: "23505", Constraint: constraint, Message: "duplicate key value violates unique constraint"}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{Code: "23503", Constraint: constraint, Message: "insert or update violates foreign key constraint"}
+}
+
+func checkViolation(constraint string) error {
+	return &pq.Error{Code: "23514", Constraint: constraint, Message: "new row violates check constraint"}
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// There is no schema to migrate, so nothing is ever pending
+func (m *Memory) MigrationStatus(ctx context.Context) (MigrationStatus, error) {
+	return MigrationStatus{}, nil
+}
+
+func (m *Memory) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// Handles are unique on lower(handle)
+func (m *Memory) handleTaken(handle string, except uuid.UUID) bool {
+	for _, u := range m.users {
+		if strings.EqualFold(u.Handle, handle) && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return database.CreateUserRow{}, uniqueViolation("users_email_key")
+	}
+
+	if m.handleTaken(arg.Handle, uuid.Nil) {
+		return database.CreateUserRow{}, uniqueViolation("users_handle_lower_key")
+	}
+
+	ts := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      ts,
+		UpdatedAt:      ts,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+		Handle:         arg.Handle,
+	}
+	m.users[user.ID] = user
+
+	return database.CreateUserRow{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		Role:      user.Role,
+		Handle:    user.Handle,
+	}, nil
+}
+
+// TRUNCATE users CASCADE takes every dependent row with it
+func (m *Memory) DeleteUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.users)
+	clear(m.refreshTokens)
+	m.apiKeys = nil
+	m.oauthClients = nil
+	m.oauthCodes = nil
+	m.identities = nil
+	m.magicLinks = nil
+	m.chirps = nil
+	m.drafts = nil
+	m.scheduledChirps = nil
+	m.polls = nil
+	m.pollOptions = nil
+	m.pollVoters = nil
+	m.pollVotes = nil
+	m.moderationFlags = nil
+	m.reports = nil
+	m.moderationActions = nil
+	m.blocks = nil
+	m.mutes = nil
+	m.follows = nil
+	m.likes = nil
+	m.bookmarks = nil
+	m.lists = nil
+	m.listMembers = nil
+	m.notifications = nil
+	m.notificationActors = nil
+	m.notificationPreferences = nil
+
+	return nil
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return nil
+	}
+
+	u.DeletionScheduledAt = arg.DeletionScheduledAt
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+func (m *Memory) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	u.DeletionScheduledAt = sql.NullTime{}
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+// Walks every table with a foreign key to users, the way ON DELETE CASCADE / SET NULL would
+func (m *Memory) DeleteDueUsers(ctx context.Context, due sql.NullTime) ([]database.DeleteDueUsersRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted []database.DeleteDueUsersRow
+	gone := map[uuid.UUID]bool{}
+
+	for id, u := range m.users {
+		// NULL <= anything is NULL, so a NULL bound matches no one, like in SQL
+		if !due.Valid || !u.DeletionScheduledAt.Valid || u.DeletionScheduledAt.Time.After(due.Time) {
+			continue
+		}
+
+		delete(m.users, id)
+		gone[id] = true
+		deleted = append(deleted, database.DeleteDueUsersRow{ID: u.ID, AvatarKey: u.AvatarKey, BannerKey: u.BannerKey})
+	}
+
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+
+	m.deleteChirps(func(c database.Chirp) bool {
+		return gone[c.UserID]
+	})
+
+	m.apiKeys = slices.DeleteFunc(m.apiKeys, func(k database.ApiKey) bool {
+		return gone[k.UserID]
+	})
+
+	// Deleting a user's clients takes the codes and tokens issued to them along
+	m.deleteOAuthClients(func(c database.OauthClient) bool {
+		return gone[c.OwnerID]
+	})
+
+	m.oauthCodes = slices.DeleteFunc(m.oauthCodes, func(c database.OauthAuthorizationCode) bool {
+		return gone[c.UserID]
+	})
+
+	m.identities = slices.DeleteFunc(m.identities, func(i database.UserIdentity) bool {
+		return gone[i.UserID]
+	})
+
+	m.magicLinks = slices.DeleteFunc(m.magicLinks, func(l database.MagicLink) bool {
+		return gone[l.UserID]
+	})
+
+	m.drafts = slices.DeleteFunc(m.drafts, func(d database.Draft) bool {
+		return gone[d.UserID]
+	})
+
+	m.scheduledChirps = slices.DeleteFunc(m.scheduledChirps, func(c database.ScheduledChirp) bool {
+		return gone[c.UserID]
+	})
+
+	m.pollVoters = slices.DeleteFunc(m.pollVoters, func(v database.PollVoter) bool {
+		return gone[v.UserID]
+	})
+
+	m.pollVotes = slices.DeleteFunc(m.pollVotes, func(v database.PollVote) bool {
+		return gone[v.UserID]
+	})
+
+	for token, t := range m.refreshTokens {
+		if gone[t.UserID] {
+			delete(m.refreshTokens, token)
+		}
+	}
+
+	m.reports = slices.DeleteFunc(m.reports, func(r database.Report) bool {
+		return gone[r.ReporterID] || gone[r.TargetUserID]
+	})
+
+	for i, a := range m.moderationActions {
+		if a.ActorID.Valid && gone[a.ActorID.UUID] {
+			m.moderationActions[i].ActorID = uuid.NullUUID{}
+		}
+		if a.TargetUserID.Valid && gone[a.TargetUserID.UUID] {
+			m.moderationActions[i].TargetUserID = uuid.NullUUID{}
+		}
+		if a.ReportID.Valid && !m.hasReport(a.ReportID.UUID) {
+			m.moderationActions[i].ReportID = uuid.NullUUID{}
+		}
+	}
+
+	m.oidcLoginStates = slices.DeleteFunc(m.oidcLoginStates, func(s database.OidcLoginState) bool {
+		return s.LinkUserID.Valid && gone[s.LinkUserID.UUID]
+	})
+
+	m.blocks = slices.DeleteFunc(m.blocks, func(b database.Block) bool {
+		return gone[b.BlockerID] || gone[b.BlockedID]
+	})
+
+	m.mutes = slices.DeleteFunc(m.mutes, func(mu database.Mute) bool {
+		return gone[mu.MuterID] || gone[mu.MutedID]
+	})
+
+	m.follows = slices.DeleteFunc(m.follows, func(f database.Follow) bool {
+		return gone[f.FollowerID] || gone[f.FolloweeID]
+	})
+
+	m.likes = slices.DeleteFunc(m.likes, func(l database.Like) bool {
+		return gone[l.UserID]
+	})
+
+	m.bookmarks = slices.DeleteFunc(m.bookmarks, func(b database.Bookmark) bool {
+		return gone[b.UserID]
+	})
+
+	m.deleteLists(func(l database.List) bool {
+		return gone[l.OwnerID]
+	})
+
+	m.listMembers = slices.DeleteFunc(m.listMembers, func(lm database.ListMember) bool {
+		return gone[lm.UserID]
+	})
+
+	m.deleteNotifications(func(n database.Notification) bool {
+		return gone[n.UserID]
+	})
+
+	m.notificationActors = slices.DeleteFunc(m.notificationActors, func(a database.NotificationActor) bool {
+		return gone[a.ActorID]
+	})
+
+	m.notificationPreferences = slices.DeleteFunc(m.notificationPreferences, func(p database.NotificationPreference) bool {
+		return gone[p.UserID]
+	})
+
+	return deleted, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *Memory) GetUserByIDNoPassword(ctx context.Context, id uuid.UUID) (database.GetUserByIDNoPasswordRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return database.GetUserByIDNoPasswordRow{}, sql.ErrNoRows
+	}
+
+	return database.GetUserByIDNoPasswordRow{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		Email:       u.Email,
+		Role:        u.Role,
+		Handle:      u.Handle,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		Location:    u.Location,
+		Website:     u.Website,
+		AvatarKey:   u.AvatarKey,
+		BannerKey:   u.BannerKey,
+
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}, nil
+}
+
+func (m *Memory) GetUserProfileByHandle(ctx context.Context, handle string) (database.GetUserProfileByHandleRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if !strings.EqualFold(u.Handle, handle) {
+			continue
+		}
+
+		profile := database.GetUserProfileByHandleRow{
+			ID:          u.ID,
+			CreatedAt:   u.CreatedAt,
+			Handle:      u.Handle,
+			DisplayName: u.DisplayName,
+			Bio:         u.Bio,
+			Location:    u.Location,
+			Website:     u.Website,
+			AvatarKey:   u.AvatarKey,
+			BannerKey:   u.BannerKey,
+		}
+
+		for _, c := range m.chirps {
+			if c.UserID == u.ID && !c.HiddenAt.Valid {
+				profile.ChirpCount++
+			}
+		}
+
+		for _, f := range m.follows {
+			if f.FolloweeID == u.ID {
+				profile.FollowerCount++
+			}
+			if f.FollowerID == u.ID {
+				profile.FollowingCount++
+			}
+		}
+
+		return profile, nil
+	}
+
+	return database.GetUserProfileByHandleRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserSummaries(ctx context.Context, ids []uuid.UUID) ([]database.GetUserSummariesRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var summaries []database.GetUserSummariesRow
+	for _, id := range ids {
+		if u, ok := m.users[id]; ok {
+			summaries = append(summaries, database.GetUserSummariesRow{
+				ID:          u.ID,
+				Handle:      u.Handle,
+				DisplayName: u.DisplayName,
+				AvatarKey:   u.AvatarKey,
+			})
+		}
+	}
+	return summaries, nil
+}
+
+// Handles arrive lower cased, compared against lower(handle)
+func (m *Memory) GetUserIDsByHandles(ctx context.Context, handles []string) ([]database.GetUserIDsByHandlesRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.GetUserIDsByHandlesRow
+	for _, u := range m.users {
+		if slices.Contains(handles, strings.ToLower(u.Handle)) {
+			rows = append(rows, database.GetUserIDsByHandlesRow{ID: u.ID, Handle: u.Handle})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return nil
+	}
+
+	if m.emailTaken(arg.Email, arg.ID) {
+		return uniqueViolation("users_email_key")
+	}
+
+	if m.handleTaken(arg.Handle, arg.ID) {
+		return uniqueViolation("users_handle_lower_key")
+	}
+
+	if u.Email != arg.Email {
+		u.EmailVerifiedAt = sql.NullTime{}
+	}
+	u.Email = arg.Email
+	u.HashedPassword = arg.HashedPassword
+	u.Handle = arg.Handle
+	u.DisplayName = arg.DisplayName
+	u.Bio = arg.Bio
+	u.Location = arg.Location
+	u.Website = arg.Website
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+func (m *Memory) VerifyUserEmail(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	ts := now()
+	if !u.EmailVerifiedAt.Valid {
+		u.EmailVerifiedAt = sql.NullTime{Time: ts, Valid: true}
+	}
+	u.UpdatedAt = ts
+	m.users[id] = u
+
+	return nil
+}
+
+func (m *Memory) UpdateUserAvatar(ctx context.Context, arg database.UpdateUserAvatarParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return nil
+	}
+
+	u.AvatarKey = arg.AvatarKey
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+func (m *Memory) UpdateUserBanner(ctx context.Context, arg database.UpdateUserBannerParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return nil
+	}
+
+	u.BannerKey = arg.BannerKey
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+// Mirrors the query in sql/queries/users.sql
+func (m *Memory) UpdateIsChirpyRedByID(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return 0, nil
+	}
+
+	u.IsChirpyRed = true
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return 1, nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	ts := now()
+	u.SuspendedAt = sql.NullTime{Time: ts, Valid: true}
+	u.UpdatedAt = ts
+	m.users[u.ID] = u
+
+	return nil
+}
+
+func (m *Memory) UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return 0, nil
+	}
+
+	u.Role = arg.Role
+	u.UpdatedAt = now()
+	m.users[u.ID] = u
+
+	return 1, nil
+}
+
+func (m *Memory) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, u := range m.users {
+		if u.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, foreignKeyViolation("chirps_user_id_fkey")
+	}
+
+	if arg.ReplyToID.Valid {
+		if _, ok := m.chirpIndex(arg.ReplyToID.UUID); !ok {
+			return database.Chirp{}, foreignKeyViolation("chirps_reply_to_id_fkey")
+		}
+	}
+
+	ts := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		ReplyToID: arg.ReplyToID,
+	}
+	m.chirps = append(m.chirps, chirp)
+
+	return chirp, nil
+}
+
+func (m *Memory) GetChirps(ctx context.Context, arg database.GetChirpsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chirps := pageAfter(newestChirps(m.chirps), arg.BeforeID, func(c database.Chirp) uuid.UUID { return c.ID })
+
+	chirps = slices.DeleteFunc(chirps, func(c database.Chirp) bool {
+		return c.HiddenAt.Valid || m.blockedBy(arg.ViewerID, c.UserID) || m.muted(arg.ViewerID, c.UserID)
+	})
+	return filterChirps(chirps, arg.AuthorID, arg.PageSize), nil
+}
+
+// ORDER BY created_at DESC, id DESC
+func newestChirps(chirps []database.Chirp) []database.Chirp {
+	chirps = slices.Clone(chirps)
+	slices.SortFunc(chirps, func(a, b database.Chirp) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID.String(), a.ID.String()))
+	})
+	return chirps
+}
+
+// The rows ordered after the one with beforeID. Like the row comparison in SQL, there are none
+// when that row doesn't exist.
+func pageAfter[T any](rows []T, beforeID uuid.NullUUID, id func(T) uuid.UUID) []T {
+	if !beforeID.Valid {
+		return rows
+	}
+
+	i := slices.IndexFunc(rows, func(row T) bool { return id(row) == beforeID.UUID })
+	if i < 0 {
+		return nil
+	}
+	return rows[i+1:]
+}
+
+// The author filter and LIMIT every chirp listing shares, applied to ordered and visible chirps
+func filterChirps(chirps []database.Chirp, authorID uuid.NullUUID, pageSize int32) []database.Chirp {
+
+	if authorID.Valid {
+		chirps = slices.DeleteFunc(chirps, func(c database.Chirp) bool { return c.UserID != authorID.UUID })
+	}
+
+	if len(chirps) > int(pageSize) {
+		chirps = chirps[:pageSize]
+	}
+	return chirps
+}
+
+func (m *Memory) GetIndividualChirp(ctx context.Context, arg database.GetIndividualChirpParams) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.chirpIndex(arg.ID)
+	if !ok || m.chirps[i].HiddenAt.Valid || m.blockedBy(arg.ViewerID, m.chirps[i].UserID) {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return m.chirps[i], nil
+}
+
+func (m *Memory) HideChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, ok := m.chirpIndex(id); ok {
+		ts := now()
+		m.chirps[i].HiddenAt = sql.NullTime{Time: ts, Valid: true}
+		m.chirps[i].UpdatedAt = ts
+	}
+	return nil
+}
+
+func (m *Memory) ListChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chirps []database.Chirp
+	for _, c := range m.chirps {
+		if c.UserID == userID {
+			chirps = append(chirps, c)
+		}
+	}
+	return chirps, nil
+}
+
+// Position of the chirp in m.chirps, callers hold the lock
+func (m *Memory) chirpIndex(id uuid.UUID) (int, bool) {
+	i := slices.IndexFunc(m.chirps, func(c database.Chirp) bool {
+		return c.ID == id
+	})
+	return i, i >= 0
+}
+
+func (m *Memory) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteChirps(func(c database.Chirp) bool {
+		return c.ID == id
+	})
+	return nil
+}
+
+// Deletes the matching chirps and mirrors the foreign keys pointing at them, callers hold the lock
+func (m *Memory) deleteChirps(match func(c database.Chirp) bool) {
+
+	deleted := map[uuid.UUID]bool{}
+	m.chirps = slices.DeleteFunc(m.chirps, func(c database.Chirp) bool {
+		if match(c) {
+			deleted[c.ID] = true
+			return true
+		}
+		return false
+	})
+
+	m.moderationFlags = slices.DeleteFunc(m.moderationFlags, func(f database.ModerationFlag) bool {
+		return deleted[f.ChirpID]
+	})
+
+	m.deletePolls(func(p database.Poll) bool {
+		return deleted[p.ChirpID]
+	})
+
+	m.reports = slices.DeleteFunc(m.reports, func(r database.Report) bool {
+		return r.ChirpID.Valid && deleted[r.ChirpID.UUID]
+	})
+
+	m.likes = slices.DeleteFunc(m.likes, func(l database.Like) bool {
+		return deleted[l.ChirpID]
+	})
+
+	m.bookmarks = slices.DeleteFunc(m.bookmarks, func(b database.Bookmark) bool {
+		return deleted[b.ChirpID]
+	})
+
+	m.deleteNotifications(func(n database.Notification) bool {
+		return n.ChirpID.Valid && deleted[n.ChirpID.UUID]
+	})
+
+	// ON DELETE SET NULL, replies outlive the chirp they answer
+	for i, c := range m.chirps {
+		if c.ReplyToID.Valid && deleted[c.ReplyToID.UUID] {
+			m.chirps[i].ReplyToID = uuid.NullUUID{}
+		}
+	}
+
+	// ON DELETE SET NULL, the audit log outlives the chirp and the report
+	for i, a := range m.moderationActions {
+		if a.ChirpID.Valid && deleted[a.ChirpID.UUID] {
+			m.moderationActions[i].ChirpID = uuid.NullUUID{}
+		}
+		if a.ReportID.Valid && !m.hasReport(a.ReportID.UUID) {
+			m.moderationActions[i].ReportID = uuid.NullUUID{}
+		}
+	}
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, foreignKeyViolation("refresh_tokens_user_id_fkey")
+	}
+
+	if arg.ClientID.Valid && !m.hasOAuthClient(arg.ClientID.UUID) {
+		return database.RefreshToken{}, foreignKeyViolation("refresh_tokens_client_id_fkey")
+	}
+
+	if _, ok := m.refreshTokens[arg.Token]; ok {
+		return database.RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+
+	ts := now()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		ClientID:  arg.ClientID,
+		// Nullable, unlike the other scopes columns: session tokens have none
+		Scopes: slices.Clone(arg.Scopes),
+	}
+	m.refreshTokens[token.Token] = token
+
+	return copyRefreshToken(token), nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return copyRefreshToken(t), nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+
+	ts := now()
+	t.RevokedAt = sql.NullTime{Time: ts, Valid: true}
+	t.UpdatedAt = ts
+	m.refreshTokens[token] = t
+
+	return nil
+}
+
+func (m *Memory) ClaimRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.refreshTokens[token]
+	ts := now()
+	if !ok || t.RevokedAt.Valid || !t.ExpiresAt.After(ts) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+
+	t.RevokedAt = sql.NullTime{Time: ts, Valid: true}
+	t.UpdatedAt = ts
+	m.refreshTokens[token] = t
+
+	return copyRefreshToken(t), nil
+}
+
+func (m *Memory) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+	for token, t := range m.refreshTokens {
+		if t.UserID != userID || t.RevokedAt.Valid {
+			continue
+		}
+		t.RevokedAt = sql.NullTime{Time: ts, Valid: true}
+		t.UpdatedAt = ts
+		m.refreshTokens[token] = t
+	}
+
+	return nil
+}
+
+// Oldest first, like ORDER BY created_at
+func (m *Memory) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.ListUserSessionsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []database.RefreshToken
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID {
+			sessions = append(sessions, t)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b database.RefreshToken) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	var rows []database.ListUserSessionsRow
+	for _, t := range sessions {
+		rows = append(rows, database.ListUserSessionsRow{
+			CreatedAt: t.CreatedAt,
+			UpdatedAt: t.UpdatedAt,
+			ExpiresAt: t.ExpiresAt,
+			RevokedAt: t.RevokedAt,
+		})
+	}
+	return rows, nil
+}
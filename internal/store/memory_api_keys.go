@@ -0,0 +1,134 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateAPIKey(ctx context.Context, arg database.CreateAPIKeyParams) (database.ApiKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.ApiKey{}, foreignKeyViolation("api_keys_user_id_fkey")
+	}
+
+	if slices.ContainsFunc(m.apiKeys, func(k database.ApiKey) bool { return k.KeyHash == arg.KeyHash }) {
+		return database.ApiKey{}, uniqueViolation("api_keys_key_hash_key")
+	}
+
+	key := database.ApiKey{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		Prefix:    arg.Prefix,
+		KeyHash:   arg.KeyHash,
+		Scopes:    cloneStrings(arg.Scopes),
+		ExpiresAt: arg.ExpiresAt,
+	}
+
+	m.apiKeys = append(m.apiKeys, key)
+	return copyAPIKey(key), nil
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []database.ApiKey
+	for _, k := range m.apiKeys {
+		if k.UserID == userID {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+
+	// ORDER BY created_at DESC, id DESC
+	slices.SortFunc(keys, func(a, b database.ApiKey) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID.String(), a.ID.String()))
+	})
+	return keys, nil
+}
+
+func (m *Memory) CountActiveAPIKeys(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ts := now()
+
+	var count int64
+	for _, k := range m.apiKeys {
+		if k.UserID == userID && !k.RevokedAt.Valid && (!k.ExpiresAt.Valid || k.ExpiresAt.Time.After(ts)) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, keyHash string) (database.GetAPIKeyByHashRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.apiKeys {
+		if k.KeyHash != keyHash {
+			continue
+		}
+
+		u, ok := m.users[k.UserID]
+		if !ok {
+			break
+		}
+
+		return database.GetAPIKeyByHashRow{
+			ID:                  k.ID,
+			UserID:              k.UserID,
+			Scopes:              cloneStrings(k.Scopes),
+			ExpiresAt:           k.ExpiresAt,
+			RevokedAt:           k.RevokedAt,
+			Role:                u.Role,
+			SuspendedAt:         u.SuspendedAt,
+			DeletionScheduledAt: u.DeletionScheduledAt,
+		}, nil
+	}
+	return database.GetAPIKeyByHashRow{}, sql.ErrNoRows
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+	for i, k := range m.apiKeys {
+		if k.ID == id && (!k.LastUsedAt.Valid || k.LastUsedAt.Time.Before(ts.Add(-time.Minute))) {
+			m.apiKeys[i].LastUsedAt = sql.NullTime{Time: ts, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeAPIKey(ctx context.Context, arg database.RevokeAPIKeyParams) (database.ApiKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, k := range m.apiKeys {
+		if k.ID == arg.ID && k.UserID == arg.UserID {
+			if !k.RevokedAt.Valid {
+				m.apiKeys[i].RevokedAt = sql.NullTime{Time: now(), Valid: true}
+			}
+			return copyAPIKey(m.apiKeys[i]), nil
+		}
+	}
+	return database.ApiKey{}, sql.ErrNoRows
+}
+
+func copyAPIKey(k database.ApiKey) database.ApiKey {
+	k.Scopes = cloneStrings(k.Scopes)
+	return k
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateBookmark(ctx context.Context, arg database.CreateBookmarkParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("bookmarks_user_id_fkey")
+	}
+	if _, ok := m.chirpIndex(arg.ChirpID); !ok {
+		return foreignKeyViolation("bookmarks_chirp_id_fkey")
+	}
+
+	// ON CONFLICT DO NOTHING
+	if slices.ContainsFunc(m.bookmarks, func(b database.Bookmark) bool {
+		return b.UserID == arg.UserID && b.ChirpID == arg.ChirpID
+	}) {
+		return nil
+	}
+
+	m.bookmarks = append(m.bookmarks, database.Bookmark{
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (m *Memory) DeleteBookmark(ctx context.Context, arg database.DeleteBookmarkParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bookmarks = slices.DeleteFunc(m.bookmarks, func(b database.Bookmark) bool {
+		return b.UserID == arg.UserID && b.ChirpID == arg.ChirpID
+	})
+	return nil
+}
+
+// ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+func (m *Memory) ListBookmarkedChirps(ctx context.Context, arg database.ListBookmarkedChirpsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	viewerID := uuid.NullUUID{UUID: arg.UserID, Valid: true}
+
+	var bookmarks []database.Bookmark
+	for _, b := range m.bookmarks {
+		if b.UserID == arg.UserID {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+
+	slices.SortFunc(bookmarks, func(a, b database.Bookmark) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ChirpID.String(), a.ChirpID.String()))
+	})
+
+	bookmarks = pageAfter(bookmarks, arg.BeforeID, func(b database.Bookmark) uuid.UUID { return b.ChirpID })
+
+	var chirps []database.Chirp
+	for _, b := range bookmarks {
+		i, ok := m.chirpIndex(b.ChirpID)
+		if !ok || m.chirps[i].HiddenAt.Valid || m.blockedBy(viewerID, m.chirps[i].UserID) {
+			continue
+		}
+		chirps = append(chirps, m.chirps[i])
+	}
+	return filterChirps(chirps, arg.AuthorID, arg.PageSize), nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateDraft(ctx context.Context, arg database.CreateDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Draft{}, foreignKeyViolation("drafts_user_id_fkey")
+	}
+
+	ts := now()
+	draft := database.Draft{
+		ID:        uuid.New(),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		UserID:    arg.UserID,
+		Body:      arg.Body,
+	}
+	m.drafts = append(m.drafts, draft)
+
+	return draft, nil
+}
+
+// ORDER BY updated_at DESC, id
+func (m *Memory) ListDrafts(ctx context.Context, userID uuid.UUID) ([]database.Draft, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var drafts []database.Draft
+	for _, d := range m.drafts {
+		if d.UserID == userID {
+			drafts = append(drafts, d)
+		}
+	}
+
+	slices.SortFunc(drafts, func(a, b database.Draft) int {
+		if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return drafts, nil
+}
+
+func (m *Memory) GetDraft(ctx context.Context, arg database.GetDraftParams) (database.Draft, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, d := range m.drafts {
+		if d.ID == arg.ID && d.UserID == arg.UserID {
+			return d, nil
+		}
+	}
+	return database.Draft{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateDraft(ctx context.Context, arg database.UpdateDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, d := range m.drafts {
+		if d.ID == arg.ID && d.UserID == arg.UserID {
+			m.drafts[i].Body = arg.Body
+			m.drafts[i].UpdatedAt = now()
+			return m.drafts[i], nil
+		}
+	}
+	return database.Draft{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.drafts)
+	m.drafts = slices.DeleteFunc(m.drafts, func(d database.Draft) bool {
+		return d.ID == arg.ID && d.UserID == arg.UserID
+	})
+	return int64(before - len(m.drafts)), nil
+}
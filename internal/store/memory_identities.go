@@ -0,0 +1,142 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateOIDCLoginState(ctx context.Context, arg database.CreateOIDCLoginStateParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.ContainsFunc(m.oidcLoginStates, func(s database.OidcLoginState) bool { return s.StateHash == arg.StateHash }) {
+		return uniqueViolation("oidc_login_states_pkey")
+	}
+
+	m.oidcLoginStates = append(m.oidcLoginStates, database.OidcLoginState{
+		StateHash:    arg.StateHash,
+		Provider:     arg.Provider,
+		Nonce:        arg.Nonce,
+		CodeVerifier: arg.CodeVerifier,
+		CreatedAt:    now(),
+		ExpiresAt:    arg.ExpiresAt,
+		LinkUserID:   arg.LinkUserID,
+	})
+	return nil
+}
+
+func (m *Memory) ConsumeOIDCLoginState(ctx context.Context, stateHash string) (database.OidcLoginState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.oidcLoginStates, func(s database.OidcLoginState) bool { return s.StateHash == stateHash })
+	if i < 0 {
+		return database.OidcLoginState{}, sql.ErrNoRows
+	}
+
+	state := m.oidcLoginStates[i]
+	m.oidcLoginStates = slices.Delete(m.oidcLoginStates, i, i+1)
+	return state, nil
+}
+
+func (m *Memory) DeleteExpiredOIDCLoginStates(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := now()
+	m.oidcLoginStates = slices.DeleteFunc(m.oidcLoginStates, func(s database.OidcLoginState) bool {
+		return !s.ExpiresAt.After(cutoff)
+	})
+	return nil
+}
+
+func (m *Memory) GetUserIdentity(ctx context.Context, arg database.GetUserIdentityParams) (database.UserIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, i := range m.identities {
+		if i.Provider == arg.Provider && i.Subject == arg.Subject {
+			return i, nil
+		}
+	}
+	return database.UserIdentity{}, sql.ErrNoRows
+}
+
+func (m *Memory) CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) (database.UserIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.UserIdentity{}, foreignKeyViolation("user_identities_user_id_fkey")
+	}
+
+	for _, i := range m.identities {
+		if i.Provider == arg.Provider && i.Subject == arg.Subject {
+			return database.UserIdentity{}, uniqueViolation("user_identities_pkey")
+		}
+		if i.UserID == arg.UserID && i.Provider == arg.Provider {
+			return database.UserIdentity{}, uniqueViolation("user_identities_user_id_provider_key")
+		}
+	}
+
+	t := now()
+	identity := database.UserIdentity{
+		Provider:    arg.Provider,
+		Subject:     arg.Subject,
+		UserID:      arg.UserID,
+		Email:       arg.Email,
+		CreatedAt:   t,
+		LastLoginAt: t,
+	}
+
+	m.identities = append(m.identities, identity)
+	return identity, nil
+}
+
+func (m *Memory) TouchUserIdentity(ctx context.Context, arg database.TouchUserIdentityParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, identity := range m.identities {
+		if identity.Provider == arg.Provider && identity.Subject == arg.Subject {
+			m.identities[i].Email = arg.Email
+			m.identities[i].LastLoginAt = now()
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListUserIdentities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var identities []database.UserIdentity
+	for _, i := range m.identities {
+		if i.UserID == userID {
+			identities = append(identities, i)
+		}
+	}
+
+	// ORDER BY created_at, provider
+	slices.SortFunc(identities, func(a, b database.UserIdentity) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.Provider, b.Provider))
+	})
+	return identities, nil
+}
+
+func (m *Memory) DeleteUserIdentity(ctx context.Context, arg database.DeleteUserIdentityParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.identities)
+	m.identities = slices.DeleteFunc(m.identities, func(i database.UserIdentity) bool {
+		return i.UserID == arg.UserID && i.Provider == arg.Provider
+	})
+	return int64(before - len(m.identities)), nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateLike(ctx context.Context, arg database.CreateLikeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("likes_user_id_fkey")
+	}
+	if _, ok := m.chirpIndex(arg.ChirpID); !ok {
+		return foreignKeyViolation("likes_chirp_id_fkey")
+	}
+
+	// ON CONFLICT DO NOTHING
+	if slices.ContainsFunc(m.likes, func(l database.Like) bool {
+		return l.UserID == arg.UserID && l.ChirpID == arg.ChirpID
+	}) {
+		return nil
+	}
+
+	m.likes = append(m.likes, database.Like{
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (m *Memory) DeleteLike(ctx context.Context, arg database.DeleteLikeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.likes = slices.DeleteFunc(m.likes, func(l database.Like) bool {
+		return l.UserID == arg.UserID && l.ChirpID == arg.ChirpID
+	})
+	return nil
+}
+
+// Appended in creation order, so already sorted by created_at
+func (m *Memory) ListLikesByUser(ctx context.Context, userID uuid.UUID) ([]database.Like, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var likes []database.Like
+	for _, l := range m.likes {
+		if l.UserID == userID {
+			likes = append(likes, l)
+		}
+	}
+	return likes, nil
+}
+
+func (m *Memory) CountLikes(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, l := range m.likes {
+		if l.ChirpID == chirpID {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// UNIQUE (owner_id, name)
+func (m *Memory) listNameTaken(ownerID uuid.UUID, name string, except uuid.UUID) bool {
+	return slices.ContainsFunc(m.lists, func(l database.List) bool {
+		return l.OwnerID == ownerID && l.Name == name && l.ID != except
+	})
+}
+
+func (m *Memory) CreateList(ctx context.Context, arg database.CreateListParams) (database.List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.OwnerID]; !ok {
+		return database.List{}, foreignKeyViolation("lists_owner_id_fkey")
+	}
+	if m.listNameTaken(arg.OwnerID, arg.Name, uuid.Nil) {
+		return database.List{}, uniqueViolation("lists_owner_id_name_key")
+	}
+
+	ts := now()
+	list := database.List{
+		ID:        uuid.New(),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		OwnerID:   arg.OwnerID,
+		Name:      arg.Name,
+		Public:    arg.Public,
+	}
+	m.lists = append(m.lists, list)
+
+	return list, nil
+}
+
+func (m *Memory) GetList(ctx context.Context, id uuid.UUID) (database.List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, l := range m.lists {
+		if l.ID == id {
+			return l, nil
+		}
+	}
+	return database.List{}, sql.ErrNoRows
+}
+
+// ORDER BY created_at ASC, id
+func (m *Memory) ListListsByOwner(ctx context.Context, ownerID uuid.UUID) ([]database.List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var lists []database.List
+	for _, l := range m.lists {
+		if l.OwnerID == ownerID {
+			lists = append(lists, l)
+		}
+	}
+
+	slices.SortFunc(lists, func(a, b database.List) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID.String(), b.ID.String()))
+	})
+	return lists, nil
+}
+
+func (m *Memory) UpdateList(ctx context.Context, arg database.UpdateListParams) (database.List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, l := range m.lists {
+		if l.ID != arg.ID {
+			continue
+		}
+
+		if m.listNameTaken(l.OwnerID, arg.Name, l.ID) {
+			return database.List{}, uniqueViolation("lists_owner_id_name_key")
+		}
+
+		m.lists[i].Name = arg.Name
+		m.lists[i].Public = arg.Public
+		m.lists[i].UpdatedAt = now()
+		return m.lists[i], nil
+	}
+	return database.List{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteList(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteLists(func(l database.List) bool {
+		return l.ID == id
+	})
+	return nil
+}
+
+func (m *Memory) AddListMember(ctx context.Context, arg database.AddListMemberParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.lists, func(l database.List) bool { return l.ID == arg.ListID }) {
+		return foreignKeyViolation("list_members_list_id_fkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("list_members_user_id_fkey")
+	}
+
+	// ON CONFLICT DO NOTHING
+	if m.listMember(arg.ListID, arg.UserID) {
+		return nil
+	}
+
+	m.listMembers = append(m.listMembers, database.ListMember{
+		ListID:    arg.ListID,
+		UserID:    arg.UserID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (m *Memory) RemoveListMember(ctx context.Context, arg database.RemoveListMemberParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listMembers = slices.DeleteFunc(m.listMembers, func(lm database.ListMember) bool {
+		return lm.ListID == arg.ListID && lm.UserID == arg.UserID
+	})
+	return nil
+}
+
+func (m *Memory) RemoveListMemberships(ctx context.Context, arg database.RemoveListMembershipsParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listMembers = slices.DeleteFunc(m.listMembers, func(lm database.ListMember) bool {
+		return lm.UserID == arg.UserID && slices.ContainsFunc(m.lists, func(l database.List) bool {
+			return l.ID == lm.ListID && l.OwnerID == arg.OwnerID
+		})
+	})
+	return nil
+}
+
+// Appended in creation order, so already sorted by created_at
+func (m *Memory) ListListMembers(ctx context.Context, listID uuid.UUID) ([]database.ListMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var members []database.ListMember
+	for _, lm := range m.listMembers {
+		if lm.ListID == listID {
+			members = append(members, lm)
+		}
+	}
+	return members, nil
+}
+
+// Same filters and paging as GetChirps, narrowed to the members of the list
+func (m *Memory) GetListChirps(ctx context.Context, arg database.GetListChirpsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chirps := pageAfter(newestChirps(m.chirps), arg.BeforeID, func(c database.Chirp) uuid.UUID { return c.ID })
+
+	chirps = slices.DeleteFunc(chirps, func(c database.Chirp) bool {
+		return c.HiddenAt.Valid || !m.listMember(arg.ListID, c.UserID) || m.blockedBy(arg.ViewerID, c.UserID) || m.muted(arg.ViewerID, c.UserID)
+	})
+	return filterChirps(chirps, arg.AuthorID, arg.PageSize), nil
+}
+
+// Whether userID is on the list, callers hold the lock
+func (m *Memory) listMember(listID, userID uuid.UUID) bool {
+	return slices.ContainsFunc(m.listMembers, func(lm database.ListMember) bool {
+		return lm.ListID == listID && lm.UserID == userID
+	})
+}
+
+// ON DELETE CASCADE from lists to their members, callers hold the lock
+func (m *Memory) deleteLists(match func(l database.List) bool) {
+
+	deleted := map[uuid.UUID]bool{}
+	m.lists = slices.DeleteFunc(m.lists, func(l database.List) bool {
+		if match(l) {
+			deleted[l.ID] = true
+			return true
+		}
+		return false
+	})
+
+	m.listMembers = slices.DeleteFunc(m.listMembers, func(lm database.ListMember) bool {
+		return deleted[lm.ListID]
+	})
+}
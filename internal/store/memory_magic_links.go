@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CountRecentMagicLinkRequests(ctx context.Context, arg database.CountRecentMagicLinkRequestsParams) (database.CountRecentMagicLinkRequestsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	since := now().Add(-time.Duration(arg.WindowSeconds) * time.Second)
+
+	var row database.CountRecentMagicLinkRequestsRow
+	for _, r := range m.magicLinkRequests {
+		if !r.CreatedAt.After(since) {
+			continue
+		}
+		if strings.EqualFold(r.Email, arg.Email) {
+			row.ByEmail++
+		}
+		if r.Ip == arg.Ip {
+			row.ByIp++
+		}
+	}
+	return row, nil
+}
+
+func (m *Memory) CreateMagicLinkRequest(ctx context.Context, arg database.CreateMagicLinkRequestParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.magicLinkRequests = append(m.magicLinkRequests, database.MagicLinkRequest{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		Email:     arg.Email,
+		Ip:        arg.Ip,
+	})
+	return nil
+}
+
+func (m *Memory) DeleteOldMagicLinkRequests(ctx context.Context, windowSeconds int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := now().Add(-time.Duration(windowSeconds) * time.Second)
+	m.magicLinkRequests = slices.DeleteFunc(m.magicLinkRequests, func(r database.MagicLinkRequest) bool {
+		return !r.CreatedAt.After(since)
+	})
+	return nil
+}
+
+func (m *Memory) InvalidateMagicLinks(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	for i, l := range m.magicLinks {
+		if l.UserID == userID && !l.InvalidatedAt.Valid {
+			m.magicLinks[i].InvalidatedAt = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateMagicLink(ctx context.Context, arg database.CreateMagicLinkParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("magic_links_user_id_fkey")
+	}
+
+	if slices.ContainsFunc(m.magicLinks, func(l database.MagicLink) bool { return l.TokenHash == arg.TokenHash }) {
+		return uniqueViolation("magic_links_pkey")
+	}
+
+	m.magicLinks = append(m.magicLinks, database.MagicLink{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: now(),
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *Memory) ConsumeMagicLink(ctx context.Context, tokenHash string) (database.MagicLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	for i, l := range m.magicLinks {
+		if l.TokenHash == tokenHash && !l.InvalidatedAt.Valid && l.ExpiresAt.After(t) {
+			m.magicLinks[i].InvalidatedAt = sql.NullTime{Time: t, Valid: true}
+			return m.magicLinks[i], nil
+		}
+	}
+	return database.MagicLink{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteDeadMagicLinks(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	m.magicLinks = slices.DeleteFunc(m.magicLinks, func(l database.MagicLink) bool {
+		return l.InvalidatedAt.Valid || !l.ExpiresAt.After(t)
+	})
+	return nil
+}
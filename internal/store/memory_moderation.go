@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateModerationRule(ctx context.Context, arg database.CreateModerationRuleParams) (database.ModerationRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.moderationRules {
+		if r.Kind == arg.Kind && r.Pattern == arg.Pattern {
+			return database.ModerationRule{}, uniqueViolation("moderation_rules_kind_pattern_key")
+		}
+	}
+
+	ts := now()
+	rule := database.ModerationRule{
+		ID:        uuid.New(),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		Kind:      arg.Kind,
+		Pattern:   arg.Pattern,
+		Action:    arg.Action,
+	}
+	m.moderationRules = append(m.moderationRules, rule)
+
+	return rule, nil
+}
+
+func (m *Memory) ListModerationRules(ctx context.Context) ([]database.ModerationRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.moderationRules), nil
+}
+
+func (m *Memory) DeleteModerationRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.moderationRules)
+	m.moderationRules = slices.DeleteFunc(m.moderationRules, func(r database.ModerationRule) bool {
+		return r.ID == id
+	})
+
+	return int64(before - len(m.moderationRules)), nil
+}
+
+func (m *Memory) CreateModerationFlag(ctx context.Context, arg database.CreateModerationFlagParams) (database.ModerationFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.chirpIndex(arg.ChirpID); !ok {
+		return database.ModerationFlag{}, foreignKeyViolation("moderation_flags_chirp_id_fkey")
+	}
+
+	flag := database.ModerationFlag{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		ChirpID:   arg.ChirpID,
+		Reason:    arg.Reason,
+	}
+	m.moderationFlags = append(m.moderationFlags, flag)
+
+	return flag, nil
+}
+
+func (m *Memory) ListModerationFlags(ctx context.Context) ([]database.ListModerationFlagsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.ListModerationFlagsRow
+	for _, f := range m.moderationFlags {
+		i, ok := m.chirpIndex(f.ChirpID)
+		if !ok {
+			continue
+		}
+
+		rows = append(rows, database.ListModerationFlagsRow{
+			ID:          f.ID,
+			CreatedAt:   f.CreatedAt,
+			ChirpID:     f.ChirpID,
+			Reason:      f.Reason,
+			ChirpBody:   m.chirps[i].Body,
+			ChirpUserID: m.chirps[i].UserID,
+		})
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+var notificationKinds = []string{"mention", "reply", "like", "follow"}
+
+// Deletes the matching notifications and their actors, callers hold the lock
+func (m *Memory) deleteNotifications(match func(n database.Notification) bool) {
+
+	deleted := map[uuid.UUID]bool{}
+	m.notifications = slices.DeleteFunc(m.notifications, func(n database.Notification) bool {
+		if match(n) {
+			deleted[n.ID] = true
+			return true
+		}
+		return false
+	})
+
+	m.notificationActors = slices.DeleteFunc(m.notificationActors, func(a database.NotificationActor) bool {
+		return deleted[a.NotificationID]
+	})
+}
+
+// Whether any actor is left in the group, callers hold the lock
+func (m *Memory) hasActors(notificationID uuid.UUID) bool {
+	return slices.ContainsFunc(m.notificationActors, func(a database.NotificationActor) bool {
+		return a.NotificationID == notificationID
+	})
+}
+
+func (m *Memory) UpsertNotification(ctx context.Context, arg database.UpsertNotificationParams) (database.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+
+	// ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+	for i, n := range m.notifications {
+		if n.UserID == arg.UserID && n.GroupKey == arg.GroupKey && !n.ReadAt.Valid {
+			m.notifications[i].UpdatedAt = ts
+			return m.notifications[i], nil
+		}
+	}
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Notification{}, foreignKeyViolation("notifications_user_id_fkey")
+	}
+	if arg.ChirpID.Valid {
+		if _, ok := m.chirpIndex(arg.ChirpID.UUID); !ok {
+			return database.Notification{}, foreignKeyViolation("notifications_chirp_id_fkey")
+		}
+	}
+	if !slices.Contains(notificationKinds, arg.Kind) {
+		return database.Notification{}, checkViolation("notifications_kind_check")
+	}
+
+	n := database.Notification{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Kind:      arg.Kind,
+		ChirpID:   arg.ChirpID,
+		GroupKey:  arg.GroupKey,
+		CreatedAt: ts,
+		UpdatedAt: ts,
+	}
+	m.notifications = append(m.notifications, n)
+
+	return n, nil
+}
+
+func (m *Memory) AddNotificationActor(ctx context.Context, arg database.AddNotificationActorParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.notifications, func(n database.Notification) bool { return n.ID == arg.NotificationID }) {
+		return foreignKeyViolation("notification_actors_notification_id_fkey")
+	}
+	if _, ok := m.users[arg.ActorID]; !ok {
+		return foreignKeyViolation("notification_actors_actor_id_fkey")
+	}
+
+	// ON CONFLICT DO NOTHING
+	if slices.ContainsFunc(m.notificationActors, func(a database.NotificationActor) bool {
+		return a.NotificationID == arg.NotificationID && a.ActorID == arg.ActorID
+	}) {
+		return nil
+	}
+
+	m.notificationActors = append(m.notificationActors, database.NotificationActor{
+		NotificationID: arg.NotificationID,
+		ActorID:        arg.ActorID,
+		CreatedAt:      now(),
+	})
+	return nil
+}
+
+// Mirrors ORDER BY updated_at DESC, id DESC and the (updated_at, id) row comparison of the cursor
+func (m *Memory) ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.ListNotificationsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	compare := func(updatedA time.Time, idA uuid.UUID, updatedB time.Time, idB uuid.UUID) int {
+		if c := updatedA.Compare(updatedB); c != 0 {
+			return c
+		}
+		return bytes.Compare(idA[:], idB[:])
+	}
+
+	var rows []database.ListNotificationsRow
+	for _, n := range m.notifications {
+		if n.UserID != arg.UserID || !m.hasActors(n.ID) {
+			continue
+		}
+		if arg.BeforeUpdatedAt.Valid && compare(n.UpdatedAt, n.ID, arg.BeforeUpdatedAt.Time, arg.BeforeID.UUID) >= 0 {
+			continue
+		}
+
+		row := database.ListNotificationsRow{
+			ID:        n.ID,
+			UserID:    n.UserID,
+			Kind:      n.Kind,
+			ChirpID:   n.ChirpID,
+			GroupKey:  n.GroupKey,
+			CreatedAt: n.CreatedAt,
+			UpdatedAt: n.UpdatedAt,
+			ReadAt:    n.ReadAt,
+		}
+		for _, a := range m.notificationActors {
+			if a.NotificationID == n.ID {
+				row.ActorCount++
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	slices.SortFunc(rows, func(a, b database.ListNotificationsRow) int {
+		return compare(b.UpdatedAt, b.ID, a.UpdatedAt, a.ID)
+	})
+
+	if len(rows) > int(arg.PageSize) {
+		rows = rows[:arg.PageSize]
+	}
+	return rows, nil
+}
+
+func (m *Memory) ListNotificationActors(ctx context.Context, notificationIds []uuid.UUID) ([]database.NotificationActor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var actors []database.NotificationActor
+	for _, a := range m.notificationActors {
+		if slices.Contains(notificationIds, a.NotificationID) {
+			actors = append(actors, a)
+		}
+	}
+
+	// Appended oldest first
+	slices.Reverse(actors)
+	return actors, nil
+}
+
+func (m *Memory) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, n := range m.notifications {
+		if n.UserID == userID && !n.ReadAt.Valid && m.hasActors(n.ID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// A nil Ids marks everything, like the NULL array in SQL
+func (m *Memory) MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+	var marked int64
+	for i, n := range m.notifications {
+		if n.UserID != arg.UserID || n.ReadAt.Valid {
+			continue
+		}
+		if arg.Ids != nil && !slices.Contains(arg.Ids, n.ID) {
+			continue
+		}
+
+		m.notifications[i].ReadAt = sql.NullTime{Time: ts, Valid: true}
+		marked++
+	}
+	return marked, nil
+}
+
+// Sorted by kind, then channel
+func (m *Memory) ListNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var prefs []database.NotificationPreference
+	for _, p := range m.notificationPreferences {
+		if p.UserID == userID {
+			prefs = append(prefs, p)
+		}
+	}
+
+	slices.SortFunc(prefs, func(a, b database.NotificationPreference) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Channel, b.Channel)
+	})
+	return prefs, nil
+}
+
+func (m *Memory) SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("notification_preferences_user_id_fkey")
+	}
+
+	// ON CONFLICT (user_id, kind, channel) DO UPDATE
+	for i, p := range m.notificationPreferences {
+		if p.UserID == arg.UserID && p.Kind == arg.Kind && p.Channel == arg.Channel {
+			m.notificationPreferences[i].Enabled = arg.Enabled
+			return nil
+		}
+	}
+
+	m.notificationPreferences = append(m.notificationPreferences, database.NotificationPreference{
+		UserID:  arg.UserID,
+		Kind:    arg.Kind,
+		Channel: arg.Channel,
+		Enabled: arg.Enabled,
+	})
+	return nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.OwnerID]; !ok {
+		return database.OauthClient{}, foreignKeyViolation("oauth_clients_owner_id_fkey")
+	}
+
+	client := database.OauthClient{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		OwnerID:      arg.OwnerID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: cloneStrings(arg.RedirectUris),
+	}
+
+	m.oauthClients = append(m.oauthClients, client)
+	return copyOAuthClient(client), nil
+}
+
+func (m *Memory) ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var clients []database.OauthClient
+	for _, c := range m.oauthClients {
+		if c.OwnerID == ownerID {
+			clients = append(clients, copyOAuthClient(c))
+		}
+	}
+
+	// ORDER BY created_at DESC, id DESC
+	slices.SortFunc(clients, func(a, b database.OauthClient) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID.String(), a.ID.String()))
+	})
+	return clients, nil
+}
+
+func (m *Memory) GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.oauthClients {
+		if c.ID == id {
+			return copyOAuthClient(c), nil
+		}
+	}
+	return database.OauthClient{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteOAuthClients(func(c database.OauthClient) bool {
+		return c.ID == arg.ID && c.OwnerID == arg.OwnerID
+	}), nil
+}
+
+func (m *Memory) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hasOAuthClient(arg.ClientID) {
+		return foreignKeyViolation("oauth_authorization_codes_client_id_fkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("oauth_authorization_codes_user_id_fkey")
+	}
+
+	if slices.ContainsFunc(m.oauthCodes, func(c database.OauthAuthorizationCode) bool { return c.CodeHash == arg.CodeHash }) {
+		return uniqueViolation("oauth_authorization_codes_pkey")
+	}
+
+	m.oauthCodes = append(m.oauthCodes, database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		CreatedAt:     now(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        cloneStrings(arg.Scopes),
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *Memory) ConsumeOAuthAuthorizationCode(ctx context.Context, arg database.ConsumeOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.oauthCodes, func(c database.OauthAuthorizationCode) bool {
+		return c.CodeHash == arg.CodeHash && c.ClientID == arg.ClientID
+	})
+	if i < 0 {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+
+	code := m.oauthCodes[i]
+	m.oauthCodes = slices.Delete(m.oauthCodes, i, i+1)
+
+	code.Scopes = cloneStrings(code.Scopes)
+	return code, nil
+}
+
+func (m *Memory) hasOAuthClient(id uuid.UUID) bool {
+	return slices.ContainsFunc(m.oauthClients, func(c database.OauthClient) bool { return c.ID == id })
+}
+
+// Deletes the matching clients along with their codes and refresh tokens (ON DELETE CASCADE),
+// returning how many clients went. The caller holds m.mu.
+func (m *Memory) deleteOAuthClients(match func(database.OauthClient) bool) int64 {
+
+	gone := map[uuid.UUID]bool{}
+	m.oauthClients = slices.DeleteFunc(m.oauthClients, func(c database.OauthClient) bool {
+		if match(c) {
+			gone[c.ID] = true
+			return true
+		}
+		return false
+	})
+
+	if len(gone) == 0 {
+		return 0
+	}
+
+	m.oauthCodes = slices.DeleteFunc(m.oauthCodes, func(c database.OauthAuthorizationCode) bool {
+		return gone[c.ClientID]
+	})
+
+	for token, t := range m.refreshTokens {
+		if t.ClientID.Valid && gone[t.ClientID.UUID] {
+			delete(m.refreshTokens, token)
+		}
+	}
+
+	return int64(len(gone))
+}
+
+// Callers get their own slices, as they would from a query
+func copyOAuthClient(c database.OauthClient) database.OauthClient {
+	c.RedirectUris = cloneStrings(c.RedirectUris)
+	return c
+}
+
+func copyRefreshToken(t database.RefreshToken) database.RefreshToken {
+	t.Scopes = slices.Clone(t.Scopes)
+	return t
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateOutboxEvent(ctx context.Context, arg database.CreateOutboxEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.ContainsFunc(m.outbox, func(e database.Outbox) bool { return e.ID == arg.ID }) {
+		return uniqueViolation("outbox_pkey")
+	}
+
+	ts := now()
+	m.outbox = append(m.outbox, database.Outbox{
+		ID:            arg.ID,
+		Type:          arg.Type,
+		Payload:       slices.Clone(arg.Payload),
+		CreatedAt:     ts,
+		NextAttemptAt: ts,
+		DeliveredTo:   []string{},
+	})
+	return nil
+}
+
+// Mirrors the lease in the query, the lock makes FOR UPDATE SKIP LOCKED unnecessary
+func (m *Memory) ClaimOutboxEvents(ctx context.Context, arg database.ClaimOutboxEventsParams) ([]database.Outbox, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+
+	var due []int
+	for i, e := range m.outbox {
+		if !e.DispatchedAt.Valid && !e.NextAttemptAt.After(ts) {
+			due = append(due, i)
+		}
+	}
+
+	// ORDER BY id, UUIDv7 sorts by creation
+	slices.SortFunc(due, func(a, b int) int {
+		return strings.Compare(m.outbox[a].ID.String(), m.outbox[b].ID.String())
+	})
+
+	if len(due) > int(arg.BatchSize) {
+		due = due[:arg.BatchSize]
+	}
+
+	claimed := make([]database.Outbox, 0, len(due))
+	for _, i := range due {
+		m.outbox[i].NextAttemptAt = ts.Add(time.Duration(arg.LeaseMs) * time.Millisecond)
+		claimed = append(claimed, copyOutboxEvent(m.outbox[i]))
+	}
+	return claimed, nil
+}
+
+func (m *Memory) CompleteOutboxEvent(ctx context.Context, arg database.CompleteOutboxEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, e := range m.outbox {
+		if e.ID == arg.ID {
+			m.outbox[i].DispatchedAt = sql.NullTime{Time: now(), Valid: true}
+			m.outbox[i].Attempts++
+			m.outbox[i].DeliveredTo = slices.Clone(arg.DeliveredTo)
+			m.outbox[i].LastError = sql.NullString{}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RetryOutboxEvent(ctx context.Context, arg database.RetryOutboxEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, e := range m.outbox {
+		if e.ID == arg.ID {
+			m.outbox[i].Attempts++
+			m.outbox[i].DeliveredTo = slices.Clone(arg.DeliveredTo)
+			m.outbox[i].LastError = arg.LastError
+			m.outbox[i].NextAttemptAt = now().Add(time.Duration(arg.RetryInMs) * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListOutboxEvents(ctx context.Context, limit int32) ([]database.Outbox, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]database.Outbox, 0, len(m.outbox))
+	for _, e := range m.outbox {
+		events = append(events, copyOutboxEvent(e))
+	}
+
+	slices.SortFunc(events, func(a, b database.Outbox) int {
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+
+	if len(events) > int(limit) {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// A NULL bound matches nothing, like the comparison in SQL
+func (m *Memory) DeleteDispatchedOutboxEvents(ctx context.Context, dispatchedAt sql.NullTime) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.outbox)
+	m.outbox = slices.DeleteFunc(m.outbox, func(e database.Outbox) bool {
+		return dispatchedAt.Valid && e.DispatchedAt.Valid && e.DispatchedAt.Time.Before(dispatchedAt.Time)
+	})
+	return int64(before - len(m.outbox)), nil
+}
+
+// Callers get their own slices, as they would from a query
+func copyOutboxEvent(e database.Outbox) database.Outbox {
+	e.Payload = slices.Clone(e.Payload)
+	e.DeliveredTo = slices.Clone(e.DeliveredTo)
+	return e
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreatePoll(ctx context.Context, arg database.CreatePollParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.chirpIndex(arg.ChirpID); !ok {
+		return foreignKeyViolation("polls_chirp_id_fkey")
+	}
+	if m.hasPoll(arg.ChirpID) {
+		return uniqueViolation("polls_pkey")
+	}
+
+	m.polls = append(m.polls, database.Poll{
+		ChirpID:        arg.ChirpID,
+		CreatedAt:      now(),
+		ClosesAt:       arg.ClosesAt,
+		MultipleChoice: arg.MultipleChoice,
+	})
+	return nil
+}
+
+func (m *Memory) CreatePollOption(ctx context.Context, arg database.CreatePollOptionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hasPoll(arg.ChirpID) {
+		return foreignKeyViolation("poll_options_chirp_id_fkey")
+	}
+	if slices.ContainsFunc(m.pollOptions, func(o database.PollOption) bool {
+		return o.ChirpID == arg.ChirpID && o.Position == arg.Position
+	}) {
+		return uniqueViolation("poll_options_chirp_id_position_key")
+	}
+
+	m.pollOptions = append(m.pollOptions, database.PollOption{
+		ID:       uuid.New(),
+		ChirpID:  arg.ChirpID,
+		Position: arg.Position,
+		Text:     arg.Text,
+	})
+	return nil
+}
+
+// ORDER BY polls.chirp_id, poll_options.position
+func (m *Memory) GetPolls(ctx context.Context, arg database.GetPollsParams) ([]database.GetPollsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.GetPollsRow
+	for _, p := range m.polls {
+		if !slices.Contains(arg.ChirpIds, p.ChirpID) {
+			continue
+		}
+
+		var voters int64
+		for _, v := range m.pollVoters {
+			if v.ChirpID == p.ChirpID {
+				voters++
+			}
+		}
+
+		for _, o := range m.pollOptions {
+			if o.ChirpID != p.ChirpID {
+				continue
+			}
+
+			row := database.GetPollsRow{
+				ChirpID:        p.ChirpID,
+				ClosesAt:       p.ClosesAt,
+				MultipleChoice: p.MultipleChoice,
+				OptionID:       o.ID,
+				Text:           o.Text,
+				Voters:         voters,
+			}
+
+			for _, v := range m.pollVotes {
+				if v.OptionID != o.ID {
+					continue
+				}
+				row.Votes++
+				// = NULL is never true
+				if arg.ViewerID.Valid && v.UserID == arg.ViewerID.UUID {
+					row.Voted = true
+				}
+			}
+
+			rows = append(rows, row)
+		}
+	}
+
+	positions := map[uuid.UUID]int32{}
+	for _, o := range m.pollOptions {
+		positions[o.ID] = o.Position
+	}
+
+	slices.SortFunc(rows, func(a, b database.GetPollsRow) int {
+		return cmp.Or(strings.Compare(a.ChirpID.String(), b.ChirpID.String()), cmp.Compare(positions[a.OptionID], positions[b.OptionID]))
+	})
+	return rows, nil
+}
+
+func (m *Memory) CreatePollVoter(ctx context.Context, arg database.CreatePollVoterParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+
+	// INSERT ... SELECT from the poll, only while it is open
+	if !slices.ContainsFunc(m.polls, func(p database.Poll) bool { return p.ChirpID == arg.ChirpID && p.ClosesAt.After(t) }) {
+		return 0, nil
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, foreignKeyViolation("poll_voters_user_id_fkey")
+	}
+	if slices.ContainsFunc(m.pollVoters, func(v database.PollVoter) bool {
+		return v.ChirpID == arg.ChirpID && v.UserID == arg.UserID
+	}) {
+		return 0, uniqueViolation("poll_voters_pkey")
+	}
+
+	m.pollVoters = append(m.pollVoters, database.PollVoter{
+		ChirpID:   arg.ChirpID,
+		UserID:    arg.UserID,
+		CreatedAt: t,
+	})
+	return 1, nil
+}
+
+func (m *Memory) CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.pollOptions, func(o database.PollOption) bool {
+		return o.ID == arg.OptionID
+	}) {
+		return foreignKeyViolation("poll_votes_option_id_fkey")
+	}
+	if !slices.ContainsFunc(m.pollVoters, func(v database.PollVoter) bool {
+		return v.ChirpID == arg.ChirpID && v.UserID == arg.UserID
+	}) {
+		return foreignKeyViolation("poll_votes_chirp_id_user_id_fkey")
+	}
+	if slices.ContainsFunc(m.pollVotes, func(v database.PollVote) bool {
+		return v.ChirpID == arg.ChirpID && v.UserID == arg.UserID && v.OptionID == arg.OptionID
+	}) {
+		return uniqueViolation("poll_votes_pkey")
+	}
+
+	m.pollVotes = append(m.pollVotes, database.PollVote{
+		ChirpID:  arg.ChirpID,
+		UserID:   arg.UserID,
+		OptionID: arg.OptionID,
+	})
+	return nil
+}
+
+func (m *Memory) hasPoll(chirpID uuid.UUID) bool {
+	return slices.ContainsFunc(m.polls, func(p database.Poll) bool {
+		return p.ChirpID == chirpID
+	})
+}
+
+// ON DELETE CASCADE from polls down to the options, voters and votes
+func (m *Memory) deletePolls(match func(p database.Poll) bool) {
+
+	deleted := map[uuid.UUID]bool{}
+	m.polls = slices.DeleteFunc(m.polls, func(p database.Poll) bool {
+		if match(p) {
+			deleted[p.ChirpID] = true
+			return true
+		}
+		return false
+	})
+
+	m.pollOptions = slices.DeleteFunc(m.pollOptions, func(o database.PollOption) bool {
+		return deleted[o.ChirpID]
+	})
+
+	m.pollVoters = slices.DeleteFunc(m.pollVoters, func(v database.PollVoter) bool {
+		return deleted[v.ChirpID]
+	})
+
+	m.pollVotes = slices.DeleteFunc(m.pollVotes, func(v database.PollVote) bool {
+		return deleted[v.ChirpID]
+	})
+}
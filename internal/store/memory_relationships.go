@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// Whether author blocked viewer, callers hold the lock. A NULL viewer is never blocked, like in SQL.
+func (m *Memory) blockedBy(viewerID uuid.NullUUID, author uuid.UUID) bool {
+	return viewerID.Valid && slices.ContainsFunc(m.blocks, func(b database.Block) bool {
+		return b.BlockerID == author && b.BlockedID == viewerID.UUID
+	})
+}
+
+// Whether viewer muted author, callers hold the lock
+func (m *Memory) muted(viewerID uuid.NullUUID, author uuid.UUID) bool {
+	return viewerID.Valid && slices.ContainsFunc(m.mutes, func(mu database.Mute) bool {
+		return mu.MuterID == viewerID.UUID && mu.MutedID == author
+	})
+}
+
+// Whether follower follows followee, callers hold the lock
+func (m *Memory) following(follower, followee uuid.UUID) bool {
+	return slices.ContainsFunc(m.follows, func(f database.Follow) bool {
+		return f.FollowerID == follower && f.FolloweeID == followee
+	})
+}
+
+// Mirrors the foreign keys and CHECK constraint of blocks, mutes and follows, fromCol and toCol name the two user columns
+func (m *Memory) checkRelationship(table, fromCol, toCol string, from, to uuid.UUID) error {
+	if _, ok := m.users[from]; !ok {
+		return foreignKeyViolation(table + "_" + fromCol + "_fkey")
+	}
+	if _, ok := m.users[to]; !ok {
+		return foreignKeyViolation(table + "_" + toCol + "_fkey")
+	}
+	if from == to {
+		return checkViolation(table + "_check")
+	}
+	return nil
+}
+
+func (m *Memory) CreateBlock(ctx context.Context, arg database.CreateBlockParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRelationship("blocks", "blocker_id", "blocked_id", arg.BlockerID, arg.BlockedID); err != nil {
+		return err
+	}
+
+	// ON CONFLICT DO NOTHING
+	if m.blockedBy(uuid.NullUUID{UUID: arg.BlockedID, Valid: true}, arg.BlockerID) {
+		return nil
+	}
+
+	m.blocks = append(m.blocks, database.Block{
+		BlockerID: arg.BlockerID,
+		BlockedID: arg.BlockedID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (m *Memory) DeleteBlock(ctx context.Context, arg database.DeleteBlockParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blocks = slices.DeleteFunc(m.blocks, func(b database.Block) bool {
+		return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID
+	})
+	return nil
+}
+
+func (m *Memory) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.blockedBy(uuid.NullUUID{UUID: arg.BlockedID, Valid: true}, arg.BlockerID), nil
+}
+
+func (m *Memory) ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]database.Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var blocks []database.Block
+	for _, b := range m.blocks {
+		if b.BlockerID == blockerID {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (m *Memory) IsInteractionHidden(ctx context.Context, arg database.IsInteractionHiddenParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	recipient := uuid.NullUUID{UUID: arg.RecipientID, Valid: true}
+	actor := uuid.NullUUID{UUID: arg.ActorID, Valid: true}
+
+	return m.blockedBy(recipient, arg.ActorID) || m.blockedBy(actor, arg.RecipientID) || m.muted(recipient, arg.ActorID), nil
+}
+
+func (m *Memory) ListBlockerIDs(ctx context.Context, blockedID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, b := range m.blocks {
+		if b.BlockedID == blockedID {
+			ids = append(ids, b.BlockerID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) CreateMute(ctx context.Context, arg database.CreateMuteParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRelationship("mutes", "muter_id", "muted_id", arg.MuterID, arg.MutedID); err != nil {
+		return err
+	}
+
+	// ON CONFLICT DO NOTHING
+	if m.muted(uuid.NullUUID{UUID: arg.MuterID, Valid: true}, arg.MutedID) {
+		return nil
+	}
+
+	m.mutes = append(m.mutes, database.Mute{
+		MuterID:   arg.MuterID,
+		MutedID:   arg.MutedID,
+		CreatedAt: now(),
+	})
+	return nil
+}
+
+func (m *Memory) DeleteMute(ctx context.Context, arg database.DeleteMuteParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mutes = slices.DeleteFunc(m.mutes, func(mu database.Mute) bool {
+		return mu.MuterID == arg.MuterID && mu.MutedID == arg.MutedID
+	})
+	return nil
+}
+
+func (m *Memory) ListMutes(ctx context.Context, muterID uuid.UUID) ([]database.Mute, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var mutes []database.Mute
+	for _, mu := range m.mutes {
+		if mu.MuterID == muterID {
+			mutes = append(mutes, mu)
+		}
+	}
+	return mutes, nil
+}
+
+func (m *Memory) CreateFollow(ctx context.Context, arg database.CreateFollowParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRelationship("follows", "follower_id", "followee_id", arg.FollowerID, arg.FolloweeID); err != nil {
+		return err
+	}
+
+	// ON CONFLICT DO NOTHING
+	if m.following(arg.FollowerID, arg.FolloweeID) {
+		return nil
+	}
+
+	m.follows = append(m.follows, database.Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  now(),
+	})
+	return nil
+}
+
+func (m *Memory) DeleteFollow(ctx context.Context, arg database.DeleteFollowParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.follows = slices.DeleteFunc(m.follows, func(f database.Follow) bool {
+		return f.FollowerID == arg.FollowerID && f.FolloweeID == arg.FolloweeID
+	})
+	return nil
+}
+
+func (m *Memory) ListFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, f := range m.follows {
+		if f.FollowerID == followerID {
+			ids = append(ids, f.FolloweeID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// Reports still waiting on a moderator, mirrors the reports_pending_unique partial index
+func reportPending(r database.Report) bool {
+	return r.Status == "open" || r.Status == "triaged"
+}
+
+// Callers hold the lock
+func (m *Memory) hasReport(id uuid.UUID) bool {
+	return slices.ContainsFunc(m.reports, func(r database.Report) bool {
+		return r.ID == id
+	})
+}
+
+func (m *Memory) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.ReporterID]; !ok {
+		return database.Report{}, foreignKeyViolation("reports_reporter_id_fkey")
+	}
+
+	if _, ok := m.users[arg.TargetUserID]; !ok {
+		return database.Report{}, foreignKeyViolation("reports_target_user_id_fkey")
+	}
+
+	if arg.ChirpID.Valid {
+		if _, ok := m.chirpIndex(arg.ChirpID.UUID); !ok {
+			return database.Report{}, foreignKeyViolation("reports_chirp_id_fkey")
+		}
+	}
+
+	for _, r := range m.reports {
+		if reportPending(r) && r.ReporterID == arg.ReporterID && r.TargetUserID == arg.TargetUserID && r.ChirpID == arg.ChirpID {
+			return database.Report{}, uniqueViolation("reports_pending_unique")
+		}
+	}
+
+	ts := now()
+	report := database.Report{
+		ID:           uuid.New(),
+		CreatedAt:    ts,
+		UpdatedAt:    ts,
+		ReporterID:   arg.ReporterID,
+		TargetUserID: arg.TargetUserID,
+		ChirpID:      arg.ChirpID,
+		Reason:       arg.Reason,
+		Details:      arg.Details,
+		Status:       "open",
+	}
+	m.reports = append(m.reports, report)
+
+	return report, nil
+}
+
+func (m *Memory) ListReports(ctx context.Context, status string) ([]database.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reports []database.Report
+	for _, r := range m.reports {
+		if status == "" || r.Status == status {
+			reports = append(reports, r)
+		}
+	}
+
+	return reports, nil
+}
+
+func (m *Memory) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.reports {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateReportStatus(ctx context.Context, arg database.UpdateReportStatusParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, r := range m.reports {
+		if r.ID != arg.ID || (r.Status != "open" && r.Status != "triaged") || r.Status == arg.Status {
+			continue
+		}
+
+		m.reports[i].Status = arg.Status
+		m.reports[i].UpdatedAt = now()
+		return m.reports[i], nil
+	}
+
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.ActorID.UUID]; arg.ActorID.Valid && !ok {
+		return database.ModerationAction{}, foreignKeyViolation("moderation_actions_actor_id_fkey")
+	}
+
+	if arg.ReportID.Valid && !m.hasReport(arg.ReportID.UUID) {
+		return database.ModerationAction{}, foreignKeyViolation("moderation_actions_report_id_fkey")
+	}
+
+	action := database.ModerationAction{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		ActorID:      arg.ActorID,
+		ReportID:     arg.ReportID,
+		Action:       arg.Action,
+		TargetUserID: arg.TargetUserID,
+		ChirpID:      arg.ChirpID,
+		Note:         arg.Note,
+	}
+	m.moderationActions = append(m.moderationActions, action)
+
+	return action, nil
+}
+
+func (m *Memory) ListModerationActions(ctx context.Context) ([]database.ModerationAction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.moderationActions), nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.ScheduledChirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.ScheduledChirp{}, foreignKeyViolation("scheduled_chirps_user_id_fkey")
+	}
+
+	ts := now()
+	chirp := database.ScheduledChirp{
+		ID:        uuid.New(),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+		UserID:    arg.UserID,
+		Body:      arg.Body,
+		ReplyToID: arg.ReplyToID,
+		PublishAt: arg.PublishAt,
+	}
+	m.scheduledChirps = append(m.scheduledChirps, chirp)
+
+	return chirp, nil
+}
+
+func (m *Memory) ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chirps []database.ScheduledChirp
+	for _, c := range m.scheduledChirps {
+		if c.UserID == userID {
+			chirps = append(chirps, c)
+		}
+	}
+
+	slices.SortFunc(chirps, compareScheduledChirps)
+	return chirps, nil
+}
+
+func (m *Memory) DeleteScheduledChirp(ctx context.Context, arg database.DeleteScheduledChirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.scheduledChirps)
+	m.scheduledChirps = slices.DeleteFunc(m.scheduledChirps, func(c database.ScheduledChirp) bool {
+		return c.ID == arg.ID && c.UserID == arg.UserID
+	})
+	return int64(before - len(m.scheduledChirps)), nil
+}
+
+// Nothing else runs during a Memory transaction, so there are no locked rows to skip
+func (m *Memory) ClaimDueScheduledChirps(ctx context.Context, limit int32) ([]database.ScheduledChirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ts := now()
+
+	var due []database.ScheduledChirp
+	for _, c := range m.scheduledChirps {
+		author, ok := m.users[c.UserID]
+		if c.Failure.Valid || c.PublishAt.After(ts) || !ok || author.SuspendedAt.Valid || author.DeletionScheduledAt.Valid {
+			continue
+		}
+		due = append(due, c)
+	}
+
+	slices.SortFunc(due, compareScheduledChirps)
+
+	if len(due) > int(limit) {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *Memory) DeletePublishedScheduledChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scheduledChirps = slices.DeleteFunc(m.scheduledChirps, func(c database.ScheduledChirp) bool {
+		return c.ID == id
+	})
+	return nil
+}
+
+func (m *Memory) FailScheduledChirp(ctx context.Context, arg database.FailScheduledChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.scheduledChirps {
+		if c.ID == arg.ID {
+			m.scheduledChirps[i].Failure = arg.Failure
+			m.scheduledChirps[i].UpdatedAt = now()
+		}
+	}
+	return nil
+}
+
+// ORDER BY publish_at, id
+func compareScheduledChirps(a, b database.ScheduledChirp) int {
+	if c := a.PublishAt.Compare(b.PublishAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
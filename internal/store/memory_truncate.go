@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+)
+
+// Tables holding a foreign key to each table, TRUNCATE ... CASCADE empties them too
+// whatever their ON DELETE action is
+var referencedBy = map[string][]string{
+	"users": {
+		"chirps", "drafts", "scheduled_chirps", "poll_voters", "refresh_tokens", "api_keys", "oauth_clients", "oauth_authorization_codes", "user_identities", "oidc_login_states", "magic_links", "likes", "bookmarks", "lists", "list_members", "follows", "blocks", "mutes", "reports", "moderation_actions",
+		"notifications", "notification_actors", "notification_preferences",
+	},
+	"oauth_clients":      {"oauth_authorization_codes", "refresh_tokens"},
+	"chirps":             {"polls", "likes", "bookmarks", "reports", "moderation_actions", "moderation_flags", "notifications"},
+	"polls":              {"poll_options", "poll_voters"},
+	"poll_options":       {"poll_votes"},
+	"poll_voters":        {"poll_votes"},
+	"lists":              {"list_members"},
+	"reports":            {"moderation_actions"},
+	"notifications":      {"notification_actors"},
+	"webhooks":           {"webhook_deliveries", "webhook_delivery_attempts"},
+	"webhook_deliveries": {"webhook_delivery_attempts"},
+}
+
+func (m *Memory) Truncate(ctx context.Context, tables ...string) error {
+
+	if err := checkTables(tables); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	truncated := map[string]bool{}
+
+	var walk func(table string)
+	walk = func(table string) {
+		if truncated[table] {
+			return
+		}
+		truncated[table] = true
+
+		for _, child := range referencedBy[table] {
+			walk(child)
+		}
+	}
+
+	for _, table := range tables {
+		walk(table)
+	}
+
+	for table := range truncated {
+		switch table {
+		case "users":
+			clear(m.users)
+		case "chirps":
+			m.chirps = nil
+		case "drafts":
+			m.drafts = nil
+		case "scheduled_chirps":
+			m.scheduledChirps = nil
+		case "polls":
+			m.polls = nil
+		case "poll_options":
+			m.pollOptions = nil
+		case "poll_voters":
+			m.pollVoters = nil
+		case "poll_votes":
+			m.pollVotes = nil
+		case "refresh_tokens":
+			clear(m.refreshTokens)
+		case "api_keys":
+			m.apiKeys = nil
+		case "oauth_clients":
+			m.oauthClients = nil
+		case "oauth_authorization_codes":
+			m.oauthCodes = nil
+		case "user_identities":
+			m.identities = nil
+		case "oidc_login_states":
+			m.oidcLoginStates = nil
+		case "magic_links":
+			m.magicLinks = nil
+		case "magic_link_requests":
+			m.magicLinkRequests = nil
+		case "likes":
+			m.likes = nil
+		case "bookmarks":
+			m.bookmarks = nil
+		case "lists":
+			m.lists = nil
+		case "list_members":
+			m.listMembers = nil
+		case "follows":
+			m.follows = nil
+		case "blocks":
+			m.blocks = nil
+		case "mutes":
+			m.mutes = nil
+		case "reports":
+			m.reports = nil
+		case "moderation_actions":
+			m.moderationActions = nil
+		case "moderation_flags":
+			m.moderationFlags = nil
+		case "moderation_rules":
+			m.moderationRules = nil
+		case "notifications":
+			m.notifications = nil
+		case "notification_actors":
+			m.notificationActors = nil
+		case "notification_preferences":
+			m.notificationPreferences = nil
+		case "outbox":
+			m.outbox = nil
+		case "webhooks":
+			m.webhooks = nil
+		case "webhook_deliveries":
+			m.webhookDeliveries = nil
+		case "webhook_delivery_attempts":
+			m.webhookDeliveryAttempts = nil
+		}
+	}
+
+	return nil
+}
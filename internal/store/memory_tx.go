@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// The tables of a Memory, copied before a transaction so a rollback can put them back
+type memoryState struct {
+	users                   map[uuid.UUID]database.User
+	chirps                  []database.Chirp
+	drafts                  []database.Draft
+	scheduledChirps         []database.ScheduledChirp
+	polls                   []database.Poll
+	pollOptions             []database.PollOption
+	pollVoters              []database.PollVoter
+	pollVotes               []database.PollVote
+	refreshTokens           map[string]database.RefreshToken
+	apiKeys                 []database.ApiKey
+	oauthClients            []database.OauthClient
+	oauthCodes              []database.OauthAuthorizationCode
+	identities              []database.UserIdentity
+	oidcLoginStates         []database.OidcLoginState
+	magicLinks              []database.MagicLink
+	magicLinkRequests       []database.MagicLinkRequest
+	moderationRules         []database.ModerationRule
+	moderationFlags         []database.ModerationFlag
+	reports                 []database.Report
+	moderationActions       []database.ModerationAction
+	blocks                  []database.Block
+	mutes                   []database.Mute
+	follows                 []database.Follow
+	likes                   []database.Like
+	bookmarks               []database.Bookmark
+	lists                   []database.List
+	listMembers             []database.ListMember
+	notifications           []database.Notification
+	notificationActors      []database.NotificationActor
+	notificationPreferences []database.NotificationPreference
+	outbox                  []database.Outbox
+	webhooks                []database.Webhook
+	webhookDeliveries       []database.WebhookDelivery
+	webhookDeliveryAttempts []database.WebhookDeliveryAttempt
+}
+
+// InTx runs fn against m itself and restores the previous state of every table when it fails.
+// Transactions are serialized against each other but not isolated from calls made outside of
+// one, which is enough for the tests.
+func (m *Memory) InTx(ctx context.Context, fn func(tx Store) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	saved := m.snapshot()
+
+	if err := fn(m); err != nil {
+		m.restore(saved)
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) snapshot() memoryState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Rows are plain values, copying the containers is enough
+	return memoryState{
+		users:                   maps.Clone(m.users),
+		chirps:                  slices.Clone(m.chirps),
+		drafts:                  slices.Clone(m.drafts),
+		scheduledChirps:         slices.Clone(m.scheduledChirps),
+		polls:                   slices.Clone(m.polls),
+		pollOptions:             slices.Clone(m.pollOptions),
+		pollVoters:              slices.Clone(m.pollVoters),
+		pollVotes:               slices.Clone(m.pollVotes),
+		refreshTokens:           maps.Clone(m.refreshTokens),
+		apiKeys:                 slices.Clone(m.apiKeys),
+		oauthClients:            slices.Clone(m.oauthClients),
+		oauthCodes:              slices.Clone(m.oauthCodes),
+		identities:              slices.Clone(m.identities),
+		oidcLoginStates:         slices.Clone(m.oidcLoginStates),
+		magicLinks:              slices.Clone(m.magicLinks),
+		magicLinkRequests:       slices.Clone(m.magicLinkRequests),
+		moderationRules:         slices.Clone(m.moderationRules),
+		moderationFlags:         slices.Clone(m.moderationFlags),
+		reports:                 slices.Clone(m.reports),
+		moderationActions:       slices.Clone(m.moderationActions),
+		blocks:                  slices.Clone(m.blocks),
+		mutes:                   slices.Clone(m.mutes),
+		follows:                 slices.Clone(m.follows),
+		likes:                   slices.Clone(m.likes),
+		bookmarks:               slices.Clone(m.bookmarks),
+		lists:                   slices.Clone(m.lists),
+		listMembers:             slices.Clone(m.listMembers),
+		notifications:           slices.Clone(m.notifications),
+		notificationActors:      slices.Clone(m.notificationActors),
+		notificationPreferences: slices.Clone(m.notificationPreferences),
+		outbox:                  slices.Clone(m.outbox),
+		webhooks:                slices.Clone(m.webhooks),
+		webhookDeliveries:       slices.Clone(m.webhookDeliveries),
+		webhookDeliveryAttempts: slices.Clone(m.webhookDeliveryAttempts),
+	}
+}
+
+func (m *Memory) restore(s memoryState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users = s.users
+	m.chirps = s.chirps
+	m.drafts = s.drafts
+	m.scheduledChirps = s.scheduledChirps
+	m.polls = s.polls
+	m.pollOptions = s.pollOptions
+	m.pollVoters = s.pollVoters
+	m.pollVotes = s.pollVotes
+	m.refreshTokens = s.refreshTokens
+	m.apiKeys = s.apiKeys
+	m.oauthClients = s.oauthClients
+	m.oauthCodes = s.oauthCodes
+	m.identities = s.identities
+	m.oidcLoginStates = s.oidcLoginStates
+	m.magicLinks = s.magicLinks
+	m.magicLinkRequests = s.magicLinkRequests
+	m.moderationRules = s.moderationRules
+	m.moderationFlags = s.moderationFlags
+	m.reports = s.reports
+	m.moderationActions = s.moderationActions
+	m.blocks = s.blocks
+	m.mutes = s.mutes
+	m.follows = s.follows
+	m.likes = s.likes
+	m.bookmarks = s.bookmarks
+	m.lists = s.lists
+	m.listMembers = s.listMembers
+	m.notifications = s.notifications
+	m.notificationActors = s.notificationActors
+	m.notificationPreferences = s.notificationPreferences
+	m.outbox = s.outbox
+	m.webhooks = s.webhooks
+	m.webhookDeliveries = s.webhookDeliveries
+	m.webhookDeliveryAttempts = s.webhookDeliveryAttempts
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+func (m *Memory) CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := now()
+	webhook := database.Webhook{
+		ID:          uuid.New(),
+		CreatedAt:   ts,
+		UpdatedAt:   ts,
+		Url:         arg.Url,
+		Description: arg.Description,
+		EventTypes:  cloneStrings(arg.EventTypes),
+		Secret:      arg.Secret,
+		Active:      true,
+	}
+
+	m.webhooks = append(m.webhooks, webhook)
+	return copyWebhook(webhook), nil
+}
+
+func (m *Memory) ListWebhooks(ctx context.Context) ([]database.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := make([]database.Webhook, 0, len(m.webhooks))
+	for _, w := range m.webhooks {
+		webhooks = append(webhooks, copyWebhook(w))
+	}
+	return webhooks, nil
+}
+
+func (m *Memory) GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, w := range m.webhooks {
+		if w.ID == id {
+			return copyWebhook(w), nil
+		}
+	}
+	return database.Webhook{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateWebhook(ctx context.Context, arg database.UpdateWebhookParams) (database.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, w := range m.webhooks {
+		if w.ID == arg.ID {
+			m.webhooks[i].Url = arg.Url
+			m.webhooks[i].Description = arg.Description
+			m.webhooks[i].EventTypes = cloneStrings(arg.EventTypes)
+			m.webhooks[i].Active = arg.Active
+			m.webhooks[i].UpdatedAt = now()
+			return copyWebhook(m.webhooks[i]), nil
+		}
+	}
+	return database.Webhook{}, sql.ErrNoRows
+}
+
+// Cascades to the deliveries and their attempts, like the foreign keys
+func (m *Memory) DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.webhooks)
+	m.webhooks = slices.DeleteFunc(m.webhooks, func(w database.Webhook) bool { return w.ID == id })
+
+	deleted := map[uuid.UUID]bool{}
+	m.webhookDeliveries = slices.DeleteFunc(m.webhookDeliveries, func(d database.WebhookDelivery) bool {
+		if d.WebhookID == id {
+			deleted[d.ID] = true
+		}
+		return d.WebhookID == id
+	})
+	m.webhookDeliveryAttempts = slices.DeleteFunc(m.webhookDeliveryAttempts, func(a database.WebhookDeliveryAttempt) bool {
+		return deleted[a.DeliveryID]
+	})
+
+	return int64(before - len(m.webhooks)), nil
+}
+
+func (m *Memory) ListWebhooksForEvent(ctx context.Context, arg database.ListWebhooksForEventParams) ([]database.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var webhooks []database.Webhook
+	for _, w := range m.webhooks {
+		subscribed := len(w.EventTypes) == 0 || slices.Contains(w.EventTypes, arg.EventType)
+		if w.Active && subscribed && !w.CreatedAt.After(arg.OccurredAt) {
+			webhooks = append(webhooks, copyWebhook(w))
+		}
+	}
+	return webhooks, nil
+}
+
+// ON CONFLICT DO NOTHING: a second copy of the event is dropped
+func (m *Memory) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.webhooks, func(w database.Webhook) bool { return w.ID == arg.WebhookID }) {
+		return foreignKeyViolation("webhook_deliveries_webhook_id_fkey")
+	}
+
+	if slices.ContainsFunc(m.webhookDeliveries, func(d database.WebhookDelivery) bool {
+		return d.WebhookID == arg.WebhookID && d.EventID == arg.EventID
+	}) {
+		return nil
+	}
+
+	ts := now()
+	m.webhookDeliveries = append(m.webhookDeliveries, database.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     arg.WebhookID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       slices.Clone(arg.Payload),
+		Status:        "pending",
+		NextAttemptAt: ts,
+		CreatedAt:     ts,
+		UpdatedAt:     ts,
+	})
+	return nil
+}
+
+// Mirrors the lease in the query, the lock makes FOR UPDATE SKIP LOCKED unnecessary
+func (m *Memory) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := map[uuid.UUID]bool{}
+	for _, w := range m.webhooks {
+		active[w.ID] = w.Active
+	}
+
+	ts := now()
+
+	var due []int
+	for i, d := range m.webhookDeliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(ts) && active[d.WebhookID] {
+			due = append(due, i)
+		}
+	}
+
+	slices.SortStableFunc(due, func(a, b int) int {
+		return m.webhookDeliveries[a].NextAttemptAt.Compare(m.webhookDeliveries[b].NextAttemptAt)
+	})
+
+	if len(due) > int(arg.BatchSize) {
+		due = due[:arg.BatchSize]
+	}
+
+	claimed := make([]database.WebhookDelivery, 0, len(due))
+	for _, i := range due {
+		m.webhookDeliveries[i].NextAttemptAt = ts.Add(time.Duration(arg.LeaseMs) * time.Millisecond)
+		claimed = append(claimed, copyWebhookDelivery(m.webhookDeliveries[i]))
+	}
+	return claimed, nil
+}
+
+func (m *Memory) UpdateWebhookDeliveryResult(ctx context.Context, arg database.UpdateWebhookDeliveryResultParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, ok := m.webhookDeliveryIndex(arg.ID); ok {
+		d := &m.webhookDeliveries[i]
+		d.Status = arg.Status
+		d.Attempts++
+		d.NextAttemptAt = arg.NextAttemptAt
+		d.LastStatusCode = arg.LastStatusCode
+		d.LastError = arg.LastError
+		d.DeliveredAt = arg.DeliveredAt
+		d.UpdatedAt = now()
+	}
+	return nil
+}
+
+func (m *Memory) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []database.WebhookDelivery
+	for _, d := range m.webhookDeliveries {
+		if d.WebhookID == arg.WebhookID && (arg.Status == "" || d.Status == arg.Status) {
+			deliveries = append(deliveries, copyWebhookDelivery(d))
+		}
+	}
+
+	// ORDER BY created_at DESC, id DESC
+	slices.SortFunc(deliveries, func(a, b database.WebhookDelivery) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID.String(), a.ID.String()))
+	})
+
+	if len(deliveries) > int(arg.RowLimit) {
+		deliveries = deliveries[:arg.RowLimit]
+	}
+	return deliveries, nil
+}
+
+func (m *Memory) GetWebhookDelivery(ctx context.Context, arg database.GetWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if i, ok := m.webhookDeliveryIndex(arg.ID); ok && m.webhookDeliveries[i].WebhookID == arg.WebhookID {
+		return copyWebhookDelivery(m.webhookDeliveries[i]), nil
+	}
+	return database.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (m *Memory) RedeliverWebhookDelivery(ctx context.Context, arg database.RedeliverWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.webhookDeliveryIndex(arg.ID)
+	if !ok || m.webhookDeliveries[i].WebhookID != arg.WebhookID {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+
+	ts := now()
+	d := &m.webhookDeliveries[i]
+	d.Status = "pending"
+	d.Attempts = 0
+	d.NextAttemptAt = ts
+	d.UpdatedAt = ts
+	return copyWebhookDelivery(*d), nil
+}
+
+func (m *Memory) CreateWebhookDeliveryAttempt(ctx context.Context, arg database.CreateWebhookDeliveryAttemptParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhookDeliveryIndex(arg.DeliveryID); !ok {
+		return foreignKeyViolation("webhook_delivery_attempts_delivery_id_fkey")
+	}
+
+	m.webhookDeliveryAttempts = append(m.webhookDeliveryAttempts, database.WebhookDeliveryAttempt{
+		ID:           uuid.New(),
+		DeliveryID:   arg.DeliveryID,
+		AttemptedAt:  arg.AttemptedAt,
+		DurationMs:   arg.DurationMs,
+		StatusCode:   arg.StatusCode,
+		Error:        arg.Error,
+		ResponseBody: arg.ResponseBody,
+	})
+	return nil
+}
+
+func (m *Memory) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]database.WebhookDeliveryAttempt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var attempts []database.WebhookDeliveryAttempt
+	for _, a := range m.webhookDeliveryAttempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+
+	slices.SortStableFunc(attempts, func(a, b database.WebhookDeliveryAttempt) int {
+		return a.AttemptedAt.Compare(b.AttemptedAt)
+	})
+	return attempts, nil
+}
+
+func (m *Memory) webhookDeliveryIndex(id uuid.UUID) (int, bool) {
+	for i, d := range m.webhookDeliveries {
+		if d.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// NOT NULL DEFAULT '{}', a nil slice reads back as empty
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return slices.Clone(s)
+}
+
+// Callers get their own slices, as they would from a query
+func copyWebhook(w database.Webhook) database.Webhook {
+	w.EventTypes = cloneStrings(w.EventTypes)
+	return w
+}
+
+func copyWebhookDelivery(d database.WebhookDelivery) database.WebhookDelivery {
+	d.Payload = slices.Clone(d.Payload)
+	return d
+}
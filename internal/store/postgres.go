@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/itsmandrew/server-go/internal/database"
+	"github.com/itsmandrew/server-go/sql/schema"
+	"github.com/lib/pq"
+)
+
+// Postgres is the production Store, the sqlc queries plus the connection they run on
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{
+		Queries: database.New(db),
+		db:      db,
+	}
+}
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// InTx binds the queries to a transaction with Queries.WithTx. Calling InTx again on the Store
+// handed to fn starts a separate transaction on another connection, not a nested one.
+func (p *Postgres) InTx(ctx context.Context, fn func(tx Store) error) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	// A no-op once committed
+	defer tx.Rollback()
+
+	if err := fn(&Postgres{Queries: p.Queries.WithTx(tx), db: p.db}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Table names can't be bind parameters, they are checked against Tables and quoted instead
+func (p *Postgres) Truncate(ctx context.Context, tables ...string) error {
+
+	if err := checkTables(tables); err != nil {
+		return err
+	}
+
+	if len(tables) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = pq.QuoteIdentifier(table)
+	}
+
+	_, err := p.db.ExecContext(ctx, "TRUNCATE TABLE "+strings.Join(quoted, ", ")+" CASCADE")
+	return err
+}
+
+// Compares the version recorded by goose in the database against the embedded migrations.
+// Unlike internal/migrate it doesn't take the migration lock, the readiness probe must not
+// wait for a migration running on another instance.
+func (p *Postgres) MigrationStatus(ctx context.Context) (MigrationStatus, error) {
+
+	versions, err := schemaVersions(schema.FS)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	var current int64
+	err = p.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version_id), 0)
+		FROM goose_db_version
+		WHERE is_applied`).Scan(&current)
+
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{CurrentVersion: current}
+
+	for _, version := range versions {
+		status.LatestVersion = max(status.LatestVersion, version)
+		if version > current {
+			status.Pending++
+		}
+	}
+
+	return status, nil
+}
+
+// Goose migration files are named "<version>_<name>.sql", returns every version found in fsys
+func schemaVersions(fsys fs.FS) ([]int64, error) {
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found {
+			continue
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
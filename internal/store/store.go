@@ -0,0 +1,350 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/itsmandrew/server-go/internal/database"
+)
+
+// Store is the repository layer the services talk to. The method set mirrors the sqlc
+// generated queries so *database.Queries satisfies it as is, and Memory can stand in for tests.
+type Store interface {
+	UserStore
+	ChirpStore
+	DraftStore
+	ScheduledChirpStore
+	PollStore
+	RefreshTokenStore
+	APIKeyStore
+	OAuthStore
+	IdentityStore
+	MagicLinkStore
+	ModerationStore
+	ReportStore
+	RelationshipStore
+	LikeStore
+	BookmarkStore
+	ListStore
+	NotificationStore
+	OutboxStore
+	WebhookStore
+	Health
+	Truncater
+	Transactor
+}
+
+// Transactor runs several store calls atomically
+type Transactor interface {
+	// InTx calls fn with a Store bound to a new transaction, committed when fn returns nil and
+	// rolled back otherwise. Calls on the outer Store don't see the changes until the commit.
+	InTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	DeleteUsers(ctx context.Context) error
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByIDNoPassword(ctx context.Context, id uuid.UUID) (database.GetUserByIDNoPasswordRow, error)
+	GetUserProfileByHandle(ctx context.Context, handle string) (database.GetUserProfileByHandleRow, error)
+	GetUserSummaries(ctx context.Context, ids []uuid.UUID) ([]database.GetUserSummariesRow, error)
+	GetUserIDsByHandles(ctx context.Context, handles []string) ([]database.GetUserIDsByHandlesRow, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) error
+	VerifyUserEmail(ctx context.Context, id uuid.UUID) error
+	UpdateUserAvatar(ctx context.Context, arg database.UpdateUserAvatarParams) error
+	UpdateUserBanner(ctx context.Context, arg database.UpdateUserBannerParams) error
+	UpdateIsChirpyRedByID(ctx context.Context, id uuid.UUID) (int64, error)
+	SuspendUser(ctx context.Context, id uuid.UUID) error
+	UpdateUserRole(ctx context.Context, arg database.UpdateUserRoleParams) (int64, error)
+	CountUsersByRole(ctx context.Context, role string) (int64, error)
+	ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) error
+	CancelUserDeletion(ctx context.Context, id uuid.UUID) error
+	DeleteDueUsers(ctx context.Context, deletionScheduledAt sql.NullTime) ([]database.DeleteDueUsersRow, error)
+}
+
+type ChirpStore interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirps(ctx context.Context, arg database.GetChirpsParams) ([]database.Chirp, error)
+	GetIndividualChirp(ctx context.Context, arg database.GetIndividualChirpParams) (database.Chirp, error)
+	DeleteChirpByID(ctx context.Context, id uuid.UUID) error
+	HideChirp(ctx context.Context, id uuid.UUID) error
+	ListChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+}
+
+// DraftStore holds the chirps their authors are still writing
+type DraftStore interface {
+	CreateDraft(ctx context.Context, arg database.CreateDraftParams) (database.Draft, error)
+	ListDrafts(ctx context.Context, userID uuid.UUID) ([]database.Draft, error)
+	GetDraft(ctx context.Context, arg database.GetDraftParams) (database.Draft, error)
+	UpdateDraft(ctx context.Context, arg database.UpdateDraftParams) (database.Draft, error)
+	DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error)
+}
+
+// ScheduledChirpStore holds the chirps waiting for their publish time
+type ScheduledChirpStore interface {
+	CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.ScheduledChirp, error)
+	ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error)
+	DeleteScheduledChirp(ctx context.Context, arg database.DeleteScheduledChirpParams) (int64, error)
+	ClaimDueScheduledChirps(ctx context.Context, limit int32) ([]database.ScheduledChirp, error)
+	DeletePublishedScheduledChirp(ctx context.Context, id uuid.UUID) error
+	FailScheduledChirp(ctx context.Context, arg database.FailScheduledChirpParams) error
+}
+
+// PollStore holds the polls attached to chirps and their votes
+type PollStore interface {
+	CreatePoll(ctx context.Context, arg database.CreatePollParams) error
+	CreatePollOption(ctx context.Context, arg database.CreatePollOptionParams) error
+	GetPolls(ctx context.Context, arg database.GetPollsParams) ([]database.GetPollsRow, error)
+	CreatePollVoter(ctx context.Context, arg database.CreatePollVoterParams) (int64, error)
+	CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) error
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	ClaimRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.ListUserSessionsRow, error)
+}
+
+// APIKeyStore holds the personal API keys, looked up by the hash of the key
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, arg database.CreateAPIKeyParams) (database.ApiKey, error)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error)
+	CountActiveAPIKeys(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (database.GetAPIKeyByHashRow, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID) error
+	RevokeAPIKey(ctx context.Context, arg database.RevokeAPIKeyParams) (database.ApiKey, error)
+}
+
+// OAuthStore holds the third-party clients and the authorization codes issued to them, their
+// refresh tokens live with the others in RefreshTokenStore
+type OAuthStore interface {
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error)
+	GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error)
+	DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error
+	ConsumeOAuthAuthorizationCode(ctx context.Context, arg database.ConsumeOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error)
+}
+
+type ModerationStore interface {
+	CreateModerationRule(ctx context.Context, arg database.CreateModerationRuleParams) (database.ModerationRule, error)
+	ListModerationRules(ctx context.Context) ([]database.ModerationRule, error)
+	DeleteModerationRule(ctx context.Context, id uuid.UUID) (int64, error)
+	CreateModerationFlag(ctx context.Context, arg database.CreateModerationFlagParams) (database.ModerationFlag, error)
+	ListModerationFlags(ctx context.Context) ([]database.ListModerationFlagsRow, error)
+}
+
+type ReportStore interface {
+	CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error)
+	ListReports(ctx context.Context, status string) ([]database.Report, error)
+	GetReport(ctx context.Context, id uuid.UUID) (database.Report, error)
+	UpdateReportStatus(ctx context.Context, arg database.UpdateReportStatusParams) (database.Report, error)
+	CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error)
+	ListModerationActions(ctx context.Context) ([]database.ModerationAction, error)
+}
+
+type RelationshipStore interface {
+	CreateBlock(ctx context.Context, arg database.CreateBlockParams) error
+	DeleteBlock(ctx context.Context, arg database.DeleteBlockParams) error
+	ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]database.Block, error)
+	CreateMute(ctx context.Context, arg database.CreateMuteParams) error
+	DeleteMute(ctx context.Context, arg database.DeleteMuteParams) error
+	ListMutes(ctx context.Context, muterID uuid.UUID) ([]database.Mute, error)
+	IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error)
+	ListBlockerIDs(ctx context.Context, blockedID uuid.UUID) ([]uuid.UUID, error)
+	IsInteractionHidden(ctx context.Context, arg database.IsInteractionHiddenParams) (bool, error)
+	CreateFollow(ctx context.Context, arg database.CreateFollowParams) error
+	DeleteFollow(ctx context.Context, arg database.DeleteFollowParams) error
+	ListFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type LikeStore interface {
+	CreateLike(ctx context.Context, arg database.CreateLikeParams) error
+	DeleteLike(ctx context.Context, arg database.DeleteLikeParams) error
+	ListLikesByUser(ctx context.Context, userID uuid.UUID) ([]database.Like, error)
+	CountLikes(ctx context.Context, chirpID uuid.UUID) (int64, error)
+}
+
+// BookmarkStore holds the chirps users saved for later
+type BookmarkStore interface {
+	CreateBookmark(ctx context.Context, arg database.CreateBookmarkParams) error
+	DeleteBookmark(ctx context.Context, arg database.DeleteBookmarkParams) error
+	ListBookmarkedChirps(ctx context.Context, arg database.ListBookmarkedChirpsParams) ([]database.Chirp, error)
+}
+
+// ListStore holds the lists of users curated by their owners and the timelines built from them
+type ListStore interface {
+	CreateList(ctx context.Context, arg database.CreateListParams) (database.List, error)
+	GetList(ctx context.Context, id uuid.UUID) (database.List, error)
+	ListListsByOwner(ctx context.Context, ownerID uuid.UUID) ([]database.List, error)
+	UpdateList(ctx context.Context, arg database.UpdateListParams) (database.List, error)
+	DeleteList(ctx context.Context, id uuid.UUID) error
+	AddListMember(ctx context.Context, arg database.AddListMemberParams) error
+	RemoveListMember(ctx context.Context, arg database.RemoveListMemberParams) error
+	RemoveListMemberships(ctx context.Context, arg database.RemoveListMembershipsParams) error
+	ListListMembers(ctx context.Context, listID uuid.UUID) ([]database.ListMember, error)
+	GetListChirps(ctx context.Context, arg database.GetListChirpsParams) ([]database.Chirp, error)
+}
+
+type NotificationStore interface {
+	UpsertNotification(ctx context.Context, arg database.UpsertNotificationParams) (database.Notification, error)
+	AddNotificationActor(ctx context.Context, arg database.AddNotificationActorParams) error
+	ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.ListNotificationsRow, error)
+	ListNotificationActors(ctx context.Context, notificationIds []uuid.UUID) ([]database.NotificationActor, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error)
+	ListNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error)
+	SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error
+}
+
+// Health backs the readiness probe
+type Health interface {
+	Ping(ctx context.Context) error
+	MigrationStatus(ctx context.Context) (MigrationStatus, error)
+}
+
+// OutboxStore holds the domain events waiting for the dispatcher, see internal/events
+type OutboxStore interface {
+	CreateOutboxEvent(ctx context.Context, arg database.CreateOutboxEventParams) error
+	ClaimOutboxEvents(ctx context.Context, arg database.ClaimOutboxEventsParams) ([]database.Outbox, error)
+	CompleteOutboxEvent(ctx context.Context, arg database.CompleteOutboxEventParams) error
+	RetryOutboxEvent(ctx context.Context, arg database.RetryOutboxEventParams) error
+	ListOutboxEvents(ctx context.Context, limit int32) ([]database.Outbox, error)
+	DeleteDispatchedOutboxEvents(ctx context.Context, dispatchedAt sql.NullTime) (int64, error)
+}
+
+// WebhookStore holds the partner webhooks, their deliveries and the delivery log
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]database.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (database.Webhook, error)
+	UpdateWebhook(ctx context.Context, arg database.UpdateWebhookParams) (database.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error)
+	ListWebhooksForEvent(ctx context.Context, arg database.ListWebhooksForEventParams) ([]database.Webhook, error)
+	CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error
+	ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	UpdateWebhookDeliveryResult(ctx context.Context, arg database.UpdateWebhookDeliveryResultParams) error
+	ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, arg database.GetWebhookDeliveryParams) (database.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, arg database.RedeliverWebhookDeliveryParams) (database.WebhookDelivery, error)
+	CreateWebhookDeliveryAttempt(ctx context.Context, arg database.CreateWebhookDeliveryAttemptParams) error
+	ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]database.WebhookDeliveryAttempt, error)
+}
+
+// Truncater empties whole tables for the dev / test reset
+// IdentityStore holds the accounts users linked at OpenID Connect providers and the sign-ins
+// waiting for a provider's redirect
+type IdentityStore interface {
+	CreateOIDCLoginState(ctx context.Context, arg database.CreateOIDCLoginStateParams) error
+	ConsumeOIDCLoginState(ctx context.Context, stateHash string) (database.OidcLoginState, error)
+	DeleteExpiredOIDCLoginStates(ctx context.Context) error
+	GetUserIdentity(ctx context.Context, arg database.GetUserIdentityParams) (database.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, arg database.CreateUserIdentityParams) (database.UserIdentity, error)
+	TouchUserIdentity(ctx context.Context, arg database.TouchUserIdentityParams) error
+	ListUserIdentities(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error)
+	DeleteUserIdentity(ctx context.Context, arg database.DeleteUserIdentityParams) (int64, error)
+}
+
+// MagicLinkStore holds the login links sent by email and the requests for them
+type MagicLinkStore interface {
+	CountRecentMagicLinkRequests(ctx context.Context, arg database.CountRecentMagicLinkRequestsParams) (database.CountRecentMagicLinkRequestsRow, error)
+	CreateMagicLinkRequest(ctx context.Context, arg database.CreateMagicLinkRequestParams) error
+	DeleteOldMagicLinkRequests(ctx context.Context, windowSeconds int32) error
+	InvalidateMagicLinks(ctx context.Context, userID uuid.UUID) error
+	CreateMagicLink(ctx context.Context, arg database.CreateMagicLinkParams) error
+	ConsumeMagicLink(ctx context.Context, tokenHash string) (database.MagicLink, error)
+	DeleteDeadMagicLinks(ctx context.Context) error
+}
+
+type Truncater interface {
+	// Truncate empties the named tables, which must come from Tables, and every table
+	// that references them (TRUNCATE ... CASCADE)
+	Truncate(ctx context.Context, tables ...string) error
+}
+
+// Tables lists every application table, the reset refuses anything else
+var Tables = []string{
+	"users",
+	"chirps",
+	"drafts",
+	"scheduled_chirps",
+	"polls",
+	"poll_options",
+	"poll_voters",
+	"poll_votes",
+	"refresh_tokens",
+	"api_keys",
+	"oauth_clients",
+	"oauth_authorization_codes",
+	"user_identities",
+	"oidc_login_states",
+	"magic_links",
+	"magic_link_requests",
+	"likes",
+	"bookmarks",
+	"lists",
+	"list_members",
+	"follows",
+	"blocks",
+	"mutes",
+	"reports",
+	"moderation_actions",
+	"moderation_flags",
+	"moderation_rules",
+	"notifications",
+	"notification_actors",
+	"notification_preferences",
+	"outbox",
+	"webhooks",
+	"webhook_deliveries",
+	"webhook_delivery_attempts",
+}
+
+// ErrUnknownTable is returned by Truncate for a name missing from Tables
+var ErrUnknownTable = errors.New("unknown table")
+
+func checkTables(tables []string) error {
+	for _, table := range tables {
+		if !slices.Contains(Tables, table) {
+			return fmt.Errorf("%w %q", ErrUnknownTable, table)
+		}
+	}
+	return nil
+}
+
+// MigrationStatus compares the schema version recorded by goose with the newest migration
+type MigrationStatus struct {
+	CurrentVersion int64 `json:"current_version"`
+	LatestVersion  int64 `json:"latest_version"`
+	Pending        int64 `json:"pending"`
+}
+
+var (
+	_ UserStore           = (*database.Queries)(nil)
+	_ ChirpStore          = (*database.Queries)(nil)
+	_ DraftStore          = (*database.Queries)(nil)
+	_ ScheduledChirpStore = (*database.Queries)(nil)
+	_ PollStore           = (*database.Queries)(nil)
+	_ RefreshTokenStore   = (*database.Queries)(nil)
+	_ APIKeyStore         = (*database.Queries)(nil)
+	_ OAuthStore          = (*database.Queries)(nil)
+	_ IdentityStore       = (*database.Queries)(nil)
+	_ MagicLinkStore      = (*database.Queries)(nil)
+	_ ModerationStore     = (*database.Queries)(nil)
+	_ ReportStore         = (*database.Queries)(nil)
+	_ RelationshipStore   = (*database.Queries)(nil)
+	_ LikeStore           = (*database.Queries)(nil)
+	_ BookmarkStore       = (*database.Queries)(nil)
+	_ ListStore           = (*database.Queries)(nil)
+	_ NotificationStore   = (*database.Queries)(nil)
+	_ OutboxStore         = (*database.Queries)(nil)
+	_ WebhookStore        = (*database.Queries)(nil)
+)
@@ -0,0 +1,161 @@
+package stream
+
+import (
+	"context"
+	"sync"
+)
+
+// How many events may queue up for one subscriber before it is considered too slow
+const subscriberBuffer = 64
+
+// Hub is the in-process pub/sub. Publish never blocks: a subscriber whose buffer is full is
+// dropped, its client reconnects with Last-Event-ID and catches up from the replay buffer.
+type Hub struct {
+	mu     sync.Mutex
+	replay []Event
+	size   int
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub keeps the last replaySize events for resuming clients, 0 disables resuming
+func NewHub(replaySize int) *Hub {
+	return &Hub{
+		size: replaySize,
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription is one connected client
+type Subscription struct {
+	// Replay holds the missed events (or a single reset event) to send before reading Events
+	Replay []Event
+	// Events is closed when the subscriber was dropped for being too slow or the hub was closed
+	Events <-chan Event
+
+	events chan Event
+	filter Filter
+	hub    *Hub
+}
+
+var _ Publisher = (*Hub)(nil)
+
+// Publish delivers e to every matching subscriber, an empty ID is filled in
+func (h *Hub) Publish(ctx context.Context, e Event) error {
+
+	if e.ID == "" {
+		e.ID = newID()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.size > 0 {
+		if len(h.replay) == h.size {
+			h.replay = h.replay[1:]
+		}
+		h.replay = append(h.replay, e)
+	}
+
+	for sub := range h.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+
+		select {
+		case sub.events <- e:
+		default:
+			h.drop(sub)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe registers a subscriber. With a lastEventID the events published after it are replayed,
+// when it is no longer in the buffer the replay is a single reset event instead.
+func (h *Hub) Subscribe(lastEventID string, filter Filter) *Subscription {
+
+	events := make(chan Event, subscriberBuffer)
+	sub := &Subscription{
+		Events: events,
+		events: events,
+		filter: filter,
+		hub:    h,
+	}
+
+	// Under the lock, so nothing is published between the replay and the live events
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub
+	}
+
+	if lastEventID != "" {
+		sub.Replay = h.since(lastEventID, filter)
+	}
+
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription and any later one, for the server shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+// Close unsubscribes, it is safe to call after the subscriber was dropped
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.drop(s)
+}
+
+// Subscribers is the number of connected clients
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
+
+// The matching events after id, callers hold the lock
+func (h *Hub) since(id string, filter Filter) []Event {
+	for i, e := range h.replay {
+		if e.ID != id {
+			continue
+		}
+
+		var missed []Event
+		for _, e := range h.replay[i+1:] {
+			if filter.Match(e) {
+				missed = append(missed, e)
+			}
+		}
+		return missed
+	}
+
+	// Carries the newest ID, so reconnecting after the refetch resumes from here
+	reset := Event{Type: TypeReset, Data: []byte("{}")}
+	if len(h.replay) > 0 {
+		reset.ID = h.replay[len(h.replay)-1].ID
+	}
+	return []Event{reset}
+}
+
+// Callers hold the lock
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func chirpEvent(t *testing.T, author uuid.UUID, body string) Event {
+	t.Helper()
+
+	e, err := NewEvent(TypeChirpCreated, author, Tags(body), map[string]string{"body": body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func ids(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestTags(t *testing.T) {
+	got := Tags("Loving #Go and #golang, #go again #")
+	if want := []string{"go", "golang"}; !slices.Equal(got, want) {
+		t.Errorf("Tags = %v, want %v", got, want)
+	}
+
+	if got := NormalizeTag(" #GoLang "); got != "golang" {
+		t.Errorf("NormalizeTag = %q", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	fromAlice := chirpEvent(t, alice, "hello #go")
+	fromBob := chirpEvent(t, bob, "hello #rust")
+	deleted := Event{Type: TypeChirpDeleted, AuthorID: bob}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []bool // fromAlice, fromBob, deleted
+	}{
+		{"everything", Filter{}, []bool{true, true, true}},
+		{"author", Filter{Authors: map[uuid.UUID]bool{alice: true}}, []bool{true, false, true}},
+		{"tag", Filter{Tag: "rust"}, []bool{false, true, true}},
+		{"hidden", Filter{Hidden: map[uuid.UUID]bool{bob: true}}, []bool{true, false, true}},
+		{"empty timeline", Filter{Authors: map[uuid.UUID]bool{}}, []bool{false, false, true}},
+	}
+
+	for _, tc := range cases {
+		got := []bool{tc.filter.Match(fromAlice), tc.filter.Match(fromBob), tc.filter.Match(deleted)}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHubDeliversMatchingEvents(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+
+	hub := NewHub(10)
+	sub := hub.Subscribe("", Filter{Authors: map[uuid.UUID]bool{alice: true}})
+	defer sub.Close()
+
+	hub.Publish(ctx, chirpEvent(t, bob, "not for you"))
+	want := chirpEvent(t, alice, "for you")
+	hub.Publish(ctx, want)
+
+	if got := <-sub.Events; got.ID != want.ID {
+		t.Errorf("got event %s, want %s", got.ID, want.ID)
+	}
+
+	select {
+	case e := <-sub.Events:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	ctx := context.Background()
+	author := uuid.New()
+
+	hub := NewHub(3)
+	var published []Event
+	for range 5 {
+		e := chirpEvent(t, author, "chirp")
+		published = append(published, e)
+		hub.Publish(ctx, e)
+	}
+
+	// Only the last three are kept
+	sub := hub.Subscribe(published[2].ID, Filter{})
+	defer sub.Close()
+
+	if got, want := ids(sub.Replay), ids(published[3:]); !slices.Equal(got, want) {
+		t.Errorf("replay = %v, want %v", got, want)
+	}
+
+	// Too old to resume from
+	old := hub.Subscribe(published[0].ID, Filter{})
+	defer old.Close()
+
+	if len(old.Replay) != 1 || old.Replay[0].Type != TypeReset || old.Replay[0].ID != published[4].ID {
+		t.Errorf("expected a reset carrying the newest ID, got %+v", old.Replay)
+	}
+
+	// No Last-Event-ID, live events only
+	if fresh := hub.Subscribe("", Filter{}); len(fresh.Replay) != 0 {
+		t.Errorf("unexpected replay %+v", fresh.Replay)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	ctx := context.Background()
+
+	hub := NewHub(0)
+	slow := hub.Subscribe("", Filter{})
+
+	for range subscriberBuffer + 1 {
+		hub.Publish(ctx, chirpEvent(t, uuid.New(), "flood"))
+	}
+
+	if n := hub.Subscribers(); n != 0 {
+		t.Fatalf("expected the slow subscriber to be dropped, %d left", n)
+	}
+
+	// The buffered events are still readable, then the channel is closed
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events, want %d", received, subscriberBuffer)
+	}
+
+	// Closing after being dropped is harmless
+	slow.Close()
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(10)
+	sub := hub.Subscribe("", Filter{})
+
+	hub.Close()
+
+	if _, ok := <-sub.Events; ok {
+		t.Error("expected the subscription to end")
+	}
+
+	if _, ok := <-hub.Subscribe("", Filter{}).Events; ok {
+		t.Error("expected subscriptions after Close to end right away")
+	}
+}
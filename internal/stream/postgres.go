@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the LISTEN/NOTIFY channel the instances share
+const Channel = "chirpy_events"
+
+// Postgres publishes through NOTIFY instead of straight to the hub. Every instance, this one
+// included, receives the event on its LISTEN connection and hands it to its own hub, so all
+// clients see the same events with the same IDs whichever instance they are connected to.
+type Postgres struct {
+	db  *sql.DB
+	hub *Hub
+}
+
+var _ Publisher = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB, hub *Hub) *Postgres {
+	return &Postgres{db: db, hub: hub}
+}
+
+// Publish sends e to every instance. NOTIFY payloads are limited to 8000 bytes, plenty for a chirp.
+func (p *Postgres) Publish(ctx context.Context, e Event) error {
+
+	if e.ID == "" {
+		e.ID = newID()
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", Channel, string(payload)); err != nil {
+		return fmt.Errorf("pg_notify: %w", err)
+	}
+	return nil
+}
+
+// Listen forwards the notifications to the hub until ctx is cancelled. The listener reconnects
+// on its own, events published while it was disconnected are lost.
+func (p *Postgres) Listen(ctx context.Context, dsn string) error {
+
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Stream listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return fmt.Errorf("listen %s: %w", Channel, err)
+	}
+
+	// A ping now and then notices a dead connection that would otherwise look idle
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ping.C:
+			go listener.Ping()
+
+		case n := <-listener.Notify:
+			// nil after a reconnect
+			if n == nil {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Printf("Stream listener: bad payload: %v", err)
+				continue
+			}
+
+			p.hub.Publish(ctx, e)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package stream fans chirp events out to the clients connected to /api/stream. Handlers publish
+// to a Hub, every subscriber gets the events matching its Filter, and the last few events are kept
+// so a client that reconnects with Last-Event-ID doesn't miss anything. Postgres relays the events
+// through LISTEN/NOTIFY so every server instance sees the chirps created on the others.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Event types, the data of each is described in the README
+const (
+	TypeChirpCreated = "chirp_created"
+	TypeChirpDeleted = "chirp_deleted"
+	TypeLikeCount    = "like_count"
+
+	// TypeReset tells a resuming client its Last-Event-ID is too old, it should refetch the chirps
+	TypeReset = "reset"
+)
+
+// Event is one message on the stream. AuthorID and Tags describe the chirp it is about, they are
+// only used for filtering and are never sent to the client.
+type Event struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	AuthorID uuid.UUID       `json:"author_id"`
+	Tags     []string        `json:"tags,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Publisher is what the handlers send events to, either a Hub or a Postgres bridge in front of one
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// NewEvent marshals data and gives the event a fresh ID. IDs are UUIDv7, so they sort by time.
+func NewEvent(typ string, authorID uuid.UUID, tags []string, data any) (Event, error) {
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:       newID(),
+		Type:     typ,
+		AuthorID: authorID,
+		Tags:     tags,
+		Data:     raw,
+	}, nil
+}
+
+func newID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// Filter decides which events a subscriber receives
+type Filter struct {
+	// Authors limits the stream to chirps by these users, nil means any author
+	Authors map[uuid.UUID]bool
+	// Tag limits the stream to chirps with this hashtag (lower case, without the #)
+	Tag string
+	// Hidden are the authors the viewer must not see: users who blocked them or who they muted
+	Hidden map[uuid.UUID]bool
+}
+
+// Match reports whether e passes the filter. Deletions only carry IDs and always pass, a client
+// that never saw the chirp simply ignores them.
+func (f Filter) Match(e Event) bool {
+
+	if e.Type == TypeChirpDeleted || e.Type == TypeReset {
+		return true
+	}
+
+	if f.Hidden[e.AuthorID] {
+		return false
+	}
+
+	if f.Authors != nil && !f.Authors[e.AuthorID] {
+		return false
+	}
+
+	return f.Tag == "" || slices.Contains(e.Tags, f.Tag)
+}
+
+var hashtag = regexp.MustCompile(`#(\w+)`)
+
+// Tags returns the distinct hashtags in body, lower cased and without the #
+func Tags(body string) []string {
+	var tags []string
+	for _, m := range hashtag.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(m[1])
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// NormalizeTag turns a tag from a query string ("#Go", "go") into the form Tags returns
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
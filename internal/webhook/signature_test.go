@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(secret, secretPrefix) {
+		t.Errorf("expected the secret to start with %s, got %q", secretPrefix, secret)
+	}
+
+	body := []byte(`{"type":"chirp.created"}`)
+	sentAt := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	SetHeaders(header, secret, sentAt, body)
+
+	if err := Verify(secret, header, body, DefaultTolerance, sentAt.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	cases := map[string]struct {
+		secret string
+		body   string
+		now    time.Time
+		want   error
+	}{
+		"other secret":    {secret: "whsec_other", body: string(body), now: sentAt, want: ErrInvalidSignature},
+		"tampered body":   {secret: secret, body: `{"type":"chirp.deleted"}`, now: sentAt, want: ErrInvalidSignature},
+		"replayed later":  {secret: secret, body: string(body), now: sentAt.Add(time.Hour), want: ErrStaleTimestamp},
+		"clock far ahead": {secret: secret, body: string(body), now: sentAt.Add(-time.Hour), want: ErrStaleTimestamp},
+	}
+
+	for name, tc := range cases {
+		if err := Verify(tc.secret, header, []byte(tc.body), DefaultTolerance, tc.now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+
+	if err := Verify(secret, http.Header{}, body, DefaultTolerance, sentAt); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("expected ErrMissingSignature without headers, got %v", err)
+	}
+}
+
+func TestSignMatchesTheDocumentedScheme(t *testing.T) {
+
+	// printf '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac whsec_test
+	want := "v1=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5"
+
+	if got := Sign("whsec_test", time.Unix(1700000000, 0), []byte(`{"id":"1"}`)); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,42 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash, scopes, expires_at)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: ListAPIKeys :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: CountActiveAPIKeys :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE user_id = $1
+    AND revoked_at IS NULL
+    AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: GetAPIKeyByHash :one
+-- Along with the owner's role and account state, a key stops working while they are suspended
+-- or their account is scheduled for deletion
+SELECT api_keys.id, api_keys.user_id, api_keys.scopes, api_keys.expires_at, api_keys.revoked_at,
+    users.role, users.suspended_at, users.deletion_scheduled_at
+FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.key_hash = $1;
+
+-- name: TouchAPIKey :exec
+-- At most once a minute, a busy bot shouldn't turn every request into a write
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+    AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: RevokeAPIKey :one
+-- Revoking twice keeps the first timestamp
+UPDATE api_keys
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1 AND user_id = $2
+RETURNING *;
@@ -0,0 +1,33 @@
+-- name: CreateBookmark :exec
+INSERT INTO bookmarks (user_id, chirp_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: DeleteBookmark :exec
+DELETE
+FROM bookmarks
+WHERE user_id = $1 AND chirp_id = $2;
+
+
+-- name: ListBookmarkedChirps :many
+-- The last bookmarked first. Like GetIndividualChirp, chirps whose author blocked the user drop out.
+-- Filtered like GetChirps, a page continues after the bookmark of the before_id chirp.
+SELECT chirps.*
+FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.user_id = sqlc.arg(user_id) AND chirps.hidden_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg(user_id)
+    )
+    AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+    AND (sqlc.narg(before_id)::uuid IS NULL
+        OR (bookmarks.created_at, bookmarks.chirp_id) < (
+            SELECT prev.created_at, prev.chirp_id FROM bookmarks AS prev
+            WHERE prev.user_id = sqlc.arg(user_id) AND prev.chirp_id = sqlc.narg(before_id)
+        ))
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+LIMIT sqlc.arg(page_size);
@@ -1,23 +1,57 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
 RETURNING *;
 
 
 -- name: GetChirps :many
+-- Leaves out chirps from users who blocked or were muted by the viewer, a NULL viewer sees everything.
+-- Newest first, a page continues after the before_id chirp and ends up empty when it was deleted.
 SELECT *
 FROM chirps
-ORDER BY created_at ASC;
+WHERE hidden_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg(viewer_id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = sqlc.narg(viewer_id) AND mutes.muted_id = chirps.user_id
+    )
+    AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+    AND (sqlc.narg(before_id)::uuid IS NULL
+        OR (created_at, id) < (SELECT prev.created_at, prev.id FROM chirps AS prev WHERE prev.id = sqlc.narg(before_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
 
 
 -- name: GetIndividualChirp :one
+-- Muting only filters lists, a blocked viewer can't open the chirp at all
 SELECT *
 FROM chirps
-WHERE id = $1;
+WHERE id = sqlc.arg(id) AND hidden_at IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg(viewer_id)
+    );
 
 -- name: DeleteChirpByID :exec
 DELETE 
 FROM chirps 
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+
+-- name: HideChirp :exec
+UPDATE chirps
+    SET hidden_at = NOW(),
+        updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListChirpsByAuthor :many
+-- Every chirp of the user including hidden ones, for their data export
+SELECT *
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
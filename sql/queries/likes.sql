@@ -0,0 +1,25 @@
+-- name: CreateLike :exec
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: DeleteLike :exec
+DELETE
+FROM likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+
+-- name: ListLikesByUser :many
+SELECT *
+FROM likes
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+
+-- name: CountLikes :one
+SELECT COUNT(*)
+FROM likes
+WHERE chirp_id = $1;
@@ -0,0 +1,87 @@
+-- name: CreateList :one
+INSERT INTO lists (id, created_at, updated_at, owner_id, name, public)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+)
+RETURNING *;
+
+
+-- name: GetList :one
+SELECT *
+FROM lists
+WHERE id = $1;
+
+
+-- name: ListListsByOwner :many
+SELECT *
+FROM lists
+WHERE owner_id = $1
+ORDER BY created_at ASC, id;
+
+
+-- name: UpdateList :one
+UPDATE lists
+    SET name = $2,
+        public = $3,
+        updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: DeleteList :exec
+DELETE
+FROM lists
+WHERE id = $1;
+
+
+-- name: AddListMember :exec
+INSERT INTO list_members (list_id, user_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: RemoveListMember :exec
+DELETE
+FROM list_members
+WHERE list_id = $1 AND user_id = $2;
+
+
+-- name: RemoveListMemberships :exec
+-- Takes user_id off every list owner_id has, when one of them blocks the other
+DELETE
+FROM list_members
+WHERE user_id = sqlc.arg(user_id)
+    AND list_id IN (SELECT id FROM lists WHERE owner_id = sqlc.arg(owner_id));
+
+
+-- name: ListListMembers :many
+SELECT *
+FROM list_members
+WHERE list_id = $1
+ORDER BY created_at ASC, user_id;
+
+
+-- name: GetListChirps :many
+-- The timeline of a list: its members' chirps, filtered and paged the same way as GetChirps
+SELECT *
+FROM chirps
+WHERE hidden_at IS NULL
+    AND EXISTS (
+        SELECT 1 FROM list_members
+        WHERE list_members.list_id = sqlc.arg(list_id) AND list_members.user_id = chirps.user_id
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg(viewer_id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = sqlc.narg(viewer_id) AND mutes.muted_id = chirps.user_id
+    )
+    AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+    AND (sqlc.narg(before_id)::uuid IS NULL
+        OR (created_at, id) < (SELECT prev.created_at, prev.id FROM chirps AS prev WHERE prev.id = sqlc.narg(before_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
@@ -0,0 +1,45 @@
+-- name: CountRecentMagicLinkRequests :one
+-- The requests within the window for the same address and from the same IP, the window is timed
+-- by the database's clock like created_at
+SELECT
+    COUNT(*) FILTER (WHERE lower(email) = lower(sqlc.arg(email))) AS by_email,
+    COUNT(*) FILTER (WHERE ip = sqlc.arg(ip)) AS by_ip
+FROM magic_link_requests
+WHERE created_at > NOW() - sqlc.arg(window_seconds)::int * INTERVAL '1 second';
+
+-- name: CreateMagicLinkRequest :exec
+INSERT INTO magic_link_requests (id, created_at, email, ip)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2
+);
+
+-- name: DeleteOldMagicLinkRequests :exec
+-- Requests older than the window don't count anymore
+DELETE FROM magic_link_requests
+WHERE created_at <= NOW() - sqlc.arg(window_seconds)::int * INTERVAL '1 second';
+
+-- name: InvalidateMagicLinks :exec
+-- Only the newest link works
+UPDATE magic_links
+SET invalidated_at = NOW()
+WHERE user_id = $1 AND invalidated_at IS NULL;
+
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1, $2, NOW(), $3
+);
+
+-- name: ConsumeMagicLink :one
+-- Invalidating the link as it is read makes it single use even when it is replayed concurrently
+UPDATE magic_links
+SET invalidated_at = NOW()
+WHERE token_hash = $1
+    AND invalidated_at IS NULL
+    AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteDeadMagicLinks :exec
+-- Links that can't log in anymore, used, replaced or expired
+DELETE FROM magic_links
+WHERE invalidated_at IS NOT NULL OR expires_at <= NOW();
@@ -0,0 +1,33 @@
+-- name: CreateModerationRule :one
+INSERT INTO moderation_rules (id, created_at, updated_at, kind, pattern, action)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+)
+RETURNING *;
+
+
+-- name: ListModerationRules :many
+SELECT *
+FROM moderation_rules
+ORDER BY created_at ASC;
+
+
+-- name: DeleteModerationRule :execrows
+DELETE
+FROM moderation_rules
+WHERE id = $1;
+
+
+-- name: CreateModerationFlag :one
+INSERT INTO moderation_flags (id, created_at, chirp_id, reason)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2
+)
+RETURNING *;
+
+
+-- name: ListModerationFlags :many
+SELECT moderation_flags.*, chirps.body AS chirp_body, chirps.user_id AS chirp_user_id
+FROM moderation_flags
+JOIN chirps ON chirps.id = moderation_flags.chirp_id
+ORDER BY moderation_flags.created_at ASC;
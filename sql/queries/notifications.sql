@@ -0,0 +1,69 @@
+-- name: UpsertNotification :one
+-- Joins the unread notification of the same group if there is one, otherwise starts a new group
+INSERT INTO notifications (id, user_id, kind, chirp_id, group_key, created_at, updated_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW()
+)
+ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+DO UPDATE SET updated_at = NOW()
+RETURNING *;
+
+
+-- name: AddNotificationActor :exec
+INSERT INTO notification_actors (notification_id, actor_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: ListNotifications :many
+-- Newest activity first, the cursor is the (updated_at, id) of the last row of the previous page.
+-- Groups whose actors have all deleted their account are left out.
+SELECT notifications.*,
+    (SELECT COUNT(*) FROM notification_actors WHERE notification_actors.notification_id = notifications.id) AS actor_count
+FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+    AND EXISTS (SELECT 1 FROM notification_actors WHERE notification_actors.notification_id = notifications.id)
+    AND (sqlc.narg(before_updated_at)::timestamp IS NULL
+        OR (updated_at, id) < (sqlc.narg(before_updated_at)::timestamp, sqlc.narg(before_id)::uuid))
+ORDER BY updated_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+
+-- name: ListNotificationActors :many
+-- The actors behind a page of notifications, most recent first
+SELECT *
+FROM notification_actors
+WHERE notification_id = ANY(sqlc.arg(notification_ids)::uuid[])
+ORDER BY created_at DESC;
+
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*)
+FROM notifications
+WHERE user_id = $1 AND read_at IS NULL
+    AND EXISTS (SELECT 1 FROM notification_actors WHERE notification_actors.notification_id = notifications.id);
+
+
+-- name: MarkNotificationsRead :execrows
+-- NULL ids marks every notification of the user as read
+UPDATE notifications
+    SET read_at = NOW()
+WHERE user_id = sqlc.arg(user_id) AND read_at IS NULL
+    AND (sqlc.narg(ids)::uuid[] IS NULL OR id = ANY(sqlc.narg(ids)::uuid[]));
+
+
+-- name: ListNotificationPreferences :many
+SELECT *
+FROM notification_preferences
+WHERE user_id = $1
+ORDER BY kind, channel;
+
+
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, kind, channel, enabled)
+VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (user_id, kind, channel) DO UPDATE SET enabled = EXCLUDED.enabled;
@@ -0,0 +1,35 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, owner_id, name, secret_hash, redirect_uris)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListOAuthClients :many
+SELECT *
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+VALUES (
+    $1, NOW(), $2, $3, $4, $5, $6, $7
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+-- Deleting the code as it is read makes it single use even when it is replayed concurrently. A
+-- code sent by another client is left alone, it can still be exchanged by the one it was issued to.
+DELETE FROM oauth_authorization_codes
+WHERE code_hash = $1
+    AND client_id = $2
+RETURNING *;
@@ -0,0 +1,52 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox (id, type, payload, created_at, next_attempt_at)
+VALUES (
+    $1, $2, $3, NOW(), NOW()
+);
+
+
+-- name: ClaimOutboxEvents :many
+-- Locks the due events for lease_ms, other instances skip them meanwhile. An instance that dies
+-- before completing them lets the lease run out and the events are claimed again.
+UPDATE outbox
+    SET next_attempt_at = NOW() + (sqlc.arg(lease_ms)::int * INTERVAL '1 millisecond')
+WHERE id IN (
+    SELECT id
+    FROM outbox
+    WHERE dispatched_at IS NULL AND next_attempt_at <= NOW()
+    ORDER BY id
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+
+-- name: CompleteOutboxEvent :exec
+UPDATE outbox
+    SET dispatched_at = NOW(),
+        attempts = attempts + 1,
+        delivered_to = $2,
+        last_error = NULL
+WHERE id = $1;
+
+
+-- name: RetryOutboxEvent :exec
+UPDATE outbox
+    SET attempts = attempts + 1,
+        delivered_to = sqlc.arg(delivered_to),
+        last_error = sqlc.arg(last_error),
+        next_attempt_at = NOW() + (sqlc.arg(retry_in_ms)::int * INTERVAL '1 millisecond')
+WHERE id = sqlc.arg(id);
+
+
+-- name: ListOutboxEvents :many
+SELECT *
+FROM outbox
+ORDER BY id
+LIMIT $1;
+
+
+-- name: DeleteDispatchedOutboxEvents :execrows
+DELETE
+FROM outbox
+WHERE dispatched_at < $1;
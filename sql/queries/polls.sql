@@ -0,0 +1,54 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, created_at, closes_at, multiple_choice)
+VALUES (
+    $1, NOW(), $2, $3
+);
+
+
+-- name: CreatePollOption :exec
+INSERT INTO poll_options (id, chirp_id, position, text)
+VALUES (
+    gen_random_uuid(), $1, $2, $3
+);
+
+
+-- name: GetPolls :many
+-- The polls of a page of chirps, one row per option with its tally. voted tells whether the viewer
+-- picked that option, a NULL viewer never did.
+SELECT
+    polls.chirp_id,
+    polls.closes_at,
+    polls.multiple_choice,
+    poll_options.id AS option_id,
+    poll_options.text,
+    (
+        SELECT COUNT(*) FROM poll_votes
+        WHERE poll_votes.option_id = poll_options.id
+    ) AS votes,
+    (
+        SELECT COUNT(*) FROM poll_voters
+        WHERE poll_voters.chirp_id = polls.chirp_id
+    ) AS voters,
+    EXISTS (
+        SELECT 1 FROM poll_votes
+        WHERE poll_votes.option_id = poll_options.id AND poll_votes.user_id = sqlc.narg(viewer_id)
+    ) AS voted
+FROM polls
+JOIN poll_options ON poll_options.chirp_id = polls.chirp_id
+WHERE polls.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY polls.chirp_id, poll_options.position;
+
+
+-- name: CreatePollVoter :execrows
+-- Fails on the primary key when the user already voted, and inserts nothing once the poll closed
+INSERT INTO poll_voters (chirp_id, user_id, created_at)
+SELECT chirp_id, $2, NOW()
+FROM polls
+WHERE chirp_id = $1 AND closes_at > NOW();
+
+
+-- name: CreatePollVote :exec
+INSERT INTO poll_votes (chirp_id, user_id, option_id)
+VALUES (
+    $1, $2, $3
+);
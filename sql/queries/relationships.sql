@@ -0,0 +1,89 @@
+-- name: CreateBlock :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: DeleteBlock :exec
+DELETE
+FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+
+-- name: ListBlocks :many
+SELECT *
+FROM blocks
+WHERE blocker_id = $1
+ORDER BY created_at ASC;
+
+
+-- name: CreateMute :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: DeleteMute :exec
+DELETE
+FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+
+-- name: ListMutes :many
+SELECT *
+FROM mutes
+WHERE muter_id = $1
+ORDER BY created_at ASC;
+
+
+-- name: CreateFollow :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+
+-- name: DeleteFollow :exec
+DELETE
+FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+
+-- name: IsBlocked :one
+SELECT EXISTS (
+    SELECT 1
+    FROM blocks
+    WHERE blocker_id = $1 AND blocked_id = $2
+);
+
+
+-- name: ListFolloweeIDs :many
+SELECT followee_id
+FROM follows
+WHERE follower_id = $1;
+
+
+-- name: ListBlockerIDs :many
+-- The users who blocked blocked_id, the inverse of ListBlocks
+SELECT blocker_id
+FROM blocks
+WHERE blocked_id = $1;
+
+
+-- name: IsInteractionHidden :one
+-- Whether recipient blocked or muted actor, or actor blocked recipient
+SELECT EXISTS (
+    SELECT 1
+    FROM blocks
+    WHERE (blocker_id = sqlc.arg(recipient_id) AND blocked_id = sqlc.arg(actor_id))
+        OR (blocker_id = sqlc.arg(actor_id) AND blocked_id = sqlc.arg(recipient_id))
+) OR EXISTS (
+    SELECT 1
+    FROM mutes
+    WHERE muter_id = sqlc.arg(recipient_id) AND muted_id = sqlc.arg(actor_id)
+) AS hidden;
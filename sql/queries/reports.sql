@@ -0,0 +1,45 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, reporter_id, target_user_id, chirp_id, reason, details, status)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, 'open'
+)
+RETURNING *;
+
+
+-- name: ListReports :many
+SELECT *
+FROM reports
+WHERE sqlc.arg(status)::text = '' OR status = sqlc.arg(status)::text
+ORDER BY created_at ASC;
+
+
+-- name: GetReport :one
+SELECT *
+FROM reports
+WHERE id = $1;
+
+
+-- name: UpdateReportStatus :one
+-- Only moves a pending report, and only to a status it doesn't have yet. Of two moderators
+-- settling it at once the second one gets no row.
+UPDATE reports
+    SET status = $2,
+        updated_at = NOW()
+WHERE id = $1
+    AND status IN ('open', 'triaged')
+    AND status <> $2
+RETURNING *;
+
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, created_at, actor_id, report_id, action, target_user_id, chirp_id, note)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+
+-- name: ListModerationActions :many
+SELECT *
+FROM moderation_actions
+ORDER BY created_at ASC;
@@ -0,0 +1,43 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (id, created_at, updated_at, user_id, body, reply_to_id, publish_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListScheduledChirps :many
+SELECT *
+FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at, id;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: ClaimDueScheduledChirps :many
+-- Locks the due chirps until the transaction ends, other instances skip them meanwhile. Authors
+-- who are suspended or leaving keep theirs queued.
+SELECT *
+FROM scheduled_chirps
+WHERE failure IS NULL
+    AND publish_at <= NOW()
+    AND EXISTS (
+        SELECT 1 FROM users
+        WHERE users.id = scheduled_chirps.user_id
+            AND users.suspended_at IS NULL
+            AND users.deletion_scheduled_at IS NULL
+    )
+ORDER BY publish_at, id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: DeletePublishedScheduledChirp :exec
+DELETE FROM scheduled_chirps
+WHERE id = $1;
+
+-- name: FailScheduledChirp :exec
+UPDATE scheduled_chirps
+SET failure = $2,
+    updated_at = NOW()
+WHERE id = $1;
@@ -1,9 +1,9 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
-RETURNING id, created_at, updated_at, email;
+RETURNING id, created_at, updated_at, email, role, handle;
 
 -- name: DeleteUsers :exec
 TRUNCATE TABLE users CASCADE;
@@ -14,22 +14,123 @@ FROM users
 WHERE email = $1;
 
 
--- name: UpdateUserPassword :exec
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+
+-- name: UpdateUser :exec
+-- A new email is unverified again
 UPDATE users
-    SET hashed_password = $1,
+    SET email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,
         email = $2,
+        hashed_password = $3,
+        handle = $4,
+        display_name = $5,
+        bio = $6,
+        location = $7,
+        website = $8,
         updated_at = NOW()
-WHERE id = $3;
+WHERE id = $1;
 
 
 -- name: GetUserByIDNoPassword :one
-SELECT id, created_at, updated_at, email
+SELECT id, created_at, updated_at, email, role, handle, display_name, bio, location, website, avatar_key, banner_key, deletion_scheduled_at
 FROM users
 WHERE id = $1;
 
 
--- name: UpdateIsChirpyRedByID :exec
+-- name: UpdateIsChirpyRedByID :execrows
 UPDATE users
-    SET is_chirpy_red = false,
+    SET is_chirpy_red = true,
         updated_at = NOW()
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+
+-- name: SuspendUser :exec
+UPDATE users
+    SET suspended_at = NOW(),
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: UpdateUserRole :execrows
+UPDATE users
+    SET role = $2,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*)
+FROM users
+WHERE role = $1;
+
+
+-- name: GetUserProfileByHandle :one
+-- Public profile, never select the email here
+SELECT
+    id, created_at, handle, display_name, bio, location, website, avatar_key, banner_key,
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = users.id AND chirps.hidden_at IS NULL) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+WHERE lower(handle) = lower($1);
+
+
+-- name: GetUserSummaries :many
+-- Batch lookup of the authors embedded in chirp responses
+SELECT id, handle, display_name, avatar_key
+FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+
+-- name: UpdateUserAvatar :exec
+UPDATE users
+    SET avatar_key = $2,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: UpdateUserBanner :exec
+UPDATE users
+    SET banner_key = $2,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: ScheduleUserDeletion :exec
+UPDATE users
+    SET deletion_scheduled_at = $2,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+    SET deletion_scheduled_at = NULL,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: DeleteDueUsers :many
+-- Returns the image keys so the uploaded files can be removed too
+DELETE
+FROM users
+WHERE deletion_scheduled_at <= $1
+RETURNING id, avatar_key, banner_key;
+
+
+-- name: GetUserIDsByHandles :many
+-- Resolves @mentions, handles must be passed lower cased
+SELECT id, handle
+FROM users
+WHERE lower(handle) = ANY(sqlc.arg(handles)::text[]);
+
+
+-- name: VerifyUserEmail :exec
+UPDATE users
+    SET email_verified_at = COALESCE(email_verified_at, NOW()),
+        updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,124 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, url, description, event_types, secret, active)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, true
+)
+RETURNING *;
+
+
+-- name: ListWebhooks :many
+SELECT *
+FROM webhooks
+ORDER BY created_at ASC;
+
+
+-- name: GetWebhook :one
+SELECT *
+FROM webhooks
+WHERE id = $1;
+
+
+-- name: UpdateWebhook :one
+UPDATE webhooks
+    SET url = $2,
+        description = $3,
+        event_types = $4,
+        active = $5,
+        updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: DeleteWebhook :execrows
+DELETE
+FROM webhooks
+WHERE id = $1;
+
+
+-- name: ListWebhooksForEvent :many
+-- Active webhooks taking this event type that already existed when the event happened
+SELECT *
+FROM webhooks
+WHERE active
+    AND (cardinality(event_types) = 0 OR sqlc.arg(event_type)::text = ANY(event_types))
+    AND created_at <= sqlc.arg(occurred_at)
+ORDER BY created_at ASC;
+
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, 'pending', NOW(), NOW(), NOW()
+)
+ON CONFLICT (webhook_id, event_id) DO NOTHING;
+
+
+-- name: ClaimWebhookDeliveries :many
+-- Same lease as ClaimOutboxEvents. Deliveries of an inactive webhook wait until it is turned back on.
+UPDATE webhook_deliveries
+    SET next_attempt_at = NOW() + (sqlc.arg(lease_ms)::int * INTERVAL '1 millisecond')
+WHERE id IN (
+    SELECT webhook_deliveries.id
+    FROM webhook_deliveries
+    JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+    WHERE webhook_deliveries.status = 'pending'
+        AND webhook_deliveries.next_attempt_at <= NOW()
+        AND webhooks.active
+    ORDER BY webhook_deliveries.next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE OF webhook_deliveries SKIP LOCKED
+)
+RETURNING *;
+
+
+-- name: UpdateWebhookDeliveryResult :exec
+UPDATE webhook_deliveries
+    SET status = $2,
+        attempts = attempts + 1,
+        next_attempt_at = $3,
+        last_status_code = $4,
+        last_error = $5,
+        delivered_at = $6,
+        updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: ListWebhookDeliveries :many
+-- Most recent first, an empty status lists every delivery
+SELECT *
+FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg(webhook_id)
+    AND (sqlc.arg(status)::text = '' OR status = sqlc.arg(status)::text)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+
+-- name: GetWebhookDelivery :one
+SELECT *
+FROM webhook_deliveries
+WHERE id = $1 AND webhook_id = $2;
+
+
+-- name: RedeliverWebhookDelivery :one
+-- Queues the delivery again with a fresh set of attempts, whatever its status
+UPDATE webhook_deliveries
+    SET status = 'pending',
+        attempts = 0,
+        next_attempt_at = NOW(),
+        updated_at = NOW()
+WHERE id = $1 AND webhook_id = $2
+RETURNING *;
+
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (id, delivery_id, attempted_at, duration_ms, status_code, error, response_body)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, $5, $6
+);
+
+
+-- name: ListWebhookDeliveryAttempts :many
+SELECT *
+FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempted_at ASC;
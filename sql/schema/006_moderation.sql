@@ -0,0 +1,23 @@
+-- 006_moderation.sql
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS moderation_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    kind TEXT NOT NULL CHECK (kind IN ('word', 'regex')),
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'flag', 'reject')),
+    UNIQUE (kind, pattern)
+);
+
+CREATE TABLE IF NOT EXISTS moderation_flags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS moderation_flags;
+DROP TABLE IF EXISTS moderation_rules;
@@ -0,0 +1,51 @@
+-- 007_reports.sql
+
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN suspended_at TIMESTAMP;
+
+ALTER TABLE chirps
+    ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- The reported user, for a chirp report that is its author
+    target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'misinformation', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'triaged', 'resolved', 'dismissed'))
+);
+
+-- A user can only have one pending report about the same chirp or user
+CREATE UNIQUE INDEX IF NOT EXISTS reports_pending_unique
+    ON reports (reporter_id, target_user_id, COALESCE(chirp_id, '00000000-0000-0000-0000-000000000000'))
+    WHERE status IN ('open', 'triaged');
+
+CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status, created_at);
+
+-- Audit log of everything moderators did, kept when the report itself goes away
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- NULL once the moderator's account is deleted, their actions stay on record
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    report_id UUID REFERENCES reports(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('triage', 'dismiss', 'hide_chirp', 'suspend_user', 'warn_user')),
+    target_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE chirps
+    DROP COLUMN hidden_at;
+
+ALTER TABLE users
+    DROP COLUMN suspended_at;
@@ -0,0 +1,42 @@
+-- 010_profiles.sql
+
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN handle TEXT,
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN location TEXT NOT NULL DEFAULT '',
+    ADD COLUMN website TEXT NOT NULL DEFAULT '';
+
+-- Existing accounts get a placeholder handle they can change through PUT /api/users
+UPDATE users
+    SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 12)
+WHERE handle IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN handle SET NOT NULL;
+
+-- Handles are unique regardless of case, @Saul and @saul are the same user
+CREATE UNIQUE INDEX IF NOT EXISTS users_handle_lower_key ON users (lower(handle));
+
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_id_idx ON follows (followee_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS follows;
+
+DROP INDEX IF EXISTS users_handle_lower_key;
+
+ALTER TABLE users
+    DROP COLUMN website,
+    DROP COLUMN location,
+    DROP COLUMN bio,
+    DROP COLUMN display_name,
+    DROP COLUMN handle;
@@ -0,0 +1,12 @@
+-- 011_user_images.sql
+
+-- +goose Up
+-- Storage keys of the uploaded images, the variants live under the key (see internal/service/media.go)
+ALTER TABLE users
+    ADD COLUMN avatar_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN banner_key TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN banner_key,
+    DROP COLUMN avatar_key;
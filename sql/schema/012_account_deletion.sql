@@ -0,0 +1,27 @@
+-- 012_account_deletion.sql
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX IF NOT EXISTS likes_chirp_id_idx ON likes (chirp_id);
+
+-- Set by DELETE /api/users/me, the purge job deletes the row once it has passed and
+-- ON DELETE CASCADE takes everything the user owns with it
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS users_deletion_scheduled_at_idx ON users (deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_deletion_scheduled_at_idx;
+
+ALTER TABLE users
+    DROP COLUMN deletion_scheduled_at;
+
+DROP TABLE IF EXISTS likes;
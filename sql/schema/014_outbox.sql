@@ -0,0 +1,25 @@
+-- 014_outbox.sql
+
+-- +goose Up
+-- Domain events, written in the same transaction as the change they describe and delivered
+-- to the subscribers by the dispatcher in internal/events
+CREATE TABLE IF NOT EXISTS outbox (
+    -- UUIDv7, so ordering by id is ordering by creation
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    -- Also pushed forward while an instance holds the event, so the others skip it
+    next_attempt_at TIMESTAMP NOT NULL,
+    -- Subscribers that already handled the event, a retry skips them
+    delivered_to TEXT[] NOT NULL DEFAULT '{}',
+    last_error TEXT,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx
+    ON outbox (next_attempt_at) WHERE dispatched_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS outbox;
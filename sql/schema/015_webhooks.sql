@@ -0,0 +1,64 @@
+-- 015_webhooks.sql
+
+-- +goose Up
+-- Partner endpoints notified of the domain events, see internal/service/webhooks.go
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    -- Event types sent to the endpoint, empty for every type
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    -- Key of the HMAC-SHA256 signatures, the partner verifies the payloads with it
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true
+);
+
+-- One per event and webhook, created when the dispatcher hands the event over
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    -- The body sent on every attempt, a redelivery sends it again
+    payload JSONB NOT NULL,
+    -- pending until an attempt succeeds, dead once the attempts run out
+    status TEXT NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP,
+    -- The outbox delivers at least once, the second copy of an event is dropped here
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+    ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_created_at_idx
+    ON webhook_deliveries (webhook_id, created_at DESC);
+
+-- The delivery log, one row per HTTP request
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id UUID PRIMARY KEY,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempted_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    -- NULL when no response came back, error says why
+    status_code INTEGER,
+    error TEXT,
+    -- The start of the response, to debug the receiving end
+    response_body TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_id_idx
+    ON webhook_delivery_attempts (delivery_id, attempted_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,24 @@
+-- 016_api_keys.sql
+
+-- +goose Up
+-- Personal API keys for bots and scripts, only a hash of the key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- The start of the key, shown in the list so the owner can tell their keys apart
+    prefix TEXT NOT NULL,
+    -- Hex SHA-256 of the key, looked up on every request
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    -- NULL never expires
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_created_at_idx ON api_keys (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
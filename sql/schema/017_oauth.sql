@@ -0,0 +1,41 @@
+-- 017_oauth.sql
+
+-- +goose Up
+-- Third-party apps registered by a user, the id doubles as the OAuth client_id
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- Hex SHA-256 of the client secret, NULL for public clients (mobile and browser apps)
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oauth_clients_owner_id_created_at_idx ON oauth_clients (owner_id, created_at DESC);
+
+-- Codes handed out by the consent step, deleted as they are exchanged so each works once
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    -- S256 PKCE challenge
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Refresh tokens issued to a client rather than a login, deleting the client revokes them
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
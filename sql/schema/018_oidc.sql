@@ -0,0 +1,46 @@
+-- 018_oidc.sql
+
+-- +goose Up
+-- Accounts at external OpenID Connect providers a user signs in with, a user may link several
+-- providers but only one account per provider. Users created by such a sign-in have an empty
+-- hashed_password, which no password matches, until they set one.
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    -- The provider's stable id for the account (the sub claim), emails may change hands
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- As the provider last reported it
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- Sign-ins waiting for the provider's redirect, deleted as the redirect comes back
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    -- Hex SHA-256 of the state parameter
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    -- Set when a logged-in user links the provider to their account instead of signing in
+    link_user_id UUID REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS oidc_login_states_expires_at_idx ON oidc_login_states (expires_at);
+
+-- Set once the user proved they own their email, by signing in with a provider that verified it
+-- or with a magic link, and cleared when the email changes. Only then may a provider sign-in with
+-- the same email join the account, otherwise the user has to link the provider while logged in.
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN email_verified_at;
+
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
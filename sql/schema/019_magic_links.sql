@@ -0,0 +1,30 @@
+-- 019_magic_links.sql
+
+-- +goose Up
+-- Single-use login links sent by email, only a hash of the token is stored
+CREATE TABLE IF NOT EXISTS magic_links (
+    -- Hex SHA-256 of the token in the link
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    -- Set when the link is used or a newer one is sent
+    invalidated_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS magic_links_user_id_created_at_idx ON magic_links (user_id, created_at DESC);
+
+-- Every request for a link, whether the address has an account or not, kept for the length of
+-- the rate limit window. Counted before a request is queued, so nobody can fill the queue.
+CREATE TABLE IF NOT EXISTS magic_link_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS magic_link_requests_created_at_idx ON magic_link_requests (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS magic_link_requests;
+DROP TABLE IF EXISTS magic_links;
@@ -0,0 +1,36 @@
+-- 020_drafts_scheduled_chirps.sql
+
+-- +goose Up
+-- Chirps the author is still writing, only they can see them
+CREATE TABLE IF NOT EXISTS drafts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS drafts_user_id_updated_at_idx ON drafts (user_id, updated_at DESC);
+
+-- Chirps waiting for their publish_at. The scheduler moves them into chirps, so nothing that
+-- reads chirps can show them early.
+CREATE TABLE IF NOT EXISTS scheduled_chirps (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    -- No foreign key: a reply whose chirp is gone by publish_at fails instead of going out as
+    -- a standalone chirp
+    reply_to_id UUID,
+    publish_at TIMESTAMP NOT NULL,
+    -- Why the scheduler couldn't publish it, such chirps stay for the author to see and aren't retried
+    failure TEXT
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_chirps_due_idx ON scheduled_chirps (publish_at) WHERE failure IS NULL;
+CREATE INDEX IF NOT EXISTS scheduled_chirps_user_id_publish_at_idx ON scheduled_chirps (user_id, publish_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS scheduled_chirps;
+DROP TABLE IF EXISTS drafts;
@@ -0,0 +1,45 @@
+-- 021_polls.sql
+
+-- +goose Up
+-- A chirp has at most one poll, which goes away with it
+CREATE TABLE IF NOT EXISTS polls (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    closes_at TIMESTAMP NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES polls(chirp_id) ON DELETE CASCADE,
+    -- Order the options were given in, from 0
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    UNIQUE (chirp_id, position)
+);
+
+-- One row per user who voted, the primary key is what limits everyone to a single vote
+CREATE TABLE IF NOT EXISTS poll_voters (
+    chirp_id UUID NOT NULL REFERENCES polls(chirp_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+-- The options picked by each voter, several for multiple choice polls
+CREATE TABLE IF NOT EXISTS poll_votes (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    option_id UUID NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    PRIMARY KEY (chirp_id, user_id, option_id),
+    FOREIGN KEY (chirp_id, user_id) REFERENCES poll_voters(chirp_id, user_id) ON DELETE CASCADE
+);
+
+-- Tallies count the votes of an option
+CREATE INDEX IF NOT EXISTS poll_votes_option_id_idx ON poll_votes (option_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS poll_voters;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
@@ -0,0 +1,39 @@
+-- 022_bookmarks_lists.sql
+
+-- +goose Up
+-- Chirps saved for later, only the user who saved them can see their bookmarks
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_user_id_created_at_idx ON bookmarks (user_id, created_at DESC);
+
+-- Named sets of users curated by their owner, each with a timeline of its members' chirps
+CREATE TABLE IF NOT EXISTS lists (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- Private lists are only visible to their owner
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id UUID NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, user_id)
+);
+
+-- Members are removed from every list when their account goes
+CREATE INDEX IF NOT EXISTS list_members_user_id_idx ON list_members (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS bookmarks;
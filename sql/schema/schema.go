@@ -0,0 +1,10 @@
+// Package schema embeds the goose migrations, so the binary can migrate the database it
+// runs against without the sql directory being shipped next to it.
+package schema
+
+import "embed"
+
+// FS holds every migration, named "<version>_<name>.sql"
+//
+//go:embed *.sql
+var FS embed.FS